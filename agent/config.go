@@ -3,8 +3,11 @@ package main
 import (
 	"fmt"
 	"runtime"
+	"time"
 
+	"github.com/djavorszky/ddn/common/inet"
 	"github.com/djavorszky/ddn/common/logger"
+	"github.com/djavorszky/ddn/common/storage"
 )
 
 // Config to hold the database server and agent information
@@ -25,6 +28,62 @@ type Config struct {
 	ShortName     string `toml:"agent-shortname"`
 	AgentName     string `toml:"agent-longname"`
 	MasterAddress string `toml:"server-address"`
+	DrainTimeout  string `toml:"drain-timeout"`
+
+	DownloadRetries     int    `toml:"download-retries"`
+	DownloadTimeout     string `toml:"download-timeout"`
+	DownloadIdleTimeout string `toml:"download-idle-timeout"`
+
+	// Credentials of the storages of the s3, sftp and ftp dump locations.
+	storage.Credentials
+}
+
+// defaultDrainTimeout is used if the drain-timeout is missing or invalid.
+const defaultDrainTimeout = 30 * time.Minute
+
+// The defaults of the download settings, used if they are missing or invalid.
+const (
+	defaultDownloadRetries     = 5
+	defaultDownloadTimeout     = time.Minute
+	defaultDownloadIdleTimeout = 5 * time.Minute
+
+	// downloadBackoff is the wait before the first retry of a download.
+	downloadBackoff = 5 * time.Second
+)
+
+// downloader returns the Downloader used to fetch the dumps.
+func (c Config) downloader() inet.Downloader {
+	d := inet.Downloader{
+		Retries:     c.DownloadRetries,
+		Backoff:     downloadBackoff,
+		Timeout:     parseDuration(c.DownloadTimeout, defaultDownloadTimeout),
+		IdleTimeout: parseDuration(c.DownloadIdleTimeout, defaultDownloadIdleTimeout),
+		Storage:     c.Credentials,
+	}
+
+	switch {
+	case d.Retries == 0:
+		d.Retries = defaultDownloadRetries
+	case d.Retries < 0:
+		d.Retries = 0
+	}
+
+	return d
+}
+
+func parseDuration(s string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return def
+	}
+
+	return d
+}
+
+// drainTimeout returns how long the agent waits for the running imports
+// when shutting down.
+func (c Config) drainTimeout() time.Duration {
+	return parseDuration(c.DrainTimeout, defaultDrainTimeout)
 }
 
 // Print prints the Config object to the log.
@@ -54,6 +113,15 @@ func (c Config) Print() {
 	logger.Info("Agent name:\t%s", conf.AgentName)
 
 	logger.Info("Master address:\t%s", conf.MasterAddress)
+	logger.Info("Drain timeout:\t%s", conf.drainTimeout())
+
+	d := conf.downloader()
+	logger.Info("Download retries:\t%d", d.Retries)
+	logger.Info("Download timeouts:\t%s, idle %s", d.Timeout, d.IdleTimeout)
+
+	if conf.S3Endpoint != "" {
+		logger.Info("S3 endpoint:\t%s", conf.S3Endpoint)
+	}
 }
 
 // NewConfig returns a configuration file based on the vendor
@@ -39,6 +39,14 @@ type Database interface {
 	// if it failed for some reason.
 	ImportDatabase(dbRequest model.DBRequest) error
 
+	// RunScript runs the SQL script in the imported database, stopping at the
+	// first statement that fails, and returns its output.
+	RunScript(dbRequest model.DBRequest, script string) (string, error)
+
+	// Query runs the query in the imported database and returns the values of
+	// the first column of the rows it selected.
+	Query(dbRequest model.DBRequest, query string) ([]string, error)
+
 	// ListDatabase returns a list of strings - the names of the databases in the server
 	// All system tables are omitted from the returned list. If there's an error, it is returned.
 	ListDatabase() ([]string, error)
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/djavorszky/ddn/common/inet"
+	"github.com/djavorszky/ddn/common/logger"
+	"github.com/djavorszky/ddn/common/status"
+	"github.com/djavorszky/notif"
+)
+
+var (
+	drainMu   sync.Mutex
+	draining  bool
+	drainOnce sync.Once
+
+	// imports tracks the running imports, so that shutdown can wait for them.
+	imports sync.WaitGroup
+
+	// running maps the IDs of the databases being imported to the IDs of the
+	// requests that started them, so that shutdown can report the ones it
+	// stops.
+	running = make(map[int]string)
+
+	// stopCtx is cancelled when the agent stops without waiting for the
+	// running imports, which kills their commands.
+	stopCtx, stopImports = context.WithCancel(context.Background())
+)
+
+// killGrace is how long the killed imports get to clean up after themselves.
+const killGrace = 10 * time.Second
+
+// acceptImport registers a new import, unless the agent is draining. The
+// caller must call importDone once the import finished.
+func acceptImport(id int, requestID string) bool {
+	drainMu.Lock()
+	defer drainMu.Unlock()
+
+	if draining {
+		return false
+	}
+
+	imports.Add(1)
+	running[id] = requestID
+
+	return true
+}
+
+// importDone marks the import of the database as finished.
+func importDone(id int) {
+	drainMu.Lock()
+	delete(running, id)
+	drainMu.Unlock()
+
+	imports.Done()
+}
+
+// failRunning tells the server that the imports still running failed, as
+// the agent stops without finishing them.
+func failRunning() {
+	drainMu.Lock()
+	defer drainMu.Unlock()
+
+	upd8Path := fmt.Sprintf("%s/%s", conf.MasterAddress, "upd8")
+
+	for id, requestID := range running {
+		msg := notif.Msg{ID: id, StatusID: status.ImportFailed, Message: "agent stopped while importing"}
+
+		if _, err := inet.PostJSON(upd8Path, requestID, msg); err != nil {
+			logger.With(logger.Fields{"request_id": requestID, "database_id": id}).Error("could not send update: %v", err)
+		}
+	}
+}
+
+// stopRunning kills the commands of the running imports, waits for them to
+// drop their databases, then reports the ones still running as failed.
+func stopRunning() {
+	stopImports()
+
+	if !waitImports(killGrace) {
+		logger.Warn("Imports still running %s after stopping them.", killGrace)
+	}
+
+	failRunning()
+}
+
+// waitImports waits up to timeout for the running imports to finish, and
+// returns whether they did.
+func waitImports(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		imports.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func isDraining() bool {
+	drainMu.Lock()
+	defer drainMu.Unlock()
+
+	return draining
+}
+
+// shutdown drains the agent: it stops accepting new databases, lets the
+// server know, waits for the running imports to finish or for the drain
+// timeout to pass, then unregisters the agent and exits. It's safe to call
+// more than once, e.g. by a signal while the drain endpoint was called.
+func shutdown() {
+	drainOnce.Do(func() {
+		drainMu.Lock()
+		draining = true
+		drainMu.Unlock()
+
+		timeout := conf.drainTimeout()
+
+		logger.Info("Draining, waiting up to %s for the running imports to finish.", timeout)
+
+		err := announceDrain()
+		if err != nil {
+			logger.Error("couldn't let the server know about draining: %v", err)
+		}
+
+		if waitImports(timeout) {
+			logger.Info("Running imports finished.")
+		} else {
+			logger.Warn("Imports still running after %s, stopping them.", timeout)
+
+			stopRunning()
+		}
+
+		err = unregisterAgent()
+		if err != nil {
+			logger.Error("unregister: %v", err)
+		}
+	})
+
+	os.Exit(0)
+}
+
+// validToken returns true if token is the one the server gave the agent when
+// it registered. Before that, no token is valid.
+func validToken(token string) bool {
+	a, reg := registration()
+
+	return reg && a.Token != "" && subtle.ConstantTimeCompare([]byte(a.Token), []byte(token)) == 1
+}
+
+// announceDrain marks the agent as draining in the registry of the server.
+func announceDrain() error {
+	a, reg := registration()
+	if !reg {
+		return nil
+	}
+
+	a.Draining = true
+
+	_, err := notif.SndLoc(a, fmt.Sprintf("%s/%s", conf.MasterAddress, "drain"))
+
+	return err
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/djavorszky/ddn/common/model"
+	"github.com/djavorszky/ddn/common/status"
+	"github.com/djavorszky/notif"
+)
+
+func TestAcceptImport(t *testing.T) {
+	defer func() { draining = false }()
+
+	if !acceptImport(1, "") {
+		t.Fatalf("acceptImport() = false before draining")
+	}
+
+	if _, ok := running[1]; !ok {
+		t.Errorf("acceptImport() didn't register the running import")
+	}
+
+	importDone(1)
+
+	if len(running) != 0 {
+		t.Errorf("importDone() left running imports: %v", running)
+	}
+
+	draining = true
+
+	if acceptImport(2, "") {
+		t.Errorf("acceptImport() = true while draining")
+	}
+
+	if !isDraining() {
+		t.Errorf("isDraining() = false while draining")
+	}
+}
+
+func TestFailRunning(t *testing.T) {
+	got := make(chan notif.Msg, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg notif.Msg
+		json.NewDecoder(r.Body).Decode(&msg)
+		got <- msg
+	}))
+	defer server.Close()
+
+	defer func(addr string) { conf.MasterAddress = addr }(conf.MasterAddress)
+	conf.MasterAddress = server.URL
+
+	if !acceptImport(42, "req") {
+		t.Fatalf("acceptImport() = false")
+	}
+	defer importDone(42)
+
+	failRunning()
+
+	msg := <-got
+	if msg.ID != 42 || msg.StatusID != status.ImportFailed {
+		t.Errorf("failRunning() sent %+v, want ImportFailed of database 42", msg)
+	}
+}
+
+func TestStopRunning(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep is not available")
+	}
+
+	defer func(ctx context.Context, cancel context.CancelFunc) { stopCtx, stopImports = ctx, cancel }(stopCtx, stopImports)
+	stopCtx, stopImports = context.WithCancel(context.Background())
+
+	got := make(chan notif.Msg, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg notif.Msg
+		json.NewDecoder(r.Body).Decode(&msg)
+		got <- msg
+	}))
+	defer server.Close()
+
+	defer func(addr string) { conf.MasterAddress = addr }(conf.MasterAddress)
+	conf.MasterAddress = server.URL
+
+	if !acceptImport(43, "req") {
+		t.Fatalf("acceptImport() = false")
+	}
+
+	res := make(chan CommandResult, 1)
+	go func() {
+		defer importDone(43)
+
+		res <- RunImportCommand("sleep", "60")
+	}()
+
+	// Let the command start, so that it has to be killed.
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	stopRunning()
+
+	if elapsed := time.Since(start); elapsed >= killGrace {
+		t.Errorf("stopRunning() took %s, the import wasn't killed", elapsed)
+	}
+
+	if r := <-res; r.exitCode == 0 {
+		t.Errorf("RunImportCommand() exit code = 0, want the killed command to fail")
+	}
+
+	select {
+	case msg := <-got:
+		t.Errorf("stopRunning() sent %+v for an import that returned", msg)
+	default:
+	}
+}
+
+func TestAPIDrain_token(t *testing.T) {
+	defer setRegistration(registration())
+	setRegistration(model.Agent{Token: "secret"}, true)
+
+	for _, token := range []string{"", "wrong"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/drain", nil)
+		req.Header.Set(model.AgentTokenHeader, token)
+
+		rec := httptest.NewRecorder()
+		apiDrain(rec, req)
+
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("apiDrain() with token %q = %d, want %d", token, rec.Code, http.StatusForbidden)
+		}
+	}
+
+	if isDraining() {
+		t.Errorf("apiDrain() started draining with an invalid token")
+	}
+
+	if !validToken("secret") {
+		t.Errorf("validToken() = false for the registered token")
+	}
+
+	// Registering again replaces the token while the handlers check it.
+	done := make(chan struct{})
+	go func() {
+		setRegistration(model.Agent{Token: "secret"}, true)
+		close(done)
+	}()
+	validToken("secret")
+	<-done
+
+	setRegistered(false)
+
+	if validToken("secret") {
+		t.Errorf("validToken() = true while unregistered")
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd && !windows
+// +build !linux,!darwin,!freebsd,!windows
+
+package main
+
+import "fmt"
+
+// freeSpace is not supported on this platform.
+func freeSpace(dir string) (uint64, error) {
+	return 0, fmt.Errorf("checking free space is not supported")
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/djavorszky/ddn/common/inet"
 	"github.com/djavorszky/ddn/common/logger"
 	"github.com/djavorszky/ddn/common/model"
+	"github.com/djavorszky/ddn/common/srv"
 	"github.com/djavorszky/ddn/common/status"
 	"github.com/djavorszky/notif"
 	"github.com/djavorszky/sutils"
@@ -22,6 +23,8 @@ func index(w http.ResponseWriter, r *http.Request) {
 }
 
 func createDatabase(w http.ResponseWriter, r *http.Request) {
+	log := srv.Log(r)
+
 	var (
 		dbreq model.DBRequest
 		msg   inet.Message
@@ -29,19 +32,26 @@ func createDatabase(w http.ResponseWriter, r *http.Request) {
 
 	err := json.NewDecoder(r.Body).Decode(&dbreq)
 	if err != nil {
-		logger.Error("couldn't decode json request: %v", err)
+		log.Error("couldn't decode json request: %v", err)
 
 		inet.SendResponse(w, http.StatusBadRequest, inet.ErrorJSONResponse(err))
 		return
 	}
 
 	if ok := sutils.Present(db.RequiredFields(dbreq, createDB)...); !ok {
-		logger.Error("createDatabase: missing fields: dbreq: %v", dbreq)
+		log.Error("createDatabase: missing fields: dbreq: %v", dbreq)
 
 		inet.SendResponse(w, http.StatusBadRequest, inet.InvalidResponse())
 		return
 	}
 
+	if isDraining() {
+		log.Warn("Refused to create database %q while draining", dbreq.DatabaseName)
+
+		inet.SendResponse(w, http.StatusServiceUnavailable, drainingResponse())
+		return
+	}
+
 	httpStatus := http.StatusOK
 	err = db.CreateDatabase(dbreq)
 	if err != nil {
@@ -49,12 +59,12 @@ func createDatabase(w http.ResponseWriter, r *http.Request) {
 		msg.Status = status.CreateDatabaseFailed
 		msg.Message = fmt.Sprintf("creating database %q failed: %v", dbreq.DatabaseName, err)
 
-		logger.Error(msg.Message)
+		log.Error(msg.Message)
 	} else {
 		msg.Status = status.Success
 		msg.Message = "Successfully created the database and user!"
 
-		logger.Debug("Successfully created database %q", dbreq.DatabaseName)
+		log.Debug("Successfully created database %q", dbreq.DatabaseName)
 	}
 
 	inet.SendResponse(w, httpStatus, msg)
@@ -101,6 +111,8 @@ func echo(w http.ResponseWriter, r *http.Request) {
 
 // dropDatabase will drop the named database with its tablespace and user
 func dropDatabase(w http.ResponseWriter, r *http.Request) {
+	log := srv.Log(r)
+
 	var (
 		dbreq model.DBRequest
 		msg   inet.Message
@@ -108,14 +120,14 @@ func dropDatabase(w http.ResponseWriter, r *http.Request) {
 
 	err := json.NewDecoder(r.Body).Decode(&dbreq)
 	if err != nil {
-		logger.Error("couldn't drop database: %v", err)
+		log.Error("couldn't drop database: %v", err)
 
 		inet.SendResponse(w, http.StatusInternalServerError, inet.ErrorJSONResponse(err))
 		return
 	}
 
 	if ok := sutils.Present(db.RequiredFields(dbreq, dropDB)...); !ok {
-		logger.Error("dropDatabase: missing fields: dbreq: %v", dbreq)
+		log.Error("dropDatabase: missing fields: dbreq: %v", dbreq)
 
 		inet.SendResponse(w, http.StatusBadRequest, inet.InvalidResponse())
 		return
@@ -129,12 +141,55 @@ func dropDatabase(w http.ResponseWriter, r *http.Request) {
 		msg.Status = status.DropDatabaseFailed
 		msg.Message = fmt.Sprintf("dropping database failed: %v", err)
 
-		logger.Error(msg.Message)
+		log.Error(msg.Message)
 	} else {
 		msg.Status = status.Success
 		msg.Message = "Successfully dropped the database and user!"
 
-		logger.Debug(msg.Message)
+		log.Debug(msg.Message)
+	}
+
+	inet.SendResponse(w, httpStatus, msg)
+}
+
+// inspectDatabase reports the Liferay portal the imported database belongs to.
+func inspectDatabase(w http.ResponseWriter, r *http.Request) {
+	log := srv.Log(r)
+
+	var (
+		dbreq model.DBRequest
+		msg   model.LiferayMessage
+	)
+
+	err := json.NewDecoder(r.Body).Decode(&dbreq)
+	if err != nil {
+		log.Error("couldn't decode json request: %v", err)
+
+		inet.SendResponse(w, http.StatusBadRequest, inet.ErrorJSONResponse(err))
+		return
+	}
+
+	if ok := sutils.Present(db.RequiredFields(dbreq, createDB)...); !ok {
+		log.Error("inspectDatabase: missing fields: dbreq: %v", dbreq)
+
+		inet.SendResponse(w, http.StatusBadRequest, inet.InvalidResponse())
+		return
+	}
+
+	httpStatus := http.StatusOK
+
+	msg.Liferay, err = inspectLiferay(dbreq)
+	if err != nil {
+		httpStatus = http.StatusInternalServerError
+		msg.Status = status.ServerError
+		msg.Message = fmt.Sprintf("inspecting database failed: %v", err)
+
+		log.Error("%s", msg.Message)
+	} else {
+		msg.Status = status.Success
+		msg.Message = "Successfully inspected the database!"
+
+		log.Debug("Inspected database %q: %+v", dbreq.DatabaseName, msg.Liferay)
 	}
 
 	inet.SendResponse(w, httpStatus, msg)
@@ -143,6 +198,8 @@ func dropDatabase(w http.ResponseWriter, r *http.Request) {
 // importDatabase will import the specified dumpfile to the database
 // creating the database, tablespace and user
 func importDatabase(w http.ResponseWriter, r *http.Request) {
+	log := srv.Log(r)
+
 	var (
 		dbreq model.DBRequest
 		msg   inet.Message
@@ -150,48 +207,57 @@ func importDatabase(w http.ResponseWriter, r *http.Request) {
 
 	err := json.NewDecoder(r.Body).Decode(&dbreq)
 	if err != nil {
-		logger.Error("couldn't decode json request: %v", err)
+		log.Error("couldn't decode json request: %v", err)
 
 		inet.SendResponse(w, http.StatusBadRequest, inet.ErrorJSONResponse(err))
 		return
 	}
 
 	if ok := sutils.Present(db.RequiredFields(dbreq, importDB)...); !ok {
-		logger.Error("importDatabase: missing fields: dbreq: %v", dbreq)
+		log.Error("importDatabase: missing fields: dbreq: %v", dbreq)
 
 		inet.SendResponse(w, http.StatusBadRequest, inet.InvalidResponse())
 		return
 	}
 
-	if exists := inet.AddrExists(dbreq.DumpLocation); !exists {
+	if exists := dumpExists(dbreq.DumpLocation); !exists {
 		msg.Status = status.NotFound
 		msg.Message = fmt.Sprintf("Specified file doesn't exist or is not reachable at location %q.", dbreq.DumpLocation)
 
-		logger.Error(msg.Message)
+		log.Error(msg.Message)
 
 		inet.SendResponse(w, http.StatusNotFound, msg)
 		return
 	}
 
+	if !acceptImport(dbreq.ID, srv.RequestID(r)) {
+		log.Warn("Refused to import database %q while draining", dbreq.DatabaseName)
+
+		inet.SendResponse(w, http.StatusServiceUnavailable, drainingResponse())
+		return
+	}
+
 	err = db.CreateDatabase(dbreq)
 	if err != nil {
+		importDone(dbreq.ID)
+
 		msg.Status = status.CreateDatabaseFailed
 		msg.Message = fmt.Sprintf("creating database failed: %v", err)
 
-		logger.Error(msg.Message)
+		log.Error(msg.Message)
 
 		inet.SendResponse(w, http.StatusInternalServerError, msg)
 		return
 	}
 
-	logger.Debug("Starting import process for database %q", dbreq.DatabaseName)
+	log.Debug("Starting import process for database %q", dbreq.DatabaseName)
 
 	msg.Status = status.Accepted
 	msg.Message = "Understood request, starting import process."
 
 	inet.SendResponse(w, http.StatusOK, msg)
 
-	go startImport(dbreq)
+	go startImport(dbreq, srv.RequestID(r))
 }
 
 func apiSetLogLevel(w http.ResponseWriter, r *http.Request) {
@@ -249,6 +315,11 @@ func whoami(w http.ResponseWriter, r *http.Request) {
 	// Round to milliseconds.
 	info["agent-uptime"] = fmt.Sprintf("%s", duration-(duration%time.Millisecond))
 
+	info["agent-state"] = "running"
+	if isDraining() {
+		info["agent-state"] = "draining"
+	}
+
 	var msg inet.MapMessage
 
 	msg.Status = status.Success
@@ -271,3 +342,36 @@ func heartbeat(w http.ResponseWriter, r *http.Request) {
 
 	inet.SendResponse(w, http.StatusOK, msg)
 }
+
+// apiDrain starts draining the agent: new databases are refused, and once
+// the running imports finished, the agent unregisters and stops.
+//
+// Only the server may ask for it, proving it with the token it gave the agent
+// when it registered.
+func apiDrain(w http.ResponseWriter, r *http.Request) {
+	if !validToken(r.Header.Get(model.AgentTokenHeader)) {
+		srv.Log(r).Warn("Drain requested by %s with an invalid token", r.RemoteAddr)
+
+		inet.SendResponse(w, http.StatusForbidden, inet.Message{
+			Status:  status.ClientError,
+			Message: "invalid agent token",
+		})
+		return
+	}
+
+	srv.Log(r).Info("Drain requested by %s", r.RemoteAddr)
+
+	inet.SendResponse(w, http.StatusAccepted, inet.Message{
+		Status:  status.Accepted,
+		Message: fmt.Sprintf("Draining, the agent stops once the running imports finished or in %s.", conf.drainTimeout()),
+	})
+
+	go shutdown()
+}
+
+func drainingResponse() inet.Message {
+	return inet.Message{
+		Status:  status.AgentDraining,
+		Message: "The agent is draining and doesn't accept new databases.",
+	}
+}
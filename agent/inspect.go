@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/djavorszky/ddn/common/logger"
+	"github.com/djavorszky/ddn/common/model"
+)
+
+// inspectLiferay reads the build and schema version of the Liferay portal
+// from the Release_ table of the imported database, along with its companies
+// and virtual hosts. It returns an empty Liferay if the database doesn't
+// have the table, and an error only if it has, but it couldn't be read.
+func inspectLiferay(dbreq model.DBRequest) (model.Liferay, error) {
+	var lr model.Liferay
+
+	rows, err := db.Query(dbreq, "SELECT buildNumber FROM Release_ WHERE servletContextName = 'portal'")
+	if err != nil || len(rows) == 0 {
+		logger.Debug("%s is not a Liferay database: %v", dbreq.DatabaseName, err)
+
+		return lr, nil
+	}
+
+	lr.BuildNumber, err = strconv.Atoi(rows[0])
+	if err != nil {
+		return model.Liferay{}, fmt.Errorf("invalid build number %q", rows[0])
+	}
+
+	// Release_ got its schemaVersion column in 7.0.
+	if lr.DXP() {
+		rows, err = db.Query(dbreq, "SELECT schemaVersion FROM Release_ WHERE servletContextName = 'portal'")
+		if err != nil {
+			return model.Liferay{}, fmt.Errorf("reading schema version failed: %v", err)
+		}
+
+		if len(rows) != 0 {
+			lr.SchemaVersion = rows[0]
+		}
+	}
+
+	rows, err = db.Query(dbreq, "SELECT COUNT(*) FROM Company")
+	if err != nil {
+		return model.Liferay{}, fmt.Errorf("counting companies failed: %v", err)
+	}
+
+	if len(rows) != 0 {
+		lr.Companies, _ = strconv.Atoi(rows[0])
+	}
+
+	lr.VirtualHosts, err = db.Query(dbreq, "SELECT hostname FROM VirtualHost ORDER BY hostname")
+	if err != nil {
+		return model.Liferay{}, fmt.Errorf("listing virtual hosts failed: %v", err)
+	}
+
+	return lr, nil
+}
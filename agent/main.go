@@ -9,6 +9,7 @@ import (
 	"os/signal"
 	"os/user"
 	"path/filepath"
+	"sync"
 	"syscall"
 	"time"
 
@@ -21,22 +22,32 @@ import (
 const version = "3"
 
 var (
-	conf       Config
-	db         Database
-	port       string
-	usr        *user.User
-	hostname   string
-	startup    time.Time
+	conf     Config
+	db       Database
+	port     string
+	usr      *user.User
+	hostname string
+	startup  time.Time
+
+	// regMu guards registered and agent, which are replaced when the agent
+	// registers again and read by the handlers. Use registration and
+	// setRegistration to access them.
+	regMu      sync.Mutex
 	registered bool
-
-	agent model.Agent
+	agent      model.Agent
 )
 
 func main() {
 	defer func() {
 		if p := recover(); p != nil {
 			logger.Error("Panic... Unregistering")
-			unregisterAgent()
+
+			err := unregisterAgent()
+			if err != nil {
+				logger.Error("unregister: %v", err)
+			}
+
+			os.Exit(1)
 		}
 	}()
 
@@ -44,8 +55,17 @@ func main() {
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-c
-		unregisterAgent()
-		os.Exit(1)
+
+		go func() {
+			<-c
+			logger.Warn("Received another signal, stopping without waiting for the imports.")
+
+			stopRunning()
+			unregisterAgent()
+			os.Exit(1)
+		}()
+
+		shutdown()
 	}()
 
 	logger.Level = logger.INFO
@@ -53,9 +73,22 @@ func main() {
 	var err error
 	filename := flag.String("p", "ddnc.conf", "Specify the configuration file's name")
 	logname := flag.String("l", "std", "Specify the log's filename. If set to std, logs to the terminal.")
+	logFormat := flag.String("log-format", "text", "Specify the format of the log: text or json.")
+	logMaxSize := flag.Int64("log-max-size", 100, "Rotate the log file once it's bigger than this many megabytes. 0 disables it.")
+	logDaily := flag.Bool("log-daily", true, "Rotate the log file every day.")
+	logBackups := flag.Int("log-backups", 10, "Keep this many rotated log files. 0 keeps all of them.")
+	logCompress := flag.Bool("log-compress", true, "Compress the rotated log files with gzip.")
 
 	flag.Parse()
 
+	switch *logFormat {
+	case "text":
+	case "json":
+		logger.Structured = true
+	default:
+		logger.Fatal("unknown log format %q, expected text or json", *logFormat)
+	}
+
 	loadProperties(*filename)
 
 	if _, err := os.Stat(conf.Exec); os.IsNotExist(err) {
@@ -63,21 +96,24 @@ func main() {
 	}
 
 	if *logname != "std" {
-		if _, err := os.Stat(*logname); err == nil {
-			rotated := fmt.Sprintf("%s.%d", *logname, time.Now().Unix())
-			logger.Debug("Rotating logfile to %s", rotated)
-
-			os.Rename(*logname, rotated)
+		logOut := &logger.File{
+			Name:       *logname,
+			MaxSize:    *logMaxSize * 1024 * 1024,
+			Daily:      *logDaily,
+			MaxBackups: *logBackups,
+			Compress:   *logCompress,
 		}
 
-		logOut, err := os.OpenFile(*logname, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		err := logOut.Open()
 		if err != nil {
 			fmt.Printf("error opening file %s, will continue logging to stderr: %s", *logname, err.Error())
-			logOut = os.Stderr
-		}
-		defer logOut.Close()
+		} else {
+			defer logOut.Close()
+
+			log.SetOutput(logOut)
 
-		log.SetOutput(logOut)
+			go logOut.ReopenOn(syscall.SIGHUP)
+		}
 	}
 
 	usr, err = user.Current()
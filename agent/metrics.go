@@ -0,0 +1,65 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	"github.com/djavorszky/ddn/common/logger"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	runningImports = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ddn_agent_running_imports",
+		Help: "Number of imports in progress.",
+	})
+
+	downloadedBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ddn_agent_downloaded_bytes_total",
+		Help: "Number of bytes of the downloaded dumps.",
+	})
+
+	importDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ddn_agent_import_duration_seconds",
+		Help:    "Time it took to import the dumps into the database, by result.",
+		Buckets: prometheus.ExponentialBuckets(10, 2, 12),
+	}, []string{"result"})
+
+	dbUp = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "ddn_agent_database_up",
+		Help: "Whether the connection to the database server is alive.",
+	}, func() float64 {
+		if db == nil || db.Alive() != nil {
+			return 0
+		}
+
+		return 1
+	})
+
+	dumpsFreeBytes = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "ddn_agent_dumps_free_bytes",
+		Help: "Free space available to the dumps directory.",
+	}, func() float64 {
+		free, err := freeSpace("dumps")
+		if err != nil {
+			logger.Error("Checking free space of dumps failed: %v", err)
+			return math.NaN()
+		}
+
+		return float64(free)
+	})
+)
+
+func init() {
+	prometheus.MustRegister(runningImports, downloadedBytes, importDuration, dbUp, dumpsFreeBytes)
+}
+
+// observeImport records the duration of an import that started at start.
+func observeImport(start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "failed"
+	}
+
+	importDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+}
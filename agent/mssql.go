@@ -81,7 +81,7 @@ func (db *mssql) ImportDatabase(dbRequest model.DBRequest) error {
 		"-v", "targetDatabaseName=" + dbRequest.DatabaseName,
 		"-i", curDir + "\\sql\\mssql\\import_dump.sql"}
 
-	res := RunCommand(conf.Exec, args...)
+	res := RunImportCommand(conf.Exec, args...)
 
 	if res.exitCode != 0 {
 		logger.Error("Dump import seems to have failed:\n> stdout:\n'%s'\n> stderr:\n'%s'\n> exitCode: %d", res.stdout, res.stderr, res.exitCode)
@@ -92,6 +92,46 @@ func (db *mssql) ImportDatabase(dbRequest model.DBRequest) error {
 	return nil
 }
 
+// RunScript runs the SQL script in the database as the configured user, as
+// the databases don't have their own.
+func (db *mssql) RunScript(dbRequest model.DBRequest, script string) (string, error) {
+	args := []string{
+		"-b",
+		"-U", conf.User,
+		"-P", conf.Password,
+		"-d", dbRequest.DatabaseName}
+
+	res := RunCommandWithInput(strings.NewReader(script+"\nGO\n"), conf.Exec, args...)
+
+	if res.exitCode != 0 {
+		logger.Error("Script seems to have failed:\n> stdout:\n'%s'\n> stderr:\n'%s'\n> exitCode: %d", res.stdout, res.stderr, res.exitCode)
+
+		return res.stdout, fmt.Errorf("script failed with exitcode '%d'", res.exitCode)
+	}
+
+	return res.stdout, nil
+}
+
+// Query runs the query in the database as the configured user.
+func (db *mssql) Query(dbRequest model.DBRequest, query string) ([]string, error) {
+	args := []string{
+		"-b", "-h", "-1", "-W",
+		"-U", conf.User,
+		"-P", conf.Password,
+		"-d", dbRequest.DatabaseName,
+		"-Q", "SET NOCOUNT ON; " + query}
+
+	res := RunCommand(conf.Exec, args...)
+
+	if res.exitCode != 0 {
+		logger.Debug("Query seems to have failed:\n> stdout:\n'%s'\n> stderr:\n'%s'\n> exitCode: %d", res.stdout, res.stderr, res.exitCode)
+
+		return nil, fmt.Errorf("query failed with exitcode '%d'", res.exitCode)
+	}
+
+	return rows(res.stdout), nil
+}
+
 func (db *mssql) ListDatabase() ([]string, error) {
 	return nil, fmt.Errorf("operation not supported: ListDatabase")
 }
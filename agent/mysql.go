@@ -257,7 +257,7 @@ func (db *mysql) ImportDatabase(dbreq model.DBRequest) error {
 	// Start the import
 	args := []string{fmt.Sprintf("-u%s", dbreq.Username), fmt.Sprintf("-p%s", dbreq.Password), dbreq.DatabaseName}
 
-	cmd := exec.Command(conf.Exec, args...)
+	cmd := exec.CommandContext(stopCtx, conf.Exec, args...)
 
 	cmd.Stdin = file
 	cmd.Stderr = &errBuf
@@ -271,6 +271,30 @@ func (db *mysql) ImportDatabase(dbreq model.DBRequest) error {
 	return nil
 }
 
+// RunScript runs the SQL script in the database as its user.
+func (db *mysql) RunScript(dbreq model.DBRequest, script string) (string, error) {
+	args := []string{fmt.Sprintf("-u%s", dbreq.Username), fmt.Sprintf("-p%s", dbreq.Password), dbreq.DatabaseName}
+
+	res := RunCommandWithInput(strings.NewReader(script), conf.Exec, args...)
+	if res.exitCode != 0 {
+		return res.stdout, fmt.Errorf("could not execute script: %s", strip(res.stderr))
+	}
+
+	return res.stdout, nil
+}
+
+// Query runs the query in the database as its user.
+func (db *mysql) Query(dbreq model.DBRequest, query string) ([]string, error) {
+	args := []string{fmt.Sprintf("-u%s", dbreq.Username), fmt.Sprintf("-p%s", dbreq.Password), "-N", "-B", "-e", query, dbreq.DatabaseName}
+
+	res := RunCommand(conf.Exec, args...)
+	if res.exitCode != 0 {
+		return nil, fmt.Errorf("could not execute query: %s", strip(res.stderr))
+	}
+
+	return rows(res.stdout), nil
+}
+
 func (db *mysql) Version() (string, error) {
 	var buf bytes.Buffer
 
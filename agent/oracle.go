@@ -72,7 +72,7 @@ func (db *oracle) ImportDatabase(dbRequest model.DBRequest) error {
 	// Start the import
 	args := []string{"-L", "-S", fmt.Sprintf("%s/%s", conf.User, conf.Password), "@./sql/oracle/import_dump.sql", dumpDir, fileName, dbRequest.Username, dbRequest.Password, conf.DatafileDir}
 
-	res := RunCommand(conf.Exec, args...)
+	res := RunImportCommand(conf.Exec, args...)
 
 	if res.exitCode != 0 {
 		return fmt.Errorf("Dump import seems to have failed:\n> stdout:\n'%s'\n> stderr:\n'%s'\n> exitCode: %d", res.stdout, res.stderr, res.exitCode)
@@ -81,6 +81,37 @@ func (db *oracle) ImportDatabase(dbRequest model.DBRequest) error {
 	return nil
 }
 
+// RunScript runs the SQL script in the schema as its user, and commits it
+// unless a statement fails.
+func (db *oracle) RunScript(dbRequest model.DBRequest, script string) (string, error) {
+	args := []string{"-L", "-S", fmt.Sprintf("%s/%s", dbRequest.Username, dbRequest.Password)}
+
+	script = "WHENEVER SQLERROR EXIT FAILURE ROLLBACK\n" + script + "\nCOMMIT;\nEXIT;\n"
+
+	res := RunCommandWithInput(strings.NewReader(script), conf.Exec, args...)
+
+	if res.exitCode != 0 {
+		return res.stdout, fmt.Errorf("Script seems to have failed:\n> stdout:\n'%s'\n> stderr:\n'%s'\n> exitCode: %d", res.stdout, res.stderr, res.exitCode)
+	}
+
+	return res.stdout, nil
+}
+
+// Query runs the query in the schema as its user.
+func (db *oracle) Query(dbRequest model.DBRequest, query string) ([]string, error) {
+	args := []string{"-L", "-S", fmt.Sprintf("%s/%s", dbRequest.Username, dbRequest.Password)}
+
+	script := "SET HEADING OFF\nSET FEEDBACK OFF\nSET PAGESIZE 0\nWHENEVER SQLERROR EXIT FAILURE\n" + query + ";\nEXIT;\n"
+
+	res := RunCommandWithInput(strings.NewReader(script), conf.Exec, args...)
+
+	if res.exitCode != 0 {
+		return nil, fmt.Errorf("Query seems to have failed:\n> stdout:\n'%s'\n> stderr:\n'%s'\n> exitCode: %d", res.stdout, res.stderr, res.exitCode)
+	}
+
+	return rows(res.stdout), nil
+}
+
 func (db *oracle) ListDatabase() ([]string, error) {
 	return nil, nil
 }
@@ -204,7 +204,7 @@ func (db *postgres) DropDatabase(dbRequest model.DBRequest) error {
 func (db *postgres) ImportDatabase(dbreq model.DBRequest) error {
 	userArg := fmt.Sprintf("-U%s", dbreq.Username)
 
-	cmd := exec.Command(conf.Exec, userArg, dbreq.DatabaseName)
+	cmd := exec.CommandContext(stopCtx, conf.Exec, userArg, dbreq.DatabaseName)
 
 	file, err := os.Open(dbreq.DumpLocation)
 	if err != nil {
@@ -227,6 +227,30 @@ func (db *postgres) ImportDatabase(dbreq model.DBRequest) error {
 	return nil
 }
 
+// RunScript runs the SQL script in the database as its user.
+func (db *postgres) RunScript(dbreq model.DBRequest, script string) (string, error) {
+	args := []string{fmt.Sprintf("-U%s", dbreq.Username), "-v", "ON_ERROR_STOP=1", dbreq.DatabaseName}
+
+	res := RunCommandWithInput(strings.NewReader(script), conf.Exec, args...)
+	if res.exitCode != 0 {
+		return res.stdout, fmt.Errorf("could not execute script: %s", res.stderr)
+	}
+
+	return res.stdout, nil
+}
+
+// Query runs the query in the database as its user.
+func (db *postgres) Query(dbreq model.DBRequest, query string) ([]string, error) {
+	args := []string{fmt.Sprintf("-U%s", dbreq.Username), "-t", "-A", "-v", "ON_ERROR_STOP=1", "-c", query, dbreq.DatabaseName}
+
+	res := RunCommand(conf.Exec, args...)
+	if res.exitCode != 0 {
+		return nil, fmt.Errorf("could not execute query: %s", res.stderr)
+	}
+
+	return rows(res.stdout), nil
+}
+
 func (db *postgres) Version() (string, error) {
 	var buf bytes.Buffer
 
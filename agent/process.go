@@ -12,32 +12,56 @@ import (
 	"github.com/djavorszky/ddn/common/logger"
 	"github.com/djavorszky/ddn/common/model"
 	"github.com/djavorszky/ddn/common/status"
+	"github.com/djavorszky/ddn/common/storage"
 	"github.com/djavorszky/notif"
 )
 
-func startImport(dbreq model.DBRequest) {
+// startImport runs the import of the database. The import must have been
+// registered with acceptImport beforehand.
+func startImport(dbreq model.DBRequest, requestID string) {
+	defer importDone(dbreq.ID)
+
+	log := logger.With(logger.Fields{"request_id": requestID, "database_id": dbreq.ID})
+
 	upd8Path := fmt.Sprintf("%s/%s", conf.MasterAddress, "upd8")
 
-	ch := notif.New(dbreq.ID, upd8Path)
-	defer close(ch)
+	// The updates are sent before the import counts as finished, so that
+	// a draining agent reports the final status before stopping.
+	ch, sent := notifier(dbreq.ID, upd8Path, requestID)
+	defer func() {
+		close(ch)
+		<-sent
+	}()
+
+	runningImports.Inc()
+	defer runningImports.Dec()
 
 	ch <- notif.Y{StatusCode: status.DownloadInProgress, Msg: "Downloading dump"}
-	logger.Debug("Downloading dump from %q", dbreq.DumpLocation)
+	log.Debug("Downloading dump from %q", dbreq.DumpLocation)
+
+	dl := conf.downloader()
+	dl.OnRetry = func(attempt int, err error) {
+		log.Warn("Downloading dump failed, retrying (%d/%d): %v", attempt, dl.Retries, err)
+	}
 
-	path, err := inet.DownloadFile("dumps", dbreq.DumpLocation)
+	path, err := dl.Download("dumps", dbreq.DumpLocation, dbreq.SHA256)
 	if err != nil {
 		db.DropDatabase(dbreq)
-		logger.Error("could not download file: %v", err)
+		log.Error("could not download file: %v", err)
 
 		ch <- notif.Y{StatusCode: status.DownloadFailed, Msg: "Downloading file failed: " + err.Error()}
 		return
 	}
 	defer os.Remove(path)
 
+	if info, err := os.Stat(path); err == nil {
+		downloadedBytes.Add(float64(info.Size()))
+	}
+
 	if isArchive(path) {
 		ch <- notif.Y{StatusCode: status.ExtractingArchive, Msg: "Extracting archive"}
 
-		logger.Debug("Extracting archive: %v", path)
+		log.Debug("Extracting archive: %v", path)
 
 		var (
 			files []string
@@ -53,7 +77,7 @@ func startImport(dbreq model.DBRequest) {
 			files, err = untar(path)
 		default:
 			db.DropDatabase(dbreq)
-			logger.Error("import process stopped; encountered unsupported archive")
+			log.Error("import process stopped; encountered unsupported archive")
 
 			ch <- notif.Y{StatusCode: status.ArchiveNotSupported, Msg: "archive not supported"}
 			return
@@ -64,7 +88,7 @@ func startImport(dbreq model.DBRequest) {
 
 		if err != nil {
 			db.DropDatabase(dbreq)
-			logger.Error("could not extract archive: %v", err)
+			log.Error("could not extract archive: %v", err)
 
 			ch <- notif.Y{StatusCode: status.ExtractingArchiveFailed, Msg: "Extracting file failed: " + err.Error()}
 			return
@@ -72,7 +96,7 @@ func startImport(dbreq model.DBRequest) {
 
 		if len(files) > 1 {
 			db.DropDatabase(dbreq)
-			logger.Error("import process stopped; more than one file found in archive")
+			log.Error("import process stopped; more than one file found in archive")
 
 			ch <- notif.Y{StatusCode: status.MultipleFilesInArchive, Msg: "Archive contains more than one file, import stopped"}
 			return
@@ -81,13 +105,13 @@ func startImport(dbreq model.DBRequest) {
 		path = files[0]
 	}
 
-	logger.Debug("Validating dump: %s", path)
+	log.Debug("Validating dump: %s", path)
 
 	ch <- notif.Y{StatusCode: status.ValidatingDump, Msg: "Validating dump"}
 	path, err = db.ValidateDump(path)
 	if err != nil {
 		db.DropDatabase(dbreq)
-		logger.Error("database validation failed: %v", err)
+		log.Error("database validation failed: %v", err)
 
 		ch <- notif.Y{StatusCode: status.ValidationFailed, Msg: "Validating dump failed: " + err.Error()}
 		return
@@ -105,21 +129,149 @@ func startImport(dbreq model.DBRequest) {
 
 	dbreq.DumpLocation = path
 
-	logger.Debug("Importing dump: %v", path)
+	log.Debug("Importing dump: %v", path)
 	ch <- notif.Y{StatusCode: status.ImportInProgress, Msg: "Importing"}
 
 	start := time.Now()
 
 	err = db.ImportDatabase(dbreq)
+	observeImport(start, err)
 	if err != nil {
-		logger.Error("could not import database: %v", err)
+		log.Error("could not import database: %v", err)
+
+		if stopCtx.Err() != nil {
+			// Not every vendor drops the database of a failed import.
+			db.DropDatabase(dbreq)
+
+			ch <- notif.Y{StatusCode: status.ImportFailed, Msg: "agent stopped while importing"}
+			return
+		}
 
 		ch <- notif.Y{StatusCode: status.ImportFailed, Msg: "Importing dump failed: " + err.Error()}
 		return
 	}
 
-	logger.Debug("Import succeded in %v", time.Since(start))
-	ch <- notif.Y{StatusCode: status.Success, Msg: "Completed"}
+	log.Debug("Import succeded in %v", time.Since(start))
+
+	if dbreq.Anonymization != nil {
+		log.Debug("Anonymizing database with rule set %q", dbreq.Anonymization.Name)
+		ch <- notif.Y{StatusCode: status.AnonymizingDatabase, Msg: "Anonymizing"}
+
+		err = anonymizeDatabase(dbreq)
+		if err != nil {
+			// The data can't be handed out without the anonymization.
+			db.DropDatabase(dbreq)
+			log.Error("could not anonymize database: %v", err)
+
+			ch <- notif.Y{StatusCode: status.AnonymizationFailed, Msg: "Anonymizing database failed: " + err.Error()}
+			return
+		}
+	}
+
+	msg := "Completed"
+	if len(dbreq.Scripts) != 0 {
+		log.Debug("Running %d post-import scripts", len(dbreq.Scripts))
+		ch <- notif.Y{StatusCode: status.RunningScripts, Msg: "Running scripts"}
+
+		msg, err = runScripts(dbreq)
+		if err != nil {
+			// The database is kept, so that the failure can be looked into.
+			log.Error("post-import script failed: %v", err)
+
+			ch <- notif.Y{StatusCode: status.PostImportFailed, Msg: msg}
+			return
+		}
+	}
+
+	ch <- notif.Y{StatusCode: status.Success, Msg: msg}
+}
+
+// anonymizeDatabase runs the UPDATE statements of the rule set of the
+// request in the imported database.
+func anonymizeDatabase(dbreq model.DBRequest) error {
+	stmts, err := dbreq.Anonymization.SQL(conf.Vendor)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.RunScript(dbreq, strings.Join(stmts, ";\n")+";\n")
+
+	return err
+}
+
+// maxScriptOutput limits the length of the output of the post-import scripts
+// sent to the server.
+const maxScriptOutput = 64 << 10
+
+// runScripts runs the post-import scripts of the request in order, and
+// returns their output. If one of them fails, the rest are skipped and the
+// last line of the output is the error.
+func runScripts(dbreq model.DBRequest) (string, error) {
+	var out strings.Builder
+
+	for _, script := range dbreq.Scripts {
+		fmt.Fprintf(&out, "-- %s\n", script.Name)
+
+		output, err := db.RunScript(dbreq, script.SQL)
+		if output != "" {
+			out.WriteString(output + "\n")
+		}
+
+		if err != nil {
+			return truncateOutput(out.String()) + fmt.Sprintf("Script %q failed: %s", script.Name, strings.Join(strings.Fields(err.Error()), " ")), err
+		}
+	}
+
+	return strings.TrimSuffix(truncateOutput(out.String()), "\n"), nil
+}
+
+func truncateOutput(output string) string {
+	if len(output) <= maxScriptOutput {
+		return output
+	}
+
+	return output[:maxScriptOutput] + "\n[output truncated]\n"
+}
+
+// dumpExists returns whether the dump at loc can be downloaded.
+func dumpExists(loc string) bool {
+	if !storage.Supported(loc) {
+		return inet.AddrExists(loc)
+	}
+
+	st, path, err := storage.Dial(loc, conf.Credentials, conf.downloader().Timeout)
+	if err != nil {
+		logger.Warn("couldn't connect to %q: %v", loc, err)
+		return false
+	}
+	defer st.Close()
+
+	_, err = st.Size(path)
+
+	return err == nil
+}
+
+// notifier returns a channel whose messages are sent to dest as updates of
+// the database with the given id, along with the ID of the request that
+// started the import. Closing the channel stops it, after which the second
+// channel is closed once the remaining updates were sent.
+func notifier(id int, dest, requestID string) (chan notif.Y, <-chan struct{}) {
+	ch := make(chan notif.Y)
+	sent := make(chan struct{})
+
+	go func() {
+		defer close(sent)
+
+		for y := range ch {
+			msg := notif.Msg{ID: id, StatusID: y.StatusCode, Message: y.Msg}
+
+			if _, err := inet.PostJSON(dest, requestID, msg); err != nil {
+				logger.With(logger.Fields{"request_id": requestID, "database_id": id}).Error("could not send update: %v", err)
+			}
+		}
+	}()
+
+	return ch, sent
 }
 
 // This method should always be called asynchronously
@@ -129,18 +281,20 @@ func keepAlive() {
 	ticker := time.NewTicker(10 * time.Second)
 	for range ticker.C {
 		// Check if the endpoint is up
+		_, reg := registration()
+
 		if !inet.AddrExists(fmt.Sprintf("%s/%s", conf.MasterAddress, "heartbeat")) {
-			if registered {
+			if reg {
 				logger.Error("Lost connection to master server, will attempt to reconnect once it's back.")
 
-				registered = false
+				setRegistered(false)
 			}
 
 			continue
 		}
 
 		// If it is, check if we're not registered
-		if !registered {
+		if !reg {
 			logger.Info("Master server back online.")
 
 			err := registerAgent()
@@ -148,7 +302,7 @@ func keepAlive() {
 				logger.Error("couldn't register with master: %v", err)
 			}
 
-			registered = true
+			setRegistered(true)
 		}
 
 		respCode := inet.GetResponseCode(endpoint)
@@ -1,6 +1,10 @@
 package main
 
-import "net/http"
+import (
+	"net/http"
+
+	"github.com/djavorszky/ddn/common/srv"
+)
 
 type route struct {
 	Name        string
@@ -43,6 +47,12 @@ var routes = Routes{
 		"/import-database",
 		importDatabase,
 	},
+	route{
+		"inspectDatabase",
+		"POST",
+		"/inspect-database",
+		inspectDatabase,
+	},
 	route{
 		"whoami",
 		"GET",
@@ -67,4 +77,16 @@ var routes = Routes{
 		"/api/loglevel/{level:[a-zA-Z]+}",
 		apiSetLogLevel,
 	},
+	route{
+		"api/drain",
+		"POST",
+		"/api/drain",
+		apiDrain,
+	},
+	route{
+		"metrics",
+		"GET",
+		"/metrics",
+		srv.Metrics,
+	},
 }
@@ -2,9 +2,10 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"io"
 	"os/exec"
 	"strings"
 	"syscall"
@@ -20,6 +21,22 @@ const defaultFailedCode = 1
 // RunCommand executes a command with specified arguments and returns its exitcode, stdout
 // and stderr as well.
 func RunCommand(name string, args ...string) CommandResult {
+	return RunCommandWithInput(nil, name, args...)
+}
+
+// RunCommandWithInput executes a command like RunCommand, with stdin as its
+// standard input.
+func RunCommandWithInput(stdin io.Reader, name string, args ...string) CommandResult {
+	return runCommand(context.Background(), stdin, name, args...)
+}
+
+// RunImportCommand executes a command like RunCommand, but kills it once the
+// drain timeout passed.
+func RunImportCommand(name string, args ...string) CommandResult {
+	return runCommand(stopCtx, nil, name, args...)
+}
+
+func runCommand(ctx context.Context, stdin io.Reader, name string, args ...string) CommandResult {
 	var (
 		outbuf, errbuf bytes.Buffer
 		exitCode       int
@@ -27,7 +44,8 @@ func RunCommand(name string, args ...string) CommandResult {
 
 	logger.Debug("Running command: %s %s", name, args)
 
-	cmd := exec.Command(name, args...)
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = stdin
 	cmd.Stdout = &outbuf
 	cmd.Stderr = &errbuf
 
@@ -92,6 +110,7 @@ func registerAgent() error {
 		DBSID:     conf.SID,
 		Port:      conf.AgentPort,
 		Addr:      conf.AgentAddr,
+		Draining:  isDraining(),
 	}
 
 	register := fmt.Sprintf("%s/%s", conf.MasterAddress, "register")
@@ -101,33 +120,79 @@ func registerAgent() error {
 		return fmt.Errorf("register: %v", err)
 	}
 
-	agent = model.Agent{
+	var regResp model.RegisterResponse
+	err = json.NewDecoder(bytes.NewBufferString(resp)).Decode(&regResp)
+	if err != nil {
+		logger.Fatal("response decoding: %v", err)
+	}
+
+	setRegistration(model.Agent{
+		ID:         regResp.ID,
 		ShortName:  conf.ShortName,
 		LongName:   longname,
 		Identifier: conf.AgentName,
 		Version:    version,
+		Token:      regResp.Token,
 		Up:         true,
-	}
-	err = json.NewDecoder(bytes.NewBufferString(resp)).Decode(&agent)
-	if err != nil {
-		logger.Fatal("response decoding: %v", err)
-	}
+		Draining:   ddnc.Draining,
+	}, true)
 
-	registered = true
-
-	logger.Info("Registered with master server. Got assigned ID '%d'", agent.ID)
+	logger.Info("Registered with master server. Got assigned ID '%d'", regResp.ID)
 
 	return nil
 }
 
-func unregisterAgent() {
-	agent.Up = false
+// registration returns the agent as it registered with the server, and
+// whether it's registered.
+func registration() (model.Agent, bool) {
+	regMu.Lock()
+	defer regMu.Unlock()
+
+	return agent, registered
+}
+
+// setRegistration replaces the agent registered with the server.
+func setRegistration(a model.Agent, reg bool) {
+	regMu.Lock()
+	defer regMu.Unlock()
+
+	agent, registered = a, reg
+}
+
+// setRegistered records whether the agent is registered with the server.
+func setRegistered(reg bool) {
+	regMu.Lock()
+	defer regMu.Unlock()
+
+	registered = reg
+}
+
+func unregisterAgent() error {
+	a, _ := registration()
+	a.Up = false
 
 	unregister := fmt.Sprintf("%s/%s", conf.MasterAddress, "unregister")
-	_, err := notif.SndLoc(agent, unregister)
+	_, err := notif.SndLoc(a, unregister)
 	if err != nil {
-		logger.Fatal("unregister: %v", err)
+		return err
+	}
+
+	logger.Info("Successfully unregistered the agent.")
+
+	return nil
+}
+
+// rows splits the unformatted output of a query to its rows, leaving out the
+// empty lines.
+func rows(out string) []string {
+	var rows []string
+
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			rows = append(rows, line)
+		}
 	}
 
-	log.Fatalf("Successfully unregistered the agent.")
+	return rows
 }
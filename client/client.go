@@ -0,0 +1,687 @@
+// Package client is a Go client for the v2 JSON API of the ddn server.
+//
+// All calls take a context that can be used to cancel in-flight requests.
+// Failed calls return an *Error, which can be matched against the exported
+// Err* values with errors.Is.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/djavorszky/ddn/common/anonymize"
+	"github.com/djavorszky/ddn/common/model"
+	"github.com/djavorszky/ddn/common/status"
+	vis "github.com/djavorszky/ddn/common/visibility"
+	"github.com/djavorszky/ddn/server/database/data"
+)
+
+// Client talks to a ddn server. Use New to create one.
+type Client struct {
+	// Address is the base address of the server, e.g. http://localhost:7010
+	Address string
+
+	// Token is sent in the Authorization header of every request.
+	Token string
+
+	// HTTPClient is used to execute the requests. If nil,
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+// AccessInfo holds the information needed to connect to a database.
+type AccessInfo struct {
+	JDBCDriver string `json:"jdbc-driver"`
+	JDBCUrl    string `json:"jdbc-url"`
+	User       string `json:"user"`
+	Password   string `json:"password"`
+	URL        string `json:"url"`
+}
+
+// DefaultChunkSize is the size of the chunks UploadFile sends by default.
+const DefaultChunkSize = 8 << 20
+
+// uploadRetries is how many times UploadFile retries a failed chunk.
+const uploadRetries = 3
+
+// New returns a Client that connects to the server at addr and authenticates with token.
+func New(addr, token string) *Client {
+	return &Client{Address: addr, Token: token}
+}
+
+// ListAgents returns all agents known to the server, including the ones that are down.
+func (c *Client) ListAgents(ctx context.Context) ([]model.Agent, error) {
+	var agents []model.Agent
+
+	err := c.do(ctx, http.MethodGet, "/api/agents", nil, &agents)
+
+	return agents, err
+}
+
+// ListActiveAgents returns the agents that are up and not draining.
+func (c *Client) ListActiveAgents(ctx context.Context) ([]model.Agent, error) {
+	var agents []model.Agent
+
+	err := c.do(ctx, http.MethodGet, "/api/agents/active", nil, &agents)
+
+	return agents, err
+}
+
+// Agent returns the agent registered with the given shortname.
+func (c *Client) Agent(ctx context.Context, name string) (model.Agent, error) {
+	var agent model.Agent
+
+	err := c.do(ctx, http.MethodGet, "/api/agents/"+name, nil, &agent)
+
+	return agent, err
+}
+
+// DrainAgent asks the agent to stop accepting new databases and to shut down
+// once its running imports finished. Only the admins may drain agents.
+func (c *Client) DrainAgent(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodPost, "/api/agents/"+name+"/drain", nil, nil)
+}
+
+// ListDatabases returns the databases of the user as well as the public ones.
+func (c *Client) ListDatabases(ctx context.Context) ([]data.Row, error) {
+	var rows []data.Row
+
+	err := c.do(ctx, http.MethodGet, "/api/databases", nil, &rows)
+
+	return rows, err
+}
+
+// FindDatabases returns the databases the user can see that match query.
+// If query.Limit is set, the page of that size containing query.Offset is
+// returned. VisibleTo and Teams are ignored, the server sets them.
+func (c *Client) FindDatabases(ctx context.Context, query data.DatabaseQuery) ([]data.Row, error) {
+	params := url.Values{}
+
+	for param, value := range map[string]string{
+		"agent":   query.Agent,
+		"vendor":  query.Vendor,
+		"creator": query.Creator,
+		"name":    query.Name,
+		"tag":     query.Tag,
+		"search":  query.Search,
+		"sort":    query.Sort,
+	} {
+		if value != "" {
+			params.Set(param, value)
+		}
+	}
+
+	if query.Status != 0 {
+		params.Set("status", strconv.Itoa(query.Status))
+	}
+
+	if !query.ExpiringBefore.IsZero() {
+		params.Set("expiring-before", query.ExpiringBefore.Format(time.RFC3339))
+	}
+
+	if query.Limit > 0 {
+		params.Set("limit", strconv.Itoa(query.Limit))
+		params.Set("page", strconv.Itoa(query.Offset/query.Limit+1))
+	}
+
+	path := "/api/databases"
+	if len(params) != 0 {
+		path += "?" + params.Encode()
+	}
+
+	var rows []data.Row
+
+	err := c.do(ctx, http.MethodGet, path, nil, &rows)
+
+	return rows, err
+}
+
+// Database returns the database with the given id.
+func (c *Client) Database(ctx context.Context, id int) (data.Row, error) {
+	var row data.Row
+
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/databases/%d", id), nil, &row)
+
+	return row, err
+}
+
+// DatabaseByName returns the database called dbname on the given agent.
+func (c *Client) DatabaseByName(ctx context.Context, agent, dbname string) (data.Row, error) {
+	var row data.Row
+
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/databases/%s/%s", agent, dbname), nil, &row)
+
+	return row, err
+}
+
+// CreateDatabase creates an empty database. Only AgentIdentifier is required,
+// missing credentials are generated by the server.
+func (c *Client) CreateDatabase(ctx context.Context, req model.ClientRequest) (data.Row, error) {
+	var row data.Row
+
+	err := c.do(ctx, http.MethodPost, "/api/databases/create", req, &row)
+
+	return row, err
+}
+
+// ImportDatabase starts importing a dump. AgentIdentifier and DumpLocation are
+// required. The import runs in the background, use WaitForStatus to wait for it
+// to finish.
+func (c *Client) ImportDatabase(ctx context.Context, req model.ClientRequest) (data.Row, error) {
+	var row data.Row
+
+	err := c.do(ctx, http.MethodPost, "/api/databases/import", req, &row)
+
+	return row, err
+}
+
+// CreateUpload starts uploading a dump of size bytes called filename. If sum
+// is not empty, the server checks the SHA-256 checksum of the dump against it.
+func (c *Client) CreateUpload(ctx context.Context, filename string, size int64, sum string) (model.Upload, error) {
+	var upload model.Upload
+
+	err := c.do(ctx, http.MethodPost, "/api/uploads", model.Upload{Filename: filename, Size: size, SHA256: sum}, &upload)
+
+	return upload, err
+}
+
+// Upload returns the upload with the given id, e.g. to find out how many
+// bytes the server received after a chunk failed.
+func (c *Client) Upload(ctx context.Context, id string) (model.Upload, error) {
+	var upload model.Upload
+
+	err := c.do(ctx, http.MethodGet, "/api/uploads/"+id, nil, &upload)
+
+	return upload, err
+}
+
+// UploadChunk sends the part of the dump starting at offset, which has to be
+// the number of bytes received by the server so far.
+func (c *Client) UploadChunk(ctx context.Context, id string, offset int64, chunk []byte) (model.Upload, error) {
+	var upload model.Upload
+
+	header := make(http.Header)
+	header.Set("Content-Type", "application/octet-stream")
+	header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+
+	err := c.send(ctx, http.MethodPatch, "/api/uploads/"+id, bytes.NewReader(chunk), header, &upload)
+
+	return upload, err
+}
+
+// DeleteUpload cancels the upload with the given id.
+func (c *Client) DeleteUpload(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/uploads/"+id, nil, nil)
+}
+
+// UploadFile uploads the dump at path in chunks of chunkSize bytes, or
+// DefaultChunkSize if it's not positive. A failed chunk is retried up to
+// uploadRetries times from wherever the server got to. The returned upload
+// can be imported by setting the UploadID of the request.
+func (c *Client) UploadFile(ctx context.Context, path string, chunkSize int) (model.Upload, error) {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return model.Upload{}, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return model.Upload{}, err
+	}
+
+	upload, err := c.CreateUpload(ctx, filepath.Base(path), fi.Size(), "")
+	if err != nil {
+		return upload, err
+	}
+
+	buf := make([]byte, chunkSize)
+	failures := 0
+
+	for upload.Offset < upload.Size {
+		n, err := f.ReadAt(buf, upload.Offset)
+		if n == 0 {
+			return upload, fmt.Errorf("reading %s failed at %d: %v", path, upload.Offset, err)
+		}
+
+		next, err := c.UploadChunk(ctx, upload.ID, upload.Offset, buf[:n])
+		if err == nil {
+			upload = next
+			failures = 0
+			continue
+		}
+
+		// Only the network errors and the chunks the server disagrees
+		// about are worth retrying.
+		var apiErr *Error
+		if ctx.Err() != nil || failures == uploadRetries || errors.As(err, &apiErr) && !errors.Is(err, ErrUploadOffsetMismatch) {
+			return upload, err
+		}
+		failures++
+
+		status, serr := c.Upload(ctx, upload.ID)
+		if serr != nil {
+			return upload, err
+		}
+		upload = status
+	}
+
+	return upload, nil
+}
+
+// Recreate drops the database with the given id and creates an empty one
+// with the same credentials.
+func (c *Client) Recreate(ctx context.Context, id int) (data.Row, error) {
+	var row data.Row
+
+	err := c.do(ctx, http.MethodPut, fmt.Sprintf("/api/databases/%d/recreate", id), nil, &row)
+
+	return row, err
+}
+
+// Drop drops the database with the given id.
+func (c *Client) Drop(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/databases/%d", id), nil, nil)
+}
+
+// SetVisibility changes the visibility of the database to either
+// vis.Public or vis.Private.
+func (c *Client) SetVisibility(ctx context.Context, id, visibility int) error {
+	var v string
+
+	switch visibility {
+	case vis.Public:
+		v = "public"
+	case vis.Private:
+		v = "private"
+	default:
+		return fmt.Errorf("unknown visibility: %d", visibility)
+	}
+
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/api/databases/%d/visibility/%s", id, v), nil, nil)
+}
+
+// ShareWithTeam sets the visibility of the database to vis.Team, sharing it
+// with the members of the team with the given id.
+func (c *Client) ShareWithTeam(ctx context.Context, id, team int) error {
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/api/databases/%d/visibility/team/%d", id, team), nil, nil)
+}
+
+// TransferOwnership makes email the creator of the database with the given
+// id. The previous creator becomes a co-owner, unless leave is true.
+func (c *Client) TransferOwnership(ctx context.Context, id int, email string, leave bool) (data.Row, error) {
+	var row data.Row
+
+	path := fmt.Sprintf("/api/databases/%d/owner/%s", id, email)
+	if leave {
+		path += "?leave=true"
+	}
+
+	err := c.do(ctx, http.MethodPut, path, nil, &row)
+
+	return row, err
+}
+
+// AddCoOwner gives email the same rights on the database as its creator.
+func (c *Client) AddCoOwner(ctx context.Context, id int, email string) (data.Row, error) {
+	var row data.Row
+
+	err := c.do(ctx, http.MethodPut, fmt.Sprintf("/api/databases/%d/coowners/%s", id, email), nil, &row)
+
+	return row, err
+}
+
+// RemoveCoOwner removes email from the co-owners of the database.
+func (c *Client) RemoveCoOwner(ctx context.Context, id int, email string) (data.Row, error) {
+	var row data.Row
+
+	err := c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/databases/%d/coowners/%s", id, email), nil, &row)
+
+	return row, err
+}
+
+// AddTag tags the database with tag.
+func (c *Client) AddTag(ctx context.Context, id int, tag string) (data.Row, error) {
+	var row data.Row
+
+	err := c.do(ctx, http.MethodPut, fmt.Sprintf("/api/databases/%d/tags/%s", id, url.PathEscape(tag)), nil, &row)
+
+	return row, err
+}
+
+// RemoveTag removes tag from the tags of the database.
+func (c *Client) RemoveTag(ctx context.Context, id int, tag string) (data.Row, error) {
+	var row data.Row
+
+	err := c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/databases/%d/tags/%s", id, url.PathEscape(tag)), nil, &row)
+
+	return row, err
+}
+
+// SetComment replaces the comment of the database.
+func (c *Client) SetComment(ctx context.Context, id int, comment string) (data.Row, error) {
+	var row data.Row
+
+	payload := map[string]string{"comment": comment}
+	err := c.do(ctx, http.MethodPut, fmt.Sprintf("/api/databases/%d/comment", id), payload, &row)
+
+	return row, err
+}
+
+// Extend extends the expiry date of the database by amount of unit, which is
+// one of "days", "months" or "years". Returns the new expiry date.
+func (c *Client) Extend(ctx context.Context, id, amount int, unit string) (time.Time, error) {
+	var expiry time.Time
+
+	err := c.do(ctx, http.MethodPut, fmt.Sprintf("/api/databases/%d/expiry/extend/%d/%s", id, amount, unit), nil, &expiry)
+
+	return expiry, err
+}
+
+// AccessInfo returns the connection details of the database with the given id.
+func (c *Client) AccessInfo(ctx context.Context, id int) (AccessInfo, error) {
+	var info AccessInfo
+
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/databases/%d/accessinfo", id), nil, &info)
+
+	return info, err
+}
+
+// AccessInfoByName returns the connection details of the database called
+// dbname on the given agent.
+func (c *Client) AccessInfoByName(ctx context.Context, agent, dbname string) (AccessInfo, error) {
+	var info AccessInfo
+
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/databases/%s/%s/accessinfo", agent, dbname), nil, &info)
+
+	return info, err
+}
+
+// RuleSets returns the anonymization rule sets imports can be anonymized
+// with, by setting their name as the Anonymize of the request.
+func (c *Client) RuleSets(ctx context.Context) ([]anonymize.RuleSet, error) {
+	var sets []anonymize.RuleSet
+
+	err := c.do(ctx, http.MethodGet, "/api/anonymization-rules", nil, &sets)
+
+	return sets, err
+}
+
+// ScriptSets returns the post-import script sets imports can run, by listing
+// their names in the PostImport of the request.
+func (c *Client) ScriptSets(ctx context.Context) ([]model.ScriptSet, error) {
+	var sets []model.ScriptSet
+
+	err := c.do(ctx, http.MethodGet, "/api/post-import-scripts", nil, &sets)
+
+	return sets, err
+}
+
+// Webhooks returns the webhooks registered by the user.
+func (c *Client) Webhooks(ctx context.Context) ([]data.Webhook, error) {
+	var hooks []data.Webhook
+
+	err := c.do(ctx, http.MethodGet, "/api/webhooks", nil, &hooks)
+
+	return hooks, err
+}
+
+// CreateWebhook registers a webhook. Only URL is required, Events can be left
+// empty to receive all of them. If Secret is empty, the server generates one.
+// Only admins can create Global webhooks.
+func (c *Client) CreateWebhook(ctx context.Context, hook data.Webhook) (data.Webhook, error) {
+	var created data.Webhook
+
+	err := c.do(ctx, http.MethodPost, "/api/webhooks", hook, &created)
+
+	return created, err
+}
+
+// DeleteWebhook removes the webhook with the given id.
+func (c *Client) DeleteWebhook(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/webhooks/%d", id), nil, nil)
+}
+
+// WebhookDeliveries returns the latest delivery attempts of the webhook, newest first.
+func (c *Client) WebhookDeliveries(ctx context.Context, id int) ([]data.WebhookDelivery, error) {
+	var deliveries []data.WebhookDelivery
+
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/webhooks/%d/deliveries", id), nil, &deliveries)
+
+	return deliveries, err
+}
+
+// Users returns the users with a stored role. Only admins have access to it.
+func (c *Client) Users(ctx context.Context) ([]data.User, error) {
+	var users []data.User
+
+	err := c.do(ctx, http.MethodGet, "/api/admin/users", nil, &users)
+
+	return users, err
+}
+
+// SetRole sets the role of the user with the given email to one of
+// data.RoleAdmin, data.RoleMember or data.RoleReadOnly. Only admins can
+// change roles.
+func (c *Client) SetRole(ctx context.Context, email, role string) error {
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/api/admin/users/%s/role/%s", email, role), nil, nil)
+}
+
+// Teams returns the teams of the user, or all of them for admins.
+func (c *Client) Teams(ctx context.Context) ([]data.Team, error) {
+	var teams []data.Team
+
+	err := c.do(ctx, http.MethodGet, "/api/teams", nil, &teams)
+
+	return teams, err
+}
+
+// CreateTeam creates a team with the given members. Only admins can
+// manage teams.
+func (c *Client) CreateTeam(ctx context.Context, team data.Team) (data.Team, error) {
+	var created data.Team
+
+	err := c.do(ctx, http.MethodPost, "/api/teams", team, &created)
+
+	return created, err
+}
+
+// DeleteTeam removes the team with the given id. The databases shared with
+// it become private.
+func (c *Client) DeleteTeam(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/teams/%d", id), nil, nil)
+}
+
+// AddTeamMember adds the user with the given email to the team.
+func (c *Client) AddTeamMember(ctx context.Context, id int, email string) error {
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/api/teams/%d/members/%s", id, email), nil, nil)
+}
+
+// RemoveTeamMember removes the user with the given email from the team.
+func (c *Client) RemoveTeamMember(ctx context.Context, id int, email string) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/teams/%d/members/%s", id, email), nil, nil)
+}
+
+// AuditLog returns the entries of the audit log matching filter, newest
+// first. Only admins have access to it.
+func (c *Client) AuditLog(ctx context.Context, filter data.AuditFilter) ([]data.AuditEntry, error) {
+	query := url.Values{}
+
+	if filter.User != "" {
+		query.Set("user", filter.User)
+	}
+
+	if filter.DatabaseID != 0 {
+		query.Set("database", strconv.Itoa(filter.DatabaseID))
+	}
+
+	if filter.Agent != "" {
+		query.Set("agent", filter.Agent)
+	}
+
+	if !filter.From.IsZero() {
+		query.Set("from", filter.From.Format(time.RFC3339))
+	}
+
+	if !filter.To.IsZero() {
+		query.Set("to", filter.To.Format(time.RFC3339))
+	}
+
+	if filter.Limit != 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+
+	path := "/api/admin/audit"
+	if len(query) != 0 {
+		path += "?" + query.Encode()
+	}
+
+	var entries []data.AuditEntry
+
+	err := c.do(ctx, http.MethodGet, path, nil, &entries)
+
+	return entries, err
+}
+
+// Backup returns a backup of everything the server stores. Only admins
+// have access to it.
+func (c *Client) Backup(ctx context.Context) (data.Backup, error) {
+	var backup data.Backup
+
+	err := c.do(ctx, http.MethodGet, "/api/admin/backup", nil, &backup)
+
+	return backup, err
+}
+
+// Restore replaces everything the server stores with the backup. Only
+// admins can restore backups.
+func (c *Client) Restore(ctx context.Context, backup data.Backup) error {
+	return c.do(ctx, http.MethodPost, "/api/admin/restore", backup, nil)
+}
+
+// WaitForStatus polls the database with the given id every interval until it
+// reaches a final status, which is returned. If progress is not nil, it is
+// called with every fetched row, so callers can display the progress.
+//
+// An error is returned if the database could not be fetched or if ctx is done
+// before the database reached a final status.
+func (c *Client) WaitForStatus(ctx context.Context, id int, interval time.Duration, progress func(data.Row)) (data.Row, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		row, err := c.Database(ctx, id)
+		if err != nil {
+			return row, err
+		}
+
+		if progress != nil {
+			progress(row)
+		}
+
+		if Finished(row) {
+			return row, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return row, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Finished returns true if nothing is happening with the database anymore,
+// e.g. its import either succeeded or failed.
+func Finished(row data.Row) bool {
+	return !row.InProgress() && row.Status != status.Accepted
+}
+
+func (c *Client) do(ctx context.Context, method, path string, payload, result interface{}) error {
+	var body io.Reader
+	header := make(http.Header)
+
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("encoding request failed: %v", err)
+		}
+
+		body = bytes.NewReader(b)
+		header.Set("Content-Type", "application/json")
+	}
+
+	return c.send(ctx, method, path, body, header, result)
+}
+
+// send executes the request with the given body and headers, and decodes
+// the data of the response into result.
+func (c *Client) send(ctx context.Context, method, path string, body io.Reader, header http.Header, result interface{}) error {
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.Address, "/")+path, body)
+	if err != nil {
+		return fmt.Errorf("creating request failed: %v", err)
+	}
+	req = req.WithContext(ctx)
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Authorization", c.Token)
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		return fmt.Errorf("%s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	// Same as inet.Response, but the data is decoded later into result.
+	var apiResp struct {
+		Success bool            `json:"success"`
+		Data    json.RawMessage `json:"data,omitempty"`
+		Error   []string        `json:"error,omitempty"`
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&apiResp)
+	if err != nil {
+		return fmt.Errorf("decoding response failed (http status %d): %v", resp.StatusCode, err)
+	}
+
+	if !apiResp.Success {
+		return newError(resp.StatusCode, apiResp.Error)
+	}
+
+	if result == nil || len(apiResp.Data) == 0 {
+		return nil
+	}
+
+	err = json.Unmarshal(apiResp.Data, result)
+	if err != nil {
+		return fmt.Errorf("decoding response data failed: %v", err)
+	}
+
+	return nil
+}
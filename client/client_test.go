@@ -0,0 +1,106 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/djavorszky/ddn/common/errs"
+	"github.com/djavorszky/ddn/common/inet"
+	"github.com/djavorszky/ddn/common/status"
+	"github.com/djavorszky/ddn/server/database/data"
+)
+
+func TestClient_token(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "test@example.com" {
+			inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+			return
+		}
+
+		inet.SendSuccess(w, http.StatusOK, data.Row{ID: 1, Creator: "test@example.com"})
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"authorized", "test@example.com", nil},
+		{"unauthorized", "", ErrAccessDenied},
+		{"wrongToken", "other@example.com", ErrAccessDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row, err := New(ts.URL, tt.token).Database(context.Background(), 1)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Database() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if err == nil && row.Creator != tt.token {
+				t.Errorf("Database() creator = %q, want %q", row.Creator, tt.token)
+			}
+		})
+	}
+}
+
+func TestClient_errors(t *testing.T) {
+	tests := []struct {
+		name       string
+		errors     []string
+		wantErr    error
+		wantParams int
+	}{
+		{"noResults", []string{errs.QueryNoResults}, ErrQueryNoResults, 0},
+		{"withParams", []string{errs.QueryFailed, "database down"}, ErrQueryFailed, 1},
+		{"agentNotFound", []string{errs.AgentNotFound, "mysql-55"}, ErrAgentNotFound, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				inet.SendFailure(w, http.StatusBadRequest, tt.errors...)
+			}))
+			defer ts.Close()
+
+			err := New(ts.URL, "test").Drop(context.Background(), 1)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Drop() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			var e *Error
+			if !errors.As(err, &e) {
+				t.Errorf("Drop() error is %T, want *Error", err)
+				return
+			}
+
+			if e.StatusCode != http.StatusBadRequest {
+				t.Errorf("Drop() status code = %d, want %d", e.StatusCode, http.StatusBadRequest)
+			}
+
+			if len(e.Params) != tt.wantParams {
+				t.Errorf("Drop() params = %v, want %d params", e.Params, tt.wantParams)
+			}
+		})
+	}
+}
+
+func TestClient_cancel(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inet.SendSuccess(w, http.StatusOK, data.Row{ID: 1, Status: status.ImportInProgress})
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := New(ts.URL, "test").WaitForStatus(ctx, 1, 10*time.Millisecond, nil)
+	if err != context.DeadlineExceeded {
+		t.Errorf("WaitForStatus() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"strings"
+
+	"github.com/djavorszky/ddn/common/errs"
+)
+
+// Error is returned when the server responds with a failure. Code is one of
+// the constants of the errs package, Params hold the rest of the error list
+// sent by the server, if any.
+type Error struct {
+	StatusCode int
+	Code       string
+	Params     []string
+}
+
+// Errors that can be used to check the Code of a returned *Error with errors.Is.
+var (
+	ErrJSONDecodeFailed       = &Error{Code: errs.JSONDecodeFailed}
+	ErrJSONEncodeFailed       = &Error{Code: errs.JSONEncodeFailed}
+	ErrMissingUserCookie      = &Error{Code: errs.MissingUserCookie}
+	ErrMissingParameters      = &Error{Code: errs.MissingParameters}
+	ErrAccessDenied           = &Error{Code: errs.AccessDenied}
+	ErrInvalidURL             = &Error{Code: errs.InvalidURL}
+	ErrUnknownParameter       = &Error{Code: errs.UnknownParameter}
+	ErrAgentNotFound          = &Error{Code: errs.AgentNotFound}
+	ErrNoAgentsAvailable      = &Error{Code: errs.NoAgentsAvailable}
+	ErrAgentDraining          = &Error{Code: errs.AgentDraining}
+	ErrDrainFailed            = &Error{Code: errs.DrainFailed}
+	ErrFailedListingDirectory = &Error{Code: errs.FailedListingDirectory}
+	ErrNoFoldersMounted       = &Error{Code: errs.NoFoldersMounted}
+	ErrFileIOFailed           = &Error{Code: errs.FileIOFailed}
+	ErrInvalidTag             = &Error{Code: errs.InvalidTag}
+	ErrCommentTooLong         = &Error{Code: errs.CommentTooLong}
+	ErrInvalidChecksum        = &Error{Code: errs.InvalidChecksum}
+	ErrUploadNotFound         = &Error{Code: errs.UploadNotFound}
+	ErrUploadTooLarge         = &Error{Code: errs.UploadTooLarge}
+	ErrUploadOffsetMismatch   = &Error{Code: errs.UploadOffsetMismatch}
+	ErrUploadIncomplete       = &Error{Code: errs.UploadIncomplete}
+	ErrTooManyUploads         = &Error{Code: errs.TooManyUploads}
+	ErrRuleSetNotFound        = &Error{Code: errs.RuleSetNotFound}
+	ErrRuleSetInvalid         = &Error{Code: errs.RuleSetInvalid}
+	ErrScriptSetNotFound      = &Error{Code: errs.ScriptSetNotFound}
+
+	ErrPersistFailed  = &Error{Code: errs.PersistFailed}
+	ErrCreateFailed   = &Error{Code: errs.CreateFailed}
+	ErrImportFailed   = &Error{Code: errs.ImportFailed}
+	ErrDeleteFailed   = &Error{Code: errs.DeleteFailed}
+	ErrQueryFailed    = &Error{Code: errs.QueryFailed}
+	ErrUpdateFailed   = &Error{Code: errs.UpdateFailed}
+	ErrQueryNoResults = &Error{Code: errs.QueryNoResults}
+)
+
+func newError(statusCode int, errors []string) *Error {
+	e := &Error{StatusCode: statusCode}
+
+	if len(errors) > 0 {
+		e.Code = errors[0]
+		e.Params = errors[1:]
+	}
+
+	return e
+}
+
+func (e *Error) Error() string {
+	msg := e.Code
+	if msg == "" {
+		msg = "unknown error"
+	}
+
+	if len(e.Params) > 0 {
+		msg += ": " + strings.Join(e.Params, ", ")
+	}
+
+	return msg
+}
+
+// Is reports whether target is an *Error with the same Code, so that
+// errors.Is(err, client.ErrAccessDenied) works regardless of the status
+// code and parameters.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+
+	return t.Code == e.Code
+}
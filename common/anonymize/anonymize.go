@@ -0,0 +1,219 @@
+// Package anonymize removes the personal data from the imported databases.
+//
+// Rule sets are TOML files which list the columns to anonymize and how,
+// optionally limited to the rows matching a condition:
+//
+//	description = "Removes the personal data of the users"
+//
+//	[[rule]]
+//	table = "User_"
+//	column = "emailAddress"
+//	action = "email"
+//	where = "defaultUser = 0"
+//
+// The rules are turned into UPDATE statements for the vendor of the
+// database, which are run after the dump was imported.
+package anonymize
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// The actions of the rules.
+const (
+	// Mask replaces every character of the value with a *.
+	Mask = "mask"
+
+	// Hash replaces the value with its hash in hex: SHA-256, or MD5 on
+	// PostgreSQL. Equal values remain equal.
+	Hash = "hash"
+
+	// Email replaces the value with an address at example.com derived from
+	// its hash, so the addresses remain unique.
+	Email = "email"
+
+	// Null sets the value to NULL.
+	Null = "null"
+)
+
+// ErrNotFound is returned by Load if there is no rule set with the name.
+var ErrNotFound = errors.New("rule set not found")
+
+var (
+	namePattern       = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	identifierPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_$#]*$`)
+)
+
+// Rule anonymizes the column of the table with the action. If Where is
+// set, only the rows matching it are changed.
+type Rule struct {
+	Table  string `toml:"table" json:"table"`
+	Column string `toml:"column" json:"column"`
+	Action string `toml:"action" json:"action"`
+	Where  string `toml:"where" json:"where,omitempty"`
+}
+
+// RuleSet is a named list of rules, stored in the file name.toml.
+type RuleSet struct {
+	Name        string `toml:"-" json:"name"`
+	Description string `toml:"description" json:"description"`
+	Rules       []Rule `toml:"rule" json:"rules"`
+}
+
+// Load reads the rule set called name from dir.
+func Load(dir, name string) (RuleSet, error) {
+	var rs RuleSet
+
+	if !namePattern.MatchString(name) {
+		return rs, ErrNotFound
+	}
+
+	_, err := toml.DecodeFile(filepath.Join(dir, name+".toml"), &rs)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return rs, ErrNotFound
+		}
+
+		return rs, fmt.Errorf("failed reading rule set %q: %v", name, err)
+	}
+	rs.Name = name
+
+	err = rs.Validate()
+	if err != nil {
+		return rs, fmt.Errorf("invalid rule set %q: %v", name, err)
+	}
+
+	return rs, nil
+}
+
+// List returns the rule sets in dir, ordered by their names.
+func List(dir string) ([]RuleSet, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.toml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	sets := make([]RuleSet, 0, len(files))
+	for _, f := range files {
+		rs, err := Load(dir, strings.TrimSuffix(filepath.Base(f), ".toml"))
+		if err != nil {
+			return nil, err
+		}
+
+		sets = append(sets, rs)
+	}
+
+	return sets, nil
+}
+
+// Validate returns an error if the rule set has no rules, or any of them
+// has an unknown action or names an invalid table or column.
+func (rs RuleSet) Validate() error {
+	if len(rs.Rules) == 0 {
+		return fmt.Errorf("no rules")
+	}
+
+	for i, r := range rs.Rules {
+		if !identifierPattern.MatchString(r.Table) {
+			return fmt.Errorf("rule %d: invalid table %q", i+1, r.Table)
+		}
+
+		if !identifierPattern.MatchString(r.Column) {
+			return fmt.Errorf("rule %d: invalid column %q", i+1, r.Column)
+		}
+
+		switch r.Action {
+		case Mask, Hash, Email, Null:
+		default:
+			return fmt.Errorf("rule %d: unknown action %q", i+1, r.Action)
+		}
+	}
+
+	return nil
+}
+
+// SQL returns the UPDATE statements applying the rules to a database of the
+// vendor, without terminating semicolons.
+func (rs RuleSet) SQL(vendor string) ([]string, error) {
+	err := rs.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	stmts := make([]string, 0, len(rs.Rules))
+	for _, r := range rs.Rules {
+		value, err := expression(vendor, r.Action, r.Column)
+		if err != nil {
+			return nil, err
+		}
+
+		var cond []string
+		if r.Action != Null {
+			cond = append(cond, r.Column+" IS NOT NULL")
+		}
+
+		if r.Where != "" {
+			cond = append(cond, "("+r.Where+")")
+		}
+
+		stmt := fmt.Sprintf("UPDATE %s SET %s = %s", r.Table, r.Column, value)
+		if len(cond) != 0 {
+			stmt += " WHERE " + strings.Join(cond, " AND ")
+		}
+
+		stmts = append(stmts, stmt)
+	}
+
+	return stmts, nil
+}
+
+// expression returns the expression the value of the column is replaced
+// with by the action in the dialect of the vendor.
+func expression(vendor, action, column string) (string, error) {
+	if action == Null {
+		return "NULL", nil
+	}
+
+	var mask, hash, email string
+
+	switch strings.ToLower(vendor) {
+	case "mysql", "mariadb":
+		mask = "REPEAT('*', CHAR_LENGTH(%[1]s))"
+		hash = "SHA2(%[1]s, 256)"
+		email = "CONCAT('user', LEFT(SHA2(%[1]s, 256), 12), '@example.com')"
+	case "postgres":
+		mask = "repeat('*', length(%[1]s::text))"
+		hash = "md5(%[1]s::text)"
+		email = "'user' || left(md5(%[1]s::text), 12) || '@example.com'"
+	case "oracle":
+		mask = "RPAD('*', LENGTH(%[1]s), '*')"
+		hash = "LOWER(RAWTOHEX(STANDARD_HASH(%[1]s, 'SHA256')))"
+		email = "'user' || SUBSTR(LOWER(RAWTOHEX(STANDARD_HASH(%[1]s, 'SHA256'))), 1, 12) || '@example.com'"
+	case "mssql":
+		mask = "REPLICATE('*', LEN(%[1]s))"
+		hash = "LOWER(CONVERT(VARCHAR(64), HASHBYTES('SHA2_256', CAST(%[1]s AS NVARCHAR(MAX))), 2))"
+		email = "'user' + LEFT(LOWER(CONVERT(VARCHAR(64), HASHBYTES('SHA2_256', CAST(%[1]s AS NVARCHAR(MAX))), 2)), 12) + '@example.com'"
+	default:
+		return "", fmt.Errorf("vendor not supported: %s", vendor)
+	}
+
+	switch action {
+	case Mask:
+		return fmt.Sprintf(mask, column), nil
+	case Hash:
+		return fmt.Sprintf(hash, column), nil
+	case Email:
+		return fmt.Sprintf(email, column), nil
+	}
+
+	return "", fmt.Errorf("unknown action %q", action)
+}
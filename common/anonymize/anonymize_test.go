@@ -0,0 +1,108 @@
+package anonymize
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRuleSet_SQL(t *testing.T) {
+	rs := RuleSet{Rules: []Rule{
+		{Table: "User_", Column: "emailAddress", Action: Email, Where: "defaultUser = 0"},
+		{Table: "User_", Column: "firstName", Action: Mask},
+		{Table: "Contact_", Column: "birthday", Action: Null},
+	}}
+
+	tests := []struct {
+		vendor string
+		want   []string
+	}{
+		{"mysql", []string{
+			"UPDATE User_ SET emailAddress = CONCAT('user', LEFT(SHA2(emailAddress, 256), 12), '@example.com') WHERE emailAddress IS NOT NULL AND (defaultUser = 0)",
+			"UPDATE User_ SET firstName = REPEAT('*', CHAR_LENGTH(firstName)) WHERE firstName IS NOT NULL",
+			"UPDATE Contact_ SET birthday = NULL",
+		}},
+		{"postgres", []string{
+			"UPDATE User_ SET emailAddress = 'user' || left(md5(emailAddress::text), 12) || '@example.com' WHERE emailAddress IS NOT NULL AND (defaultUser = 0)",
+			"UPDATE User_ SET firstName = repeat('*', length(firstName::text)) WHERE firstName IS NOT NULL",
+			"UPDATE Contact_ SET birthday = NULL",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.vendor, func(t *testing.T) {
+			got, err := rs.SQL(tt.vendor)
+			if err != nil {
+				t.Fatalf("SQL() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SQL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := rs.SQL("db2"); err == nil {
+		t.Errorf("SQL() of unsupported vendor succeeded")
+	}
+}
+
+func TestRuleSet_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr bool
+	}{
+		{"valid", Rule{Table: "User_", Column: "emailAddress", Action: Hash}, false},
+		{"unknownAction", Rule{Table: "User_", Column: "emailAddress", Action: "shuffle"}, true},
+		{"injectedTable", Rule{Table: "User_; DROP TABLE User_", Column: "emailAddress", Action: Null}, true},
+		{"missingColumn", Rule{Table: "User_", Action: Null}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := RuleSet{Rules: []Rule{tt.rule}}.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ddn-anonymize-test")
+	if err != nil {
+		t.Fatalf("TempDir() error = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, "users.toml"), []byte(`
+description = "Users"
+
+[[rule]]
+table = "User_"
+column = "emailAddress"
+action = "email"
+`), 0644)
+
+	rs, err := Load(dir, "users")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	want := RuleSet{Name: "users", Description: "Users", Rules: []Rule{{Table: "User_", Column: "emailAddress", Action: Email}}}
+	if !reflect.DeepEqual(rs, want) {
+		t.Errorf("Load() = %+v, want %+v", rs, want)
+	}
+
+	for _, name := range []string{"missing", "../users"} {
+		if _, err := Load(dir, name); err != ErrNotFound {
+			t.Errorf("Load(%q) error = %v, want ErrNotFound", name, err)
+		}
+	}
+
+	sets, err := List(dir)
+	if err != nil || len(sets) != 1 || sets[0].Name != "users" {
+		t.Errorf("List() = %+v, %v, want the users rule set", sets, err)
+	}
+}
@@ -12,9 +12,22 @@ const (
 	UnknownParameter       = "ERR_UNKNOWN_PARAMETER"
 	AgentNotFound          = "ERR_AGENT_NOT_FOUND"
 	NoAgentsAvailable      = "ERR_NO_AGENTS_AVAILABLE"
+	AgentDraining          = "ERR_AGENT_DRAINING"
+	DrainFailed            = "ERR_DRAIN_FAILED"
 	FailedListingDirectory = "ERR_DIR_LIST_FAILED"
 	NoFoldersMounted       = "ERR_NO_FOLDER_MOUNTED"
 	FileIOFailed           = "ERR_FILE_IO_FAILED"
+	InvalidTag             = "ERR_INVALID_TAG"
+	CommentTooLong         = "ERR_COMMENT_TOO_LONG"
+	InvalidChecksum        = "ERR_INVALID_CHECKSUM"
+	UploadNotFound         = "ERR_UPLOAD_NOT_FOUND"
+	UploadTooLarge         = "ERR_UPLOAD_TOO_LARGE"
+	UploadOffsetMismatch   = "ERR_UPLOAD_OFFSET_MISMATCH"
+	UploadIncomplete       = "ERR_UPLOAD_INCOMPLETE"
+	TooManyUploads         = "ERR_TOO_MANY_UPLOADS"
+	RuleSetNotFound        = "ERR_RULE_SET_NOT_FOUND"
+	RuleSetInvalid         = "ERR_RULE_SET_INVALID"
+	ScriptSetNotFound      = "ERR_SCRIPT_SET_NOT_FOUND"
 
 	// Database related
 	PersistFailed  = "ERR_DATABASE_PERSIST_FAILED"
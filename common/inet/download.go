@@ -0,0 +1,279 @@
+package inet
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/djavorszky/ddn/common/storage"
+)
+
+// Downloader downloads files over HTTP or from the remote storages,
+// retrying with an exponential backoff and resuming when the download
+// fails midway. The zero value tries only once, without timeouts.
+type Downloader struct {
+	// Retries is how many times a failed download is retried.
+	Retries int
+
+	// Backoff is the wait before the first retry, doubled after each one.
+	Backoff time.Duration
+
+	// Timeout limits connecting and waiting for the response headers.
+	Timeout time.Duration
+
+	// IdleTimeout aborts the download if no data is received for this long.
+	IdleTimeout time.Duration
+
+	// OnRetry, if set, is called with the error before each retry.
+	OnRetry func(attempt int, err error)
+
+	// Storage holds the credentials for the s3, sftp and ftp urls.
+	Storage storage.Credentials
+}
+
+// errPermanent marks the failures that retrying doesn't help.
+type errPermanent struct {
+	err error
+}
+
+func (e errPermanent) Error() string {
+	return e.err.Error()
+}
+
+// Download downloads the file from the url into the dest folder and
+// returns its path. If sum is not empty, it's compared to the SHA-256 of
+// the downloaded file in hex, and the file is removed if they differ.
+func (d Downloader) Download(dest, url, sum string) (string, error) {
+	name := url
+	if q := strings.Index(name, "?"); q >= 0 {
+		// Signed urls carry their signature in the query.
+		name = name[:q]
+	}
+	filename := name[strings.LastIndex(name, "/")+1:]
+
+	filepath := fmt.Sprintf("%s/%s", dest, filename)
+
+	out, err := os.Create(filepath)
+	if err != nil {
+		return "", fmt.Errorf("could not create file: %s", err.Error())
+	}
+	defer out.Close()
+
+	client := d.client()
+	h := sha256.New()
+
+	backoff := d.Backoff
+	for attempt := 0; ; attempt++ {
+		err = d.fetch(client, url, out, h)
+		if err == nil {
+			break
+		}
+
+		var perm errPermanent
+		if errors.As(err, &perm) || attempt >= d.Retries {
+			out.Close()
+			os.Remove(filepath)
+
+			return "", fmt.Errorf("downloading file failed: %s", err.Error())
+		}
+
+		if d.OnRetry != nil {
+			d.OnRetry(attempt+1, err)
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	if sum != "" {
+		got := hex.EncodeToString(h.Sum(nil))
+		if !strings.EqualFold(got, sum) {
+			out.Close()
+			os.Remove(filepath)
+
+			return "", fmt.Errorf("checksum mismatch: expected sha256 %s, got %s", sum, got)
+		}
+	}
+
+	return filepath, nil
+}
+
+// fetch downloads the rest of the file into out, which holds the part
+// downloaded by the previous attempts, and h, which has hashed that part.
+func (d Downloader) fetch(client *http.Client, url string, out *os.File, h hash.Hash) error {
+	offset, err := out.Seek(0, io.SeekEnd)
+	if err != nil {
+		return errPermanent{err}
+	}
+
+	if storage.Supported(url) {
+		return d.fetchStore(url, offset, out, h)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return errPermanent{fmt.Errorf("couldn't get url '%s': %s", url, err.Error())}
+	}
+	req = req.WithContext(ctx)
+
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("couldn't get url '%s': %s", url, err.Error())
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0 && rangeStart(resp) == offset:
+		// Resuming where the previous attempt stopped.
+	case resp.StatusCode == http.StatusOK:
+		// No range support, or nothing downloaded yet: start over.
+		if offset > 0 {
+			if err := restart(out, h); err != nil {
+				return errPermanent{err}
+			}
+		}
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable,
+		resp.StatusCode == http.StatusPartialContent:
+		// The file changed or the range was misunderstood; the next
+		// attempt downloads the whole file.
+		if err := restart(out, h); err != nil {
+			return errPermanent{err}
+		}
+
+		return fmt.Errorf("unexpected range response: %s", resp.Status)
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("couldn't get url '%s': %s", url, resp.Status)
+	default:
+		return errPermanent{fmt.Errorf("couldn't get url '%s': %s", url, resp.Status)}
+	}
+
+	return d.receive(io.MultiWriter(out, h), resp.Body, cancel)
+}
+
+// fetchStore is fetch for the files of the remote storages, which resume
+// by opening the file at offset.
+func (d Downloader) fetchStore(url string, offset int64, out *os.File, h hash.Hash) error {
+	st, path, err := storage.Dial(url, d.Storage, d.Timeout)
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidLocation) {
+			return errPermanent{err}
+		}
+
+		return fmt.Errorf("couldn't connect to '%s': %s", url, err.Error())
+	}
+	defer st.Close()
+
+	body, err := st.Open(path, offset)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotExist) {
+			return errPermanent{fmt.Errorf("couldn't get url '%s': %s", url, err.Error())}
+		}
+
+		return fmt.Errorf("couldn't get url '%s': %s", url, err.Error())
+	}
+	defer body.Close()
+
+	return d.receive(io.MultiWriter(out, h), body, func() { st.Close() })
+}
+
+// receive copies body to w. If no data is received for the idle timeout,
+// it calls abort, which should make the pending read fail.
+func (d Downloader) receive(w io.Writer, body io.Reader, abort func()) error {
+	if d.IdleTimeout <= 0 {
+		_, err := io.Copy(w, body)
+		return err
+	}
+
+	var idle int32
+	timer := time.AfterFunc(d.IdleTimeout, func() {
+		atomic.StoreInt32(&idle, 1)
+		abort()
+	})
+	defer timer.Stop()
+
+	_, err := io.Copy(w, &idleReader{r: body, timer: timer, timeout: d.IdleTimeout})
+	if err != nil && atomic.LoadInt32(&idle) == 1 {
+		return fmt.Errorf("no data received for %s", d.IdleTimeout)
+	}
+
+	return err
+}
+
+func (d Downloader) client() *http.Client {
+	if d.Timeout <= 0 {
+		return http.DefaultClient
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: d.Timeout, KeepAlive: 30 * time.Second}).DialContext,
+			TLSHandshakeTimeout:   d.Timeout,
+			ResponseHeaderTimeout: d.Timeout,
+		},
+	}
+}
+
+// rangeStart returns the first byte of the Content-Range of resp, or -1.
+func rangeStart(resp *http.Response) int64 {
+	cr := resp.Header.Get("Content-Range")
+	if !strings.HasPrefix(cr, "bytes ") {
+		return -1
+	}
+
+	cr = strings.TrimPrefix(cr, "bytes ")
+	if i := strings.Index(cr, "-"); i > 0 {
+		start, err := strconv.ParseInt(cr[:i], 10, 64)
+		if err == nil {
+			return start
+		}
+	}
+
+	return -1
+}
+
+// restart empties the file and the hash to download from the beginning.
+func restart(out *os.File, h hash.Hash) error {
+	h.Reset()
+
+	if err := out.Truncate(0); err != nil {
+		return err
+	}
+
+	_, err := out.Seek(0, io.SeekStart)
+
+	return err
+}
+
+// idleReader resets the timer after each read, so that it only fires if
+// the reads stall.
+type idleReader struct {
+	r       io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.timer.Reset(r.timeout)
+
+	return n, err
+}
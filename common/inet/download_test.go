@@ -0,0 +1,140 @@
+package inet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDownloader_resume(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	sum := sha256.Sum256(content)
+
+	var requests, ranged int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			// Break the connection halfway through the first attempt.
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write(content[:len(content)/2])
+			w.(http.Flusher).Flush()
+
+			panic(http.ErrAbortHandler)
+		}
+
+		if r.Header.Get("Range") != "" {
+			atomic.AddInt32(&ranged, 1)
+		}
+
+		http.ServeContent(w, r, "dump.sql", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	d := Downloader{Retries: 2, Backoff: time.Millisecond}
+
+	path, err := d.Download(dir, srv.URL+"/dump.sql?expires=1&signature=abc", hex.EncodeToString(sum[:]))
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	if filepath.Base(path) != "dump.sql" {
+		t.Errorf("Download() saved the file as %q, want dump.sql", filepath.Base(path))
+	}
+
+	got, _ := ioutil.ReadFile(path)
+	if !bytes.Equal(got, content) {
+		t.Errorf("downloaded %d bytes, want the %d bytes of the file", len(got), len(content))
+	}
+
+	if ranged != 1 {
+		t.Errorf("%d range requests, want 1", ranged)
+	}
+}
+
+func TestDownloader_checksum(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not what was expected"))
+	}))
+	defer srv.Close()
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	_, err := Downloader{}.Download(dir, srv.URL+"/dump.sql", hex.EncodeToString(make([]byte, 32)))
+	if err == nil {
+		t.Fatalf("Download() with wrong checksum succeeded")
+	}
+
+	if _, err := os.Stat(dir + "/dump.sql"); !os.IsNotExist(err) {
+		t.Errorf("file with wrong checksum was kept")
+	}
+}
+
+func TestDownloader_notFound(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	_, err := Downloader{Retries: 3, Backoff: time.Millisecond}.Download(dir, srv.URL+"/dump.sql", "")
+	if err == nil {
+		t.Fatalf("Download() of missing file succeeded")
+	}
+
+	if requests != 1 {
+		t.Errorf("missing file was requested %d times, want 1", requests)
+	}
+}
+
+func TestDownloader_idleTimeout(t *testing.T) {
+	stall := make(chan struct{})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+
+		<-stall
+	}))
+	defer srv.Close()
+	defer close(stall)
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	start := time.Now()
+
+	_, err := Downloader{IdleTimeout: 50 * time.Millisecond}.Download(dir, srv.URL+"/dump.sql", "")
+	if err == nil {
+		t.Fatalf("Download() of stalled file succeeded")
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Download() gave up after %s", elapsed)
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "ddn-inet-test")
+	if err != nil {
+		t.Fatalf("TempDir() error = %v", err)
+	}
+
+	return dir
+}
@@ -2,50 +2,62 @@
 package inet
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
+	"io/ioutil"
 	"net/http"
-	"os"
 	"strings"
 )
 
-// WriteHeader updates the header's Content-Type to application/json and charset to
-// UTF-8. Additionally, it also adds the http status to it.
-func WriteHeader(w http.ResponseWriter, status int) {
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.WriteHeader(status)
-}
+// RequestIDHeader carries the ID of a request from the server to the agents
+// and back, so that the lines they log about it can be matched.
+const RequestIDHeader = "X-Request-ID"
 
-// DownloadFile downloads the file from the url and places it into the
-// `dest` folder
-func DownloadFile(dest, url string) (string, error) {
-	i, j := strings.LastIndex(url, "/"), len(url)
-	filename := url[i+1 : j]
-
-	filepath := fmt.Sprintf("%s/%s", dest, filename)
+// PostJSON sends msg as JSON to dest, along with the request ID if it's not
+// empty, and returns the body of the response.
+func PostJSON(dest, requestID string, msg interface{}) (string, error) {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return "", fmt.Errorf("encoding message failed: %v", err)
+	}
 
-	out, err := os.Create(filepath)
+	req, err := http.NewRequest(http.MethodPost, dest, bytes.NewReader(b))
 	if err != nil {
-		return "", fmt.Errorf("could not create file: %s", err.Error())
+		return "", fmt.Errorf("creating request failed: %v", err)
 	}
-	defer out.Close()
 
-	resp, err := http.Get(url)
+	req.Header.Set("Content-Type", "application/json")
+	if requestID != "" {
+		req.Header.Set(RequestIDHeader, requestID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("couldn't get url '%s': %s", url, err.Error())
+		return "", fmt.Errorf("sending request failed: %v", err)
 	}
 	defer resp.Body.Close()
 
-	_, err = io.Copy(out, resp.Body)
+	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		os.Remove(filepath)
-
-		return "", fmt.Errorf("downloading file failed: %s", err.Error())
+		return "", fmt.Errorf("reading response failed: %v", err)
 	}
 
-	return filepath, nil
+	return string(body), nil
+}
+
+// WriteHeader updates the header's Content-Type to application/json and charset to
+// UTF-8. Additionally, it also adds the http status to it.
+func WriteHeader(w http.ResponseWriter, status int) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(status)
+}
+
+// DownloadFile downloads the file from the url and places it into the
+// `dest` folder, trying only once. Use a Downloader for retries.
+func DownloadFile(dest, url string) (string, error) {
+	return Downloader{}.Download(dest, url, "")
 }
 
 // AddrExists checks the URL to see if it's valid, downloadable file or not.
@@ -0,0 +1,250 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupFormat is appended to the name of the rotated files, so that they
+// sort in the order they were rotated.
+const backupFormat = "2006-01-02T15-04-05.000"
+
+// File is a log file that rotates itself once it grows over MaxSize or, if
+// Daily is set, when the day changes. The rotated files are renamed to
+// <Name>.<time>, compressed with gzip if Compress is set, and all but the
+// newest MaxBackups of them are removed.
+//
+// File can be given to log.SetOutput after calling Open.
+type File struct {
+	Name       string
+	MaxSize    int64 // in bytes, 0 disables rotation by size
+	Daily      bool
+	MaxBackups int // 0 keeps every rotated file
+	Compress   bool
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+	day  string
+
+	// bg runs the compression and the cleanup of the rotated files one at
+	// a time, so that a file being compressed is not counted twice.
+	bg sync.Mutex
+	wg sync.WaitGroup
+}
+
+// Open opens the file for appending, creating it if needed.
+func (l *File) Open() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.open()
+}
+
+// Reopen closes and opens the file again, e.g. after it was moved by an
+// external tool like logrotate.
+func (l *File) Reopen() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.f != nil {
+		l.f.Close()
+		l.f = nil
+	}
+
+	return l.open()
+}
+
+// ReopenOn reopens the file every time one of sigs is received. It never
+// returns, so it should be run in a goroutine.
+func (l *File) ReopenOn(sigs ...os.Signal) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sigs...)
+
+	for range c {
+		if err := l.Reopen(); err != nil {
+			fmt.Fprintf(os.Stderr, "reopening log file failed: %v\n", err)
+			continue
+		}
+
+		Info("Reopened log file %s", l.Name)
+	}
+}
+
+// Rotate rotates the file regardless of its size and age.
+func (l *File) Rotate() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.rotate(time.Now())
+}
+
+// Write writes p to the file, rotating it first if needed.
+func (l *File) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.f == nil {
+		if err := l.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	now := time.Now()
+	if (l.MaxSize > 0 && l.size > 0 && l.size+int64(len(p)) > l.MaxSize) ||
+		(l.Daily && l.day != now.Format("2006-01-02")) {
+		if err := l.rotate(now); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := l.f.Write(p)
+	l.size += int64(n)
+
+	return n, err
+}
+
+// Close closes the file and waits for the rotated files to be compressed.
+func (l *File) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.wg.Wait()
+
+	if l.f == nil {
+		return nil
+	}
+
+	err := l.f.Close()
+	l.f = nil
+
+	return err
+}
+
+func (l *File) open() error {
+	f, err := os.OpenFile(l.Name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("opening log file: %v", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("checking log file: %v", err)
+	}
+
+	l.f = f
+	l.size = info.Size()
+	l.day = time.Now().Format("2006-01-02")
+
+	// An existing file belongs to the day it was last written on.
+	if l.size > 0 {
+		l.day = info.ModTime().Format("2006-01-02")
+	}
+
+	return nil
+}
+
+func (l *File) rotate(now time.Time) error {
+	if l.f != nil {
+		l.f.Close()
+		l.f = nil
+	}
+
+	if info, err := os.Stat(l.Name); err == nil && info.Size() > 0 {
+		rotated := fmt.Sprintf("%s.%s", l.Name, now.Format(backupFormat))
+
+		if err := os.Rename(l.Name, rotated); err != nil {
+			return fmt.Errorf("rotating log file: %v", err)
+		}
+
+		l.wg.Add(1)
+		go func() {
+			defer l.wg.Done()
+
+			l.bg.Lock()
+			defer l.bg.Unlock()
+
+			if l.Compress {
+				if err := compress(rotated); err != nil {
+					fmt.Fprintf(os.Stderr, "compressing %s failed: %v\n", rotated, err)
+				}
+			}
+
+			l.removeBackups()
+		}()
+	}
+
+	return l.open()
+}
+
+// removeBackups removes the oldest rotated files over MaxBackups.
+func (l *File) removeBackups() {
+	if l.MaxBackups <= 0 {
+		return
+	}
+
+	matches, err := filepath.Glob(l.Name + ".*")
+	if err != nil {
+		return
+	}
+
+	var backups []string
+	for _, m := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(m, l.Name+"."), ".gz")
+		if _, err := time.Parse(backupFormat, stamp); err == nil {
+			backups = append(backups, m)
+		}
+	}
+
+	if len(backups) <= l.MaxBackups {
+		return
+	}
+
+	sort.Strings(backups)
+
+	for _, b := range backups[:len(backups)-l.MaxBackups] {
+		os.Remove(b)
+	}
+}
+
+// compress gzips name to name.gz and removes name.
+func compress(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(name+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		os.Remove(name + ".gz")
+		return err
+	}
+
+	src.Close()
+
+	return os.Remove(name)
+}
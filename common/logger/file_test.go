@@ -0,0 +1,146 @@
+package logger
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileRotateBySize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ddn-logger-test")
+	if err != nil {
+		t.Fatalf("TempDir() error = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "ddn.log")
+	l := &File{Name: name, MaxSize: 10, MaxBackups: 2, Compress: true}
+
+	if err := l.Open(); err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := l.Write([]byte(line)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+
+		// Keeps the names of the rotated files apart.
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	current, _ := ioutil.ReadFile(name)
+	if string(current) != "fourth\n" {
+		t.Errorf("current log = %q, want %q", current, "fourth\n")
+	}
+
+	backups, _ := filepath.Glob(name + ".*")
+	if len(backups) != 2 {
+		t.Fatalf("backups = %v, want 2", backups)
+	}
+
+	for i, want := range []string{"second\n", "third\n"} {
+		if !strings.HasSuffix(backups[i], ".gz") {
+			t.Errorf("backup %s is not compressed", backups[i])
+			continue
+		}
+
+		if got := readGzip(t, backups[i]); got != want {
+			t.Errorf("backup %s = %q, want %q", backups[i], got, want)
+		}
+	}
+}
+
+func TestFileRotateDaily(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ddn-logger-test")
+	if err != nil {
+		t.Fatalf("TempDir() error = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "ddn.log")
+	l := &File{Name: name, Daily: true}
+
+	if err := l.Open(); err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer l.Close()
+
+	l.Write([]byte("yesterday\n"))
+	l.day = time.Now().AddDate(0, 0, -1).Format("2006-01-02")
+	l.Write([]byte("today\n"))
+	l.Write([]byte("still today\n"))
+
+	backups, _ := filepath.Glob(name + ".*")
+	if len(backups) != 1 {
+		t.Fatalf("backups = %v, want 1", backups)
+	}
+
+	if got, _ := ioutil.ReadFile(backups[0]); string(got) != "yesterday\n" {
+		t.Errorf("backup = %q, want %q", got, "yesterday\n")
+	}
+
+	if got, _ := ioutil.ReadFile(name); string(got) != "today\nstill today\n" {
+		t.Errorf("current log = %q", got)
+	}
+}
+
+func TestFileReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ddn-logger-test")
+	if err != nil {
+		t.Fatalf("TempDir() error = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "ddn.log")
+	l := &File{Name: name}
+
+	if err := l.Open(); err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer l.Close()
+
+	l.Write([]byte("before\n"))
+
+	if err := os.Rename(name, name+".moved"); err != nil {
+		t.Fatalf("Rename() error = %v", err)
+	}
+
+	if err := l.Reopen(); err != nil {
+		t.Fatalf("Reopen() error = %v", err)
+	}
+
+	l.Write([]byte("after\n"))
+
+	if got, _ := ioutil.ReadFile(name); string(got) != "after\n" {
+		t.Errorf("reopened log = %q, want %q", got, "after\n")
+	}
+}
+
+func readGzip(t *testing.T, name string) string {
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatalf("Open(%s) error = %v", name, err)
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip.NewReader(%s) error = %v", name, err)
+	}
+
+	b, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("reading %s failed: %v", name, err)
+	}
+
+	return string(b)
+}
@@ -1,9 +1,14 @@
 package logger
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
 // LogLevel is used to determine what to log.
@@ -38,39 +43,147 @@ const (
 // Level is to be used to control the log level of the application.
 var Level = INFO
 
+// Structured switches the log to JSON lines with the time, the level, the
+// message and the fields of the entry, instead of formatted text.
+var Structured = false
+
+// mu serializes the writes of the JSON lines.
+var mu sync.Mutex
+
+// Fields are key-value pairs attached to the log lines, e.g. the ID of the
+// request being served.
+type Fields map[string]interface{}
+
+// String returns the fields as space separated key=value pairs, ordered
+// by key.
+func (f Fields) String() string {
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%v", k, f[k])
+	}
+
+	return b.String()
+}
+
+// Entry logs with a set of fields attached to every line.
+type Entry struct {
+	fields Fields
+}
+
+// With returns an Entry that attaches fields to the lines it logs.
+func With(fields Fields) Entry {
+	return Entry{}.With(fields)
+}
+
+// With returns an Entry with the fields of e and fields. The latter win
+// if a key is present in both.
+func (e Entry) With(fields Fields) Entry {
+	merged := make(Fields, len(e.fields)+len(fields))
+	for k, v := range e.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+
+	return Entry{fields: merged}
+}
+
 // Fatal should be used to log a critical incident and exit the application
-func Fatal(msg string, args ...interface{}) {
+func (e Entry) Fatal(msg string, args ...interface{}) {
 	defer os.Exit(1)
 
-	log.Printf("[%s] %s", FATAL, fmt.Sprintf(msg, args...))
+	e.output(FATAL, fmt.Sprintf(msg, args...))
 }
 
 // Error should be used for application errors that should be resolved
-func Error(msg string, args ...interface{}) {
+func (e Entry) Error(msg string, args ...interface{}) {
 	if shouldLog(ERROR) {
-		log.Printf("[%s] %s", ERROR, fmt.Sprintf(msg, args...))
+		e.output(ERROR, fmt.Sprintf(msg, args...))
 	}
 }
 
 // Warn should be used for events that can be dangerous
-func Warn(msg string, args ...interface{}) {
+func (e Entry) Warn(msg string, args ...interface{}) {
 	if shouldLog(WARN) {
-		log.Printf("[%s]  %s", WARN, fmt.Sprintf(msg, args...))
+		e.output(WARN, fmt.Sprintf(msg, args...))
 	}
 }
 
 // Info should be used to share data.
-func Info(msg string, args ...interface{}) {
+func (e Entry) Info(msg string, args ...interface{}) {
 	if shouldLog(INFO) {
-		log.Printf("[%s]  %s", INFO, fmt.Sprintf(msg, args...))
+		e.output(INFO, fmt.Sprintf(msg, args...))
 	}
 }
 
 // Debug should be used for debugging purposes only.
-func Debug(msg string, args ...interface{}) {
+func (e Entry) Debug(msg string, args ...interface{}) {
 	if shouldLog(DEBUG) {
-		log.Printf("[%s] %s", DEBUG, fmt.Sprintf(msg, args...))
+		e.output(DEBUG, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (e Entry) output(lvl LogLevel, msg string) {
+	if !Structured {
+		// The levels are padded so that the messages line up.
+		log.Printf("%-8s%s%s", "["+lvl.String()+"]", msg, e.fields)
+		return
+	}
+
+	line := make(map[string]interface{}, len(e.fields)+3)
+	for k, v := range e.fields {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+
+		line[k] = v
 	}
+
+	line["time"] = time.Now().Format(time.RFC3339Nano)
+	line["level"] = lvl.String()
+	line["msg"] = msg
+
+	b, err := json.Marshal(line)
+	if err != nil {
+		b, _ = json.Marshal(map[string]string{"time": line["time"].(string), "level": lvl.String(), "msg": msg, "error": err.Error()})
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	log.Writer().Write(append(b, '\n'))
+}
+
+// Fatal should be used to log a critical incident and exit the application
+func Fatal(msg string, args ...interface{}) {
+	Entry{}.Fatal(msg, args...)
+}
+
+// Error should be used for application errors that should be resolved
+func Error(msg string, args ...interface{}) {
+	Entry{}.Error(msg, args...)
+}
+
+// Warn should be used for events that can be dangerous
+func Warn(msg string, args ...interface{}) {
+	Entry{}.Warn(msg, args...)
+}
+
+// Info should be used to share data.
+func Info(msg string, args ...interface{}) {
+	Entry{}.Info(msg, args...)
+}
+
+// Debug should be used for debugging purposes only.
+func Debug(msg string, args ...interface{}) {
+	Entry{}.Debug(msg, args...)
 }
 
 func shouldLog(lvl LogLevel) bool {
@@ -1,7 +1,14 @@
 package logger
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestShouldLog(t *testing.T) {
@@ -26,3 +33,47 @@ func TestShouldLog(t *testing.T) {
 		}
 	}
 }
+
+func TestStructured(t *testing.T) {
+	var buf bytes.Buffer
+
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	Level = INFO
+	Structured = true
+	defer func() { Structured = false }()
+
+	With(Fields{"request_id": "abc"}).With(Fields{"database_id": 4}).Error("failed: %s", "boom")
+	Debug("hidden")
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("log line %q is not JSON: %v", buf.String(), err)
+	}
+
+	want := map[string]interface{}{"level": "error", "msg": "failed: boom", "request_id": "abc", "database_id": float64(4)}
+	for k, v := range want {
+		if line[k] != v {
+			t.Errorf("%s = %v, want %v", k, line[k], v)
+		}
+	}
+
+	if _, err := time.Parse(time.RFC3339Nano, fmt.Sprint(line["time"])); err != nil {
+		t.Errorf("time %v is not RFC3339: %v", line["time"], err)
+	}
+}
+
+func TestFields(t *testing.T) {
+	var buf bytes.Buffer
+
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	Level = INFO
+	With(Fields{"b": 2, "a": "x"}).Info("hello")
+
+	if !strings.HasSuffix(buf.String(), "[info]  hello a=x b=2\n") {
+		t.Errorf("text log line = %q", buf.String())
+	}
+}
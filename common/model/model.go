@@ -3,15 +3,20 @@ package model
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"strings"
 
+	"github.com/djavorszky/ddn/common/anonymize"
 	"github.com/djavorszky/ddn/common/inet"
 	"github.com/djavorszky/ddn/common/status"
-	"github.com/djavorszky/notif"
 	"github.com/djavorszky/sutils"
 	webpush "github.com/sherclockholmes/webpush-go"
 )
 
+// AgentTokenHeader carries the token the server gave the agent when it
+// registered, on the calls that only the server may make to the agent.
+const AgentTokenHeader = "X-Agent-Token"
+
 // DBRequest is used to represent JSON call about creating, dropping or importing databases
 type DBRequest struct {
 	ID           int    `json:"id"`
@@ -19,15 +24,98 @@ type DBRequest struct {
 	DumpLocation string `json:"dumpfile_location"`
 	Username     string `json:"username"`
 	Password     string `json:"password"`
+	SHA256       string `json:"sha256,omitempty"`
+
+	// Anonymization is the rule set the agent anonymizes the database with
+	// after importing it. It's always loaded by the server.
+	Anonymization *anonymize.RuleSet `json:"anonymization,omitempty"`
+
+	// Scripts are run in the database after the import, in order. Like the
+	// anonymization rules, they're always loaded by the server.
+	Scripts []Script `json:"scripts,omitempty"`
+}
+
+// Script is a post-import script in the SQL dialect of the agent's vendor.
+type Script struct {
+	Name string `json:"name"`
+	SQL  string `json:"sql"`
+}
+
+// ScriptSet is a named set of post-import scripts stored on the server, with
+// the vendors it has scripts for.
+type ScriptSet struct {
+	Name    string   `json:"name"`
+	Vendors []string `json:"vendors"`
 }
 
 // ClientRequest is used to represent a JSON call between a client and the server
 type ClientRequest struct {
-	AgentIdentifier string `json:"agent_identifier"`
-	RequesterEmail  string `json:"requester_email"`
+	AgentIdentifier string   `json:"agent_identifier"`
+	RequesterEmail  string   `json:"requester_email"`
+	Comment         string   `json:"comment"`
+	Tags            []string `json:"tags"`
+	UploadID        string   `json:"upload_id,omitempty"`
+	Anonymize       string   `json:"anonymize,omitempty"`
+	PostImport      []string `json:"post_import,omitempty"`
 	DBRequest
 }
 
+// Liferay describes the Liferay portal found in an imported database. It's
+// left at its zero value if the database doesn't have the Release_ table of
+// the portal.
+type Liferay struct {
+	SchemaVersion string   `json:"schema_version,omitempty"`
+	BuildNumber   int      `json:"build_number,omitempty"`
+	Companies     int      `json:"companies,omitempty"`
+	VirtualHosts  []string `json:"virtual_hosts,omitempty"`
+}
+
+// Known returns true if the database was found to be a Liferay one.
+func (l Liferay) Known() bool {
+	return l.BuildNumber != 0
+}
+
+// DXP returns true if the portal is 7.0 or newer, which needs the DXP
+// portal-ext properties instead of the 6.2 ones.
+func (l Liferay) DXP() bool {
+	return l.BuildNumber >= 7000
+}
+
+// Version returns the version of the portal derived from its build number,
+// e.g. 6.2 or 7.4, or an empty string if it's not known.
+func (l Liferay) Version() string {
+	if !l.Known() {
+		return ""
+	}
+
+	return fmt.Sprintf("%d.%d", l.BuildNumber/1000, l.BuildNumber/100%10)
+}
+
+// LiferayMessage is the response of the agent to the inspection of a database.
+type LiferayMessage struct {
+	Status  int     `json:"status"`
+	Message string  `json:"message"`
+	Liferay Liferay `json:"liferay"`
+}
+
+// Compose creates a JSON formatted byte slice from the LiferayMessage
+func (msg LiferayMessage) Compose() []byte {
+	b, _ := json.Marshal(msg)
+
+	return b
+}
+
+// Upload is a dump uploaded to the server in chunks. Offset is the number of
+// bytes received so far, SHA256 is set once all Size bytes are in, after
+// which the dump can be imported by referencing its ID.
+type Upload struct {
+	ID       string `json:"id"`
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+	Offset   int64  `json:"offset"`
+	SHA256   string `json:"sha256,omitempty"`
+}
+
 // RegisterRequest is used to represent a JSON call between the agent and the server.
 // ID can be null if it's the initial registration, but must correspond to the agent's
 // ID when unregistering
@@ -42,6 +130,7 @@ type RegisterRequest struct {
 	Version   string `json:"version"`
 	Port      string `json:"port"`
 	Addr      string `json:"address"`
+	Draining  bool   `json:"draining"`
 }
 
 // RegisterResponse is used as the response to the RegisterRequest
@@ -66,6 +155,36 @@ type Agent struct {
 	Address    string `json:"agent_address"`
 	Token      string `json:"agent_token"`
 	Up         bool   `json:"agent_up"`
+	Draining   bool   `json:"agent_draining"`
+
+	requestID string
+}
+
+// Available returns whether the agent accepts new databases, i.e. it's up
+// and not draining.
+func (a Agent) Available() bool {
+	return a.Up && !a.Draining
+}
+
+// Public returns a copy of the agent without its token, to be served to the
+// users.
+func (a Agent) Public() Agent {
+	a.Token = ""
+
+	return a
+}
+
+// WithRequestID returns a copy of the agent that sends id along with its
+// actions, so that they can be traced in the logs of the agent.
+func (a Agent) WithRequestID(id string) Agent {
+	a.requestID = id
+
+	return a
+}
+
+// RequestID returns the ID set by WithRequestID.
+func (a Agent) RequestID() string {
+	return a.requestID
 }
 
 // PushSubscription is used to represent a subscription for web push notifications
@@ -92,18 +211,12 @@ func (a Agent) CreateDatabase(id int, dbname, dbuser, dbpass string) (string, er
 	return a.executeAction(dbreq, "create-database")
 }
 
-// ImportDatabase starts the import on the agent.
-func (a Agent) ImportDatabase(id int, dbname, dbuser, dbpass, dumploc string) (string, error) {
-	if ok := sutils.Present(dbname, dbuser, dbpass, dumploc); !ok {
-		return "", fmt.Errorf("asked to import database with missing values: dbname: %q, dbuser: %q, dbpass: %q, dumploc: %q", dbname, dbuser, dbpass, dumploc)
-	}
-
-	dbreq := DBRequest{
-		ID:           id,
-		DatabaseName: dbname,
-		Username:     dbuser,
-		Password:     dbpass,
-		DumpLocation: dumploc,
+// ImportDatabase starts the import on the agent. If dbreq.SHA256 is not
+// empty, the agent checks that the SHA-256 of the downloaded dump matches it.
+func (a Agent) ImportDatabase(dbreq DBRequest) (string, error) {
+	if ok := sutils.Present(dbreq.DatabaseName, dbreq.Username, dbreq.Password, dbreq.DumpLocation); !ok {
+		return "", fmt.Errorf("asked to import database with missing values: dbname: %q, dbuser: %q, dbpass: %q, dumploc: %q",
+			dbreq.DatabaseName, dbreq.Username, dbreq.Password, dbreq.DumpLocation)
 	}
 
 	return a.executeAction(dbreq, "import-database")
@@ -125,14 +238,74 @@ func (a Agent) DropDatabase(id int, dbname, dbuser string) (string, error) {
 	return a.executeAction(dbreq, "drop-database")
 }
 
-func (a Agent) executeAction(dbreq DBRequest, endpoint string) (string, error) {
+// InspectDatabase asks the agent which Liferay portal the imported database
+// belongs to. The returned Liferay is empty if it's not a Liferay database.
+func (a Agent) InspectDatabase(id int, dbname, dbuser, dbpass string) (Liferay, error) {
+	dbreq := DBRequest{
+		ID:           id,
+		DatabaseName: dbname,
+		Username:     dbuser,
+		Password:     dbpass,
+	}
+
+	resp, err := inet.PostJSON(a.url("inspect-database"), a.requestID, dbreq)
+	if err != nil && resp == "" {
+		return Liferay{}, fmt.Errorf("sending json message failed: %s", err.Error())
+	}
+
+	var respMsg LiferayMessage
+
+	json.Unmarshal([]byte(resp), &respMsg)
+
+	if respMsg.Status != status.Success {
+		return Liferay{}, fmt.Errorf("inspecting database failed: %s", respMsg.Message)
+	}
+
+	return respMsg.Liferay, nil
+}
+
+// Drain asks the agent to stop accepting new databases and to shut down once
+// its running imports finished.
+func (a Agent) Drain() (string, error) {
+	req, err := http.NewRequest(http.MethodPost, a.url("api/drain"), nil)
+	if err != nil {
+		return "", fmt.Errorf("creating request failed: %v", err)
+	}
+
+	req.Header.Set(AgentTokenHeader, a.Token)
+	if a.requestID != "" {
+		req.Header.Set(inet.RequestIDHeader, a.requestID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("sending request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var respMsg inet.Message
+
+	json.NewDecoder(resp.Body).Decode(&respMsg)
+
+	if respMsg.Status != status.Accepted {
+		return "", fmt.Errorf("draining failed: %s", respMsg.Message)
+	}
+
+	return respMsg.Message, nil
+}
+
+func (a Agent) url(endpoint string) string {
 	dest := fmt.Sprintf("%s:%s/%s", a.Address, a.AgentPort, endpoint)
 
 	if !strings.HasPrefix(dest, "http://") && !strings.HasPrefix(dest, "https://") {
 		dest = fmt.Sprintf("http://%s", dest)
 	}
 
-	resp, err := notif.SndLoc(dbreq, dest)
+	return dest
+}
+
+func (a Agent) executeAction(dbreq DBRequest, endpoint string) (string, error) {
+	resp, err := inet.PostJSON(a.url(endpoint), a.requestID, dbreq)
 	if err != nil && resp == "" {
 		return "", fmt.Errorf("sending json message failed: %s", err.Error())
 	}
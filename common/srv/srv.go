@@ -1,26 +1,117 @@
 package srv
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"net/http"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/djavorszky/ddn/common/inet"
 	"github.com/djavorszky/ddn/common/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-// Logger logs queries to the log with some extra information
+// requestDuration records the latency of the requests by the name of the
+// route that served them.
+var requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "ddn_http_request_duration_seconds",
+	Help:    "Latency of the HTTP requests by route, method and status code.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"route", "method", "code"})
+
+func init() {
+	prometheus.MustRegister(requestDuration)
+}
+
+// validRequestID matches the request IDs accepted from the callers.
+var validRequestID = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,64}$`)
+
+type requestIDKey struct{}
+
+// Logger logs queries to the log with some extra information, and
+// records their latency under the name of the handler.
+//
+// Each request gets an ID, which is returned in the RequestIDHeader of the
+// response and can be logged with Log. Requests that already carry one,
+// e.g. the ones between the server and the agents, keep it.
 func Logger(inner http.Handler, handler string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
-		inner.ServeHTTP(w, r)
+		id := r.Header.Get(inet.RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(inet.RequestIDHeader, id)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		inner.ServeHTTP(rec, r)
+
+		requestDuration.WithLabelValues(handler, r.Method, strconv.Itoa(rec.status)).Observe(time.Since(start).Seconds())
 
 		if strings.HasPrefix(r.RequestURI, "/alive") ||
-			r.RequestURI == "/heartbeat" {
+			r.RequestURI == "/heartbeat" ||
+			r.RequestURI == "/metrics" {
 			return
 		}
 
-		logger.Debug("[%s]\t%s\t%s\t%s\t",
-			r.RemoteAddr, r.Method, r.RequestURI, time.Since(start))
+		Log(r).With(logger.Fields{
+			"route":    handler,
+			"remote":   r.RemoteAddr,
+			"status":   rec.status,
+			"duration": time.Since(start).String(),
+		}).Debug("%s %s", r.Method, r.RequestURI)
 	})
 }
+
+// RequestID returns the ID of the request given to it by Logger.
+func RequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+
+	return id
+}
+
+// Log returns a logger that attaches the ID of the request to its lines.
+func Log(r *http.Request) logger.Entry {
+	return logger.With(logger.Fields{"request_id": RequestID(r)})
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// metricsHandler serves the metrics of the default registry.
+var metricsHandler = promhttp.Handler()
+
+// Metrics serves the metrics of the process in the Prometheus text format.
+func Metrics(w http.ResponseWriter, r *http.Request) {
+	metricsHandler.ServeHTTP(w, r)
+}
+
+// statusRecorder remembers the status code written to the ResponseWriter.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// Flush keeps streaming responses, like the event stream, working.
+func (rec *statusRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -16,6 +16,8 @@ func init() {
 	Labels[ValidatingDump] = "Validating Dump"
 	Labels[ImportInProgress] = "Importing"
 	Labels[CopyInProgress] = "Copying"
+	Labels[AnonymizingDatabase] = "Anonymizing"
+	Labels[RunningScripts] = "Running scripts"
 
 	// Success
 	Labels[Success] = "Completed"
@@ -40,6 +42,9 @@ func init() {
 	Labels[CreateDatabaseFailed] = "Creating database failed"
 	Labels[ListDatabaseFailed] = "Listing databases failed"
 	Labels[DropDatabaseFailed] = "Dropping database failed"
+	Labels[AgentDraining] = "Agent is draining"
+	Labels[AnonymizationFailed] = "Anonymization failed"
+	Labels[PostImportFailed] = "Post-import script failed"
 
 	// Warnings
 	Labels[DropInProgress] = "Drop in progress"
@@ -59,6 +64,9 @@ const (
 	ValidatingDump     int = 5 // status.ValidatingDump
 	ImportInProgress   int = 6 // status.ImportInProgress
 	CopyInProgress     int = 7 // status.CopyInProgress
+
+	AnonymizingDatabase int = 8 // status.AnonymizingDatabase
+	RunningScripts      int = 9 // status.RunningScripts
 )
 
 // Success statuses are used to convey a successful result.
@@ -93,6 +101,9 @@ const (
 	DropDatabaseFailed       int = 307 // status.DropDatabaseFailed
 	SaveSubscriptionFailed   int = 308 // status.SaveSubscriptionFailed
 	DeleteSubscriptionFailed int = 309 // status.DeleteSubscriptionFailed
+	AgentDraining            int = 310 // status.AgentDraining
+	AnonymizationFailed      int = 311 // status.AnonymizationFailed
+	PostImportFailed         int = 312 // status.PostImportFailed
 )
 
 // Warnings are for issuing warnings.
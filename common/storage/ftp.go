@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/jlaffaye/ftp"
+)
+
+// ftpAnonymous is the user to log in with if no username is set.
+const ftpAnonymous = "anonymous"
+
+type ftpStore struct {
+	conn *ftp.ServerConn
+
+	// conns holds the control and data connections, so that Close can
+	// interrupt the running transfers.
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func dialFTP(u *url.URL, c Credentials, timeout time.Duration) (*ftpStore, error) {
+	user, pass := login(u, c.FTPHost, "21", c.FTPUser, c.FTPPassword)
+
+	if user == "" {
+		user, pass = ftpAnonymous, ftpAnonymous
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "21")
+	}
+
+	s := &ftpStore{}
+	dialer := net.Dialer{Timeout: timeout}
+
+	conn, err := ftp.Dial(addr, ftp.DialWithDialFunc(func(network, address string) (net.Conn, error) {
+		c, err := dialer.Dial(network, address)
+		if err == nil {
+			s.mu.Lock()
+			s.conns = append(s.conns, c)
+			s.mu.Unlock()
+		}
+
+		return c, err
+	}))
+	if err != nil {
+		return nil, err
+	}
+	s.conn = conn
+
+	err = conn.Login(user, pass)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *ftpStore) Open(path string, offset int64) (io.ReadCloser, error) {
+	resp, err := s.conn.RetrFrom(path, uint64(offset))
+	if err != nil {
+		return nil, ftpError(err)
+	}
+
+	return resp, nil
+}
+
+func (s *ftpStore) Size(path string) (int64, error) {
+	size, err := s.conn.FileSize(path)
+	if err != nil {
+		return 0, ftpError(err)
+	}
+
+	return size, nil
+}
+
+func (s *ftpStore) List(path string) ([]Entry, error) {
+	list, err := s.conn.List(path)
+	if err != nil {
+		return nil, ftpError(err)
+	}
+
+	var entries []Entry
+	for _, e := range list {
+		switch e.Type {
+		case ftp.EntryTypeFile:
+			entries = append(entries, Entry{Name: e.Name, Size: int64(e.Size)})
+		case ftp.EntryTypeFolder:
+			if e.Name == "." || e.Name == ".." {
+				continue
+			}
+
+			entries = append(entries, Entry{Name: e.Name, Folder: true})
+		}
+	}
+
+	return entries, nil
+}
+
+func (s *ftpStore) Close() error {
+	err := s.conn.Quit()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range s.conns {
+		c.Close()
+	}
+	s.conns = nil
+
+	return err
+}
+
+// ftpError turns the "file unavailable" replies into ErrNotExist.
+func ftpError(err error) error {
+	if tperr, ok := err.(*textproto.Error); ok && tperr.Code == ftp.StatusFileUnavailable {
+		return ErrNotExist
+	}
+
+	return err
+}
@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFTPStore(t *testing.T) {
+	files := map[string]string{
+		"dumps/lportal.sql": "CREATE TABLE users;",
+		"dumps/old/a.sql":   "old",
+	}
+
+	addr, stop := ftpServer(t, files)
+	defer stop()
+
+	c := Credentials{FTPHost: addr, FTPUser: "ddn", FTPPassword: "secret"}
+
+	st, path, err := Dial("ftp://"+addr+"/dumps/lportal.sql", c, time.Second)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer st.Close()
+
+	if path != "dumps/lportal.sql" {
+		t.Errorf("path = %q, want %q", path, "dumps/lportal.sql")
+	}
+
+	rc, err := st.Open(path, 7)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	got, _ := ioutil.ReadAll(rc)
+	rc.Close()
+
+	if string(got) != "TABLE users;" {
+		t.Errorf("Open() at 7 read %q, want %q", got, "TABLE users;")
+	}
+
+	if size, err := st.Size(path); err != nil || size != 19 {
+		t.Errorf("Size() = %d, %v, want 19", size, err)
+	}
+
+	if _, err := st.Open("dumps/missing.sql", 0); err != ErrNotExist {
+		t.Errorf("Open() of missing file error = %v, want ErrNotExist", err)
+	}
+
+	entries, err := st.List("dumps")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	want := []Entry{{Name: "lportal.sql", Size: 19}, {Name: "old", Folder: true}}
+	if len(entries) != len(want) || entries[0] != want[0] || entries[1] != want[1] {
+		t.Errorf("List() = %v, want %v", entries, want)
+	}
+}
+
+// ftpServer starts an FTP server on a random port, which serves files
+// read-only in passive mode to the user ddn with the password secret.
+func ftpServer(t *testing.T, files map[string]string) (string, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go serveFTP(conn, files)
+		}
+	}()
+
+	return l.Addr().String(), func() { l.Close() }
+}
+
+func serveFTP(conn net.Conn, files map[string]string) {
+	defer conn.Close()
+
+	var (
+		r      = bufio.NewReader(conn)
+		data   net.Listener
+		offset int
+	)
+
+	reply := func(format string, args ...interface{}) {
+		fmt.Fprintf(conn, format+"\r\n", args...)
+	}
+
+	// transfer sends s over the data connection opened by EPSV.
+	transfer := func(s string) {
+		defer func() {
+			data.Close()
+			data = nil
+		}()
+
+		reply("150 Opening data connection")
+
+		dc, err := data.Accept()
+		if err != nil {
+			return
+		}
+		dc.Write([]byte(s))
+		dc.Close()
+
+		reply("226 Transfer complete")
+	}
+
+	reply("220 Ready")
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		cmd := strings.TrimSpace(line)
+		arg := ""
+		if i := strings.Index(cmd, " "); i > 0 {
+			cmd, arg = cmd[:i], cmd[i+1:]
+		}
+
+		switch cmd {
+		case "USER":
+			reply("331 Password required")
+		case "PASS":
+			if arg != "secret" {
+				reply("530 Login incorrect")
+				continue
+			}
+			reply("230 Logged in")
+		case "TYPE":
+			reply("200 Type set")
+		case "EPSV":
+			data, err = net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				reply("425 Can't open data connection")
+				continue
+			}
+			reply("229 Entering Extended Passive Mode (|||%d|)", data.Addr().(*net.TCPAddr).Port)
+		case "REST":
+			offset, _ = strconv.Atoi(arg)
+			reply("350 Restarting at %d", offset)
+		case "SIZE":
+			content, ok := files[arg]
+			if !ok {
+				reply("550 No such file")
+				continue
+			}
+			reply("213 %d", len(content))
+		case "RETR":
+			content, ok := files[arg]
+			if !ok {
+				data.Close()
+				reply("550 No such file")
+				continue
+			}
+
+			transfer(content[offset:])
+			offset = 0
+		case "LIST":
+			var list strings.Builder
+
+			seen := make(map[string]bool)
+			for name, content := range files {
+				if !strings.HasPrefix(name, arg+"/") {
+					continue
+				}
+
+				rest := strings.TrimPrefix(name, arg+"/")
+				if i := strings.Index(rest, "/"); i >= 0 {
+					if !seen[rest[:i]] {
+						seen[rest[:i]] = true
+						fmt.Fprintf(&list, "drwxr-xr-x 2 ddn ddn 4096 Jan 02 12:00 %s\r\n", rest[:i])
+					}
+					continue
+				}
+
+				fmt.Fprintf(&list, "-rw-r--r-- 1 ddn ddn %d Jan 02 12:00 %s\r\n", len(content), rest)
+			}
+
+			transfer(list.String())
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultS3Region is used if the s3-region is not set. Most S3-compatible
+// services, e.g. MinIO, accept it regardless of where they are.
+const defaultS3Region = "us-east-1"
+
+// emptySHA256 is the hash of the empty payload of the requests.
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// s3Store reads a bucket with the REST API, using path-style urls so that
+// it works with the S3-compatible services too. Requests are signed with
+// Signature Version 4, unless no access key is set, which only works with
+// public buckets.
+type s3Store struct {
+	client   *http.Client
+	endpoint *url.URL
+	bucket   string
+	region   string
+	access   string
+	secret   string
+
+	// ctx is cancelled by Close to interrupt the running requests.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func dialS3(bucket string, c Credentials, timeout time.Duration) (*s3Store, error) {
+	if c.S3Endpoint == "" {
+		return nil, fmt.Errorf("s3-endpoint is not configured")
+	}
+
+	endpoint, err := url.Parse(c.S3Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3-endpoint %q", c.S3Endpoint)
+	}
+
+	region := c.S3Region
+	if region == "" {
+		region = defaultS3Region
+	}
+
+	client := http.DefaultClient
+	if timeout > 0 {
+		client = &http.Client{
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				DialContext:           (&net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}).DialContext,
+				TLSHandshakeTimeout:   timeout,
+				ResponseHeaderTimeout: timeout,
+			},
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &s3Store{
+		ctx:      ctx,
+		cancel:   cancel,
+		client:   client,
+		endpoint: endpoint,
+		bucket:   bucket,
+		region:   region,
+		access:   c.S3AccessKey,
+		secret:   c.S3SecretKey,
+	}, nil
+}
+
+func (s *s3Store) Open(key string, offset int64) (io.ReadCloser, error) {
+	req := s.request(http.MethodGet, key, nil)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusOK && offset > 0 {
+		// The range was ignored, skip the part that's already read.
+		_, err = io.CopyN(ioutil.Discard, resp.Body, offset)
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	}
+
+	return resp.Body, nil
+}
+
+func (s *s3Store) Size(key string) (int64, error) {
+	resp, err := s.do(s.request(http.MethodHead, key, nil))
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	return resp.ContentLength, nil
+}
+
+func (s *s3Store) List(prefix string) ([]Entry, error) {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	var (
+		entries []Entry
+		token   string
+	)
+
+	for {
+		query := url.Values{"list-type": {"2"}, "delimiter": {"/"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := s.do(s.request(http.MethodGet, "", query))
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			Contents []struct {
+				Key  string
+				Size int64
+			}
+			CommonPrefixes []struct {
+				Prefix string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed decoding listing: %v", err)
+		}
+
+		for _, p := range result.CommonPrefixes {
+			name := strings.TrimSuffix(strings.TrimPrefix(p.Prefix, prefix), "/")
+			entries = append(entries, Entry{Name: name, Folder: true})
+		}
+
+		for _, obj := range result.Contents {
+			name := strings.TrimPrefix(obj.Key, prefix)
+			if name == "" {
+				// The placeholder of the folder itself.
+				continue
+			}
+
+			entries = append(entries, Entry{Name: name, Size: obj.Size})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+
+		token = result.NextContinuationToken
+	}
+
+	if len(entries) == 0 && prefix != "" {
+		return nil, ErrNotExist
+	}
+
+	return entries, nil
+}
+
+func (s *s3Store) Close() error {
+	s.cancel()
+
+	return nil
+}
+
+// request returns the request of key in the bucket.
+func (s *s3Store) request(method, key string, query url.Values) *http.Request {
+	u := *s.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.bucket + "/" + key
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = canonicalQuery(query)
+
+	req, _ := http.NewRequest(method, u.String(), nil)
+
+	return req.WithContext(s.ctx)
+}
+
+// do signs and sends req, and turns the error responses into errors.
+func (s *s3Store) do(req *http.Request) (*http.Response, error) {
+	if s.access != "" {
+		s.sign(req, time.Now())
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	var s3err struct {
+		Code    string
+		Message string
+	}
+	xml.NewDecoder(resp.Body).Decode(&s3err)
+
+	if resp.StatusCode == http.StatusNotFound && s3err.Code != "NoSuchBucket" {
+		return nil, ErrNotExist
+	}
+
+	if s3err.Code != "" {
+		return nil, fmt.Errorf("s3: %s: %s: %s", resp.Status, s3err.Code, s3err.Message)
+	}
+
+	return nil, fmt.Errorf("s3: %s", resp.Status)
+}
+
+// sign adds the Signature Version 4 authorization to req, see
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func (s *s3Store) sign(req *http.Request, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", amzDate[:8], s.region)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptySHA256)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "range" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(req.Header.Get(name))
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptySHA256,
+	}, "\n")
+
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secret), amzDate[:8])
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.access, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+
+	return h.Sum(nil)
+}
+
+// canonicalQuery encodes the query sorted by key, the way the signature
+// expects it.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes everything but the unreserved characters, and
+// the slashes too if encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
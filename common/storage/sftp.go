@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/djavorszky/ddn/common/logger"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+type sftpStore struct {
+	conn   *ssh.Client
+	client *sftp.Client
+}
+
+func dialSFTP(u *url.URL, c Credentials, timeout time.Duration) (*sftpStore, error) {
+	user, pass := login(u, c.SFTPHost, "22", c.SFTPUser, c.SFTPPassword)
+
+	var auth []ssh.AuthMethod
+
+	if c.SFTPKeyFile != "" && sameHost(u, c.SFTPHost, "22") {
+		key, err := ioutil.ReadFile(c.SFTPKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed reading sftp-private-key: %v", err)
+		}
+
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing sftp-private-key: %v", err)
+		}
+
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+
+	if pass != "" {
+		auth = append(auth, ssh.Password(pass))
+	}
+
+	var hostKey ssh.HostKeyCallback
+
+	switch {
+	case c.SFTPKnownHosts != "":
+		var err error
+
+		hostKey, err = knownhosts.New(c.SFTPKnownHosts)
+		if err != nil {
+			return nil, fmt.Errorf("failed reading sftp-known-hosts: %v", err)
+		}
+	case c.SFTPInsecureSkipHostKey:
+		logger.Warn("Not checking the key of %s: sftp-known-hosts is blank and sftp-insecure-skip-host-key is set.", u.Host)
+
+		hostKey = ssh.InsecureIgnoreHostKey()
+	default:
+		return nil, fmt.Errorf("refusing to connect to %s without checking its key: set sftp-known-hosts", u.Host)
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "22")
+	}
+
+	conn, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: hostKey,
+		Timeout:         timeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &sftpStore{conn: conn, client: client}, nil
+}
+
+func (s *sftpStore) Open(path string, offset int64) (io.ReadCloser, error) {
+	f, err := s.client.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotExist
+		}
+
+		return nil, err
+	}
+
+	_, err = f.Seek(offset, io.SeekStart)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (s *sftpStore) Size(path string) (int64, error) {
+	fi, err := s.client.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, ErrNotExist
+		}
+
+		return 0, err
+	}
+
+	if fi.IsDir() {
+		return 0, fmt.Errorf("%s is a folder", path)
+	}
+
+	return fi.Size(), nil
+}
+
+func (s *sftpStore) List(path string) ([]Entry, error) {
+	if path == "" {
+		path = "."
+	}
+
+	list, err := s.client.ReadDir(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotExist
+		}
+
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(list))
+	for _, fi := range list {
+		entries = append(entries, Entry{Name: fi.Name(), Size: fi.Size(), Folder: fi.IsDir()})
+	}
+
+	return entries, nil
+}
+
+func (s *sftpStore) Close() error {
+	s.client.Close()
+
+	return s.conn.Close()
+}
@@ -0,0 +1,232 @@
+package storage
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestSFTPStore(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	os.Mkdir(filepath.Join(dir, "old"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "lportal.sql"), []byte("CREATE TABLE users;"), 0644)
+
+	addr, key, stop := sftpServer(t, "ddn", "secret")
+	defer stop()
+
+	hosts := knownHosts(t, addr, key)
+	defer os.Remove(hosts)
+
+	c := Credentials{SFTPHost: addr, SFTPUser: "ddn", SFTPPassword: "secret", SFTPKnownHosts: hosts}
+
+	st, path, err := Dial("sftp://"+addr+filepath.ToSlash(dir)+"/lportal.sql", c, time.Second)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer st.Close()
+
+	rc, err := st.Open(path, 7)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	got, _ := ioutil.ReadAll(rc)
+	rc.Close()
+
+	if string(got) != "TABLE users;" {
+		t.Errorf("Open() at 7 read %q, want %q", got, "TABLE users;")
+	}
+
+	if size, err := st.Size(path); err != nil || size != 19 {
+		t.Errorf("Size() = %d, %v, want 19", size, err)
+	}
+
+	if _, err := st.Open(path+".missing", 0); err != ErrNotExist {
+		t.Errorf("Open() of missing file error = %v, want ErrNotExist", err)
+	}
+
+	entries, err := st.List(filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+
+	if len(entries) != 2 {
+		t.Errorf("List() = %v, want 2 entries", entries)
+	}
+}
+
+func TestSFTPCredentials(t *testing.T) {
+	addr, key, stop := sftpServer(t, "ddn", "secret")
+	defer stop()
+
+	hosts := knownHosts(t, addr, key)
+	defer os.Remove(hosts)
+
+	// The configured credentials are not sent to the other hosts.
+	c := Credentials{SFTPHost: "files.example.com", SFTPUser: "ddn", SFTPPassword: "secret", SFTPKnownHosts: hosts}
+
+	_, _, err := Dial("sftp://"+addr+"/dump.sql", c, time.Second)
+	if err == nil {
+		t.Errorf("Dial() with the credentials of another host succeeded")
+	}
+
+	st, _, err := Dial("sftp://ddn:secret@"+addr+"/dump.sql", c, time.Second)
+	if err != nil {
+		t.Fatalf("Dial() with credentials in the location error = %v", err)
+	}
+	st.Close()
+}
+
+func TestSFTPHostKey(t *testing.T) {
+	addr, _, stop := sftpServer(t, "ddn", "secret")
+	defer stop()
+
+	loc := "sftp://ddn:secret@" + addr + "/dump.sql"
+
+	_, _, err := Dial(loc, Credentials{}, time.Second)
+	if err == nil {
+		t.Errorf("Dial() without sftp-known-hosts succeeded")
+	}
+
+	other, err := ssh.NewPublicKey(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)))
+	if err != nil {
+		t.Fatalf("NewPublicKey() error = %v", err)
+	}
+
+	hosts := knownHosts(t, addr, other)
+	defer os.Remove(hosts)
+
+	_, _, err = Dial(loc, Credentials{SFTPKnownHosts: hosts}, time.Second)
+	if err == nil {
+		t.Errorf("Dial() to a server with an unknown key succeeded")
+	}
+
+	st, _, err := Dial(loc, Credentials{SFTPInsecureSkipHostKey: true}, time.Second)
+	if err != nil {
+		t.Fatalf("Dial() with sftp-insecure-skip-host-key error = %v", err)
+	}
+	st.Close()
+}
+
+// knownHosts writes a known_hosts file that holds key for addr, and returns
+// its path.
+func knownHosts(t *testing.T, addr string, key ssh.PublicKey) string {
+	f, err := ioutil.TempFile("", "ddn-known-hosts")
+	if err != nil {
+		t.Fatalf("TempFile() error = %v", err)
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(addr)}, key))
+	if err != nil {
+		t.Fatalf("writing known_hosts error = %v", err)
+	}
+
+	return f.Name()
+}
+
+// sftpServer starts an SFTP server on a random port, which allows user to
+// log in with pass, and returns its address and its key.
+func sftpServer(t *testing.T, user, pass string) (string, ssh.PublicKey, func()) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("NewSignerFromKey() error = %v", err)
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, p []byte) (*ssh.Permissions, error) {
+			if c.User() == user && string(p) == pass {
+				return nil, nil
+			}
+
+			return nil, fmt.Errorf("access denied for %q", c.User())
+		},
+	}
+	config.AddHostKey(signer)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go serveSFTP(conn, config)
+		}
+	}()
+
+	return l.Addr().String(), signer.PublicKey(), func() { l.Close() }
+}
+
+func serveSFTP(conn net.Conn, config *ssh.ServerConfig) {
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer sconn.Close()
+
+	go ssh.DiscardRequests(reqs)
+
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+
+		ch, chReqs, err := nc.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			for req := range chReqs {
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+
+				if ok {
+					go func() {
+						srv, err := sftp.NewServer(ch)
+						if err != nil {
+							ch.Close()
+							return
+						}
+
+						srv.Serve()
+						srv.Close()
+					}()
+				}
+			}
+		}()
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "ddn-storage-test")
+	if err != nil {
+		t.Fatalf("TempDir() error = %v", err)
+	}
+
+	return dir
+}
@@ -0,0 +1,182 @@
+// Package storage reads dumps from remote storages: S3-compatible object
+// storages, SFTP and FTP servers. Locations are given as URLs, e.g.
+// s3://bucket/dumps/db.sql, sftp://user@host/home/user/db.sql or
+// ftp://host/dumps/db.sql.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotExist is returned if the file or folder doesn't exist.
+	ErrNotExist = errors.New("file does not exist")
+
+	// ErrInvalidLocation is returned if the location is not a valid URL
+	// of a supported storage.
+	ErrInvalidLocation = errors.New("invalid location")
+)
+
+// Credentials to access the remote storages. The SFTP and FTP credentials
+// are only sent to the configured host, the locations on other hosts need
+// to hold their own username and password, which take precedence anyway.
+type Credentials struct {
+	// S3Endpoint is the url of the S3-compatible service, e.g.
+	// https://s3.eu-west-1.amazonaws.com or http://localhost:9000.
+	S3Endpoint  string `toml:"s3-endpoint"`
+	S3Region    string `toml:"s3-region"`
+	S3AccessKey string `toml:"s3-access-key"`
+	S3SecretKey string `toml:"s3-secret-key"`
+
+	// SFTPHost is the host, optionally with the port, that the SFTP
+	// credentials are used for.
+	SFTPHost     string `toml:"sftp-host"`
+	SFTPUser     string `toml:"sftp-username"`
+	SFTPPassword string `toml:"sftp-password"`
+
+	// SFTPKeyFile is the path of the private key to log in with.
+	SFTPKeyFile string `toml:"sftp-private-key"`
+
+	// SFTPKnownHosts is the path of the known_hosts file to check the
+	// keys of the servers against. If empty, the servers are not connected
+	// to, unless SFTPInsecureSkipHostKey is set.
+	SFTPKnownHosts string `toml:"sftp-known-hosts"`
+
+	// SFTPInsecureSkipHostKey allows connecting to the servers without
+	// checking their keys when SFTPKnownHosts is empty.
+	SFTPInsecureSkipHostKey bool `toml:"sftp-insecure-skip-host-key"`
+
+	// FTPHost is the host, optionally with the port, that the FTP
+	// credentials are used for.
+	FTPHost     string `toml:"ftp-host"`
+	FTPUser     string `toml:"ftp-username"`
+	FTPPassword string `toml:"ftp-password"`
+}
+
+// Entry is a file or a folder in a storage.
+type Entry struct {
+	Name   string
+	Size   int64
+	Folder bool
+}
+
+// Store is a connection to a remote storage.
+type Store interface {
+	// Open returns the contents of the file at path, starting at offset.
+	Open(path string, offset int64) (io.ReadCloser, error)
+
+	// Size returns the size of the file at path.
+	Size(path string) (int64, error)
+
+	// List returns the files and folders in the folder at path.
+	List(path string) ([]Entry, error)
+
+	// Close closes the connection. It interrupts the running reads.
+	Close() error
+}
+
+// Supported returns whether loc is the location of a remote storage.
+func Supported(loc string) bool {
+	i := strings.Index(loc, "://")
+	if i < 0 {
+		return false
+	}
+
+	switch strings.ToLower(loc[:i]) {
+	case "s3", "sftp", "ftp":
+		return true
+	}
+
+	return false
+}
+
+// Dial connects to the storage of loc, and returns it along with the path
+// of loc inside the storage. Connecting times out after timeout, if it's
+// positive.
+func Dial(loc string, c Credentials, timeout time.Duration) (Store, string, error) {
+	u, err := url.Parse(loc)
+	if err != nil || u.Host == "" {
+		return nil, "", fmt.Errorf("%w: %s", ErrInvalidLocation, loc)
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "s3":
+		st, err := dialS3(u.Host, c, timeout)
+		return st, strings.TrimPrefix(u.Path, "/"), err
+	case "sftp":
+		st, err := dialSFTP(u, c, timeout)
+		return st, u.Path, err
+	case "ftp":
+		st, err := dialFTP(u, c, timeout)
+		return st, strings.TrimPrefix(u.Path, "/"), err
+	}
+
+	return nil, "", fmt.Errorf("%w: %s", ErrInvalidLocation, loc)
+}
+
+// login returns the username and password to log in to the host of u with:
+// the ones in u, or the configured ones if u is on host.
+func login(u *url.URL, host, defaultPort, user, pass string) (string, string) {
+	if u.User != nil {
+		p, _ := u.User.Password()
+		return u.User.Username(), p
+	}
+
+	if !sameHost(u, host, defaultPort) {
+		return "", ""
+	}
+
+	return user, pass
+}
+
+// sameHost returns whether u is on host, which may omit the default port.
+func sameHost(u *url.URL, host, defaultPort string) bool {
+	if host == "" {
+		return false
+	}
+
+	h, port, err := net.SplitHostPort(host)
+	if err != nil {
+		h, port = host, defaultPort
+	}
+
+	uport := u.Port()
+	if uport == "" {
+		uport = defaultPort
+	}
+
+	return strings.EqualFold(h, u.Hostname()) && port == uport
+}
+
+// Join returns the location of the entry called name in the folder at loc.
+func Join(loc, name string) string {
+	return strings.TrimSuffix(loc, "/") + "/" + name
+}
+
+// Parent returns the location of the folder containing loc, and false if
+// loc is the root of its storage.
+func Parent(loc string) (string, bool) {
+	u, err := url.Parse(loc)
+	if err != nil {
+		return "", false
+	}
+
+	p := strings.TrimSuffix(u.Path, "/")
+	if p == "" {
+		return "", false
+	}
+
+	u.Path = path.Dir(p)
+	if u.Path == "/" || u.Path == "." {
+		u.Path = ""
+	}
+
+	return u.String(), true
+}
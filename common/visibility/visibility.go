@@ -4,4 +4,7 @@ package vis
 var (
 	Private = 0
 	Public  = 1
+
+	// Team databases are shared with the members of their team.
+	Team = 2
 )
@@ -0,0 +1,524 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/djavorszky/ddn/client"
+	"github.com/djavorszky/ddn/common/model"
+	vis "github.com/djavorszky/ddn/common/visibility"
+	"github.com/djavorszky/ddn/server/database/data"
+)
+
+// newFlagSet returns a FlagSet for the named command that prints the
+// command's usage on error.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ddnctl %s\n", commands[name].usage)
+		fs.PrintDefaults()
+	}
+
+	return fs
+}
+
+func agentsCmd(ctx context.Context, c *client.Client, args []string) error {
+	fs := newFlagSet("agents")
+	all := fs.Bool("all", false, "List agents that are down as well")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var (
+		agents []model.Agent
+		err    error
+	)
+
+	if *all {
+		agents, err = c.ListAgents(ctx)
+	} else {
+		agents, err = c.ListActiveAgents(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	return printAgents(os.Stdout, agents)
+}
+
+func drainCmd(ctx context.Context, c *client.Client, args []string) error {
+	fs := newFlagSet("drain")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected 1 argument(s), got %d", fs.NArg())
+	}
+
+	err := c.DrainAgent(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Agent %s is draining\n", fs.Arg(0))
+
+	return nil
+}
+
+func listCmd(ctx context.Context, c *client.Client, args []string) error {
+	var query data.DatabaseQuery
+
+	fs := newFlagSet("list")
+	fs.StringVar(&query.Agent, "agent", "", "Only list the databases on this agent")
+	fs.StringVar(&query.Vendor, "vendor", "", "Only list the databases of this vendor")
+	fs.IntVar(&query.Status, "status", 0, "Only list the databases with this status code")
+	fs.StringVar(&query.Creator, "creator", "", "Only list the databases created by this user")
+	fs.StringVar(&query.Name, "name", "", "Only list the databases whose name contains this")
+	fs.StringVar(&query.Tag, "tag", "", "Only list the databases with this tag")
+	fs.StringVar(&query.Search, "search", "", "Only list the databases whose name, tags, comment or virtual hosts contain this")
+	fs.StringVar(&query.Sort, "sort", "", "Sort by id, name, agent, vendor, status, creator, created or expiry. Prefix with - for descending order")
+	expiring := fs.Duration("expiring", 0, "Only list the databases expiring within this duration, e.g. 72h")
+	page := fs.Int("page", 1, "The page to list if -limit is set")
+	fs.IntVar(&query.Limit, "limit", 0, "The number of databases on a page")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *expiring != 0 {
+		query.ExpiringBefore = time.Now().Add(*expiring)
+	}
+
+	if *page > 1 {
+		query.Offset = (*page - 1) * query.Limit
+	}
+
+	rows, err := c.FindDatabases(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return printRows(os.Stdout, rows)
+}
+
+func getCmd(ctx context.Context, c *client.Client, args []string) error {
+	fs := newFlagSet("get")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	id, err := idArg(fs, 1)
+	if err != nil {
+		return err
+	}
+
+	row, err := c.Database(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return printRow(os.Stdout, row)
+}
+
+func createCmd(ctx context.Context, c *client.Client, args []string) error {
+	fs := newFlagSet("create")
+	req := requestFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if req.AgentIdentifier == "" {
+		fs.Usage()
+		return fmt.Errorf("missing -agent")
+	}
+
+	row, err := c.CreateDatabase(ctx, *req)
+	if err != nil {
+		return err
+	}
+
+	return printRow(os.Stdout, row)
+}
+
+func importCmd(ctx context.Context, c *client.Client, args []string) error {
+	fs := newFlagSet("import")
+	req := requestFlags(fs)
+	fs.StringVar(&req.DumpLocation, "dump", "", "URL of the dump, or its path relative to the mounted folder of the server")
+	file := fs.String("file", "", "Path of a local dump to upload to the server instead of -dump")
+	fs.StringVar(&req.Anonymize, "anonymize", "", "Name of the rule set to anonymize the database with after the import")
+	fs.Var((*listFlag)(&req.PostImport), "scripts", "Comma separated post-import script sets to run after the import, e.g. reset-admin,clear-locks")
+	wait := fs.Bool("wait", false, "Wait for the import to finish")
+	interval := fs.Duration("interval", 5*time.Second, "How often to check the status while waiting")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if req.AgentIdentifier == "" || (req.DumpLocation == "") == (*file == "") {
+		fs.Usage()
+		return fmt.Errorf("missing -agent, or not exactly one of -dump and -file")
+	}
+
+	if *file != "" {
+		fmt.Fprintf(os.Stderr, "Uploading %s...\n", *file)
+
+		upload, err := c.UploadFile(ctx, *file, 0)
+		if err != nil {
+			return fmt.Errorf("uploading %s failed: %v", *file, err)
+		}
+
+		req.UploadID = upload.ID
+	}
+
+	row, err := c.ImportDatabase(ctx, *req)
+	if err != nil {
+		return err
+	}
+
+	if !*wait {
+		return printRow(os.Stdout, row)
+	}
+
+	return waitFor(ctx, c, row.ID, *interval)
+}
+
+func waitCmd(ctx context.Context, c *client.Client, args []string) error {
+	fs := newFlagSet("wait")
+	interval := fs.Duration("interval", 5*time.Second, "How often to check the status")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	id, err := idArg(fs, 1)
+	if err != nil {
+		return err
+	}
+
+	return waitFor(ctx, c, id, *interval)
+}
+
+// waitFor waits for the database to finish importing, displaying the
+// progress on stderr. Returns an error if the import failed.
+func waitFor(ctx context.Context, c *client.Client, id int, interval time.Duration) error {
+	row, err := c.WaitForStatus(ctx, id, interval, func(row data.Row) {
+		printProgress(os.Stderr, row)
+	})
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	if row.IsErr() {
+		if row.ScriptOutput != "" {
+			fmt.Fprintln(os.Stderr, row.ScriptOutput)
+		}
+
+		return fmt.Errorf("import of %q failed: %s", row.DBName, row.Message)
+	}
+
+	return printRow(os.Stdout, row)
+}
+
+func dropCmd(ctx context.Context, c *client.Client, args []string) error {
+	fs := newFlagSet("drop")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	id, err := idArg(fs, 1)
+	if err != nil {
+		return err
+	}
+
+	err = c.Drop(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Database %d dropped\n", id)
+
+	return nil
+}
+
+func recreateCmd(ctx context.Context, c *client.Client, args []string) error {
+	fs := newFlagSet("recreate")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	id, err := idArg(fs, 1)
+	if err != nil {
+		return err
+	}
+
+	row, err := c.Recreate(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return printRow(os.Stdout, row)
+}
+
+func extendCmd(ctx context.Context, c *client.Client, args []string) error {
+	fs := newFlagSet("extend")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	id, err := idArg(fs, 3)
+	if err != nil {
+		return err
+	}
+
+	amount, err := strconv.Atoi(fs.Arg(1))
+	if err != nil || amount < 1 {
+		fs.Usage()
+		return fmt.Errorf("invalid amount: %q", fs.Arg(1))
+	}
+
+	expiry, err := c.Extend(ctx, id, amount, fs.Arg(2))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Database %d now expires on %s\n", id, expiry.Format(dateFormat))
+
+	return nil
+}
+
+func visibilityCmd(ctx context.Context, c *client.Client, args []string) error {
+	fs := newFlagSet("visibility")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	id, err := idArg(fs, 2)
+	if err != nil {
+		return err
+	}
+
+	arg := fs.Arg(1)
+
+	if strings.HasPrefix(arg, "team:") {
+		team, err := strconv.Atoi(strings.TrimPrefix(arg, "team:"))
+		if err != nil {
+			fs.Usage()
+			return fmt.Errorf("invalid team id: %q", arg)
+		}
+
+		err = c.ShareWithTeam(ctx, id, team)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Database %d is now shared with team %d\n", id, team)
+
+		return nil
+	}
+
+	var visibility int
+	switch arg {
+	case "public":
+		visibility = vis.Public
+	case "private":
+		visibility = vis.Private
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown visibility: %q", arg)
+	}
+
+	err = c.SetVisibility(ctx, id, visibility)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Database %d is now %s\n", id, fs.Arg(1))
+
+	return nil
+}
+
+func transferCmd(ctx context.Context, c *client.Client, args []string) error {
+	fs := newFlagSet("transfer")
+	leave := fs.Bool("leave", false, "Don't stay a co-owner of the database")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	id, err := idArg(fs, 2)
+	if err != nil {
+		return err
+	}
+
+	row, err := c.TransferOwnership(ctx, id, fs.Arg(1), *leave)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Database %d is now owned by %s\n", id, row.Creator)
+
+	return nil
+}
+
+func coOwnerCmd(ctx context.Context, c *client.Client, args []string) error {
+	fs := newFlagSet("coowner")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	id, err := idArg(fs, 3)
+	if err != nil {
+		return err
+	}
+
+	var row data.Row
+	switch fs.Arg(1) {
+	case "add":
+		row, err = c.AddCoOwner(ctx, id, fs.Arg(2))
+	case "remove":
+		row, err = c.RemoveCoOwner(ctx, id, fs.Arg(2))
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown action: %q", fs.Arg(1))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return printRow(os.Stdout, row)
+}
+
+func tagCmd(ctx context.Context, c *client.Client, args []string) error {
+	fs := newFlagSet("tag")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	id, err := idArg(fs, 3)
+	if err != nil {
+		return err
+	}
+
+	var row data.Row
+	switch fs.Arg(1) {
+	case "add":
+		row, err = c.AddTag(ctx, id, fs.Arg(2))
+	case "remove":
+		row, err = c.RemoveTag(ctx, id, fs.Arg(2))
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown action: %q", fs.Arg(1))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return printRow(os.Stdout, row)
+}
+
+func commentCmd(ctx context.Context, c *client.Client, args []string) error {
+	fs := newFlagSet("comment")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	id, err := idArg(fs, 2)
+	if err != nil {
+		return err
+	}
+
+	row, err := c.SetComment(ctx, id, fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	return printRow(os.Stdout, row)
+}
+
+func accessCmd(ctx context.Context, c *client.Client, args []string) error {
+	fs := newFlagSet("access")
+	format := fs.String("format", "properties", "Output format, one of properties, env or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var (
+		info client.AccessInfo
+		err  error
+	)
+
+	switch fs.NArg() {
+	case 1:
+		var id int
+
+		id, err = idArg(fs, 1)
+		if err != nil {
+			return err
+		}
+
+		info, err = c.AccessInfo(ctx, id)
+	case 2:
+		info, err = c.AccessInfoByName(ctx, fs.Arg(0), fs.Arg(1))
+	default:
+		fs.Usage()
+		return fmt.Errorf("expected an id or an agent and a database name")
+	}
+	if err != nil {
+		return err
+	}
+
+	return printAccess(os.Stdout, info, *format)
+}
+
+// requestFlags registers the flags shared by create and import.
+func requestFlags(fs *flag.FlagSet) *model.ClientRequest {
+	var req model.ClientRequest
+
+	fs.StringVar(&req.AgentIdentifier, "agent", "", "Shortname of the agent to use")
+	fs.StringVar(&req.DatabaseName, "name", "", "Name of the database. Generated if empty.")
+	fs.StringVar(&req.Username, "user", "", "Name of the database user. Generated if empty.")
+	fs.StringVar(&req.Password, "pass", "", "Password of the database user. Generated if empty.")
+	fs.Var((*listFlag)(&req.Tags), "tags", "Comma separated tags of the database, e.g. LPS-12345,acme")
+	fs.StringVar(&req.Comment, "comment", "", "Comment on the database")
+
+	return &req
+}
+
+// listFlag is a flag that holds a comma separated list.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	if l == nil {
+		return ""
+	}
+
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = strings.Split(value, ",")
+
+	return nil
+}
+
+// idArg checks that the command received exactly n positional arguments
+// and returns the first one as a database id.
+func idArg(fs *flag.FlagSet, n int) (int, error) {
+	if fs.NArg() != n {
+		fs.Usage()
+		return 0, fmt.Errorf("expected %d argument(s), got %d", n, fs.NArg())
+	}
+
+	id, err := strconv.Atoi(fs.Arg(0))
+	if err != nil {
+		return 0, fmt.Errorf("invalid id: %q", fs.Arg(0))
+	}
+
+	return id, nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+
+	"github.com/djavorszky/ddn/client"
+	"github.com/djavorszky/ddn/common/model"
+	vis "github.com/djavorszky/ddn/common/visibility"
+	"github.com/djavorszky/ddn/server/database/data"
+)
+
+const (
+	dateFormat  = "2006-01-02"
+	progressLen = 30
+)
+
+func printAgents(w io.Writer, agents []model.Agent) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "NAME\tVENDOR\tADDRESS\tVERSION\tUP")
+	for _, a := range agents {
+		fmt.Fprintf(tw, "%s\t%s\t%s:%s\t%s\t%t\n", a.ShortName, a.DBVendor, a.DBAddr, a.DBPort, a.Version, a.Up)
+	}
+
+	return tw.Flush()
+}
+
+func printRows(w io.Writer, rows []data.Row) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "ID\tNAME\tAGENT\tVENDOR\tSTATUS\tCREATOR\tVISIBILITY\tEXPIRES")
+	for _, r := range rows {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.ID, r.DBName, r.AgentName, r.DBVendor,
+			r.StatusLabel(), r.Creator, visibilityLabel(r.Public), r.ExpiryDate.Format(dateFormat))
+	}
+
+	return tw.Flush()
+}
+
+func printRow(w io.Writer, r data.Row) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 1, ' ', 0)
+
+	fmt.Fprintf(tw, "ID:\t%d\n", r.ID)
+	fmt.Fprintf(tw, "Name:\t%s\n", r.DBName)
+	fmt.Fprintf(tw, "User:\t%s\n", r.DBUser)
+	fmt.Fprintf(tw, "Password:\t%s\n", r.DBPass)
+	fmt.Fprintf(tw, "Agent:\t%s\n", r.AgentName)
+	fmt.Fprintf(tw, "Vendor:\t%s\n", r.DBVendor)
+	fmt.Fprintf(tw, "Address:\t%s:%s\n", r.DBAddress, r.DBPort)
+	fmt.Fprintf(tw, "Status:\t%s\n", r.StatusLabel())
+	if r.Message != "" {
+		fmt.Fprintf(tw, "Message:\t%s\n", r.Message)
+	}
+	fmt.Fprintf(tw, "Creator:\t%s\n", r.Creator)
+	if len(r.CoOwners) != 0 {
+		fmt.Fprintf(tw, "Co-owners:\t%s\n", strings.Join(r.CoOwners, ", "))
+	}
+	fmt.Fprintf(tw, "Visibility:\t%s\n", visibilityLabel(r.Public))
+	if len(r.Tags) != 0 {
+		fmt.Fprintf(tw, "Tags:\t%s\n", strings.Join(r.Tags, ", "))
+	}
+	if r.Comment != "" {
+		fmt.Fprintf(tw, "Comment:\t%s\n", r.Comment)
+	}
+	if lr := r.Liferay; lr.Known() {
+		fmt.Fprintf(tw, "Liferay:\t%s (build %d)\n", lr.Version(), lr.BuildNumber)
+		if lr.SchemaVersion != "" {
+			fmt.Fprintf(tw, "Schema version:\t%s\n", lr.SchemaVersion)
+		}
+		fmt.Fprintf(tw, "Companies:\t%d\n", lr.Companies)
+		if len(lr.VirtualHosts) != 0 {
+			fmt.Fprintf(tw, "Virtual hosts:\t%s\n", strings.Join(lr.VirtualHosts, ", "))
+		}
+	}
+	fmt.Fprintf(tw, "Created:\t%s\n", r.CreateDate.Format(dateFormat))
+	fmt.Fprintf(tw, "Expires:\t%s\n", r.ExpiryDate.Format(dateFormat))
+
+	err := tw.Flush()
+	if err != nil || r.ScriptOutput == "" {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "\nScript output:\n%s\n", r.ScriptOutput)
+
+	return err
+}
+
+// printProgress overwrites the current line of w with a progress bar of the row.
+func printProgress(w io.Writer, r data.Row) {
+	done := r.Progress() * progressLen / 100
+
+	fmt.Fprintf(w, "\r[%s%s] %3d%% %-30s", strings.Repeat("#", done), strings.Repeat(" ", progressLen-done), r.Progress(), r.StatusLabel())
+}
+
+// printAccess prints the connection details in the given format:
+//
+// properties: portal-ext.properties entries
+// env: shell exports of the same properties, using Liferay's env variable naming
+// json: the access info as a JSON object
+func printAccess(w io.Writer, info client.AccessInfo, format string) error {
+	props := [][2]string{
+		{"jdbc.default.driverClassName", info.JDBCDriver},
+		{"jdbc.default.url", info.JDBCUrl},
+		{"jdbc.default.username", info.User},
+		{"jdbc.default.password", info.Password},
+	}
+
+	switch format {
+	case "properties":
+		for _, p := range props {
+			fmt.Fprintf(w, "%s=%s\n", p[0], p[1])
+		}
+	case "env":
+		for _, p := range props {
+			fmt.Fprintf(w, "export %s=%s\n", liferayEnv(p[0]), shellQuote(p[1]))
+		}
+	case "json":
+		b, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			return fmt.Errorf("encoding json failed: %v", err)
+		}
+
+		fmt.Fprintf(w, "%s\n", b)
+	default:
+		return fmt.Errorf("unknown format: %q", format)
+	}
+
+	return nil
+}
+
+// liferayEnv converts a portal property key to the env variable that
+// overrides it, e.g. jdbc.default.url -> LIFERAY_JDBC_PERIOD_DEFAULT_PERIOD_URL
+func liferayEnv(key string) string {
+	var b bytes.Buffer
+
+	b.WriteString("LIFERAY_")
+	for _, r := range key {
+		switch {
+		case r == '.':
+			b.WriteString("_PERIOD_")
+		case unicode.IsUpper(r):
+			b.WriteString("_UPPERCASE")
+			b.WriteRune(r)
+			b.WriteString("_")
+		default:
+			b.WriteRune(unicode.ToUpper(r))
+		}
+	}
+
+	return b.String()
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func visibilityLabel(v int) string {
+	switch v {
+	case vis.Public:
+		return "public"
+	case vis.Team:
+		return "team"
+	}
+
+	return "private"
+}
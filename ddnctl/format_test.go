@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/djavorszky/ddn/client"
+)
+
+func Test_liferayEnv(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"jdbc.default.url", "LIFERAY_JDBC_PERIOD_DEFAULT_PERIOD_URL"},
+		{"jdbc.default.driverClassName", "LIFERAY_JDBC_PERIOD_DEFAULT_PERIOD_DRIVER_UPPERCASEC_LASS_UPPERCASEN_AME"},
+		{"jdbc.default.password", "LIFERAY_JDBC_PERIOD_DEFAULT_PERIOD_PASSWORD"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := liferayEnv(tt.key); got != tt.want {
+				t.Errorf("liferayEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_printAccess(t *testing.T) {
+	info := client.AccessInfo{
+		JDBCDriver: "com.mysql.jdbc.Driver",
+		JDBCUrl:    "jdbc:mysql://localhost:3306/testdb",
+		User:       "testuser",
+		Password:   "it's",
+		URL:        "localhost:3306",
+	}
+
+	tests := []struct {
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{"properties", `jdbc.default.driverClassName=com.mysql.jdbc.Driver
+jdbc.default.url=jdbc:mysql://localhost:3306/testdb
+jdbc.default.username=testuser
+jdbc.default.password=it's
+`, false},
+		{"env", `export LIFERAY_JDBC_PERIOD_DEFAULT_PERIOD_DRIVER_UPPERCASEC_LASS_UPPERCASEN_AME='com.mysql.jdbc.Driver'
+export LIFERAY_JDBC_PERIOD_DEFAULT_PERIOD_URL='jdbc:mysql://localhost:3306/testdb'
+export LIFERAY_JDBC_PERIOD_DEFAULT_PERIOD_USERNAME='testuser'
+export LIFERAY_JDBC_PERIOD_DEFAULT_PERIOD_PASSWORD='it'\''s'
+`, false},
+		{"json", `{
+  "jdbc-driver": "com.mysql.jdbc.Driver",
+  "jdbc-url": "jdbc:mysql://localhost:3306/testdb",
+  "user": "testuser",
+  "password": "it's",
+  "url": "localhost:3306"
+}
+`, false},
+		{"yaml", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			err := printAccess(&buf, info, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("printAccess() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if got := buf.String(); got != tt.want {
+				t.Errorf("printAccess() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+// Command ddnctl is a command-line client for the v2 API of the ddn server.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+
+	"github.com/djavorszky/ddn/client"
+)
+
+const version = "1"
+
+// command is a subcommand of ddnctl. run receives the arguments
+// after the name of the command.
+type command struct {
+	usage string
+	desc  string
+	run   func(ctx context.Context, c *client.Client, args []string) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"agents":     {"agents [-all]", "List the agents that are up, or all of them", agentsCmd},
+		"drain":      {"drain <agent>", "Stop an agent once its running imports finished (admins only)", drainCmd},
+		"list":       {"list [-agent <agent>] [-vendor <vendor>] [-status <code>] [-creator <email>] [-name <text>] [-tag <tag>] [-search <text>] [-expiring <duration>] [-sort <field>] [-limit <n> [-page <n>]]", "List your databases, the public ones and the ones shared with your teams", listCmd},
+		"get":        {"get <id>", "Show a database", getCmd},
+		"create":     {"create -agent <agent> [-name <dbname>] [-user <dbuser>] [-pass <dbpass>] [-tags <tags>] [-comment <text>]", "Create an empty database", createCmd},
+		"import":     {"import -agent <agent> (-dump <location> | -file <path>) [-anonymize <rules>] [-scripts <sets>] [-name <dbname>] [-user <dbuser>] [-pass <dbpass>] [-tags <tags>] [-comment <text>] [-wait]", "Import a dump into a new database", importCmd},
+		"wait":       {"wait [-interval <duration>] <id>", "Wait for an import to finish", waitCmd},
+		"drop":       {"drop <id>", "Drop a database", dropCmd},
+		"recreate":   {"recreate <id>", "Drop a database and create an empty one with the same credentials", recreateCmd},
+		"extend":     {"extend <id> <amount> <days|months|years>", "Extend the expiry date of a database", extendCmd},
+		"visibility": {"visibility <id> <public|private|team:<team-id>>", "Change who can see a database", visibilityCmd},
+		"transfer":   {"transfer [-leave] <id> <email>", "Transfer the ownership of a database", transferCmd},
+		"coowner":    {"coowner <id> <add|remove> <email>", "Add or remove a co-owner of a database", coOwnerCmd},
+		"tag":        {"tag <id> <add|remove> <tag>", "Add or remove a tag of a database", tagCmd},
+		"comment":    {"comment <id> <text>", "Replace the comment on a database", commentCmd},
+		"access":     {"access [-format properties|env|json] <id> | <agent> <dbname>", "Print the connection details of a database", accessCmd},
+	}
+}
+
+func main() {
+	server := flag.String("s", envOr("DDN_SERVER", "http://localhost:7010"), "Address of the ddn server. Defaults to $DDN_SERVER if set.")
+	token := flag.String("t", os.Getenv("DDN_TOKEN"), "Token (email address) used to authenticate. Defaults to $DDN_TOKEN.")
+	showVersion := flag.Bool("version", false, "Print the version and exit")
+
+	flag.Usage = usage
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Printf("ddnctl version %s\n", version)
+		return
+	}
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "ddnctl: unknown command %q\n\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	if *token == "" {
+		fmt.Fprintln(os.Stderr, "ddnctl: no token specified, use -t or set $DDN_TOKEN")
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		cancel()
+	}()
+
+	err := cmd.run(ctx, client.New(*server, *token), flag.Args()[1:])
+	if err == flag.ErrHelp {
+		return
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ddnctl %s: %v\n", flag.Arg(0), err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: ddnctl [-s server] [-t token] <command> [arguments]\n\nCommands:\n")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", name, commands[name].desc)
+	}
+
+	fmt.Fprintf(os.Stderr, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+func envOr(key, def string) string {
+	if val := os.Getenv(key); val != "" {
+		return val
+	}
+
+	return def
+}
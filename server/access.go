@@ -0,0 +1,110 @@
+package main
+
+import (
+	"github.com/djavorszky/ddn/common/logger"
+	vis "github.com/djavorszky/ddn/common/visibility"
+	"github.com/djavorszky/ddn/server/database/data"
+)
+
+// getRole returns the role of the user. The admins in the configuration
+// are always admins, and users without a stored role are members.
+func getRole(user string) string {
+	for _, admin := range config.AdminEmail {
+		if admin == user {
+			return data.RoleAdmin
+		}
+	}
+
+	stored, err := db.FetchUser(user)
+	if err != nil {
+		logger.Error("failed fetching role of %q: %v", user, err)
+		return data.RoleReadOnly
+	}
+
+	if stored.Role == "" {
+		return data.RoleMember
+	}
+
+	return stored.Role
+}
+
+// isAdmin returns true if the user has the admin role.
+func isAdmin(user string) bool {
+	return getRole(user) == data.RoleAdmin
+}
+
+// canWrite returns true if the user is allowed to create or change
+// anything, i.e. is not read-only.
+func canWrite(user string) bool {
+	return user != "" && getRole(user) != data.RoleReadOnly
+}
+
+// inTeam returns true if the user is a member of the team.
+func inTeam(teamID int, user string) bool {
+	team, err := db.FetchTeamByID(teamID)
+	if err != nil {
+		logger.Error("failed fetching team %d: %v", teamID, err)
+		return false
+	}
+
+	return team.HasMember(user)
+}
+
+// hasAccess returns true if the user can see the database: it is public,
+// shared with one of the user's teams, owned by the user, or the user
+// is an admin.
+func hasAccess(meta data.Row, user string) bool {
+	switch {
+	case meta.IsOwner(user), meta.Public == vis.Public:
+		return true
+	case meta.Public == vis.Team && inTeam(meta.Team, user):
+		return true
+	}
+
+	return isAdmin(user)
+}
+
+// canModify returns true if the user can change or drop the database: the
+// user is its creator or a co-owner, it is shared with one of their teams,
+// or the user is an admin. Read-only users can't modify anything.
+func canModify(meta data.Row, user string) bool {
+	if !canWrite(user) {
+		return false
+	}
+
+	if meta.IsOwner(user) || (meta.Public == vis.Team && inTeam(meta.Team, user)) {
+		return true
+	}
+
+	return isAdmin(user)
+}
+
+// canManageOwners returns true if the user can transfer the database or
+// change its co-owners: only its creator and the admins can.
+func canManageOwners(meta data.Row, user string) bool {
+	if !canWrite(user) {
+		return false
+	}
+
+	return meta.Creator == user || isAdmin(user)
+}
+
+// fetchTeamDatabases returns the databases shared with the teams of the user.
+func fetchTeamDatabases(user string) ([]data.Row, error) {
+	teams, err := db.FetchTeamsByMember(user)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []data.Row
+	for _, team := range teams {
+		shared, err := db.FetchByTeam(team.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		rows = append(rows, shared...)
+	}
+
+	return rows, nil
+}
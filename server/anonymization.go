@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/djavorszky/ddn/common/anonymize"
+	"github.com/djavorszky/ddn/common/errs"
+	"github.com/djavorszky/ddn/common/inet"
+	"github.com/djavorszky/ddn/common/logger"
+)
+
+// getRuleSet loads the anonymization rule set called name from
+// config.AnonymizationDir, to be sent to the agent with the import.
+func getRuleSet(name string) (*anonymize.RuleSet, errResult) {
+	if config.AnonymizationDir == "" {
+		return nil, errResult{
+			httpStatus: http.StatusBadRequest,
+			errors:     []string{errs.RuleSetNotFound, name},
+		}
+	}
+
+	rs, err := anonymize.Load(config.AnonymizationDir, name)
+	if err == anonymize.ErrNotFound {
+		return nil, errResult{
+			httpStatus: http.StatusBadRequest,
+			errors:     []string{errs.RuleSetNotFound, name},
+		}
+	}
+
+	if err != nil {
+		logger.Error("Loading rule set %q failed: %v", name, err)
+
+		return nil, errResult{
+			httpStatus: http.StatusInternalServerError,
+			errors:     []string{errs.RuleSetInvalid, err.Error()},
+		}
+	}
+
+	return &rs, errResult{}
+}
+
+// getAPIRuleSets lists the anonymization rule sets imports can be
+// anonymized with.
+func getAPIRuleSets(w http.ResponseWriter, r *http.Request) {
+	_, err := getAPIUser(r)
+	if err != nil {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	sets := []anonymize.RuleSet{}
+	if config.AnonymizationDir != "" {
+		sets, err = anonymize.List(config.AnonymizationDir)
+		if err != nil {
+			inet.SendFailure(w, http.StatusInternalServerError, errs.RuleSetInvalid, err.Error())
+
+			logger.Error("Listing rule sets failed: %v", err)
+			return
+		}
+	}
+
+	inet.SendSuccess(w, http.StatusOK, sets)
+}
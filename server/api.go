@@ -11,10 +11,11 @@ import (
 	"github.com/djavorszky/ddn/common/inet"
 	"github.com/djavorszky/ddn/common/logger"
 	"github.com/djavorszky/ddn/common/model"
+	"github.com/djavorszky/ddn/common/srv"
 	"github.com/djavorszky/ddn/common/status"
-	"github.com/djavorszky/ddn/common/visibility"
 	"github.com/djavorszky/ddn/server/database/data"
 	"github.com/djavorszky/ddn/server/registry"
+	"github.com/djavorszky/ddn/server/webhook"
 	"github.com/djavorszky/liferay"
 	"github.com/djavorszky/sutils"
 	"github.com/gorilla/mux"
@@ -48,7 +49,7 @@ func apiList(w http.ResponseWriter, r *http.Request) {
 func apiListAgents(w http.ResponseWriter, r *http.Request) {
 	list := make(map[string]model.Agent, 10)
 	for _, agent := range registry.List() {
-		list[agent.ShortName] = agent
+		list[agent.ShortName] = agent.Public()
 	}
 
 	msg := inet.StructMessage{Status: status.Success, Message: list}
@@ -103,6 +104,28 @@ func apiListDatabases(w http.ResponseWriter, r *http.Request) {
 		databases[db.ID] = db
 	}
 
+	// Get the ones shared with the user's teams
+	dbs, err = fetchTeamDatabases(user)
+	if err != nil {
+		inet.SendResponse(w, http.StatusInternalServerError, inet.Message{
+			Status:  http.StatusInternalServerError,
+			Message: errs.QueryFailed,
+		})
+
+		logger.Error("Fetching team dbs failed: %v", err)
+		return
+	}
+
+	for _, db := range dbs {
+		databases[db.ID] = db
+	}
+
+	// The passwords are only served by the access info calls.
+	for id, row := range databases {
+		row.DBPass = ""
+		databases[id] = row
+	}
+
 	msg := inet.StructMessage{Status: http.StatusOK, Message: databases}
 
 	inet.SendResponse(w, http.StatusOK, msg)
@@ -134,6 +157,14 @@ func apiCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !canWrite(req.RequesterEmail) {
+		inet.SendResponse(w, http.StatusForbidden, inet.Message{
+			Status:  http.StatusForbidden,
+			Message: errs.AccessDenied,
+		})
+		return
+	}
+
 	agent, ok := registry.Get(req.AgentIdentifier)
 	if !ok {
 		logger.Error("Agent %q not found", req.AgentIdentifier)
@@ -143,6 +174,15 @@ func apiCreate(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	agent = agent.WithRequestID(srv.RequestID(r))
+
+	if agent.Draining {
+		inet.SendResponse(w, http.StatusServiceUnavailable, inet.Message{
+			Status:  status.AgentDraining,
+			Message: errs.AgentDraining,
+		})
+		return
+	}
 
 	if req.DatabaseName == "" && req.Username != "" {
 		req.DatabaseName = req.Username
@@ -189,6 +229,9 @@ func apiCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	fireEvent(webhook.DatabaseCreated, dbe)
+	audit(dbe.Creator, auditCreate, dbe, "")
+
 	resp, err := json.Marshal(dbe)
 	if err != nil {
 		logger.Error("json marshal failed: %v", err)
@@ -325,6 +368,8 @@ func apiSaveSubscription(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	writeAudit(data.AuditEntry{User: userCookie.Value, Action: auditSubscribe, Details: subscription.Endpoint})
+
 	msg := inet.Message{Status: status.Success, Message: fmt.Sprintf("Subscription has been saved to back end.")}
 
 	inet.SendResponse(w, http.StatusOK, msg)
@@ -380,6 +425,8 @@ func apiRemoveSubscription(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	writeAudit(data.AuditEntry{User: userCookie.Value, Action: auditUnsubscribe, Details: subscription.Endpoint})
+
 	msg := inet.Message{Status: status.Success, Message: fmt.Sprintf("Subscription has been removed from back end.")}
 
 	inet.SendResponse(w, http.StatusOK, msg)
@@ -412,7 +459,7 @@ func apiDBAccess(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if dbe.Public == vis.Private && dbe.Creator != requester {
+	if !hasAccess(dbe, requester) {
 		logger.Error("User %q tried to get portalext of db created by %q.", requester, dbe.Creator)
 		inet.SendResponse(w, http.StatusBadRequest, inet.Message{
 			Status:  http.StatusForbidden,
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -15,18 +19,20 @@ import (
 	"github.com/djavorszky/ddn/common/inet"
 	"github.com/djavorszky/ddn/common/logger"
 	"github.com/djavorszky/ddn/common/model"
+	"github.com/djavorszky/ddn/common/srv"
 	"github.com/djavorszky/ddn/common/status"
+	"github.com/djavorszky/ddn/common/storage"
 	vis "github.com/djavorszky/ddn/common/visibility"
 	"github.com/djavorszky/ddn/server/brwsr"
 	"github.com/djavorszky/ddn/server/database/data"
 	"github.com/djavorszky/ddn/server/registry"
-	"github.com/djavorszky/liferay"
+	"github.com/djavorszky/ddn/server/webhook"
 	"github.com/gorilla/mux"
 )
 
 func apiSetLogLevel(w http.ResponseWriter, r *http.Request) {
-	_, err := getAPIUser(r)
-	if err != nil {
+	user, err := getAPIUser(r)
+	if err != nil || !isAdmin(user) {
 		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
 		return
 	}
@@ -61,6 +67,8 @@ func apiSetLogLevel(w http.ResponseWriter, r *http.Request) {
 
 	logger.Level = lvl
 
+	writeAudit(data.AuditEntry{User: user, Action: auditLogLevel, Details: msg})
+
 	inet.SendSuccess(w, http.StatusOK, msg)
 	return
 }
@@ -79,6 +87,10 @@ func getAPIAgents(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	for i, agent := range agents {
+		agents[i] = agent.Public()
+	}
+
 	inet.SendSuccess(w, http.StatusOK, agents)
 }
 
@@ -93,11 +105,11 @@ func getAPIActiveAgents(w http.ResponseWriter, r *http.Request) {
 
 	agents := registry.List()
 	for _, agent := range agents {
-		if !agent.Up {
+		if !agent.Available() {
 			continue
 		}
 
-		result = append(result, agent)
+		result = append(result, agent.Public())
 	}
 
 	if len(result) == 0 {
@@ -126,9 +138,64 @@ func getAPIAgentByName(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	inet.SendSuccess(w, http.StatusOK, agent)
+	inet.SendSuccess(w, http.StatusOK, agent.Public())
+}
+
+// drainAPIAgent asks the agent to drain: it stops accepting new databases and
+// shuts down once its running imports finished. Only the admins may drain
+// agents.
+func drainAPIAgent(w http.ResponseWriter, r *http.Request) {
+	user, err := getAPIUser(r)
+	if err != nil || !isAdmin(user) {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	agent, ok := registry.Get(mux.Vars(r)["agent"])
+	if !ok {
+		inet.SendFailure(w, http.StatusNotFound, errs.AgentNotFound)
+		return
+	}
+
+	msg, err := agent.WithRequestID(srv.RequestID(r)).Drain()
+	if err != nil {
+		srv.Log(r).Error("draining %s: %v", agent.ShortName, err)
+		inet.SendFailure(w, http.StatusBadGateway, errs.DrainFailed, err.Error())
+		return
+	}
+
+	agent.Draining = true
+	registry.Store(agent)
+
+	auditAgent(user, auditDrain, agent.ShortName, agent.Identifier)
+
+	inet.SendSuccess(w, http.StatusAccepted, msg)
 }
 
+const (
+	// defaultDatabasesLimit is the size of the pages if a page is
+	// requested without a limit.
+	defaultDatabasesLimit = 50
+
+	// maxDatabasesLimit is the largest page size that can be requested.
+	maxDatabasesLimit = 1000
+
+	maxTags          = 20
+	maxTagLength     = 64
+	maxCommentLength = 2048
+)
+
+// tagPattern matches the valid tags, e.g. ticket IDs like LPS-12345. It
+// has to match the tag in the routes, and mustn't contain commas.
+var tagPattern = regexp.MustCompile(`^[a-zA-Z0-9_.:-]+$`)
+
+// sha256Pattern matches the checksums accepted for imports, in hex.
+var sha256Pattern = regexp.MustCompile(`^[a-fA-F0-9]{64}$`)
+
+// getAPIDatabases returns the databases the user can see: their own, the
+// public ones and the ones shared with their teams, filtered, sorted and
+// paged by the query parameters. The total number of matching databases
+// is returned in the X-Total-Count header.
 func getAPIDatabases(w http.ResponseWriter, r *http.Request) {
 	user, err := getAPIUser(r)
 	if err != nil {
@@ -136,37 +203,111 @@ func getAPIDatabases(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get private ones
-	metas, err := db.FetchByCreator(user)
+	query, param, err := parseDatabaseQuery(r.URL.Query())
+	if err != nil {
+		inet.SendFailure(w, http.StatusBadRequest, errs.InvalidURL, param)
+		return
+	}
+
+	teams, err := db.FetchTeamsByMember(user)
 	if err != nil {
 		inet.SendFailure(w, http.StatusInternalServerError, errs.QueryFailed, err.Error())
 
-		logger.Error("Fetching private dbs failed: %v", err)
+		logger.Error("Fetching teams failed: %v", err)
 		return
 	}
 
-	databases := make([]data.Row, 0, len(metas))
+	query.VisibleTo = user
+	for _, team := range teams {
+		query.Teams = append(query.Teams, team.ID)
+	}
+
+	databases, err := db.FetchDatabases(query)
+	if err != nil {
+		inet.SendFailure(w, http.StatusInternalServerError, errs.QueryFailed, err.Error())
 
-	for _, meta := range metas {
-		databases = append(databases, meta)
+		logger.Error("Fetching dbs failed: %v", err)
+		return
 	}
 
-	// Get public ones
-	metas, err = db.FetchPublic()
+	total, err := db.CountDatabases(query)
 	if err != nil {
 		inet.SendFailure(w, http.StatusInternalServerError, errs.QueryFailed, err.Error())
 
-		logger.Error("Fetching public dbs failed: %v", err)
+		logger.Error("Counting dbs failed: %v", err)
 		return
 	}
 
-	for _, meta := range metas {
-		databases = append(databases, meta)
+	// The passwords are only served by the access info calls.
+	for i := range databases {
+		databases[i].DBPass = ""
+	}
+
+	if databases == nil {
+		databases = []data.Row{}
 	}
 
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
 	inet.SendSuccess(w, http.StatusOK, databases)
 }
 
+// parseDatabaseQuery returns the query described by the parameters of a
+// database listing. If a parameter is invalid, its name is returned along
+// with the error.
+func parseDatabaseQuery(params url.Values) (data.DatabaseQuery, string, error) {
+	query := data.DatabaseQuery{
+		Agent:   params.Get("agent"),
+		Vendor:  params.Get("vendor"),
+		Creator: params.Get("creator"),
+		Name:    params.Get("name"),
+		Tag:     params.Get("tag"),
+		Search:  params.Get("search"),
+		Sort:    params.Get("sort"),
+	}
+
+	var err error
+
+	if query.Sort != "" && !data.ValidSort(query.Sort) {
+		return query, "sort", fmt.Errorf("unknown sort %q", query.Sort)
+	}
+
+	if value := params.Get("status"); value != "" {
+		query.Status, err = strconv.Atoi(value)
+		if err != nil {
+			return query, "status", err
+		}
+	}
+
+	if value := params.Get("expiring-before"); value != "" {
+		query.ExpiringBefore, err = parseTimeParam(value)
+		if err != nil {
+			return query, "expiring-before", err
+		}
+	}
+
+	page := 1
+	if value := params.Get("page"); value != "" {
+		page, err = strconv.Atoi(value)
+		if err != nil || page < 1 {
+			return query, "page", fmt.Errorf("invalid page %q", value)
+		}
+
+		query.Limit = defaultDatabasesLimit
+	}
+
+	if value := params.Get("limit"); value != "" {
+		query.Limit, err = strconv.Atoi(value)
+		if err != nil || query.Limit < 1 || query.Limit > maxDatabasesLimit {
+			return query, "limit", fmt.Errorf("invalid limit %q", value)
+		}
+	}
+
+	query.Offset = (page - 1) * query.Limit
+
+	return query, "", nil
+}
+
 func getAPIDatabaseByID(w http.ResponseWriter, r *http.Request) {
 	user, err := getAPIUser(r)
 	if err != nil {
@@ -225,7 +366,7 @@ func dropAPIDatabaseByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !hasAccess(meta, user) {
+	if !canModify(meta, user) {
 		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
 		return
 	}
@@ -236,6 +377,9 @@ func dropAPIDatabaseByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	fireEvent(webhook.DatabaseDropped, meta)
+	audit(user, auditDrop, meta, meta.DBName)
+
 	inet.SendSuccess(w, http.StatusOK, "Delete successful")
 }
 
@@ -258,7 +402,7 @@ func dropAPIDatabaseByAgentDBName(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !hasAccess(meta, user) {
+	if !canModify(meta, user) {
 		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
 		return
 	}
@@ -269,12 +413,15 @@ func dropAPIDatabaseByAgentDBName(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	fireEvent(webhook.DatabaseDropped, meta)
+	audit(user, auditDrop, meta, meta.DBName)
+
 	inet.SendSuccess(w, http.StatusOK, "Delete successful")
 }
 
 func importAPIDB(w http.ResponseWriter, r *http.Request) {
 	user, err := getAPIUser(r)
-	if err != nil {
+	if err != nil || !canWrite(user) {
 		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
 		return
 	}
@@ -294,11 +441,21 @@ func importAPIDB(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.DumpLocation == "" {
+	if req.DumpLocation == "" && req.UploadID == "" {
 		inet.SendFailure(w, http.StatusBadRequest, errs.MissingParameters, "dumpfile_location")
 		return
 	}
 
+	if req.DumpLocation != "" && req.UploadID != "" {
+		inet.SendFailure(w, http.StatusBadRequest, errs.UnknownParameter, "upload_id")
+		return
+	}
+
+	if req.SHA256 != "" && !sha256Pattern.MatchString(req.SHA256) {
+		inet.SendFailure(w, http.StatusBadRequest, errs.InvalidChecksum, req.SHA256)
+		return
+	}
+
 	agent, ok := registry.Get(req.AgentIdentifier)
 	if !ok {
 		inet.SendFailure(w, http.StatusBadRequest, errs.AgentNotFound, req.AgentIdentifier)
@@ -306,8 +463,59 @@ func importAPIDB(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if agent.Draining {
+		inet.SendFailure(w, http.StatusServiceUnavailable, errs.AgentDraining, req.AgentIdentifier)
+
+		return
+	}
+	agent = agent.WithRequestID(srv.RequestID(r))
+
+	tags, errr := checkNotes(req.Tags, req.Comment)
+	if errr.httpStatus != 0 {
+		inet.SendFailure(w, errr.httpStatus, errr.errors...)
+		return
+	}
+
+	// The rules are only ever taken from the server's own rule sets.
+	req.Anonymization = nil
+	if req.Anonymize != "" {
+		req.Anonymization, errr = getRuleSet(req.Anonymize)
+		if errr.httpStatus != 0 {
+			inet.SendFailure(w, errr.httpStatus, errr.errors...)
+			return
+		}
+	}
+
+	req.Scripts = nil
+	if len(req.PostImport) != 0 {
+		req.Scripts, errr = getScripts(req.PostImport, agent.DBVendor)
+		if errr.httpStatus != 0 {
+			inet.SendFailure(w, errr.httpStatus, errr.errors...)
+			return
+		}
+	}
+
 	ensureValues(&req.DatabaseName, &req.Username, &req.Password, agent.DBVendor)
 
+	// Uploads are staged for the agent like the dumps in the mounted folder.
+	var up *upload
+	if req.UploadID != "" {
+		up, errr = claimUpload(req.UploadID, user)
+		if errr.httpStatus != 0 {
+			inet.SendFailure(w, errr.httpStatus, errr.errors...)
+			return
+		}
+
+		if req.SHA256 != "" && !strings.EqualFold(req.SHA256, up.SHA256) {
+			releaseUpload(up)
+			inet.SendFailure(w, http.StatusBadRequest, errs.InvalidChecksum, req.SHA256)
+			return
+		}
+
+		req.DumpLocation = up.name
+		req.SHA256 = up.SHA256
+	}
+
 	dbe := data.Row{
 		DBName:     req.DatabaseName,
 		DBUser:     req.Username,
@@ -322,6 +530,8 @@ func importAPIDB(w http.ResponseWriter, r *http.Request) {
 		DBPort:     agent.DBPort,
 		DBVendor:   agent.DBVendor,
 		Status:     status.Accepted,
+		Comment:    req.Comment,
+		Tags:       tags,
 	}
 
 	err = db.Insert(&dbe)
@@ -330,6 +540,10 @@ func importAPIDB(w http.ResponseWriter, r *http.Request) {
 
 		logger.Error("failed inserting database: %v", err)
 		db.Delete(dbe)
+
+		if up != nil {
+			releaseUpload(up)
+		}
 		return
 	}
 
@@ -339,60 +553,108 @@ func importAPIDB(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	go startImport(agent, dbe)
+	dump := dbe.Dumpfile
+	if up != nil {
+		dump, err = stageUpload(up, dbe.ID)
+		if err != nil {
+			inet.SendFailure(w, http.StatusInternalServerError, errs.FileIOFailed, err.Error())
+
+			logger.Error("failed staging upload %s: %v", up.ID, err)
+			db.Delete(dbe)
+			releaseUpload(up)
+			return
+		}
+	}
+
+	details := dbe.Dumpfile
+	if req.Anonymization != nil {
+		details += ", anonymized with " + req.Anonymize
+	}
+
+	if len(req.Scripts) != 0 {
+		details += ", post-import scripts " + strings.Join(req.PostImport, ", ")
+	}
+	audit(user, auditImport, dbe, details)
+
+	req.DumpLocation = dump
+	background(func() { startImport(agent, dbe, req.DBRequest) })
 
 	inet.SendSuccess(w, http.StatusAccepted, dbe)
 }
 
-func startImport(agent model.Agent, dbe data.Row) {
-	defer db.Update(&dbe)
+// startImport hands the import over to the agent, which downloads the dump
+// from dbreq.DumpLocation. Dumps in the mounted folder are staged to be served
+// to the agent first, and their checksum is sent along, unless the client
+// supplied one in dbreq.SHA256.
+func startImport(agent model.Agent, dbe data.Row, dbreq model.DBRequest) {
+	log := logger.With(logger.Fields{"request_id": agent.RequestID(), "database_id": dbe.ID})
+
+	defer func() {
+		db.Update(&dbe)
+
+		if dbe.IsErr() {
+			removeStaged(dbe.ID)
+			fireEvent(webhook.ImportFailed, dbe)
+		}
+	}()
 
-	url := dbe.Dumpfile
-	if strings.HasPrefix(dbe.Dumpfile, "/") {
-		_, filename := filepath.Split(dbe.Dumpfile)
-		logger.Debug("Starting to copy %s to %s/web/dumps/", filename, workdir)
-		dst, err := os.OpenFile(fmt.Sprintf("%s/web/dumps/%s", workdir, filename), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	dump := dbreq.DumpLocation
+	if strings.HasPrefix(dump, "/") {
+		_, filename := filepath.Split(dump)
+		log.Debug("Starting to copy %s to %s", filename, stageDir(dbe.ID))
+		dst, err := stageFile(dbe.ID, filename)
 		if err != nil {
 			errMsg := fmt.Sprintf("Failed creating downloadable file at web/dumps: %v", err)
 
-			logger.Error(errMsg)
+			log.Error(errMsg)
 			dbe.Status = status.ImportFailed
 			dbe.Message = errMsg
 			return
 		}
 		defer dst.Close()
 
-		src, err := os.Open(filepath.Join(config.MountLoc, dbe.Dumpfile))
+		src, err := os.Open(filepath.Join(config.MountLoc, dump))
 		if err != nil {
-			errMsg := fmt.Sprintf("Failed opening dumpfile at %v: %v", dbe.Dumpfile, err)
+			errMsg := fmt.Sprintf("Failed opening dumpfile at %v: %v", dump, err)
 
-			logger.Error(errMsg)
+			log.Error(errMsg)
 			dbe.Status = status.ImportFailed
 			dbe.Message = errMsg
 			return
 		}
 		defer src.Close()
 
-		_, err = io.Copy(dst, src)
+		h := sha256.New()
+
+		_, err = io.Copy(io.MultiWriter(dst, h), src)
 		if err != nil {
 			errMsg := fmt.Sprintf("Failed copying dumpfile %s -> %s: %v", src.Name(), dst.Name(), err)
 
-			logger.Error(errMsg)
+			log.Error(errMsg)
 			dbe.Status = status.ImportFailed
 			dbe.Message = errMsg
 			return
 		}
 
-		logger.Debug("Copy successful, starting import")
+		log.Debug("Copy successful, starting import")
+
+		if dbreq.SHA256 == "" {
+			dbreq.SHA256 = hex.EncodeToString(h.Sum(nil))
+		}
 
-		url = fmt.Sprintf("http://%s:%s/dumps/%s", config.ServerHost, config.ServerPort, filename)
+		dbreq.DumpLocation = stagedURL(dbe.ID, filename)
 	}
 
-	_, err := agent.ImportDatabase(dbe.ID, dbe.DBName, dbe.DBUser, dbe.DBPass, url)
+	dbreq.ID = dbe.ID
+	dbreq.DatabaseName = dbe.DBName
+	dbreq.Username = dbe.DBUser
+	dbreq.Password = dbe.DBPass
+
+	_, err := agent.ImportDatabase(dbreq)
 	if err != nil {
 		errMsg := fmt.Sprintf("Import failed: %v", err)
 
-		logger.Error(errMsg)
+		log.Error(errMsg)
 
 		dbe.Status = status.ImportFailed
 		dbe.Message = errMsg
@@ -404,7 +666,7 @@ func startImport(agent model.Agent, dbe data.Row) {
 
 func createAPIDB(w http.ResponseWriter, r *http.Request) {
 	user, err := getAPIUser(r)
-	if err != nil {
+	if err != nil || !canWrite(user) {
 		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
 		return
 	}
@@ -432,6 +694,19 @@ func createAPIDB(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if agent.Draining {
+		inet.SendFailure(w, http.StatusServiceUnavailable, errs.AgentDraining, req.AgentIdentifier)
+
+		return
+	}
+	agent = agent.WithRequestID(srv.RequestID(r))
+
+	tags, errr := checkNotes(req.Tags, req.Comment)
+	if errr.httpStatus != 0 {
+		inet.SendFailure(w, errr.httpStatus, errr.errors...)
+		return
+	}
+
 	ensureValues(&req.DatabaseName, &req.Username, &req.Password, agent.DBVendor)
 
 	req.ID = registry.ID()
@@ -448,6 +723,8 @@ func createAPIDB(w http.ResponseWriter, r *http.Request) {
 		DBPort:     agent.DBPort,
 		DBVendor:   agent.DBVendor,
 		Status:     status.Success,
+		Comment:    req.Comment,
+		Tags:       tags,
 	}
 
 	err = db.Insert(&dbe)
@@ -466,6 +743,9 @@ func createAPIDB(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	fireEvent(webhook.DatabaseCreated, dbe)
+	audit(user, auditCreate, dbe, "")
+
 	inet.SendSuccess(w, http.StatusOK, dbe)
 }
 
@@ -483,7 +763,7 @@ func recreateAPIDB(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !hasAccess(meta, user) {
+	if !canModify(meta, user) {
 		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
 		return
 	}
@@ -494,6 +774,12 @@ func recreateAPIDB(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if agent.Draining {
+		inet.SendFailure(w, http.StatusServiceUnavailable, errs.AgentDraining, meta.AgentName)
+		return
+	}
+	agent = agent.WithRequestID(srv.RequestID(r))
+
 	_, err = agent.DropDatabase(meta.ID, meta.DBName, meta.DBUser)
 	if err != nil {
 		meta.Status = status.DropDatabaseFailed
@@ -512,6 +798,8 @@ func recreateAPIDB(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	audit(user, auditRecreate, meta, meta.DBName)
+
 	inet.SendSuccess(w, http.StatusOK, meta)
 }
 
@@ -522,17 +810,26 @@ func browseAPI(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if config.MountLoc == "" {
-		inet.SendFailure(w, http.StatusFailedDependency, errs.NoFoldersMounted)
-		return
-	}
-
 	vars := mux.Vars(r)
 	loc, ok := vars["loc"]
 	if !ok {
 		loc = "/"
 	}
 
+	if remote := r.URL.Query().Get("loc"); remote != "" {
+		if !storage.Supported(remote) {
+			inet.SendFailure(w, http.StatusBadRequest, errs.InvalidURL, remote)
+			return
+		}
+
+		loc = remote
+	}
+
+	if config.MountLoc == "" && !storage.Supported(loc) {
+		inet.SendFailure(w, http.StatusFailedDependency, errs.NoFoldersMounted)
+		return
+	}
+
 	files, err := brwsr.List(loc)
 	if err != nil {
 		inet.SendFailure(w, http.StatusForbidden, errs.FailedListingDirectory, err.Error())
@@ -558,31 +855,47 @@ func apiSetVisibility(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !hasAccess(meta, user) {
+	if !canModify(meta, user) {
 		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
 		return
 	}
 
 	visibility := vars["visibility"]
 
-	var visibilityNum int
+	var visibilityNum, teamID int
 	switch visibility {
 	case "public":
 		visibilityNum = vis.Public
 	case "private":
 		visibilityNum = vis.Private
+	case "team":
+		team, errr := getTeamByIDFrom(vars, "team")
+		if errr.httpStatus != 0 {
+			inet.SendFailure(w, errr.httpStatus, errr.errors...)
+			return
+		}
+
+		if !team.HasMember(user) && !isAdmin(user) {
+			inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+			return
+		}
+
+		visibilityNum = vis.Team
+		teamID = team.ID
+		visibility = "team " + team.Name
 	default:
 		inet.SendFailure(w, http.StatusBadRequest, errs.MissingParameters, visibility)
 		return
 	}
 
 	// If no change needed
-	if visibilityNum == meta.Public {
+	if visibilityNum == meta.Public && teamID == meta.Team {
 		inet.SendSuccess(w, http.StatusOK, "Visibility already set to "+visibility)
 		return
 	}
 
 	meta.Public = visibilityNum
+	meta.Team = teamID
 
 	err = db.Update(&meta)
 	if err != nil {
@@ -592,6 +905,8 @@ func apiSetVisibility(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	audit(user, auditVisibility, meta, visibility)
+
 	inet.SendSuccess(w, http.StatusOK, "Visibility updated successfully")
 }
 
@@ -609,7 +924,7 @@ func apiExtendExpiry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !hasAccess(meta, user) {
+	if !canModify(meta, user) {
 		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
 		return
 	}
@@ -628,7 +943,7 @@ func apiExtendExpiry(w http.ResponseWriter, r *http.Request) {
 		newExpiry = meta.ExpiryDate.AddDate(0, 0, amount)
 	case "months":
 		newExpiry = meta.ExpiryDate.AddDate(0, amount, 0)
-	case "year":
+	case "years":
 		newExpiry = meta.ExpiryDate.AddDate(amount, 0, 0)
 	default:
 		inet.SendFailure(w, http.StatusBadRequest, errs.UnknownParameter, vars["unit"])
@@ -645,10 +960,12 @@ func apiExtendExpiry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	audit(user, auditExtend, meta, fmt.Sprintf("%s %s, until %s", vars["amount"], vars["unit"], meta.ExpiryDate.Format("2006-01-02")))
+
 	inet.SendSuccess(w, http.StatusOK, meta.ExpiryDate)
 }
 
-func apiAccessInfoByAgentDB(w http.ResponseWriter, r *http.Request) {
+func transferAPIDatabase(w http.ResponseWriter, r *http.Request) {
 	user, err := getAPIUser(r)
 	if err != nil {
 		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
@@ -656,21 +973,48 @@ func apiAccessInfoByAgentDB(w http.ResponseWriter, r *http.Request) {
 	}
 
 	vars := mux.Vars(r)
-	meta, errr := getDatabaseByAgentDBNameFrom(vars)
+	meta, errr := getDatabaseByIDFrom(vars)
 	if errr.httpStatus != 0 {
 		inet.SendFailure(w, errr.httpStatus, errr.errors...)
 		return
 	}
 
-	if !hasAccess(meta, user) {
+	if !canManageOwners(meta, user) {
 		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
 		return
 	}
 
-	inet.SendSuccess(w, http.StatusOK, getDBAccess(meta))
+	previous, owner := meta.Creator, vars["email"]
+	if owner == previous {
+		inet.SendSuccess(w, http.StatusOK, meta)
+		return
+	}
+
+	// The previous creator stays a co-owner, unless they asked to leave.
+	meta.Creator = owner
+	meta.CoOwners = removeString(meta.CoOwners, owner)
+	if r.URL.Query().Get("leave") != "true" {
+		meta.CoOwners = append(meta.CoOwners, previous)
+	}
+
+	err = db.Update(&meta)
+	if err != nil {
+		inet.SendFailure(w, http.StatusInternalServerError, errs.UpdateFailed, err.Error())
+
+		logger.Error("failed transferring database: %v", err)
+		return
+	}
+
+	audit(user, auditTransfer, meta, previous+" -> "+owner)
+
+	notifyUsers(fmt.Sprintf("Database %q transferred", meta.DBName),
+		fmt.Sprintf("The ownership of database %s has been transferred from %s to %s.", meta.DBName, previous, owner),
+		previous, owner)
+
+	inet.SendSuccess(w, http.StatusOK, meta)
 }
 
-func apiAccessInfoByID(w http.ResponseWriter, r *http.Request) {
+func addAPICoOwner(w http.ResponseWriter, r *http.Request) {
 	user, err := getAPIUser(r)
 	if err != nil {
 		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
@@ -684,94 +1028,824 @@ func apiAccessInfoByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !hasAccess(meta, user) {
+	if !canManageOwners(meta, user) {
 		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
 		return
 	}
 
-	inet.SendSuccess(w, http.StatusOK, getDBAccess(meta))
-}
+	coOwner := vars["email"]
+	if meta.IsOwner(coOwner) {
+		inet.SendSuccess(w, http.StatusOK, meta)
+		return
+	}
 
-type dbAccess struct {
-	JDBCDriver string `json:"jdbc-driver"`
-	JDBCUrl    string `json:"jdbc-url"`
-	User       string `json:"user"`
-	Password   string `json:"password"`
-	URL        string `json:"url"`
-}
+	meta.CoOwners = append(meta.CoOwners, coOwner)
 
-func getDBAccess(meta data.Row) dbAccess {
-	var jdbc liferay.JDBC
-	switch meta.DBVendor {
-	case "mysql":
-		jdbc = liferay.MysqlJDBC(meta.DBAddress, meta.DBPort, meta.DBName, meta.DBUser, meta.DBPass)
-	case "mariadb":
-		jdbc = liferay.MariaDBJDBC(meta.DBAddress, meta.DBPort, meta.DBName, meta.DBUser, meta.DBPass)
-	case "postgres":
-		jdbc = liferay.PostgreJDBC(meta.DBAddress, meta.DBPort, meta.DBName, meta.DBUser, meta.DBPass)
-	case "oracle":
-		jdbc = liferay.OracleJDBC(meta.DBAddress, meta.DBPort, meta.DBSID, meta.DBUser, meta.DBPass)
-	case "mssql":
-		jdbc = liferay.MSSQLJDBC(meta.DBAddress, meta.DBPort, meta.DBName, meta.DBUser, meta.DBPass)
-	}
+	err = db.Update(&meta)
+	if err != nil {
+		inet.SendFailure(w, http.StatusInternalServerError, errs.UpdateFailed, err.Error())
 
-	return dbAccess{
-		JDBCDriver: jdbc.Driver,
-		JDBCUrl:    jdbc.URL,
-		User:       meta.DBUser,
-		Password:   meta.DBPass,
-		URL:        meta.DBAddress + ":" + meta.DBPort,
+		logger.Error("failed adding co-owner: %v", err)
+		return
 	}
-}
 
-func getAPIUser(r *http.Request) (string, error) {
-	auth := r.Header.Get("Authorization")
-	if auth == "" {
-		return "", fmt.Errorf("unauthorized request")
-	}
+	audit(user, auditCoOwnerAdd, meta, coOwner)
 
-	return auth, nil
+	notifyUsers(fmt.Sprintf("Co-owner added to %q", meta.DBName),
+		fmt.Sprintf("%s is now a co-owner of database %s.", coOwner, meta.DBName),
+		meta.Creator, coOwner)
+
+	inet.SendSuccess(w, http.StatusOK, meta)
 }
 
-func hasResult(meta data.Row) bool {
-	if meta.Creator == "" {
-		return false
+func removeAPICoOwner(w http.ResponseWriter, r *http.Request) {
+	user, err := getAPIUser(r)
+	if err != nil {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
 	}
-	return true
-}
 
-func hasAccess(meta data.Row, user string) bool {
-	if meta.Public == vis.Private && meta.Creator != user {
-		return false
+	vars := mux.Vars(r)
+	meta, errr := getDatabaseByIDFrom(vars)
+	if errr.httpStatus != 0 {
+		inet.SendFailure(w, errr.httpStatus, errr.errors...)
+		return
 	}
-	return true
-}
 
-type errResult struct {
-	httpStatus int
-	errors     []string
-}
+	if !canManageOwners(meta, user) {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
 
-func getDatabaseByIDFrom(vars map[string]string) (data.Row, errResult) {
-	id, err := strconv.Atoi(vars["id"])
-	if err != nil {
-		return data.Row{}, errResult{
-			httpStatus: http.StatusBadRequest,
-			errors:     []string{errs.InvalidURL},
-		}
+	coOwner := vars["email"]
+	coOwners := removeString(meta.CoOwners, coOwner)
+	if len(coOwners) == len(meta.CoOwners) {
+		inet.SendSuccess(w, http.StatusOK, meta)
+		return
 	}
 
-	meta, err := db.FetchByID(id)
+	meta.CoOwners = coOwners
+
+	err = db.Update(&meta)
 	if err != nil {
-		logger.Error("Fetching database failed: %v", err)
+		inet.SendFailure(w, http.StatusInternalServerError, errs.UpdateFailed, err.Error())
 
-		return data.Row{}, errResult{
-			httpStatus: http.StatusInternalServerError,
-			errors:     []string{errs.QueryFailed, err.Error()},
-		}
+		logger.Error("failed removing co-owner: %v", err)
+		return
 	}
 
-	if !hasResult(meta) {
+	audit(user, auditCoOwnerRemove, meta, coOwner)
+
+	notifyUsers(fmt.Sprintf("Co-owner removed from %q", meta.DBName),
+		fmt.Sprintf("%s is no longer a co-owner of database %s.", coOwner, meta.DBName),
+		meta.Creator, coOwner)
+
+	inet.SendSuccess(w, http.StatusOK, meta)
+}
+
+func addAPITag(w http.ResponseWriter, r *http.Request) {
+	user, err := getAPIUser(r)
+	if err != nil {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	vars := mux.Vars(r)
+	meta, errr := getDatabaseByIDFrom(vars)
+	if errr.httpStatus != 0 {
+		inet.SendFailure(w, errr.httpStatus, errr.errors...)
+		return
+	}
+
+	if !canModify(meta, user) {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	tag := vars["tag"]
+	if meta.HasTag(tag) {
+		inet.SendSuccess(w, http.StatusOK, meta)
+		return
+	}
+
+	tags, errr := checkNotes(append(meta.Tags, tag), meta.Comment)
+	if errr.httpStatus != 0 {
+		inet.SendFailure(w, errr.httpStatus, errr.errors...)
+		return
+	}
+
+	meta.Tags = tags
+
+	err = db.Update(&meta)
+	if err != nil {
+		inet.SendFailure(w, http.StatusInternalServerError, errs.UpdateFailed, err.Error())
+
+		logger.Error("failed adding tag: %v", err)
+		return
+	}
+
+	audit(user, auditTagAdd, meta, tag)
+
+	inet.SendSuccess(w, http.StatusOK, meta)
+}
+
+func removeAPITag(w http.ResponseWriter, r *http.Request) {
+	user, err := getAPIUser(r)
+	if err != nil {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	vars := mux.Vars(r)
+	meta, errr := getDatabaseByIDFrom(vars)
+	if errr.httpStatus != 0 {
+		inet.SendFailure(w, errr.httpStatus, errr.errors...)
+		return
+	}
+
+	if !canModify(meta, user) {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	tag := vars["tag"]
+
+	var tags []string
+	for _, t := range meta.Tags {
+		if !strings.EqualFold(t, tag) {
+			tags = append(tags, t)
+		}
+	}
+
+	if len(tags) == len(meta.Tags) {
+		inet.SendSuccess(w, http.StatusOK, meta)
+		return
+	}
+
+	meta.Tags = tags
+
+	err = db.Update(&meta)
+	if err != nil {
+		inet.SendFailure(w, http.StatusInternalServerError, errs.UpdateFailed, err.Error())
+
+		logger.Error("failed removing tag: %v", err)
+		return
+	}
+
+	audit(user, auditTagRemove, meta, tag)
+
+	inet.SendSuccess(w, http.StatusOK, meta)
+}
+
+// apiSetComment replaces the comment of the database with the one in the
+// request body.
+func apiSetComment(w http.ResponseWriter, r *http.Request) {
+	user, err := getAPIUser(r)
+	if err != nil {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	vars := mux.Vars(r)
+	meta, errr := getDatabaseByIDFrom(vars)
+	if errr.httpStatus != 0 {
+		inet.SendFailure(w, errr.httpStatus, errr.errors...)
+		return
+	}
+
+	if !canModify(meta, user) {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	var req struct {
+		Comment string `json:"comment"`
+	}
+
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		inet.SendFailure(w, http.StatusBadRequest, errs.JSONDecodeFailed, err.Error())
+
+		logger.Error("couldn't decode json request: %v", err)
+		return
+	}
+
+	_, errr = checkNotes(meta.Tags, req.Comment)
+	if errr.httpStatus != 0 {
+		inet.SendFailure(w, errr.httpStatus, errr.errors...)
+		return
+	}
+
+	meta.Comment = req.Comment
+
+	err = db.Update(&meta)
+	if err != nil {
+		inet.SendFailure(w, http.StatusInternalServerError, errs.UpdateFailed, err.Error())
+
+		logger.Error("failed updating comment: %v", err)
+		return
+	}
+
+	audit(user, auditComment, meta, meta.Comment)
+
+	inet.SendSuccess(w, http.StatusOK, meta)
+}
+
+func apiAccessInfoByAgentDB(w http.ResponseWriter, r *http.Request) {
+	user, err := getAPIUser(r)
+	if err != nil {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	vars := mux.Vars(r)
+	meta, errr := getDatabaseByAgentDBNameFrom(vars)
+	if errr.httpStatus != 0 {
+		inet.SendFailure(w, errr.httpStatus, errr.errors...)
+		return
+	}
+
+	if !hasAccess(meta, user) {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	inet.SendSuccess(w, http.StatusOK, getDBAccess(meta))
+}
+
+func apiAccessInfoByID(w http.ResponseWriter, r *http.Request) {
+	user, err := getAPIUser(r)
+	if err != nil {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	vars := mux.Vars(r)
+	meta, errr := getDatabaseByIDFrom(vars)
+	if errr.httpStatus != 0 {
+		inet.SendFailure(w, errr.httpStatus, errr.errors...)
+		return
+	}
+
+	if !hasAccess(meta, user) {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	inet.SendSuccess(w, http.StatusOK, getDBAccess(meta))
+}
+
+type dbAccess struct {
+	JDBCDriver string `json:"jdbc-driver"`
+	JDBCUrl    string `json:"jdbc-url"`
+	User       string `json:"user"`
+	Password   string `json:"password"`
+	URL        string `json:"url"`
+}
+
+func getAPIWebhooks(w http.ResponseWriter, r *http.Request) {
+	user, err := getAPIUser(r)
+	if err != nil {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	hooks, err := db.FetchWebhooksByOwner(user)
+	if err != nil {
+		inet.SendFailure(w, http.StatusInternalServerError, errs.QueryFailed, err.Error())
+
+		logger.Error("Fetching webhooks failed: %v", err)
+		return
+	}
+
+	if len(hooks) == 0 {
+		inet.SendFailure(w, http.StatusNotFound, errs.QueryNoResults)
+		return
+	}
+
+	inet.SendSuccess(w, http.StatusOK, hooks)
+}
+
+func createAPIWebhook(w http.ResponseWriter, r *http.Request) {
+	user, err := getAPIUser(r)
+	if err != nil || !canWrite(user) {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	var hook data.Webhook
+
+	err = json.NewDecoder(r.Body).Decode(&hook)
+	if err != nil {
+		inet.SendFailure(w, http.StatusBadRequest, errs.JSONDecodeFailed, err.Error())
+
+		logger.Error("couldn't decode json request: %v", err)
+		return
+	}
+
+	if hook.URL == "" {
+		inet.SendFailure(w, http.StatusBadRequest, errs.MissingParameters, "url")
+		return
+	}
+
+	u, err := url.Parse(hook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		inet.SendFailure(w, http.StatusBadRequest, errs.InvalidURL, hook.URL)
+		return
+	}
+
+	for _, event := range hook.Events {
+		if !webhook.ValidEvent(event) {
+			inet.SendFailure(w, http.StatusBadRequest, errs.UnknownParameter, event)
+			return
+		}
+	}
+
+	if hook.Global && !isAdmin(user) {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	if hook.Secret == "" {
+		hook.Secret = webhook.NewSecret()
+	}
+
+	hook.ID = 0
+	hook.Owner = user
+	hook.CreateDate = time.Now()
+
+	err = db.InsertWebhook(&hook)
+	if err != nil {
+		inet.SendFailure(w, http.StatusInternalServerError, errs.PersistFailed, err.Error())
+
+		logger.Error("failed inserting webhook: %v", err)
+		return
+	}
+
+	writeAudit(data.AuditEntry{User: user, Action: auditWebhookCreate, Details: fmt.Sprintf("#%d %s", hook.ID, hook.URL)})
+
+	inet.SendSuccess(w, http.StatusCreated, hook)
+}
+
+func getAPIWebhookByID(w http.ResponseWriter, r *http.Request) {
+	user, err := getAPIUser(r)
+	if err != nil {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	hook, errr := getWebhookByIDFrom(mux.Vars(r))
+	if errr.httpStatus != 0 {
+		inet.SendFailure(w, errr.httpStatus, errr.errors...)
+		return
+	}
+
+	if !canManageWebhook(hook, user) {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	inet.SendSuccess(w, http.StatusOK, hook)
+}
+
+func deleteAPIWebhook(w http.ResponseWriter, r *http.Request) {
+	user, err := getAPIUser(r)
+	if err != nil || !canWrite(user) {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	hook, errr := getWebhookByIDFrom(mux.Vars(r))
+	if errr.httpStatus != 0 {
+		inet.SendFailure(w, errr.httpStatus, errr.errors...)
+		return
+	}
+
+	if !canManageWebhook(hook, user) {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	err = db.DeleteWebhook(hook)
+	if err != nil {
+		inet.SendFailure(w, http.StatusInternalServerError, errs.DeleteFailed, err.Error())
+		return
+	}
+
+	writeAudit(data.AuditEntry{User: user, Action: auditWebhookDelete, Details: fmt.Sprintf("#%d %s", hook.ID, hook.URL)})
+
+	inet.SendSuccess(w, http.StatusOK, "Delete successful")
+}
+
+func getAPIWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	user, err := getAPIUser(r)
+	if err != nil {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	hook, errr := getWebhookByIDFrom(mux.Vars(r))
+	if errr.httpStatus != 0 {
+		inet.SendFailure(w, errr.httpStatus, errr.errors...)
+		return
+	}
+
+	if !canManageWebhook(hook, user) {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	deliveries, err := db.FetchWebhookDeliveries(hook.ID, deliveryLogLimit)
+	if err != nil {
+		inet.SendFailure(w, http.StatusInternalServerError, errs.QueryFailed, err.Error())
+
+		logger.Error("Fetching webhook deliveries failed: %v", err)
+		return
+	}
+
+	if len(deliveries) == 0 {
+		inet.SendFailure(w, http.StatusNotFound, errs.QueryNoResults)
+		return
+	}
+
+	inet.SendSuccess(w, http.StatusOK, deliveries)
+}
+
+// getAPIAuditLog returns the entries of the audit log, newest first. Only
+// admins can query it. The entries can be filtered with the user, database,
+// agent, from and to query parameters, the latter two accepting either
+// RFC 3339 timestamps or dates like 2018-03-20.
+func getAPIAuditLog(w http.ResponseWriter, r *http.Request) {
+	user, err := getAPIUser(r)
+	if err != nil || !isAdmin(user) {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	query := r.URL.Query()
+
+	filter := data.AuditFilter{
+		User:  query.Get("user"),
+		Agent: query.Get("agent"),
+		Limit: auditLogLimit,
+	}
+
+	if id := query.Get("database"); id != "" {
+		filter.DatabaseID, err = strconv.Atoi(id)
+		if err != nil {
+			inet.SendFailure(w, http.StatusBadRequest, errs.InvalidURL, "database")
+			return
+		}
+	}
+
+	for param, t := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+
+		*t, err = parseTimeParam(value)
+		if err != nil {
+			inet.SendFailure(w, http.StatusBadRequest, errs.InvalidURL, param)
+			return
+		}
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		filter.Limit, err = strconv.Atoi(limit)
+		if err != nil || filter.Limit < 1 || filter.Limit > maxAuditLogLimit {
+			inet.SendFailure(w, http.StatusBadRequest, errs.InvalidURL, "limit")
+			return
+		}
+	}
+
+	entries, err := db.FetchAuditEntries(filter)
+	if err != nil {
+		inet.SendFailure(w, http.StatusInternalServerError, errs.QueryFailed, err.Error())
+
+		logger.Error("failed fetching audit log: %v", err)
+		return
+	}
+
+	inet.SendSuccess(w, http.StatusOK, entries)
+}
+
+// parseTimeParam parses a time given as a query parameter, either in
+// RFC 3339 format or as a date in the local time zone.
+func parseTimeParam(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
+
+// getAPIUsers returns the users with a stored role. Users not in the list
+// are members, except for the admins in the configuration.
+func getAPIUsers(w http.ResponseWriter, r *http.Request) {
+	user, err := getAPIUser(r)
+	if err != nil || !isAdmin(user) {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	users, err := db.FetchUsers()
+	if err != nil {
+		inet.SendFailure(w, http.StatusInternalServerError, errs.QueryFailed, err.Error())
+
+		logger.Error("failed fetching users: %v", err)
+		return
+	}
+
+	if users == nil {
+		users = []data.User{}
+	}
+
+	inet.SendSuccess(w, http.StatusOK, users)
+}
+
+func setAPIUserRole(w http.ResponseWriter, r *http.Request) {
+	user, err := getAPIUser(r)
+	if err != nil || !isAdmin(user) {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	vars := mux.Vars(r)
+	target := data.User{Email: vars["email"], Role: vars["role"]}
+
+	if !data.ValidRole(target.Role) {
+		inet.SendFailure(w, http.StatusBadRequest, errs.UnknownParameter, target.Role)
+		return
+	}
+
+	err = db.SaveUser(target)
+	if err != nil {
+		inet.SendFailure(w, http.StatusInternalServerError, errs.PersistFailed, err.Error())
+
+		logger.Error("failed saving user: %v", err)
+		return
+	}
+
+	writeAudit(data.AuditEntry{User: user, Action: auditRole, Details: target.Email + " " + target.Role})
+
+	inet.SendSuccess(w, http.StatusOK, target)
+}
+
+// getAPIBackup returns a backup of everything the server stores.
+func getAPIBackup(w http.ResponseWriter, r *http.Request) {
+	user, err := getAPIUser(r)
+	if err != nil || !isAdmin(user) {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	backup, err := createBackup()
+	if err != nil {
+		inet.SendFailure(w, http.StatusInternalServerError, errs.QueryFailed, err.Error())
+
+		logger.Error("failed creating backup: %v", err)
+		return
+	}
+
+	writeAudit(data.AuditEntry{User: user, Action: auditBackup})
+
+	inet.SendSuccess(w, http.StatusOK, backup)
+}
+
+// restoreAPIBackup replaces everything the server stores with the
+// backup in the request's body.
+func restoreAPIBackup(w http.ResponseWriter, r *http.Request) {
+	user, err := getAPIUser(r)
+	if err != nil || !isAdmin(user) {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	var backup data.Backup
+
+	err = json.NewDecoder(r.Body).Decode(&backup)
+	if err != nil {
+		inet.SendFailure(w, http.StatusBadRequest, errs.JSONDecodeFailed, err.Error())
+
+		logger.Error("couldn't decode json request: %v", err)
+		return
+	}
+
+	err = restoreBackup(backup)
+	if err != nil {
+		inet.SendFailure(w, http.StatusInternalServerError, errs.PersistFailed, err.Error())
+
+		logger.Error("failed restoring backup: %v", err)
+		return
+	}
+
+	details := fmt.Sprintf("%d databases from the %s backup of %s", len(backup.Databases), backup.Provider, backup.Date.Format(time.RFC3339))
+	writeAudit(data.AuditEntry{User: user, Action: auditRestore, Details: details})
+
+	inet.SendSuccess(w, http.StatusOK, fmt.Sprintf("Restored %s", details))
+}
+
+// getAPITeams returns the teams of the user, or all teams for admins.
+func getAPITeams(w http.ResponseWriter, r *http.Request) {
+	user, err := getAPIUser(r)
+	if err != nil {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	var teams []data.Team
+	if isAdmin(user) {
+		teams, err = db.FetchTeams()
+	} else {
+		teams, err = db.FetchTeamsByMember(user)
+	}
+
+	if err != nil {
+		inet.SendFailure(w, http.StatusInternalServerError, errs.QueryFailed, err.Error())
+
+		logger.Error("failed fetching teams: %v", err)
+		return
+	}
+
+	if teams == nil {
+		teams = []data.Team{}
+	}
+
+	inet.SendSuccess(w, http.StatusOK, teams)
+}
+
+func createAPITeam(w http.ResponseWriter, r *http.Request) {
+	user, err := getAPIUser(r)
+	if err != nil || !isAdmin(user) {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	var team data.Team
+
+	err = json.NewDecoder(r.Body).Decode(&team)
+	if err != nil {
+		inet.SendFailure(w, http.StatusBadRequest, errs.JSONDecodeFailed, err.Error())
+
+		logger.Error("couldn't decode json request: %v", err)
+		return
+	}
+
+	if team.Name == "" {
+		inet.SendFailure(w, http.StatusBadRequest, errs.MissingParameters, "name")
+		return
+	}
+
+	team.ID = 0
+
+	err = db.InsertTeam(&team)
+	if err != nil {
+		inet.SendFailure(w, http.StatusInternalServerError, errs.PersistFailed, err.Error())
+
+		logger.Error("failed inserting team: %v", err)
+		return
+	}
+
+	writeAudit(data.AuditEntry{User: user, Action: auditTeamCreate, Details: fmt.Sprintf("#%d %s", team.ID, team.Name)})
+
+	inet.SendSuccess(w, http.StatusCreated, team)
+}
+
+func deleteAPITeam(w http.ResponseWriter, r *http.Request) {
+	user, err := getAPIUser(r)
+	if err != nil || !isAdmin(user) {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	team, errr := getTeamByIDFrom(mux.Vars(r), "id")
+	if errr.httpStatus != 0 {
+		inet.SendFailure(w, errr.httpStatus, errr.errors...)
+		return
+	}
+
+	err = db.DeleteTeam(team)
+	if err != nil {
+		inet.SendFailure(w, http.StatusInternalServerError, errs.DeleteFailed, err.Error())
+		return
+	}
+
+	writeAudit(data.AuditEntry{User: user, Action: auditTeamDelete, Details: fmt.Sprintf("#%d %s", team.ID, team.Name)})
+
+	inet.SendSuccess(w, http.StatusOK, "Delete successful")
+}
+
+func addAPITeamMember(w http.ResponseWriter, r *http.Request) {
+	user, err := getAPIUser(r)
+	if err != nil || !isAdmin(user) {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	vars := mux.Vars(r)
+	team, errr := getTeamByIDFrom(vars, "id")
+	if errr.httpStatus != 0 {
+		inet.SendFailure(w, errr.httpStatus, errr.errors...)
+		return
+	}
+
+	err = db.AddTeamMember(team.ID, vars["email"])
+	if err != nil {
+		inet.SendFailure(w, http.StatusInternalServerError, errs.PersistFailed, err.Error())
+		return
+	}
+
+	writeAudit(data.AuditEntry{User: user, Action: auditTeamJoin, Details: fmt.Sprintf("%s to #%d %s", vars["email"], team.ID, team.Name)})
+
+	inet.SendSuccess(w, http.StatusOK, "Member added")
+}
+
+func removeAPITeamMember(w http.ResponseWriter, r *http.Request) {
+	user, err := getAPIUser(r)
+	if err != nil || !isAdmin(user) {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	vars := mux.Vars(r)
+	team, errr := getTeamByIDFrom(vars, "id")
+	if errr.httpStatus != 0 {
+		inet.SendFailure(w, errr.httpStatus, errr.errors...)
+		return
+	}
+
+	err = db.RemoveTeamMember(team.ID, vars["email"])
+	if err != nil {
+		inet.SendFailure(w, http.StatusInternalServerError, errs.DeleteFailed, err.Error())
+		return
+	}
+
+	writeAudit(data.AuditEntry{User: user, Action: auditTeamLeave, Details: fmt.Sprintf("%s from #%d %s", vars["email"], team.ID, team.Name)})
+
+	inet.SendSuccess(w, http.StatusOK, "Member removed")
+}
+
+func getDBAccess(meta data.Row) dbAccess {
+	// The DXP properties are only picked if the import found a DXP portal,
+	// the 6.2 ones remain the default.
+	jdbc := portalExt(meta, meta.Liferay.DXP())
+
+	return dbAccess{
+		JDBCDriver: jdbc.Driver,
+		JDBCUrl:    jdbc.URL,
+		User:       meta.DBUser,
+		Password:   meta.DBPass,
+		URL:        meta.DBAddress + ":" + meta.DBPort,
+	}
+}
+
+func getAPIUser(r *http.Request) (string, error) {
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		return "", fmt.Errorf("unauthorized request")
+	}
+
+	return auth, nil
+}
+
+func canManageWebhook(hook data.Webhook, user string) bool {
+	return hook.Owner == user || (hook.Global && isAdmin(user))
+}
+
+func hasResult(meta data.Row) bool {
+	if meta.Creator == "" {
+		return false
+	}
+	return true
+}
+
+type errResult struct {
+	httpStatus int
+	errors     []string
+}
+
+func getDatabaseByIDFrom(vars map[string]string) (data.Row, errResult) {
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return data.Row{}, errResult{
+			httpStatus: http.StatusBadRequest,
+			errors:     []string{errs.InvalidURL},
+		}
+	}
+
+	meta, err := db.FetchByID(id)
+	if err != nil {
+		logger.Error("Fetching database failed: %v", err)
+
+		return data.Row{}, errResult{
+			httpStatus: http.StatusInternalServerError,
+			errors:     []string{errs.QueryFailed, err.Error()},
+		}
+	}
+
+	if !hasResult(meta) {
 		return data.Row{}, errResult{
 			httpStatus: http.StatusNotFound,
 			errors:     []string{errs.QueryNoResults},
@@ -803,6 +1877,113 @@ func getDatabaseByAgentDBNameFrom(vars map[string]string) (data.Row, errResult)
 	return meta, errResult{}
 }
 
+func getWebhookByIDFrom(vars map[string]string) (data.Webhook, errResult) {
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return data.Webhook{}, errResult{
+			httpStatus: http.StatusBadRequest,
+			errors:     []string{errs.InvalidURL},
+		}
+	}
+
+	hook, err := db.FetchWebhookByID(id)
+	if err != nil {
+		logger.Error("Fetching webhook failed: %v", err)
+
+		return data.Webhook{}, errResult{
+			httpStatus: http.StatusInternalServerError,
+			errors:     []string{errs.QueryFailed, err.Error()},
+		}
+	}
+
+	if hook.ID == 0 {
+		return data.Webhook{}, errResult{
+			httpStatus: http.StatusNotFound,
+			errors:     []string{errs.QueryNoResults},
+		}
+	}
+
+	return hook, errResult{}
+}
+
+// checkNotes validates the tags and the comment of a database, and
+// returns the tags trimmed and without duplicates.
+func checkNotes(tags []string, comment string) ([]string, errResult) {
+	if len(comment) > maxCommentLength {
+		return nil, errResult{
+			httpStatus: http.StatusBadRequest,
+			errors:     []string{errs.CommentTooLong, fmt.Sprintf("max %d characters", maxCommentLength)},
+		}
+	}
+
+	var res []string
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || (data.Row{Tags: res}).HasTag(tag) {
+			continue
+		}
+
+		if len(tag) > maxTagLength || !tagPattern.MatchString(tag) {
+			return nil, errResult{
+				httpStatus: http.StatusBadRequest,
+				errors:     []string{errs.InvalidTag, tag},
+			}
+		}
+
+		res = append(res, tag)
+	}
+
+	if len(res) > maxTags {
+		return nil, errResult{
+			httpStatus: http.StatusBadRequest,
+			errors:     []string{errs.InvalidTag, fmt.Sprintf("max %d tags", maxTags)},
+		}
+	}
+
+	return res, errResult{}
+}
+
+// removeString returns values without s.
+func removeString(values []string, s string) []string {
+	var res []string
+	for _, v := range values {
+		if v != s {
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
+
+func getTeamByIDFrom(vars map[string]string, key string) (data.Team, errResult) {
+	id, err := strconv.Atoi(vars[key])
+	if err != nil {
+		return data.Team{}, errResult{
+			httpStatus: http.StatusBadRequest,
+			errors:     []string{errs.InvalidURL},
+		}
+	}
+
+	team, err := db.FetchTeamByID(id)
+	if err != nil {
+		logger.Error("Fetching team failed: %v", err)
+
+		return data.Team{}, errResult{
+			httpStatus: http.StatusInternalServerError,
+			errors:     []string{errs.QueryFailed, err.Error()},
+		}
+	}
+
+	if team.ID == 0 {
+		return data.Team{}, errResult{
+			httpStatus: http.StatusNotFound,
+			errors:     []string{errs.QueryNoResults},
+		}
+	}
+
+	return team, errResult{}
+}
+
 /*
 	func method(w http.ResponseWriter, r *http.Request) {}
 */
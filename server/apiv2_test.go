@@ -0,0 +1,1741 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/djavorszky/ddn/client"
+	"github.com/djavorszky/ddn/common/anonymize"
+	"github.com/djavorszky/ddn/common/inet"
+	"github.com/djavorszky/ddn/common/model"
+	"github.com/djavorszky/ddn/common/status"
+	vis "github.com/djavorszky/ddn/common/visibility"
+	"github.com/djavorszky/ddn/server/database/data"
+	"github.com/djavorszky/ddn/server/database/memory"
+	"github.com/djavorszky/ddn/server/hub"
+	"github.com/djavorszky/ddn/server/registry"
+	"github.com/djavorszky/ddn/server/webhook"
+	"github.com/djavorszky/notif"
+)
+
+const (
+	testUser       = "test@example.com"
+	testAgent      = "mysql-55"
+	testAgentToken = "agent-token"
+)
+
+var (
+	testServer *httptest.Server
+	testClient *client.Client
+
+	// agentRequestID holds the request ID last received by the fake agent.
+	agentRequestID atomic.Value
+
+	// agentRequest holds the model.DBRequest last received by the fake agent.
+	agentRequest atomic.Value
+
+	// agentLiferay holds the model.Liferay the fake agent finds when it
+	// inspects a database.
+	agentLiferay atomic.Value
+
+	// agentDrainToken holds the token the fake agent was last asked to
+	// drain with.
+	agentDrainToken atomic.Value
+)
+
+func TestMain(m *testing.M) {
+	cleanup, err := setupTestServer()
+	if err != nil {
+		fmt.Printf("Failed setup: %s", err.Error())
+		os.Exit(-1)
+	}
+
+	res := m.Run()
+
+	cleanup()
+
+	os.Exit(res)
+}
+
+// setupTestServer starts the real router with an in-memory database
+// and a fake agent that accepts every request.
+func setupTestServer() (func(), error) {
+	dir, err := ioutil.TempDir("", "ddn-server-test")
+	if err != nil {
+		return nil, fmt.Errorf("creating temp dir: %v", err)
+	}
+
+	workdir = dir
+	config.DumpURLExpiry = defaultDumpURLExpiry
+	config.UploadMaxPending = defaultUploadMaxPending
+
+	err = os.MkdirAll(filepath.Join(workdir, "web", "dumps"), os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("creating dumps dir: %v", err)
+	}
+
+	mem := &memory.DB{}
+
+	err = mem.ConnectAndPrepare()
+	if err != nil {
+		return nil, fmt.Errorf("preparing database: %v", err)
+	}
+
+	db = mem
+
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agentRequestID.Store(r.Header.Get(inet.RequestIDHeader))
+
+		if r.URL.Path == "/inspect-database" {
+			lr, _ := agentLiferay.Load().(model.Liferay)
+			inet.SendResponse(w, http.StatusOK, model.LiferayMessage{Status: status.Success, Message: "ok", Liferay: lr})
+			return
+		}
+
+		if r.URL.Path == "/api/drain" {
+			agentDrainToken.Store(r.Header.Get(model.AgentTokenHeader))
+			inet.SendResponse(w, http.StatusAccepted, inet.Message{Status: status.Accepted, Message: "draining"})
+			return
+		}
+
+		var dbreq model.DBRequest
+		json.NewDecoder(r.Body).Decode(&dbreq)
+		agentRequest.Store(dbreq)
+
+		inet.SendResponse(w, http.StatusOK, inet.Message{Status: status.Success, Message: "ok"})
+	}))
+
+	loc := strings.LastIndex(agent.URL, ":")
+	registry.Store(model.Agent{
+		ShortName: testAgent,
+		DBVendor:  "mysql",
+		DBAddr:    "localhost",
+		DBPort:    "3306",
+		Address:   agent.URL[:loc],
+		AgentPort: agent.URL[loc+1:],
+		Token:     testAgentToken,
+		Up:        true,
+	})
+
+	testServer = httptest.NewServer(Router())
+	testClient = client.New(testServer.URL, testUser)
+
+	return func() {
+		testServer.Close()
+		agent.Close()
+		mem.Close()
+		os.RemoveAll(dir)
+	}, nil
+}
+
+func TestAPI_create(t *testing.T) {
+	ctx := context.Background()
+
+	row, err := testClient.CreateDatabase(ctx, model.ClientRequest{AgentIdentifier: testAgent})
+	if err != nil {
+		t.Fatalf("CreateDatabase() error = %v", err)
+	}
+
+	if row.ID == 0 || row.DBName == "" || row.Creator != testUser {
+		t.Errorf("CreateDatabase() returned unexpected row: %+v", row)
+	}
+
+	got, err := testClient.Database(ctx, row.ID)
+	if err != nil {
+		t.Fatalf("Database() error = %v", err)
+	}
+
+	if got.DBName != row.DBName {
+		t.Errorf("Database() dbname = %q, want %q", got.DBName, row.DBName)
+	}
+
+	info, err := testClient.AccessInfo(ctx, row.ID)
+	if err != nil {
+		t.Fatalf("AccessInfo() error = %v", err)
+	}
+
+	if info.User != row.DBUser || info.Password != row.DBPass || info.JDBCUrl == "" {
+		t.Errorf("AccessInfo() returned unexpected info: %+v", info)
+	}
+
+	expiry, err := testClient.Extend(ctx, row.ID, 1, "years")
+	if err != nil {
+		t.Fatalf("Extend() error = %v", err)
+	}
+
+	if want := row.ExpiryDate.AddDate(1, 0, 0); !expiry.Equal(want) {
+		t.Errorf("Extend() expiry = %v, want %v", expiry, want)
+	}
+
+	err = testClient.SetVisibility(ctx, row.ID, vis.Public)
+	if err != nil {
+		t.Fatalf("SetVisibility() error = %v", err)
+	}
+
+	rows, err := client.New(testServer.URL, "other@example.com").ListDatabases(ctx)
+	if err != nil {
+		t.Fatalf("ListDatabases() error = %v", err)
+	}
+
+	if !containsRow(rows, row.ID) {
+		t.Errorf("ListDatabases() of other user does not contain public database %d", row.ID)
+	}
+
+	err = testClient.Drop(ctx, row.ID)
+	if err != nil {
+		t.Fatalf("Drop() error = %v", err)
+	}
+
+	_, err = testClient.Database(ctx, row.ID)
+	if !errors.Is(err, client.ErrQueryNoResults) {
+		t.Errorf("Database() after Drop() error = %v, want %v", err, client.ErrQueryNoResults)
+	}
+}
+
+func TestAPI_errors(t *testing.T) {
+	ctx := context.Background()
+
+	row, err := testClient.CreateDatabase(ctx, model.ClientRequest{AgentIdentifier: testAgent})
+	if err != nil {
+		t.Fatalf("CreateDatabase() error = %v", err)
+	}
+	defer testClient.Drop(ctx, row.ID)
+
+	tests := []struct {
+		name    string
+		call    func() error
+		wantErr error
+	}{
+		{"noToken", func() error {
+			_, err := client.New(testServer.URL, "").ListDatabases(ctx)
+			return err
+		}, client.ErrAccessDenied},
+		{"privateOfOther", func() error {
+			_, err := client.New(testServer.URL, "other@example.com").Database(ctx, row.ID)
+			return err
+		}, client.ErrAccessDenied},
+		{"unknownAgent", func() error {
+			_, err := testClient.CreateDatabase(ctx, model.ClientRequest{AgentIdentifier: "nope"})
+			return err
+		}, client.ErrAgentNotFound},
+		{"missingDump", func() error {
+			_, err := testClient.ImportDatabase(ctx, model.ClientRequest{AgentIdentifier: testAgent})
+			return err
+		}, client.ErrMissingParameters},
+		{"noSuchDatabase", func() error {
+			_, err := testClient.Database(ctx, 1000000)
+			return err
+		}, client.ErrQueryNoResults},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAPI_import(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	row, err := testClient.ImportDatabase(ctx, model.ClientRequest{
+		AgentIdentifier: testAgent,
+		DBRequest:       model.DBRequest{DumpLocation: "http://localhost/dump.sql"},
+	})
+	if err != nil {
+		t.Fatalf("ImportDatabase() error = %v", err)
+	}
+	defer testClient.Drop(context.Background(), row.ID)
+
+	// Act as the agent and report back once the server considers the import started.
+	var reported bool
+	progress := func(r data.Row) {
+		if reported || r.Status != status.ImportInProgress {
+			return
+		}
+		reported = true
+
+		err := postUpdate(notif.Msg{ID: r.ID, StatusID: status.Success})
+		if err != nil {
+			t.Errorf("posting update failed: %v", err)
+		}
+	}
+
+	got, err := testClient.WaitForStatus(ctx, row.ID, 10*time.Millisecond, progress)
+	if err != nil {
+		t.Fatalf("WaitForStatus() error = %v", err)
+	}
+
+	if got.Status != status.Success {
+		t.Errorf("WaitForStatus() status = %d, want %d", got.Status, status.Success)
+	}
+}
+
+func TestAPI_anonymize(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "ddn-anonymize-test")
+	if err != nil {
+		t.Fatalf("TempDir() error = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	config.AnonymizationDir = dir
+	defer func() { config.AnonymizationDir = "" }()
+
+	ioutil.WriteFile(filepath.Join(dir, "users.toml"), []byte(`
+[[rule]]
+table = "User_"
+column = "emailAddress"
+action = "email"
+`), 0644)
+
+	sets, err := testClient.RuleSets(ctx)
+	if err != nil || len(sets) != 1 || sets[0].Name != "users" {
+		t.Fatalf("RuleSets() = %+v, %v, want the users rule set", sets, err)
+	}
+
+	_, err = testClient.ImportDatabase(ctx, model.ClientRequest{
+		AgentIdentifier: testAgent,
+		Anonymize:       "missing",
+		DBRequest:       model.DBRequest{DumpLocation: "http://localhost/dump.sql"},
+	})
+	if !errors.Is(err, client.ErrRuleSetNotFound) {
+		t.Errorf("ImportDatabase() with unknown rule set error = %v, want %v", err, client.ErrRuleSetNotFound)
+	}
+
+	// The rules sent by the client are replaced with the server's own.
+	clientRules := &anonymize.RuleSet{Name: "users", Rules: []anonymize.Rule{{Table: "User_", Column: "password_", Action: anonymize.Null}}}
+
+	tests := []struct {
+		name      string
+		anonymize string
+		want      []anonymize.Rule
+	}{
+		{"named", "users", sets[0].Rules},
+		{"none", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row, err := testClient.ImportDatabase(ctx, model.ClientRequest{
+				AgentIdentifier: testAgent,
+				Anonymize:       tt.anonymize,
+				DBRequest:       model.DBRequest{DumpLocation: "http://localhost/dump.sql", Anonymization: clientRules},
+			})
+			if err != nil {
+				t.Fatalf("ImportDatabase() error = %v", err)
+			}
+			defer testClient.Drop(context.Background(), row.ID)
+
+			_, err = testClient.WaitForStatus(ctx, row.ID, 10*time.Millisecond, func(r data.Row) {
+				if r.Status == status.ImportInProgress {
+					postUpdate(notif.Msg{ID: r.ID, StatusID: status.Success})
+				}
+			})
+			if err != nil {
+				t.Fatalf("WaitForStatus() error = %v", err)
+			}
+
+			var got []anonymize.Rule
+			if dbreq, _ := agentRequest.Load().(model.DBRequest); dbreq.Anonymization != nil {
+				got = dbreq.Anonymization.Rules
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("agent received rules %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPI_postImport(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "ddn-postimport-test")
+	if err != nil {
+		t.Fatalf("TempDir() error = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	config.PostImportDir = dir
+	defer func() { config.PostImportDir = "" }()
+
+	os.MkdirAll(filepath.Join(dir, "reset-admin"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dir, "reset-admin", "mysql.sql"), []byte("UPDATE User_ SET password_ = 'test';"), 0644)
+	os.MkdirAll(filepath.Join(dir, "disable-ldap"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dir, "disable-ldap", "postgres.sql"), []byte("DELETE FROM PortalPreferenceValue WHERE key_ LIKE 'ldap.%';"), 0644)
+
+	sets, err := testClient.ScriptSets(ctx)
+	if err != nil {
+		t.Fatalf("ScriptSets() error = %v", err)
+	}
+
+	wantSets := []model.ScriptSet{
+		{Name: "disable-ldap", Vendors: []string{"postgres"}},
+		{Name: "reset-admin", Vendors: []string{"mysql", "mariadb"}},
+	}
+	if !reflect.DeepEqual(sets, wantSets) {
+		t.Errorf("ScriptSets() = %+v, want %+v", sets, wantSets)
+	}
+
+	for _, name := range []string{"missing", "disable-ldap", "../reset-admin"} {
+		_, err = testClient.ImportDatabase(ctx, model.ClientRequest{
+			AgentIdentifier: testAgent,
+			PostImport:      []string{name},
+			DBRequest:       model.DBRequest{DumpLocation: "http://localhost/dump.sql"},
+		})
+		if !errors.Is(err, client.ErrScriptSetNotFound) {
+			t.Errorf("ImportDatabase() with script set %q error = %v, want %v", name, err, client.ErrScriptSetNotFound)
+		}
+	}
+
+	row, err := testClient.ImportDatabase(ctx, model.ClientRequest{
+		AgentIdentifier: testAgent,
+		PostImport:      []string{"reset-admin"},
+		DBRequest:       model.DBRequest{DumpLocation: "http://localhost/dump.sql"},
+	})
+	if err != nil {
+		t.Fatalf("ImportDatabase() error = %v", err)
+	}
+	defer testClient.Drop(context.Background(), row.ID)
+
+	// Act as the agent: run the scripts, then report their failure.
+	output := "-- reset-admin\nRows matched: 1\nScript \"reset-admin\" failed: Table 'User_' doesn't exist"
+
+	var reported bool
+	got, err := testClient.WaitForStatus(ctx, row.ID, 10*time.Millisecond, func(r data.Row) {
+		if reported || r.Status != status.ImportInProgress {
+			return
+		}
+		reported = true
+
+		postUpdate(notif.Msg{ID: r.ID, StatusID: status.RunningScripts, Message: "Running scripts"})
+		postUpdate(notif.Msg{ID: r.ID, StatusID: status.PostImportFailed, Message: output})
+	})
+	if err != nil {
+		t.Fatalf("WaitForStatus() error = %v", err)
+	}
+
+	dbreq, _ := agentRequest.Load().(model.DBRequest)
+	wantScripts := []model.Script{{Name: "reset-admin", SQL: "UPDATE User_ SET password_ = 'test';"}}
+	if !reflect.DeepEqual(dbreq.Scripts, wantScripts) {
+		t.Errorf("agent received scripts %+v, want %+v", dbreq.Scripts, wantScripts)
+	}
+
+	if got.Status != status.PostImportFailed {
+		t.Errorf("WaitForStatus() status = %d, want %d", got.Status, status.PostImportFailed)
+	}
+
+	if got.ScriptOutput != output {
+		t.Errorf("ScriptOutput = %q, want %q", got.ScriptOutput, output)
+	}
+
+	if want := `Script "reset-admin" failed: Table 'User_' doesn't exist`; got.Message != want {
+		t.Errorf("Message = %q, want %q", got.Message, want)
+	}
+}
+
+func TestAPI_inspect(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	lr := model.Liferay{SchemaVersion: "9.2.1", BuildNumber: 7413, Companies: 2, VirtualHosts: []string{"localhost", "portal.example.com"}}
+	agentLiferay.Store(lr)
+	defer agentLiferay.Store(model.Liferay{})
+
+	row, err := testClient.ImportDatabase(ctx, model.ClientRequest{
+		AgentIdentifier: testAgent,
+		DBRequest:       model.DBRequest{DumpLocation: "http://localhost/dump.sql"},
+	})
+	if err != nil {
+		t.Fatalf("ImportDatabase() error = %v", err)
+	}
+	defer testClient.Drop(context.Background(), row.ID)
+
+	if row.Liferay.Known() {
+		t.Errorf("Liferay of a database being imported = %+v, want none", row.Liferay)
+	}
+
+	got, err := testClient.WaitForStatus(ctx, row.ID, 10*time.Millisecond, func(r data.Row) {
+		if r.Status == status.ImportInProgress {
+			postUpdate(notif.Msg{ID: r.ID, StatusID: status.Success})
+		}
+	})
+	if err != nil {
+		t.Fatalf("WaitForStatus() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got.Liferay, lr) {
+		t.Errorf("Liferay = %+v, want %+v", got.Liferay, lr)
+	}
+
+	found, err := testClient.FindDatabases(ctx, data.DatabaseQuery{Search: "PORTAL.example"})
+	if err != nil || len(found) != 1 || found[0].ID != row.ID {
+		t.Errorf("FindDatabases() by virtual host = %+v, %v, want the imported database", found, err)
+	}
+
+	// The access info suggests the DXP driver for the DXP portal.
+	info, err := testClient.AccessInfo(ctx, row.ID)
+	if err != nil {
+		t.Fatalf("AccessInfo() error = %v", err)
+	}
+
+	if want := portalExt(got, true).Driver; info.JDBCDriver != want {
+		t.Errorf("AccessInfo() driver = %q, want %q", info.JDBCDriver, want)
+	}
+}
+
+func TestAPI_upload(t *testing.T) {
+	ctx := context.Background()
+
+	defer func(size, expiry int) {
+		config.UploadMaxSize, config.UploadExpiry = size, expiry
+	}(config.UploadMaxSize, config.UploadExpiry)
+	config.UploadMaxSize, config.UploadExpiry = 1, 1
+
+	dump := []byte("CREATE TABLE users; INSERT INTO users VALUES (1);")
+	sum := sha256.Sum256(dump)
+
+	_, err := testClient.CreateUpload(ctx, "big.sql", 2<<20, "")
+	if !errors.Is(err, client.ErrUploadTooLarge) {
+		t.Errorf("CreateUpload() over the limit error = %v, want %v", err, client.ErrUploadTooLarge)
+	}
+
+	up, err := testClient.CreateUpload(ctx, "../dumps/my dump.sql", int64(len(dump)), "")
+	if err != nil {
+		t.Fatalf("CreateUpload() error = %v", err)
+	}
+
+	if up.Filename != up.ID+"_my_dump.sql" {
+		t.Errorf("CreateUpload() filename = %q, want %q", up.Filename, up.ID+"_my_dump.sql")
+	}
+
+	up, err = testClient.UploadChunk(ctx, up.ID, 0, dump[:20])
+	if err != nil || up.Offset != 20 {
+		t.Fatalf("UploadChunk() = %+v, %v, want offset 20", up, err)
+	}
+
+	_, err = testClient.UploadChunk(ctx, up.ID, 0, dump[:20])
+	if !errors.Is(err, client.ErrUploadOffsetMismatch) {
+		t.Errorf("UploadChunk() at the wrong offset error = %v, want %v", err, client.ErrUploadOffsetMismatch)
+	}
+
+	_, err = testClient.UploadChunk(ctx, up.ID, 20, append(dump[20:], "extra"...))
+	if !errors.Is(err, client.ErrUploadTooLarge) {
+		t.Errorf("UploadChunk() past the size error = %v, want %v", err, client.ErrUploadTooLarge)
+	}
+
+	// Without a Content-Length, the chunk is only found too long while it's
+	// written, and has to be taken back.
+	patch, _ := http.NewRequest(http.MethodPatch, testServer.URL+"/api/uploads/"+up.ID, struct{ io.Reader }{bytes.NewReader(append(dump[20:], "extra"...))})
+	patch.Header.Set("Authorization", testUser)
+	patch.Header.Set(UploadOffsetHeader, "20")
+
+	resp, err := http.DefaultClient.Do(patch)
+	if err != nil {
+		t.Fatalf("PATCH chunked error = %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("PATCH chunked past the size = %d, want %d", resp.StatusCode, http.StatusRequestEntityTooLarge)
+	}
+
+	if cur, _ := testClient.Upload(ctx, up.ID); cur.Offset != 20 || cur.SHA256 != "" {
+		t.Errorf("upload after chunked PATCH past the size = %+v, want offset 20", cur)
+	}
+
+	if fi, err := os.Stat(filepath.Join(workdir, "web", "dumps", up.Filename)); err != nil || fi.Size() != 20 {
+		t.Errorf("file after chunked PATCH past the size = %v, %v, want 20 bytes", fi, err)
+	}
+
+	_, err = client.New(testServer.URL, "other@example.com").Upload(ctx, up.ID)
+	if !errors.Is(err, client.ErrUploadNotFound) {
+		t.Errorf("Upload() of other user error = %v, want %v", err, client.ErrUploadNotFound)
+	}
+
+	req := model.ClientRequest{AgentIdentifier: testAgent, UploadID: up.ID}
+
+	_, err = testClient.ImportDatabase(ctx, req)
+	if !errors.Is(err, client.ErrUploadIncomplete) {
+		t.Errorf("ImportDatabase() of incomplete upload error = %v, want %v", err, client.ErrUploadIncomplete)
+	}
+
+	up, err = testClient.UploadChunk(ctx, up.ID, 20, dump[20:])
+	if err != nil {
+		t.Fatalf("UploadChunk() error = %v", err)
+	}
+
+	if up.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("UploadChunk() sha256 = %q, want %q", up.SHA256, hex.EncodeToString(sum[:]))
+	}
+
+	got, err := ioutil.ReadFile(filepath.Join(workdir, "web", "dumps", up.Filename))
+	if err != nil || !bytes.Equal(got, dump) {
+		t.Errorf("uploaded file = %q, %v, want %q", got, err, dump)
+	}
+
+	row, err := testClient.ImportDatabase(ctx, req)
+	if err != nil {
+		t.Fatalf("ImportDatabase() error = %v", err)
+	}
+	defer testClient.Drop(ctx, row.ID)
+
+	if row.Dumpfile != "my_dump.sql" {
+		t.Errorf("ImportDatabase() dumpfile = %q, want %q", row.Dumpfile, "my_dump.sql")
+	}
+
+	if _, err := os.Stat(filepath.Join(stageDir(row.ID), "my_dump.sql")); err != nil {
+		t.Errorf("upload was not staged for the import: %v", err)
+	}
+
+	_, err = testClient.ImportDatabase(ctx, req)
+	if !errors.Is(err, client.ErrUploadNotFound) {
+		t.Errorf("ImportDatabase() of imported upload error = %v, want %v", err, client.ErrUploadNotFound)
+	}
+
+	// A dump that doesn't match the expected checksum is dropped.
+	up, err = testClient.CreateUpload(ctx, "dump.sql", int64(len(dump)), strings.Repeat("0", 64))
+	if err != nil {
+		t.Fatalf("CreateUpload() error = %v", err)
+	}
+
+	_, err = testClient.UploadChunk(ctx, up.ID, 0, dump)
+	if !errors.Is(err, client.ErrInvalidChecksum) {
+		t.Errorf("UploadChunk() with wrong checksum error = %v, want %v", err, client.ErrInvalidChecksum)
+	}
+
+	if _, err := os.Stat(filepath.Join(workdir, "web", "dumps", up.Filename)); !os.IsNotExist(err) {
+		t.Errorf("file of upload with wrong checksum exists, stat error = %v", err)
+	}
+}
+
+func TestAPI_uploadPending(t *testing.T) {
+	ctx := context.Background()
+
+	defer func(size, pending int) {
+		config.UploadMaxSize, config.UploadMaxPending = size, pending
+	}(config.UploadMaxSize, config.UploadMaxPending)
+	config.UploadMaxSize, config.UploadMaxPending = 1, 2
+
+	c := client.New(testServer.URL, "uploader@example.com")
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		up, err := c.CreateUpload(ctx, "lportal.sql", 10, "")
+		if err != nil {
+			t.Fatalf("CreateUpload() error = %v", err)
+		}
+		ids = append(ids, up.ID)
+	}
+
+	_, err := c.CreateUpload(ctx, "lportal.sql", 10, "")
+	if !errors.Is(err, client.ErrTooManyUploads) {
+		t.Errorf("CreateUpload() over the cap error = %v, want %v", err, client.ErrTooManyUploads)
+	}
+
+	// The cap is per user.
+	up, err := testClient.CreateUpload(ctx, "lportal.sql", 10, "")
+	if err != nil {
+		t.Fatalf("CreateUpload() by another user error = %v", err)
+	}
+	testClient.DeleteUpload(ctx, up.ID)
+
+	err = c.DeleteUpload(ctx, ids[0])
+	if err != nil {
+		t.Fatalf("DeleteUpload() error = %v", err)
+	}
+
+	up, err = c.CreateUpload(ctx, "lportal.sql", 10, "")
+	if err != nil {
+		t.Fatalf("CreateUpload() after deleting one error = %v", err)
+	}
+
+	c.DeleteUpload(ctx, ids[1])
+	c.DeleteUpload(ctx, up.ID)
+}
+
+func TestAPI_uploadFile(t *testing.T) {
+	ctx := context.Background()
+
+	defer func(size, expiry int) {
+		config.UploadMaxSize, config.UploadExpiry = size, expiry
+	}(config.UploadMaxSize, config.UploadExpiry)
+	config.UploadMaxSize, config.UploadExpiry = 1, 1
+
+	f, err := ioutil.TempFile("", "ddn-upload-*.sql")
+	if err != nil {
+		t.Fatalf("TempFile() error = %v", err)
+	}
+	defer os.Remove(f.Name())
+
+	dump := bytes.Repeat([]byte("INSERT INTO users VALUES (1);\n"), 1000)
+	f.Write(dump)
+	f.Close()
+
+	up, err := testClient.UploadFile(ctx, f.Name(), 4096)
+	if err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+
+	sum := sha256.Sum256(dump)
+	if up.Offset != int64(len(dump)) || up.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("UploadFile() = %+v, want all %d bytes with sha256 %x", up, len(dump), sum)
+	}
+
+	// Abandoned uploads are removed once they expire.
+	uploads.Lock()
+	uploads.m[up.ID].updated = time.Now().Add(-2 * time.Hour)
+	uploads.Unlock()
+
+	expireUploads()
+
+	_, err = testClient.Upload(ctx, up.ID)
+	if !errors.Is(err, client.ErrUploadNotFound) {
+		t.Errorf("Upload() of expired upload error = %v, want %v", err, client.ErrUploadNotFound)
+	}
+
+	if _, err := os.Stat(filepath.Join(workdir, "web", "dumps", up.Filename)); !os.IsNotExist(err) {
+		t.Errorf("file of expired upload exists, stat error = %v", err)
+	}
+}
+
+func TestStagedDumps(t *testing.T) {
+	dump := []byte("CREATE TABLE users;")
+
+	f, err := stageFile(-1, "dump.sql")
+	if err != nil {
+		t.Fatalf("stageFile() error = %v", err)
+	}
+	f.Write(dump)
+	f.Close()
+	defer removeStaged(-1)
+
+	signed, err := url.Parse(stagedURL(-1, "dump.sql"))
+	if err != nil {
+		t.Fatalf("stagedURL() is invalid: %v", err)
+	}
+
+	expired := signDump("-1/dump.sql", time.Now().Add(-time.Minute).Unix())
+
+	tests := []struct {
+		name       string
+		uri        string
+		wantStatus int
+	}{
+		{"signed", signed.RequestURI(), http.StatusOK},
+		{"unsigned", "/dumps/-1/dump.sql", http.StatusForbidden},
+		{"otherFile", strings.Replace(signed.RequestURI(), "dump.sql", "other.sql", 1), http.StatusForbidden},
+		{"expired", fmt.Sprintf("/dumps/-1/dump.sql?expires=%d&signature=%s", time.Now().Add(-time.Minute).Unix(), expired), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(testServer.URL + tt.uri)
+			if err != nil {
+				t.Fatalf("GET %s error = %v", tt.uri, err)
+			}
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("GET %s status = %d, want %d", tt.uri, resp.StatusCode, tt.wantStatus)
+			}
+
+			if tt.wantStatus == http.StatusOK && !bytes.Equal(body, dump) {
+				t.Errorf("GET %s = %q, want %q", tt.uri, body, dump)
+			}
+		})
+	}
+
+	// The staged dump is removed once the import finished.
+	row := data.Row{DBName: "staged", AgentName: testAgent, Creator: testUser, Status: status.DownloadInProgress}
+	db.Insert(&row)
+	defer db.Delete(row)
+
+	f, err = stageFile(row.ID, "dump.sql")
+	if err != nil {
+		t.Fatalf("stageFile() error = %v", err)
+	}
+	f.Close()
+
+	postUpdate(notif.Msg{ID: row.ID, StatusID: status.Success})
+
+	if _, err := os.Stat(stageDir(row.ID)); !os.IsNotExist(err) {
+		t.Errorf("staged dump exists after the import finished, stat error = %v", err)
+	}
+}
+
+func TestAPI_webhooks(t *testing.T) {
+	ctx := context.Background()
+
+	received := make(chan webhook.Payload, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get(webhook.SignatureHeader) != webhook.Sign("secret", body) {
+			t.Errorf("signature mismatch: %q", r.Header.Get(webhook.SignatureHeader))
+		}
+
+		var p webhook.Payload
+		json.Unmarshal(body, &p)
+
+		received <- p
+	}))
+	defer receiver.Close()
+
+	hook, err := testClient.CreateWebhook(ctx, data.Webhook{URL: receiver.URL, Secret: "secret", Events: []string{webhook.ImportSucceeded}})
+	if err != nil {
+		t.Fatalf("CreateWebhook() error = %v", err)
+	}
+	defer testClient.DeleteWebhook(ctx, hook.ID)
+
+	_, err = testClient.CreateWebhook(ctx, data.Webhook{URL: receiver.URL, Global: true})
+	if !errors.Is(err, client.ErrAccessDenied) {
+		t.Errorf("CreateWebhook(global) by non-admin error = %v, want %v", err, client.ErrAccessDenied)
+	}
+
+	_, err = testClient.CreateWebhook(ctx, data.Webhook{URL: receiver.URL, Events: []string{"unknown"}})
+	if !errors.Is(err, client.ErrUnknownParameter) {
+		t.Errorf("CreateWebhook(unknown event) error = %v, want %v", err, client.ErrUnknownParameter)
+	}
+
+	row, err := testClient.ImportDatabase(ctx, model.ClientRequest{
+		AgentIdentifier: testAgent,
+		DBRequest:       model.DBRequest{DumpLocation: "http://localhost/dump.sql"},
+	})
+	if err != nil {
+		t.Fatalf("ImportDatabase() error = %v", err)
+	}
+	defer testClient.Drop(ctx, row.ID)
+
+	postUpdate(notif.Msg{ID: row.ID, StatusID: status.ImportInProgress})
+	postUpdate(notif.Msg{ID: row.ID, StatusID: status.Success})
+
+	select {
+	case p := <-received:
+		if p.Event != webhook.ImportSucceeded || p.Database.ID != row.ID {
+			t.Errorf("received %q of database %d, want %q of %d", p.Event, p.Database.ID, webhook.ImportSucceeded, row.ID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("webhook was not called")
+	}
+
+	// The delivery is logged after the webhook responded.
+	var deliveries []data.WebhookDelivery
+	for i := 0; i < 50 && len(deliveries) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		deliveries, _ = testClient.WebhookDeliveries(ctx, hook.ID)
+	}
+
+	if len(deliveries) != 1 || !deliveries[0].Success || deliveries[0].DatabaseID != row.ID {
+		t.Errorf("WebhookDeliveries() = %+v, want one successful delivery", deliveries)
+	}
+
+	_, err = client.New(testServer.URL, "other@example.com").WebhookDeliveries(ctx, hook.ID)
+	if !errors.Is(err, client.ErrAccessDenied) {
+		t.Errorf("WebhookDeliveries() of other user error = %v, want %v", err, client.ErrAccessDenied)
+	}
+}
+
+func TestAPI_events(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	row, err := testClient.ImportDatabase(ctx, model.ClientRequest{
+		AgentIdentifier: testAgent,
+		DBRequest:       model.DBRequest{DumpLocation: "http://localhost/dump.sql"},
+	})
+	if err != nil {
+		t.Fatalf("ImportDatabase() error = %v", err)
+	}
+	defer testClient.Drop(context.Background(), row.ID)
+
+	query := fmt.Sprintf("id=%d", row.ID)
+
+	events, err := streamEvents(ctx, testUser, query, "")
+	if err != nil {
+		t.Fatalf("streamEvents() error = %v", err)
+	}
+
+	others, err := streamEvents(ctx, "other@example.com", query, "")
+	if err != nil {
+		t.Fatalf("streamEvents() of other user error = %v", err)
+	}
+
+	postUpdate(notif.Msg{ID: row.ID, StatusID: status.ImportInProgress})
+	postUpdate(notif.Msg{ID: row.ID, StatusID: status.Success})
+
+	want := []struct {
+		typ    string
+		status int
+	}{
+		{webhook.ImportStarted, status.ImportInProgress},
+		{hub.StatusChanged, status.ImportInProgress},
+		{hub.StatusChanged, status.Success},
+		{webhook.ImportSucceeded, status.Success},
+	}
+
+	var got []hub.Event
+	for range want {
+		select {
+		case e := <-events:
+			got = append(got, e)
+		case <-ctx.Done():
+			t.Fatalf("received %d events, want %d", len(got), len(want))
+		}
+	}
+
+	for i, e := range got {
+		if e.Type != want[i].typ || e.Database.Status != want[i].status || e.Database.ID != row.ID {
+			t.Errorf("event %d = %q with status %d, want %q with status %d", i, e.Type, e.Database.Status, want[i].typ, want[i].status)
+		}
+
+		if e.Database.DBPass != "" {
+			t.Errorf("event %d contains the password of the database", i)
+		}
+	}
+
+	select {
+	case e := <-others:
+		t.Errorf("other user received %q of private database %d", e.Type, e.Database.ID)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Reconnecting after the first event should replay the rest.
+	replayed, err := streamEvents(ctx, testUser, query, fmt.Sprint(got[0].ID))
+	if err != nil {
+		t.Fatalf("streamEvents() with Last-Event-ID error = %v", err)
+	}
+
+	for i := 1; i < len(got); i++ {
+		select {
+		case e := <-replayed:
+			if e.ID != got[i].ID {
+				t.Errorf("replayed event %d, want %d", e.ID, got[i].ID)
+			}
+		case <-ctx.Done():
+			t.Fatalf("replayed %d events, want %d", i-1, len(got)-1)
+		}
+	}
+}
+
+func TestAPI_audit(t *testing.T) {
+	ctx := context.Background()
+
+	config.AdminEmail = []string{"admin@example.com"}
+	defer func() { config.AdminEmail = nil }()
+
+	row, err := testClient.CreateDatabase(ctx, model.ClientRequest{AgentIdentifier: testAgent})
+	if err != nil {
+		t.Fatalf("CreateDatabase() error = %v", err)
+	}
+
+	_, err = testClient.Extend(ctx, row.ID, 2, "days")
+	if err != nil {
+		t.Fatalf("Extend() error = %v", err)
+	}
+
+	err = testClient.Drop(ctx, row.ID)
+	if err != nil {
+		t.Fatalf("Drop() error = %v", err)
+	}
+
+	entries, err := client.New(testServer.URL, "admin@example.com").AuditLog(ctx, data.AuditFilter{DatabaseID: row.ID})
+	if err != nil {
+		t.Fatalf("AuditLog() error = %v", err)
+	}
+
+	want := []string{auditDrop, auditExtend, auditCreate}
+	if len(entries) != len(want) {
+		t.Fatalf("AuditLog() returned %d entries, want %d: %+v", len(entries), len(want), entries)
+	}
+
+	for i, entry := range entries {
+		if entry.Action != want[i] || entry.User != testUser || entry.Agent != testAgent {
+			t.Errorf("entry %d = %+v, want %q by %q on %q", i, entry, want[i], testUser, testAgent)
+		}
+	}
+
+	_, err = testClient.AuditLog(ctx, data.AuditFilter{})
+	if !errors.Is(err, client.ErrAccessDenied) {
+		t.Errorf("AuditLog() of non-admin error = %v, want %v", err, client.ErrAccessDenied)
+	}
+}
+
+func TestAPI_rbac(t *testing.T) {
+	ctx := context.Background()
+
+	config.AdminEmail = []string{"admin@example.com"}
+	defer func() { config.AdminEmail = nil }()
+
+	var (
+		admin    = client.New(testServer.URL, "admin@example.com")
+		teammate = client.New(testServer.URL, "teammate@example.com")
+		other    = client.New(testServer.URL, "other@example.com")
+	)
+
+	_, err := testClient.CreateTeam(ctx, data.Team{Name: "nope"})
+	if !errors.Is(err, client.ErrAccessDenied) {
+		t.Errorf("CreateTeam() by non-admin error = %v, want %v", err, client.ErrAccessDenied)
+	}
+
+	team, err := admin.CreateTeam(ctx, data.Team{Name: "qa", Members: []string{testUser}})
+	if err != nil {
+		t.Fatalf("CreateTeam() error = %v", err)
+	}
+	defer admin.DeleteTeam(ctx, team.ID)
+
+	err = admin.AddTeamMember(ctx, team.ID, "teammate@example.com")
+	if err != nil {
+		t.Fatalf("AddTeamMember() error = %v", err)
+	}
+
+	row, err := testClient.CreateDatabase(ctx, model.ClientRequest{AgentIdentifier: testAgent})
+	if err != nil {
+		t.Fatalf("CreateDatabase() error = %v", err)
+	}
+	defer testClient.Drop(ctx, row.ID)
+
+	err = other.ShareWithTeam(ctx, row.ID, team.ID)
+	if !errors.Is(err, client.ErrAccessDenied) {
+		t.Errorf("ShareWithTeam() by other user error = %v, want %v", err, client.ErrAccessDenied)
+	}
+
+	err = testClient.ShareWithTeam(ctx, row.ID, team.ID)
+	if err != nil {
+		t.Fatalf("ShareWithTeam() error = %v", err)
+	}
+
+	rows, err := teammate.ListDatabases(ctx)
+	if err != nil || !containsRow(rows, row.ID) {
+		t.Errorf("ListDatabases() of teammate = %v, want it to contain database %d", err, row.ID)
+	}
+
+	_, err = teammate.Extend(ctx, row.ID, 1, "days")
+	if err != nil {
+		t.Errorf("Extend() by teammate error = %v", err)
+	}
+
+	_, err = teammate.TransferOwnership(ctx, row.ID, "teammate@example.com", false)
+	if !errors.Is(err, client.ErrAccessDenied) {
+		t.Errorf("TransferOwnership() by teammate error = %v, want %v", err, client.ErrAccessDenied)
+	}
+
+	_, err = teammate.AddCoOwner(ctx, row.ID, "teammate@example.com")
+	if !errors.Is(err, client.ErrAccessDenied) {
+		t.Errorf("AddCoOwner() by teammate error = %v, want %v", err, client.ErrAccessDenied)
+	}
+
+	_, err = other.Database(ctx, row.ID)
+	if !errors.Is(err, client.ErrAccessDenied) {
+		t.Errorf("Database() by other user error = %v, want %v", err, client.ErrAccessDenied)
+	}
+
+	_, err = admin.Database(ctx, row.ID)
+	if err != nil {
+		t.Errorf("Database() by admin error = %v", err)
+	}
+
+	hook, err := teammate.CreateWebhook(ctx, data.Webhook{URL: testServer.URL})
+	if err != nil {
+		t.Fatalf("CreateWebhook() error = %v", err)
+	}
+	defer admin.DeleteWebhook(ctx, hook.ID)
+
+	err = admin.SetRole(ctx, "teammate@example.com", data.RoleReadOnly)
+	if err != nil {
+		t.Fatalf("SetRole() error = %v", err)
+	}
+	defer admin.SetRole(ctx, "teammate@example.com", data.RoleMember)
+
+	_, err = teammate.Database(ctx, row.ID)
+	if err != nil {
+		t.Errorf("Database() by read-only teammate error = %v", err)
+	}
+
+	_, err = teammate.Extend(ctx, row.ID, 1, "days")
+	if !errors.Is(err, client.ErrAccessDenied) {
+		t.Errorf("Extend() by read-only teammate error = %v, want %v", err, client.ErrAccessDenied)
+	}
+
+	_, err = teammate.CreateDatabase(ctx, model.ClientRequest{AgentIdentifier: testAgent})
+	if !errors.Is(err, client.ErrAccessDenied) {
+		t.Errorf("CreateDatabase() by read-only user error = %v, want %v", err, client.ErrAccessDenied)
+	}
+
+	_, err = teammate.CreateWebhook(ctx, data.Webhook{URL: testServer.URL})
+	if !errors.Is(err, client.ErrAccessDenied) {
+		t.Errorf("CreateWebhook() by read-only user error = %v, want %v", err, client.ErrAccessDenied)
+	}
+
+	err = teammate.DeleteWebhook(ctx, hook.ID)
+	if !errors.Is(err, client.ErrAccessDenied) {
+		t.Errorf("DeleteWebhook() by read-only user error = %v, want %v", err, client.ErrAccessDenied)
+	}
+
+	err = testClient.SetRole(ctx, testUser, data.RoleAdmin)
+	if !errors.Is(err, client.ErrAccessDenied) {
+		t.Errorf("SetRole() by non-admin error = %v, want %v", err, client.ErrAccessDenied)
+	}
+}
+
+// streamEvents connects to the event stream as user and sends the received
+// events on the returned channel until ctx is done.
+func streamEvents(ctx context.Context, user, query, lastEventID string) (<-chan hub.Event, error) {
+	req, err := http.NewRequest(http.MethodGet, testServer.URL+"/api/events?"+query, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", user)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	events := make(chan hub.Event, 10)
+
+	go func() {
+		defer resp.Body.Close()
+
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
+
+			var e hub.Event
+			if err := json.Unmarshal([]byte(line[len("data: "):]), &e); err != nil {
+				continue
+			}
+
+			select {
+			case events <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+func postUpdate(msg notif.Msg) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.Post(testServer.URL+"/upd8", "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+func containsRow(rows []data.Row, id int) bool {
+	for _, row := range rows {
+		if row.ID == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestAPI_owners(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		coowner = client.New(testServer.URL, "coowner@example.com")
+		owner   = client.New(testServer.URL, "owner@example.com")
+	)
+
+	row, err := testClient.CreateDatabase(ctx, model.ClientRequest{AgentIdentifier: testAgent})
+	if err != nil {
+		t.Fatalf("CreateDatabase() error = %v", err)
+	}
+	defer coowner.Drop(ctx, row.ID)
+
+	_, err = coowner.AddCoOwner(ctx, row.ID, "coowner@example.com")
+	if !errors.Is(err, client.ErrAccessDenied) {
+		t.Errorf("AddCoOwner() by other user error = %v, want %v", err, client.ErrAccessDenied)
+	}
+
+	row, err = testClient.AddCoOwner(ctx, row.ID, "coowner@example.com")
+	if err != nil {
+		t.Fatalf("AddCoOwner() error = %v", err)
+	}
+
+	if !row.IsOwner("coowner@example.com") {
+		t.Errorf("AddCoOwner() co-owners = %v, want it to contain %q", row.CoOwners, "coowner@example.com")
+	}
+
+	rows, err := coowner.ListDatabases(ctx)
+	if err != nil || !containsRow(rows, row.ID) {
+		t.Errorf("ListDatabases() of co-owner = %v, want it to contain database %d", err, row.ID)
+	}
+
+	_, err = coowner.Extend(ctx, row.ID, 1, "days")
+	if err != nil {
+		t.Errorf("Extend() by co-owner error = %v", err)
+	}
+
+	// Only the creator and the admins can change the owners.
+	_, err = coowner.TransferOwnership(ctx, row.ID, "coowner@example.com", false)
+	if !errors.Is(err, client.ErrAccessDenied) {
+		t.Errorf("TransferOwnership() by co-owner error = %v, want %v", err, client.ErrAccessDenied)
+	}
+
+	_, err = coowner.AddCoOwner(ctx, row.ID, "other@example.com")
+	if !errors.Is(err, client.ErrAccessDenied) {
+		t.Errorf("AddCoOwner() by co-owner error = %v, want %v", err, client.ErrAccessDenied)
+	}
+
+	_, err = coowner.RemoveCoOwner(ctx, row.ID, "coowner@example.com")
+	if !errors.Is(err, client.ErrAccessDenied) {
+		t.Errorf("RemoveCoOwner() by co-owner error = %v, want %v", err, client.ErrAccessDenied)
+	}
+
+	row, err = testClient.TransferOwnership(ctx, row.ID, "owner@example.com", false)
+	if err != nil {
+		t.Fatalf("TransferOwnership() error = %v", err)
+	}
+
+	if row.Creator != "owner@example.com" {
+		t.Errorf("TransferOwnership() creator = %q, want %q", row.Creator, "owner@example.com")
+	}
+
+	if !row.IsOwner(testUser) {
+		t.Errorf("TransferOwnership() co-owners = %v, want the previous creator among them", row.CoOwners)
+	}
+
+	rows, err = owner.ListDatabases(ctx)
+	if err != nil || !containsRow(rows, row.ID) {
+		t.Errorf("ListDatabases() of new owner = %v, want it to contain database %d", err, row.ID)
+	}
+
+	row, err = owner.RemoveCoOwner(ctx, row.ID, testUser)
+	if err != nil {
+		t.Fatalf("RemoveCoOwner() error = %v", err)
+	}
+
+	_, err = testClient.Database(ctx, row.ID)
+	if !errors.Is(err, client.ErrAccessDenied) {
+		t.Errorf("Database() by removed co-owner error = %v, want %v", err, client.ErrAccessDenied)
+	}
+
+	row, err = owner.TransferOwnership(ctx, row.ID, "coowner@example.com", true)
+	if err != nil {
+		t.Fatalf("TransferOwnership() leaving error = %v", err)
+	}
+
+	if row.Creator != "coowner@example.com" || len(row.CoOwners) != 0 {
+		t.Errorf("TransferOwnership() leaving = creator %q, co-owners %v, want %q and none", row.Creator, row.CoOwners, "coowner@example.com")
+	}
+
+	_, err = owner.Database(ctx, row.ID)
+	if !errors.Is(err, client.ErrAccessDenied) {
+		t.Errorf("Database() by previous owner who left error = %v, want %v", err, client.ErrAccessDenied)
+	}
+}
+
+func TestAPI_backup(t *testing.T) {
+	ctx := context.Background()
+
+	config.AdminEmail = []string{"admin@example.com"}
+	defer func() { config.AdminEmail = nil }()
+
+	admin := client.New(testServer.URL, "admin@example.com")
+
+	row, err := testClient.CreateDatabase(ctx, model.ClientRequest{AgentIdentifier: testAgent})
+	if err != nil {
+		t.Fatalf("CreateDatabase() error = %v", err)
+	}
+
+	_, err = testClient.Backup(ctx)
+	if !errors.Is(err, client.ErrAccessDenied) {
+		t.Errorf("Backup() by non-admin error = %v, want %v", err, client.ErrAccessDenied)
+	}
+
+	backup, err := admin.Backup(ctx)
+	if err != nil {
+		t.Fatalf("Backup() error = %v", err)
+	}
+
+	if backup.Format != data.BackupFormat {
+		t.Errorf("Backup() format = %d, want %d", backup.Format, data.BackupFormat)
+	}
+
+	var found bool
+	for _, dbe := range backup.Databases {
+		found = found || (dbe.ID == row.ID && dbe.DBPass == row.DBPass)
+	}
+
+	if !found {
+		t.Errorf("Backup() is missing database %d with its password", row.ID)
+	}
+
+	after, err := testClient.CreateDatabase(ctx, model.ClientRequest{AgentIdentifier: testAgent})
+	if err != nil {
+		t.Fatalf("CreateDatabase() error = %v", err)
+	}
+
+	err = testClient.Restore(ctx, backup)
+	if !errors.Is(err, client.ErrAccessDenied) {
+		t.Errorf("Restore() by non-admin error = %v, want %v", err, client.ErrAccessDenied)
+	}
+
+	err = admin.Restore(ctx, data.Backup{Format: data.BackupFormat + 1})
+	if err == nil {
+		t.Errorf("Restore() of unknown format should have failed")
+	}
+
+	err = admin.Restore(ctx, backup)
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	_, err = testClient.Database(ctx, row.ID)
+	if err != nil {
+		t.Errorf("Database(%d) after Restore() error = %v", row.ID, err)
+	}
+
+	_, err = testClient.Database(ctx, after.ID)
+	if !errors.Is(err, client.ErrQueryNoResults) {
+		t.Errorf("Database(%d) created after the backup error = %v, want %v", after.ID, err, client.ErrQueryNoResults)
+	}
+
+	entries, _ := admin.AuditLog(ctx, data.AuditFilter{User: "admin@example.com", Limit: 1})
+	if len(entries) != 1 || entries[0].Action != auditRestore {
+		t.Errorf("AuditLog() after Restore() = %+v, want a %q entry", entries, auditRestore)
+	}
+}
+
+func TestBackupFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ddn-backup-test")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	names := []string{"20180101-000000", "20180102-000000", "20180103-000000"}
+	for _, name := range names {
+		err = writeBackup(filepath.Join(dir, backupPrefix+name+".json"))
+		if err != nil {
+			t.Fatalf("writeBackup() error = %v", err)
+		}
+	}
+
+	other := filepath.Join(dir, "other.json")
+	err = ioutil.WriteFile(other, []byte("{}"), 0600)
+	if err != nil {
+		t.Fatalf("writing file: %v", err)
+	}
+
+	err = pruneBackups(dir, 2)
+	if err != nil {
+		t.Fatalf("pruneBackups() error = %v", err)
+	}
+
+	for i, name := range names {
+		_, err = os.Stat(filepath.Join(dir, backupPrefix+name+".json"))
+		if kept := err == nil; kept != (i > 0) {
+			t.Errorf("backup %s kept = %t, want %t", name, kept, i > 0)
+		}
+	}
+
+	if _, err = os.Stat(other); err != nil {
+		t.Errorf("pruneBackups() removed a file that is not a backup: %v", err)
+	}
+
+	backup, err := readBackup(filepath.Join(dir, backupPrefix+names[2]+".json"))
+	if err != nil {
+		t.Fatalf("readBackup() error = %v", err)
+	}
+
+	if backup.Format != data.BackupFormat {
+		t.Errorf("readBackup() format = %d, want %d", backup.Format, data.BackupFormat)
+	}
+}
+
+func TestAPI_passwords(t *testing.T) {
+	ctx := context.Background()
+
+	row, err := testClient.CreateDatabase(ctx, model.ClientRequest{AgentIdentifier: testAgent, DBRequest: model.DBRequest{Password: "s3cret"}})
+	if err != nil {
+		t.Fatalf("CreateDatabase() error = %v", err)
+	}
+
+	rows, err := testClient.ListDatabases(ctx)
+	if err != nil {
+		t.Fatalf("ListDatabases() error = %v", err)
+	}
+
+	for _, r := range rows {
+		if r.DBPass != "" {
+			t.Errorf("ListDatabases() returned the password of database %d", r.ID)
+		}
+	}
+
+	info, err := testClient.AccessInfo(ctx, row.ID)
+	if err != nil {
+		t.Fatalf("AccessInfo() error = %v", err)
+	}
+
+	if info.Password != "s3cret" {
+		t.Errorf("AccessInfo() password = %q, want %q", info.Password, "s3cret")
+	}
+
+	// The v1 list leaves them out as well.
+	req, _ := http.NewRequest(http.MethodPost, testServer.URL+"/api/list-databases", nil)
+	req.Header.Set("Authorization", testUser)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST /api/list-databases error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	var list map[int]data.Row
+
+	err = json.NewDecoder(resp.Body).Decode(&list)
+	if err != nil {
+		t.Fatalf("decoding /api/list-databases failed: %v", err)
+	}
+
+	if _, ok := list[row.ID]; !ok {
+		t.Errorf("/api/list-databases doesn't contain database %d", row.ID)
+	}
+
+	for _, r := range list {
+		if r.DBPass != "" {
+			t.Errorf("/api/list-databases returned the password of database %d", r.ID)
+		}
+	}
+}
+
+func TestAPI_listQuery(t *testing.T) {
+	ctx := context.Background()
+
+	lister := client.New(testServer.URL, "lister@example.com")
+
+	var rows []data.Row
+	for _, name := range []string{"list_b", "list_a", "list_c", "other"} {
+		row, err := lister.CreateDatabase(ctx, model.ClientRequest{AgentIdentifier: testAgent, DBRequest: model.DBRequest{DatabaseName: name}})
+		if err != nil {
+			t.Fatalf("CreateDatabase(%q) error = %v", name, err)
+		}
+		defer lister.Drop(ctx, row.ID)
+
+		rows = append(rows, row)
+	}
+
+	found, err := lister.FindDatabases(ctx, data.DatabaseQuery{Name: "LIST_", Sort: data.SortName})
+	if err != nil {
+		t.Fatalf("FindDatabases() error = %v", err)
+	}
+
+	want := []int{rows[1].ID, rows[0].ID, rows[2].ID}
+	if len(found) != len(want) {
+		t.Fatalf("FindDatabases() returned %d databases, want %d", len(found), len(want))
+	}
+
+	for i := range want {
+		if found[i].ID != want[i] {
+			t.Errorf("FindDatabases() database %d is %d, want %d", i, found[i].ID, want[i])
+		}
+	}
+
+	found, err = lister.FindDatabases(ctx, data.DatabaseQuery{Name: "list_", Sort: data.SortName, Limit: 2, Offset: 2})
+	if err != nil || len(found) != 1 || found[0].ID != rows[2].ID {
+		t.Errorf("FindDatabases() of second page = %+v, %v, want database %d", found, err, rows[2].ID)
+	}
+
+	found, _ = testClient.FindDatabases(ctx, data.DatabaseQuery{Name: "list_"})
+	if len(found) != 0 {
+		t.Errorf("FindDatabases() returned %d private databases of another user", len(found))
+	}
+
+	_, err = lister.FindDatabases(ctx, data.DatabaseQuery{Sort: "dbpass"})
+	if !errors.Is(err, client.ErrInvalidURL) {
+		t.Errorf("FindDatabases() with unknown sort error = %v, want %v", err, client.ErrInvalidURL)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, testServer.URL+"/api/databases?name=list_&limit=1", nil)
+	req.Header.Set("Authorization", "lister@example.com")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /api/databases error = %v", err)
+	}
+	resp.Body.Close()
+
+	if total := resp.Header.Get("X-Total-Count"); total != "3" {
+		t.Errorf("X-Total-Count = %q, want %q", total, "3")
+	}
+}
+
+func TestAPI_tags(t *testing.T) {
+	ctx := context.Background()
+
+	tagger := client.New(testServer.URL, "tagger@example.com")
+
+	row, err := tagger.CreateDatabase(ctx, model.ClientRequest{
+		AgentIdentifier: testAgent,
+		Comment:         "Upgrade of the Acme portal",
+		Tags:            []string{" LPS-12345", "acme", "", "ACME"},
+	})
+	if err != nil {
+		t.Fatalf("CreateDatabase() error = %v", err)
+	}
+	defer tagger.Drop(ctx, row.ID)
+
+	if fmt.Sprint(row.Tags) != "[LPS-12345 acme]" || row.Comment != "Upgrade of the Acme portal" {
+		t.Errorf("CreateDatabase() tags = %v, comment = %q", row.Tags, row.Comment)
+	}
+
+	_, err = tagger.CreateDatabase(ctx, model.ClientRequest{AgentIdentifier: testAgent, Tags: []string{"a,b"}})
+	if !errors.Is(err, client.ErrInvalidTag) {
+		t.Errorf("CreateDatabase() with invalid tag error = %v, want %v", err, client.ErrInvalidTag)
+	}
+
+	_, err = testClient.AddTag(ctx, row.ID, "LPS-1")
+	if !errors.Is(err, client.ErrAccessDenied) {
+		t.Errorf("AddTag() by other user error = %v, want %v", err, client.ErrAccessDenied)
+	}
+
+	row, err = tagger.AddTag(ctx, row.ID, "LPS-1")
+	if err != nil {
+		t.Fatalf("AddTag() error = %v", err)
+	}
+
+	row, err = tagger.RemoveTag(ctx, row.ID, "Acme")
+	if err != nil {
+		t.Fatalf("RemoveTag() error = %v", err)
+	}
+
+	if fmt.Sprint(row.Tags) != "[LPS-12345 LPS-1]" {
+		t.Errorf("RemoveTag() tags = %v, want [LPS-12345 LPS-1]", row.Tags)
+	}
+
+	row, err = tagger.SetComment(ctx, row.ID, "Customer: Example Corp")
+	if err != nil {
+		t.Fatalf("SetComment() error = %v", err)
+	}
+
+	_, err = tagger.SetComment(ctx, row.ID, strings.Repeat("x", maxCommentLength+1))
+	if !errors.Is(err, client.ErrCommentTooLong) {
+		t.Errorf("SetComment() with long comment error = %v, want %v", err, client.ErrCommentTooLong)
+	}
+
+	for _, query := range []data.DatabaseQuery{{Tag: "lps-1"}, {Search: "example corp"}} {
+		found, err := tagger.FindDatabases(ctx, query)
+		if err != nil || len(found) != 1 || found[0].ID != row.ID {
+			t.Errorf("FindDatabases(%+v) = %+v, %v, want database %d", query, found, err, row.ID)
+		}
+	}
+
+	found, err := tagger.FindDatabases(ctx, data.DatabaseQuery{Tag: "acme"})
+	if err != nil || len(found) != 0 {
+		t.Errorf("FindDatabases() by removed tag = %+v, %v, want none", found, err)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+
+	row, err := testClient.CreateDatabase(ctx, model.ClientRequest{AgentIdentifier: testAgent})
+	if err != nil {
+		t.Fatalf("CreateDatabase() error = %v", err)
+	}
+	defer testClient.Drop(ctx, row.ID)
+
+	resp, err := http.Get(testServer.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading metrics failed: %v", err)
+	}
+
+	for _, want := range []string{
+		`ddn_server_agents{state="up"} 1`,
+		fmt.Sprintf(`ddn_server_databases{status="%d",vendor="mysql"}`, status.Success),
+		`ddn_http_request_duration_seconds_count{code="200",method="POST",route="api/databases/create"}`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics don't contain %q", want)
+		}
+	}
+}
+
+func TestAPI_requestID(t *testing.T) {
+	body := strings.NewReader(fmt.Sprintf(`{"agent_identifier": %q}`, testAgent))
+
+	req, err := http.NewRequest(http.MethodPost, testServer.URL+"/api/databases/create", body)
+	if err != nil {
+		t.Fatalf("NewRequest() error = %v", err)
+	}
+	req.Header.Set("Authorization", testUser)
+	req.Header.Set(inet.RequestIDHeader, "trace-me")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST /api/databases/create error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	var msg struct {
+		Data data.Row `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&msg)
+	defer testClient.Drop(context.Background(), msg.Data.ID)
+
+	if got := resp.Header.Get(inet.RequestIDHeader); got != "trace-me" {
+		t.Errorf("response request ID = %q, want %q", got, "trace-me")
+	}
+
+	if got, _ := agentRequestID.Load().(string); got != "trace-me" {
+		t.Errorf("agent received request ID %q, want %q", got, "trace-me")
+	}
+
+	resp, err = http.Get(testServer.URL + "/heartbeat")
+	if err != nil {
+		t.Fatalf("GET /heartbeat error = %v", err)
+	}
+	resp.Body.Close()
+
+	if got := resp.Header.Get(inet.RequestIDHeader); got == "" || got == "trace-me" {
+		t.Errorf("generated request ID = %q, want a new one", got)
+	}
+}
+
+func TestAPI_drain(t *testing.T) {
+	ctx := context.Background()
+
+	agent, _ := registry.Get(testAgent)
+	defer registry.Store(agent)
+
+	for _, token := range []string{"", "wrong"} {
+		msg, _ := json.Marshal(model.Agent{ShortName: testAgent, Token: token})
+
+		resp, err := http.Post(testServer.URL+"/drain", "application/json", bytes.NewReader(msg))
+		if err != nil {
+			t.Fatalf("POST /drain error = %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("POST /drain with token %q = %d, want %d", token, resp.StatusCode, http.StatusForbidden)
+		}
+	}
+
+	if got, _ := registry.Get(testAgent); got.Draining {
+		t.Fatalf("agent drained without its token")
+	}
+
+	msg, _ := json.Marshal(model.Agent{ShortName: testAgent, Token: testAgentToken})
+
+	resp, err := http.Post(testServer.URL+"/drain", "application/json", bytes.NewReader(msg))
+	if err != nil {
+		t.Fatalf("POST /drain error = %v", err)
+	}
+	resp.Body.Close()
+
+	if got, _ := registry.Get(testAgent); !got.Draining || !got.Up {
+		t.Fatalf("agent after drain = %+v, want up and draining", got)
+	}
+
+	_, err = testClient.CreateDatabase(ctx, model.ClientRequest{AgentIdentifier: testAgent})
+	if !errors.Is(err, client.ErrAgentDraining) {
+		t.Errorf("CreateDatabase() on draining agent error = %v, want %v", err, client.ErrAgentDraining)
+	}
+
+	_, err = testClient.ListActiveAgents(ctx)
+	if !errors.Is(err, client.ErrNoAgentsAvailable) {
+		t.Errorf("ListActiveAgents() error = %v, want %v", err, client.ErrNoAgentsAvailable)
+	}
+}
+
+func TestAPI_drainAgent(t *testing.T) {
+	ctx := context.Background()
+
+	agent, _ := registry.Get(testAgent)
+	defer registry.Store(agent)
+
+	defer func(admins []string) { config.AdminEmail = admins }(config.AdminEmail)
+	config.AdminEmail = []string{"admin@example.com"}
+
+	agentDrainToken.Store("")
+
+	err := testClient.DrainAgent(ctx, testAgent)
+	if !errors.Is(err, client.ErrAccessDenied) {
+		t.Errorf("DrainAgent() by a user error = %v, want %v", err, client.ErrAccessDenied)
+	}
+
+	if got := agentDrainToken.Load(); got != "" {
+		t.Fatalf("DrainAgent() by a user reached the agent")
+	}
+
+	err = client.New(testServer.URL, "admin@example.com").DrainAgent(ctx, testAgent)
+	if err != nil {
+		t.Fatalf("DrainAgent() by an admin error = %v", err)
+	}
+
+	if got := agentDrainToken.Load(); got != testAgentToken {
+		t.Errorf("agent drained with token %q, want %q", got, testAgentToken)
+	}
+
+	if got, _ := registry.Get(testAgent); !got.Draining {
+		t.Errorf("agent after DrainAgent() = %+v, want draining", got)
+	}
+
+	agents, err := testClient.ListAgents(ctx)
+	if err != nil {
+		t.Fatalf("ListAgents() error = %v", err)
+	}
+
+	for _, a := range agents {
+		if a.Token != "" {
+			t.Errorf("ListAgents() served the token of %s", a.ShortName)
+		}
+	}
+}
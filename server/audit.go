@@ -0,0 +1,82 @@
+package main
+
+import (
+	"time"
+
+	"github.com/djavorszky/ddn/common/logger"
+	"github.com/djavorszky/ddn/server/database/data"
+)
+
+// Actions recorded in the audit log
+const (
+	auditCreate        = "database.create"
+	auditImport        = "database.import"
+	auditDrop          = "database.drop"
+	auditRecreate      = "database.recreate"
+	auditExtend        = "database.extend"
+	auditVisibility    = "database.visibility"
+	auditTransfer      = "database.transfer"
+	auditCoOwnerAdd    = "database.coowner.add"
+	auditCoOwnerRemove = "database.coowner.remove"
+	auditTagAdd        = "database.tag.add"
+	auditTagRemove     = "database.tag.remove"
+	auditComment       = "database.comment"
+	auditRegister      = "agent.register"
+	auditUnregister    = "agent.unregister"
+	auditDrain         = "agent.drain"
+	auditWebhookCreate = "webhook.create"
+	auditWebhookDelete = "webhook.delete"
+	auditSubscribe     = "subscription.save"
+	auditUnsubscribe   = "subscription.remove"
+	auditLogLevel      = "loglevel.set"
+	auditRole          = "user.role"
+	auditTeamCreate    = "team.create"
+	auditTeamDelete    = "team.delete"
+	auditTeamJoin      = "team.member.add"
+	auditTeamLeave     = "team.member.remove"
+	auditBackup        = "server.backup"
+	auditRestore       = "server.restore"
+)
+
+const (
+	// auditLogLimit is the number of entries returned by the API if
+	// no limit is requested.
+	auditLogLimit = 100
+
+	// maxAuditLogLimit is the largest limit that can be requested.
+	maxAuditLogLimit = 1000
+)
+
+// auditSystem is recorded as the user of the actions the server does
+// on its own.
+const auditSystem = "system"
+
+// audit records an action that was done by user on a database.
+func audit(user, action string, dbe data.Row, details string) {
+	writeAudit(data.AuditEntry{
+		User:       user,
+		Action:     action,
+		DatabaseID: dbe.ID,
+		Agent:      dbe.AgentName,
+		Details:    details,
+	})
+}
+
+// auditAgent records an action that was done by or on an agent.
+func auditAgent(user, action, agent, details string) {
+	writeAudit(data.AuditEntry{
+		User:    user,
+		Action:  action,
+		Agent:   agent,
+		Details: details,
+	})
+}
+
+func writeAudit(entry data.AuditEntry) {
+	entry.Date = time.Now()
+
+	err := db.InsertAuditEntry(&entry)
+	if err != nil {
+		logger.Error("failed writing audit log of %q by %q: %v", entry.Action, entry.User, err)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/djavorszky/ddn/common/logger"
+	"github.com/djavorszky/ddn/server/database"
+	"github.com/djavorszky/ddn/server/database/data"
+)
+
+// backupPrefix is how the names of the scheduled backups start. Only the
+// files starting with it are removed when pruning the backup directory.
+const backupPrefix = "ddn-backup-"
+
+// defaultBackupInterval is used if scheduled backups are enabled
+// without an interval.
+const defaultBackupInterval = 24
+
+// createBackup exports everything the server stores.
+func createBackup() (data.Backup, error) {
+	backup, err := db.Export()
+	if err != nil {
+		return data.Backup{}, fmt.Errorf("export failed: %v", err)
+	}
+
+	backup.Format = data.BackupFormat
+	backup.Date = time.Now()
+	backup.Provider = config.DBProvider
+
+	return backup, nil
+}
+
+// restoreBackup replaces everything the server stores with the contents
+// of the backup. The passwords in it are encrypted with the current key.
+func restoreBackup(backup data.Backup) error {
+	if backup.Format < 1 || backup.Format > data.BackupFormat {
+		return fmt.Errorf("unsupported backup format %d", backup.Format)
+	}
+
+	err := db.Restore(backup)
+	if err != nil {
+		return err
+	}
+
+	// The backup may have been taken before encryption was enabled or
+	// with an older key.
+	if enc, ok := db.(database.Encrypted); ok {
+		_, err = enc.Migrate()
+		if err != nil {
+			return fmt.Errorf("encrypting restored passwords failed: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// writeBackup writes a backup to filename. The file is only replaced
+// once the backup has been written completely.
+func writeBackup(filename string) error {
+	backup, err := createBackup()
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding backup failed: %v", err)
+	}
+
+	tmp := filename + ".tmp"
+
+	// The backup contains the passwords of the databases.
+	err = ioutil.WriteFile(tmp, b, 0600)
+	if err != nil {
+		return fmt.Errorf("writing backup failed: %v", err)
+	}
+
+	err = os.Rename(tmp, filename)
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("writing backup failed: %v", err)
+	}
+
+	return nil
+}
+
+// readBackup reads a backup written by writeBackup.
+func readBackup(filename string) (data.Backup, error) {
+	var backup data.Backup
+
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return backup, fmt.Errorf("reading backup failed: %v", err)
+	}
+
+	err = json.Unmarshal(b, &backup)
+	if err != nil {
+		return backup, fmt.Errorf("decoding backup failed: %v", err)
+	}
+
+	return backup, nil
+}
+
+// backupPeriodically writes a backup to config.BackupDir right away and
+// then every config.BackupInterval hours, keeping the latest
+// config.BackupRetention of them.
+func backupPeriodically() {
+	ticker := time.NewTicker(time.Duration(config.BackupInterval) * time.Hour)
+
+	for {
+		filename := filepath.Join(config.BackupDir, backupPrefix+time.Now().Format("20060102-150405")+".json")
+
+		err := writeBackup(filename)
+		if err != nil {
+			logger.Error("Scheduled backup failed: %v", err)
+		} else {
+			logger.Info("Backup written to %s", filename)
+		}
+
+		err = pruneBackups(config.BackupDir, config.BackupRetention)
+		if err != nil {
+			logger.Error("Failed removing old backups: %v", err)
+		}
+
+		<-ticker.C
+	}
+}
+
+// pruneBackups removes all but the latest keep scheduled backups from dir.
+// If keep is not positive, all of them are kept.
+func pruneBackups(dir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, backupPrefix+"*.json"))
+	if err != nil {
+		return err
+	}
+
+	if len(files) <= keep {
+		return nil
+	}
+
+	// The timestamps in the names sort chronologically.
+	sort.Strings(files)
+
+	for _, file := range files[:len(files)-keep] {
+		err = os.Remove(file)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
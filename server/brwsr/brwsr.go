@@ -5,10 +5,20 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
+
+	"github.com/djavorszky/ddn/common/storage"
+)
+
+var (
+	root        string
+	credentials storage.Credentials
 )
 
-var root string
+// remoteTimeout limits connecting to the remote storages.
+const remoteTimeout = 30 * time.Second
 
 const (
 	kb = 1 << 10
@@ -18,8 +28,10 @@ const (
 )
 
 // FileList contains the list of files in a folder and bool to decide whether it's on root or not.
+// Remote is set for the folders of the remote storages, whose Path and Parent are urls.
 type FileList struct {
 	OnRoot  bool
+	Remote  bool
 	Path    string
 	Parent  string
 	Entries []Entry
@@ -62,10 +74,21 @@ func Mount(path string) error {
 	return nil
 }
 
-// List returns the entries in a given path relative to the root path
+// Remote sets the credentials used to list the remote storages.
+func Remote(c storage.Credentials) {
+	credentials = c
+}
+
+// List returns the entries in a given path relative to the root path, or
+// in the folder of a remote storage if relPath is its url, e.g.
+// s3://bucket/folder.
 func List(relPath string) (FileList, error) {
 	var flist FileList
 
+	if storage.Supported(relPath) {
+		return listRemote(relPath)
+	}
+
 	if strings.HasPrefix(relPath, "..") {
 		return flist, fmt.Errorf("relpath starting with '..'")
 	}
@@ -149,6 +172,44 @@ func (e Entry) Importable() bool {
 	return false
 }
 
+func listRemote(loc string) (FileList, error) {
+	var flist FileList
+
+	st, path, err := storage.Dial(loc, credentials, remoteTimeout)
+	if err != nil {
+		return flist, fmt.Errorf("failed connecting: %s", err.Error())
+	}
+	defer st.Close()
+
+	list, err := st.List(path)
+	if err != nil {
+		return flist, fmt.Errorf("failed reading dir: %s", err.Error())
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	for _, item := range list {
+		if strings.HasPrefix(item.Name, ".") {
+			continue
+		}
+
+		flist.Entries = append(flist.Entries, Entry{
+			Name:   item.Name,
+			Path:   storage.Join(loc, item.Name),
+			Size:   item.Size,
+			Folder: item.Folder,
+		})
+	}
+
+	flist.Remote = true
+	flist.Path = loc
+	parent, ok := storage.Parent(loc)
+	flist.Parent = parent
+	flist.OnRoot = !ok
+
+	return flist, nil
+}
+
 func fullPath(relPath string) string {
 	return filepath.Join(root, relPath)
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"github.com/djavorszky/ddn/common/logger"
+	"github.com/djavorszky/ddn/common/storage"
 )
 
 // Config to hold the database server and ddn server configuration
@@ -14,6 +15,7 @@ type Config struct {
 	DBName            string   `toml:"db-name"`
 	ServerHost        string   `toml:"server-host"`
 	ServerPort        string   `toml:"server-port"`
+	ShutdownTimeout   int      `toml:"shutdown-timeout"`
 	SMTPAddr          string   `toml:"smtp-host"`
 	SMTPPort          int      `toml:"smtp-port"`
 	SMTPUser          string   `toml:"smtp-user"`
@@ -25,13 +27,28 @@ type Config struct {
 	WebPushSubscriber string   `toml:"webpush-subscriber"`
 	VAPIDPrivateKey   string   `toml:"vapid-private-key"`
 	GoogleAnalyticsID string   `toml:"google-analytics-id"`
+	WebhookRetries    int      `toml:"webhook-retries"`
+	BackupDir         string   `toml:"backup-dir"`
+	BackupInterval    int      `toml:"backup-interval"`
+	BackupRetention   int      `toml:"backup-retention"`
+	EncryptionKeys    []string `toml:"encryption-keys"`
+	UploadMaxSize     int      `toml:"upload-max-size"`
+	UploadExpiry      int      `toml:"upload-expiry"`
+	UploadMaxPending  int      `toml:"upload-max-pending"`
+	DumpURLExpiry     int      `toml:"dump-url-expiry"`
+	DumpSigningKey    string   `toml:"dump-signing-key"`
+	AnonymizationDir  string   `toml:"anonymization-dir"`
+	PostImportDir     string   `toml:"post-import-dir"`
+
+	// Credentials of the storages that can be browsed for dumps.
+	storage.Credentials
 }
 
 // Print prints the configuration to the log.
 func (c Config) Print() {
 	logger.Info("Database Provider:\t\t%s", c.DBProvider)
 
-	if c.DBProvider == "mysql" {
+	if c.DBProvider == "mysql" || c.DBProvider == "postgres" {
 		logger.Info("Database Address:\t\t%s", c.DBAddress)
 		logger.Info("Database Port:\t\t%s", c.DBPort)
 		logger.Info("Database User:\t\t%s", c.DBUser)
@@ -48,6 +65,26 @@ func (c Config) Print() {
 		logger.Info("Server configured to send emails.")
 	}
 
+	if len(c.EncryptionKeys) != 0 {
+		logger.Info("Database passwords are encrypted.")
+	}
+
+	if c.S3Endpoint != "" {
+		logger.Info("S3 endpoint:\t\t%s", c.S3Endpoint)
+	}
+
+	if c.BackupDir != "" {
+		logger.Info("Backup directory:\t\t%s", c.BackupDir)
+	}
+
+	if c.AnonymizationDir != "" {
+		logger.Info("Anonymization rules:\t%s", c.AnonymizationDir)
+	}
+
+	if c.PostImportDir != "" {
+		logger.Info("Post-import scripts:\t%s", c.PostImportDir)
+	}
+
 	if c.GoogleAnalyticsID != "" {
 		logger.Info("Google analytics enabled.")
 	}
@@ -0,0 +1,26 @@
+package data
+
+import "time"
+
+// AuditEntry is a record of a state-changing action: who did what, when,
+// and to which database or agent.
+type AuditEntry struct {
+	ID         int       `json:"id"`
+	Date       time.Time `json:"date"`
+	User       string    `json:"user"`
+	Action     string    `json:"action"`
+	DatabaseID int       `json:"database_id"`
+	Agent      string    `json:"agent"`
+	Details    string    `json:"details"`
+}
+
+// AuditFilter narrows down the audit entries to fetch. Fields left at
+// their zero value don't filter.
+type AuditFilter struct {
+	User       string
+	DatabaseID int
+	Agent      string
+	From       time.Time
+	To         time.Time
+	Limit      int
+}
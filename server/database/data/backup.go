@@ -0,0 +1,39 @@
+package data
+
+import "time"
+
+// BackupFormat is the version of the backup archive's layout. It is
+// increased whenever a change would make older servers misread it.
+const BackupFormat = 1
+
+// Backup is a portable copy of everything the server stores. A backup
+// taken from one backend can be restored into any other.
+type Backup struct {
+	Format            int                `json:"format"`
+	Date              time.Time          `json:"date"`
+	Provider          string             `json:"provider"`
+	Versions          []Version          `json:"versions"`
+	Databases         []Row              `json:"databases"`
+	PushSubscriptions []PushSubscription `json:"push_subscriptions"`
+	Webhooks          []Webhook          `json:"webhooks"`
+	WebhookDeliveries []WebhookDelivery  `json:"webhook_deliveries"`
+	Users             []User             `json:"users"`
+	Teams             []Team             `json:"teams"`
+	AuditLog          []AuditEntry       `json:"audit_log"`
+}
+
+// Version is an update that has been applied to the tables of the backend.
+type Version struct {
+	ID      int       `json:"id"`
+	Query   string    `json:"query"`
+	Comment string    `json:"comment"`
+	Date    time.Time `json:"date"`
+}
+
+// PushSubscription is a browser of a user that receives push notifications.
+type PushSubscription struct {
+	Subscriber string `json:"subscriber"`
+	Endpoint   string `json:"endpoint"`
+	P256dh     string `json:"p256dh"`
+	Auth       string `json:"auth"`
+}
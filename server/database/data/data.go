@@ -1,8 +1,10 @@
 package data
 
 import (
+	"strings"
 	"time"
 
+	"github.com/djavorszky/ddn/common/model"
 	"github.com/djavorszky/ddn/common/status"
 )
 
@@ -25,6 +27,42 @@ type Row struct {
 	Comment    string    `json:"comment"`
 	Message    string    `json:"message"`
 	Public     int       `json:"public"`
+	Team       int       `json:"team"`
+	CoOwners   []string  `json:"coowners"`
+	Tags       []string  `json:"tags"`
+
+	// ScriptOutput is the output of the post-import scripts, if any.
+	ScriptOutput string `json:"script_output"`
+
+	// Liferay is the portal found in the database after the import.
+	Liferay model.Liferay `json:"liferay"`
+}
+
+// IsOwner returns true if the user is the creator or one of the
+// co-owners of the database.
+func (row Row) IsOwner(user string) bool {
+	if row.Creator == user {
+		return true
+	}
+
+	for _, owner := range row.CoOwners {
+		if owner == user {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasTag returns true if the database is tagged with tag, ignoring case.
+func (row Row) HasTag(tag string) bool {
+	for _, t := range row.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+
+	return false
 }
 
 // InProgress returns true if the DBEntry's status denotes that something's in progress.
@@ -87,6 +125,10 @@ func (row Row) Progress() int {
 		return 50
 	case status.ImportInProgress:
 		return 75
+	case status.AnonymizingDatabase:
+		return 90
+	case status.RunningScripts:
+		return 95
 	default:
 		return 0
 	}
@@ -0,0 +1,83 @@
+package data
+
+import (
+	"strings"
+	"time"
+)
+
+// The fields the databases can be sorted by. Prefixed with SortDesc,
+// they are sorted in descending order.
+const (
+	SortID      = "id"
+	SortName    = "name"
+	SortAgent   = "agent"
+	SortVendor  = "vendor"
+	SortStatus  = "status"
+	SortCreator = "creator"
+	SortCreated = "created"
+	SortExpiry  = "expiry"
+
+	SortDesc = "-"
+)
+
+// DefaultSort lists the newest databases first.
+const DefaultSort = SortDesc + SortID
+
+// ValidSort returns true if sort is one of the fields the databases can
+// be sorted by, optionally prefixed with SortDesc.
+func ValidSort(sort string) bool {
+	switch strings.TrimPrefix(sort, SortDesc) {
+	case SortID, SortName, SortAgent, SortVendor, SortStatus, SortCreator, SortCreated, SortExpiry:
+		return true
+	}
+
+	return false
+}
+
+// DatabaseQuery selects, sorts and pages the databases to fetch. Fields
+// left at their zero value don't filter.
+type DatabaseQuery struct {
+	// VisibleTo limits the databases to the ones the user owns, the
+	// public ones, and the ones shared with one of Teams.
+	VisibleTo string
+	Teams     []int
+
+	Agent          string
+	Vendor         string
+	Status         int
+	Creator        string
+	ExpiringBefore time.Time
+
+	// Name matches the databases whose name contains it, ignoring case.
+	Name string
+
+	// Tag matches the databases tagged with it, ignoring case.
+	Tag string
+
+	// Search matches the databases whose name, tags, comment or Liferay
+	// virtual hosts contain it, ignoring case.
+	Search string
+
+	// Sort is one of the Sort fields, DefaultSort if empty.
+	Sort string
+
+	Offset int
+	Limit  int
+}
+
+// StatusCount is the number of databases of a vendor in a status.
+type StatusCount struct {
+	Status int
+	Vendor string
+	Count  int
+}
+
+// SortField returns the field to sort by and whether the order is descending.
+func (q DatabaseQuery) SortField() (string, bool) {
+	sort := q.Sort
+	if sort == "" {
+		sort = DefaultSort
+	}
+
+	return strings.TrimPrefix(sort, SortDesc), strings.HasPrefix(sort, SortDesc)
+}
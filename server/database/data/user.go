@@ -0,0 +1,53 @@
+package data
+
+// Roles of the users
+const (
+	// RoleAdmin can see and change everything, and manage users and teams.
+	RoleAdmin = "admin"
+
+	// RoleMember can create databases and change the ones they have
+	// access to. Users without a stored role are members.
+	RoleMember = "member"
+
+	// RoleReadOnly can only look at the databases they have access to.
+	RoleReadOnly = "read-only"
+)
+
+// ValidRole returns true if role is one of the known roles.
+func ValidRole(role string) bool {
+	switch role {
+	case RoleAdmin, RoleMember, RoleReadOnly:
+		return true
+	}
+
+	return false
+}
+
+// User is someone who uses ddn, identified by their email address.
+type User struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// CanWrite returns true if the user is allowed to change anything.
+func (user User) CanWrite() bool {
+	return user.Role != RoleReadOnly
+}
+
+// Team is a group of users that databases can be shared with.
+type Team struct {
+	ID      int      `json:"id"`
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+// HasMember returns true if email is a member of the team.
+func (team Team) HasMember(email string) bool {
+	for _, member := range team.Members {
+		if member == email {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,46 @@
+package data
+
+import "time"
+
+// Webhook is an URL that is notified about the lifecycle events
+// of the databases of its owner, or of all databases if it is global.
+type Webhook struct {
+	ID         int       `json:"id"`
+	Owner      string    `json:"owner"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret"`
+	Events     []string  `json:"events"`
+	Global     bool      `json:"global"`
+	CreateDate time.Time `json:"createdate"`
+}
+
+// Wants returns true if the webhook should be notified about event.
+// A webhook without any events wants all of them.
+func (hook Webhook) Wants(event string) bool {
+	if len(hook.Events) == 0 {
+		return true
+	}
+
+	for _, e := range hook.Events {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WebhookDelivery is a single attempt of sending an event to a webhook.
+// Retries of the same event share the DeliveryID.
+type WebhookDelivery struct {
+	ID         int       `json:"id"`
+	WebhookID  int       `json:"webhook_id"`
+	DeliveryID string    `json:"delivery_id"`
+	Event      string    `json:"event"`
+	DatabaseID int       `json:"database_id"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error"`
+	Date       time.Time `json:"date"`
+}
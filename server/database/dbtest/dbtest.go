@@ -0,0 +1,1193 @@
+// Package dbtest contains the conformance test suite of the
+// database.BackendConnection implementations.
+package dbtest
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/djavorszky/ddn/common/model"
+	vis "github.com/djavorszky/ddn/common/visibility"
+	"github.com/djavorszky/ddn/server/database"
+	"github.com/djavorszky/ddn/server/database/data"
+	"github.com/djavorszky/ddn/server/database/dbutil"
+	"github.com/djavorszky/ddn/server/database/secret"
+	webpush "github.com/sherclockholmes/webpush-go"
+)
+
+// Factory returns a connected backend with its tables prepared. It may
+// return the same backend every time, the tests don't expect it to be
+// empty and don't close it.
+type Factory func(t *testing.T) database.BackendConnection
+
+// runID tells the runs of the suite apart, so that they can be repeated
+// on backends that keep the entries of the previous runs.
+var runID string
+
+// Run runs the conformance suite against the backends returned by newDB.
+func Run(t *testing.T, newDB Factory) {
+	runID = strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	tests := []struct {
+		name string
+		test func(t *testing.T, db database.BackendConnection)
+	}{
+		{"Insert", testInsert},
+		{"InsertDuplicate", testInsertDuplicate},
+		{"FetchByID", testFetchByID},
+		{"FetchByDBNameAgent", testFetchByDBNameAgent},
+		{"FetchByCreator", testFetchByCreator},
+		{"FetchPublic", testFetchPublic},
+		{"FetchAll", testFetchAll},
+		{"FetchDatabases", testFetchDatabases},
+		{"FetchDatabasesVisibility", testFetchDatabasesVisibility},
+		{"CountByStatus", testCountByStatus},
+		{"EncryptedPassword", testEncryptedPassword},
+		{"Update", testUpdate},
+		{"UpdateMissing", testUpdateMissing},
+		{"Delete", testDelete},
+		{"CoOwners", testCoOwners},
+		{"PushSubscriptions", testPushSubscriptions},
+		{"Webhooks", testWebhooks},
+		{"AuditLog", testAuditLog},
+		{"Users", testUsers},
+		{"Teams", testTeams},
+		{"Concurrency", testConcurrency},
+		// Restoring replaces everything, it has to run last.
+		{"ExportRestore", testExportRestore},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newDB(t))
+		})
+	}
+}
+
+// name returns a name that is unique to the test and the run of the suite.
+func name(t *testing.T) string {
+	return t.Name() + "-" + runID
+}
+
+// newRow returns a database entry with every field set. The agent name
+// is derived from the test's name so that the entries of the tests don't
+// interfere even if they share the backend.
+func newRow(t *testing.T, dbname string) data.Row {
+	return data.Row{
+		DBName:     dbname,
+		DBUser:     "testUser",
+		DBPass:     "testPass",
+		DBSID:      "testsid",
+		Dumpfile:   "testloc",
+		CreateDate: time.Now(),
+		ExpiryDate: time.Now().AddDate(0, 0, 30),
+		Creator:    name(t) + "@example.com",
+		AgentName:  name(t),
+		DBAddress:  "localhost",
+		DBPort:     "3306",
+		DBVendor:   "mysql",
+		Status:     100,
+		Comment:    "Just some random comment",
+	}
+}
+
+func insert(t *testing.T, db database.BackendConnection, row *data.Row) {
+	err := db.Insert(row)
+	if err != nil {
+		t.Fatalf("Insert(%q) error: %v", row.DBName, err)
+	}
+}
+
+func containsRow(rows []data.Row, id int) bool {
+	for _, row := range rows {
+		if row.ID == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+func testInsert(t *testing.T, db database.BackendConnection) {
+	row := newRow(t, "insert")
+	insert(t, db, &row)
+
+	if row.ID == 0 {
+		t.Errorf("Insert() resulted in id of 0")
+		return
+	}
+
+	other := newRow(t, "insert_2")
+	insert(t, db, &other)
+
+	if other.ID == row.ID {
+		t.Errorf("Insert() reused id %d", row.ID)
+	}
+
+	read, err := db.FetchByID(row.ID)
+	if err != nil {
+		t.Errorf("FetchByID(%d) error: %v", row.ID, err)
+		return
+	}
+
+	if err := dbutil.CompareRows(row, read); err != nil {
+		t.Errorf("Persisted and read results not the same: %v", err)
+	}
+}
+
+func testEncryptedPassword(t *testing.T, db database.BackendConnection) {
+	ring, err := secret.NewKeyring(base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef")))
+	if err != nil {
+		t.Fatalf("NewKeyring() error: %v", err)
+	}
+
+	enc := database.Encrypted{BackendConnection: db, Keys: ring}
+
+	// The encrypted form of the longest password is much longer than it.
+	row := newRow(t, "encrypted")
+	row.DBPass = strings.Repeat("p", 255)
+	insert(t, enc, &row)
+
+	read, err := enc.FetchByID(row.ID)
+	if err != nil {
+		t.Fatalf("FetchByID(%d) error: %v", row.ID, err)
+	}
+
+	if read.DBPass != row.DBPass {
+		t.Errorf("FetchByID() password = %q, want %q", read.DBPass, row.DBPass)
+	}
+
+	_, err = enc.FetchAll()
+	if err != nil {
+		t.Errorf("FetchAll() error: %v", err)
+	}
+}
+
+func testInsertDuplicate(t *testing.T, db database.BackendConnection) {
+	row := newRow(t, "duplicate")
+	insert(t, db, &row)
+
+	dup := newRow(t, "duplicate")
+	err := db.Insert(&dup)
+	if err == nil {
+		t.Errorf("Insert() of existing (dbname, agentName) should have failed")
+	}
+
+	other := newRow(t, "duplicate")
+	other.AgentName += "_other"
+	err = db.Insert(&other)
+	if err != nil {
+		t.Errorf("Insert() of same dbname on other agent error: %v", err)
+	}
+
+	other.AgentName = row.AgentName
+	err = db.Update(&other)
+	if err == nil {
+		t.Errorf("Update() to existing (dbname, agentName) should have failed")
+	}
+}
+
+func testFetchByID(t *testing.T, db database.BackendConnection) {
+	row := newRow(t, "fetchByID")
+	insert(t, db, &row)
+
+	read, err := db.FetchByID(row.ID)
+	if err != nil {
+		t.Errorf("FetchByID(%d) error: %v", row.ID, err)
+		return
+	}
+
+	if err := dbutil.CompareRows(read, row); err != nil {
+		t.Errorf("Fetched result not the same as queried: %v", err)
+	}
+
+	read, err = db.FetchByID(row.ID + 1000000)
+	if err != nil || read.ID != 0 {
+		t.Errorf("FetchByID() of unknown id = %+v, %v, want empty row", read, err)
+	}
+}
+
+func testFetchByDBNameAgent(t *testing.T, db database.BackendConnection) {
+	row := newRow(t, "fetchByDBNameAgent")
+	insert(t, db, &row)
+
+	read, err := db.FetchByDBNameAgent(row.DBName, row.AgentName)
+	if err != nil {
+		t.Errorf("FetchByDBNameAgent(%s, %s) error: %v", row.DBName, row.AgentName, err)
+		return
+	}
+
+	if err := dbutil.CompareRows(read, row); err != nil {
+		t.Errorf("Fetched result not the same as queried: %v", err)
+	}
+
+	read, err = db.FetchByDBNameAgent(row.DBName, "unknown")
+	if err != nil || read.ID != 0 {
+		t.Errorf("FetchByDBNameAgent() of unknown agent = %+v, %v, want empty row", read, err)
+	}
+}
+
+func testFetchByCreator(t *testing.T, db database.BackendConnection) {
+	first := newRow(t, "fetchByCreator_1")
+	insert(t, db, &first)
+
+	second := newRow(t, "fetchByCreator_2")
+	insert(t, db, &second)
+
+	public := newRow(t, "fetchByCreator_public")
+	public.Public = vis.Public
+	insert(t, db, &public)
+
+	other := newRow(t, "fetchByCreator_other")
+	other.Creator = "someone.else@example.com"
+	insert(t, db, &other)
+
+	results, err := db.FetchByCreator(first.Creator)
+	if err != nil {
+		t.Errorf("FetchByCreator() error: %v", err)
+		return
+	}
+
+	if len(results) != 2 {
+		t.Errorf("FetchByCreator() returned %d results, want 2", len(results))
+		return
+	}
+
+	if results[0].ID != second.ID || results[1].ID != first.ID {
+		t.Errorf("FetchByCreator() returned ids %d, %d, want newest first", results[0].ID, results[1].ID)
+	}
+
+	results, err = db.FetchByCreator("nobody@example.com")
+	if err != nil || len(results) != 0 {
+		t.Errorf("FetchByCreator() of unknown user = %+v, %v, want none", results, err)
+	}
+}
+
+func testFetchPublic(t *testing.T, db database.BackendConnection) {
+	private := newRow(t, "fetchPublic_private")
+	insert(t, db, &private)
+
+	public := newRow(t, "fetchPublic")
+	public.Public = vis.Public
+	insert(t, db, &public)
+
+	res, err := db.FetchPublic()
+	if err != nil {
+		t.Errorf("FetchPublic() error: %v", err)
+		return
+	}
+
+	if containsRow(res, private.ID) {
+		t.Errorf("FetchPublic() returned a private entry")
+	}
+
+	for _, row := range res {
+		if row.ID != public.ID {
+			continue
+		}
+
+		if err := dbutil.CompareRows(row, public); err != nil {
+			t.Errorf("Read and persisted mismatch: %v", err)
+		}
+
+		return
+	}
+
+	t.Errorf("FetchPublic() did not return the public entry")
+}
+
+func testFetchAll(t *testing.T, db database.BackendConnection) {
+	private := newRow(t, "fetchAll_private")
+	insert(t, db, &private)
+
+	public := newRow(t, "fetchAll_public")
+	public.Public = vis.Public
+	insert(t, db, &public)
+
+	entries, err := db.FetchAll()
+	if err != nil {
+		t.Errorf("FetchAll() error: %v", err)
+		return
+	}
+
+	if !containsRow(entries, private.ID) || !containsRow(entries, public.ID) {
+		t.Errorf("FetchAll() did not return both entries")
+	}
+
+	for i := 1; i < len(entries); i++ {
+		if entries[i-1].ID < entries[i].ID {
+			t.Errorf("FetchAll() not ordered newest first")
+			return
+		}
+	}
+}
+
+func testFetchDatabases(t *testing.T, db database.BackendConnection) {
+	now := time.Now()
+
+	// The digits decide the order by name regardless of the collation.
+	rows := []data.Row{newRow(t, "query_1abc"), newRow(t, "query_2a_c"), newRow(t, "query_3xyz"), newRow(t, "query_0old")}
+	rows[0].DBVendor, rows[0].Status = "postgres", 200
+	rows[0].Tags = []string{"LPS-12345", "acme"}
+	rows[1].ExpiryDate = now.AddDate(0, 0, 2)
+	rows[1].Comment = "Upgrade of the Acme portal"
+	rows[2].Creator = "other-" + rows[2].Creator
+	rows[2].Tags = []string{"LPS-123"}
+	rows[3].ExpiryDate = now.AddDate(0, 0, 1)
+	rows[3].Liferay = model.Liferay{BuildNumber: 7413, VirtualHosts: []string{"portal.globex.com"}}
+
+	for i := range rows {
+		insert(t, db, &rows[i])
+	}
+
+	agent := rows[0].AgentName
+
+	ids := func(rows []data.Row) []int {
+		var ids []int
+		for _, row := range rows {
+			ids = append(ids, row.ID)
+		}
+
+		return ids
+	}
+
+	tests := []struct {
+		name  string
+		query data.DatabaseQuery
+		want  []data.Row
+	}{
+		{"Agent", data.DatabaseQuery{Agent: agent}, []data.Row{rows[3], rows[2], rows[1], rows[0]}},
+		{"Vendor", data.DatabaseQuery{Agent: agent, Vendor: "postgres"}, []data.Row{rows[0]}},
+		{"Status", data.DatabaseQuery{Agent: agent, Status: 200}, []data.Row{rows[0]}},
+		{"Creator", data.DatabaseQuery{Agent: agent, Creator: rows[2].Creator}, []data.Row{rows[2]}},
+		{"ExpiringBefore", data.DatabaseQuery{Agent: agent, ExpiringBefore: now.AddDate(0, 0, 3)}, []data.Row{rows[3], rows[1]}},
+		{"Name", data.DatabaseQuery{Agent: agent, Name: "QUERY_"}, []data.Row{rows[3], rows[2], rows[1], rows[0]}},
+		{"Name with wildcard", data.DatabaseQuery{Agent: agent, Name: "a_c"}, []data.Row{rows[1]}},
+		{"Tag", data.DatabaseQuery{Agent: agent, Tag: "lps-12345"}, []data.Row{rows[0]}},
+		{"Tag is not a prefix", data.DatabaseQuery{Agent: agent, Tag: "LPS-123"}, []data.Row{rows[2]}},
+		{"Search", data.DatabaseQuery{Agent: agent, Search: "ACME"}, []data.Row{rows[1], rows[0]}},
+		{"Search by name", data.DatabaseQuery{Agent: agent, Search: "xyz"}, []data.Row{rows[2]}},
+		{"Search by tag", data.DatabaseQuery{Agent: agent, Search: "lps-123"}, []data.Row{rows[2], rows[0]}},
+		{"Search by virtual host", data.DatabaseQuery{Agent: agent, Search: "Globex"}, []data.Row{rows[3]}},
+		{"Sort by name", data.DatabaseQuery{Agent: agent, Sort: data.SortName}, []data.Row{rows[3], rows[0], rows[1], rows[2]}},
+		{"Sort by expiry descending", data.DatabaseQuery{Agent: agent, Sort: data.SortDesc + data.SortExpiry}, []data.Row{rows[2], rows[0], rows[1], rows[3]}},
+		{"Sort by id", data.DatabaseQuery{Agent: agent, Sort: data.SortID}, []data.Row{rows[0], rows[1], rows[2], rows[3]}},
+		{"First page", data.DatabaseQuery{Agent: agent, Sort: data.SortID, Limit: 3}, []data.Row{rows[0], rows[1], rows[2]}},
+		{"Last page", data.DatabaseQuery{Agent: agent, Sort: data.SortID, Limit: 3, Offset: 3}, []data.Row{rows[3]}},
+		{"Past the last page", data.DatabaseQuery{Agent: agent, Limit: 3, Offset: 6}, nil},
+	}
+	for _, tt := range tests {
+		read, err := db.FetchDatabases(tt.query)
+		if err != nil {
+			t.Errorf("FetchDatabases() %s error: %v", tt.name, err)
+			continue
+		}
+
+		if fmt.Sprint(ids(read)) != fmt.Sprint(ids(tt.want)) {
+			t.Errorf("FetchDatabases() %s = %v, want %v", tt.name, ids(read), ids(tt.want))
+		}
+	}
+
+	count, err := db.CountDatabases(data.DatabaseQuery{Agent: agent, Limit: 1, Offset: 1})
+	if err != nil || count != len(rows) {
+		t.Errorf("CountDatabases() = %d, %v, want %d", count, err, len(rows))
+	}
+
+	count, err = db.CountDatabases(data.DatabaseQuery{Agent: agent, Name: "xyz"})
+	if err != nil || count != 1 {
+		t.Errorf("CountDatabases() by name = %d, %v, want 1", count, err)
+	}
+}
+
+func testCountByStatus(t *testing.T, db database.BackendConnection) {
+	rows := []data.Row{newRow(t, "count_1"), newRow(t, "count_2"), newRow(t, "count_3")}
+	for i := range rows {
+		rows[i].DBVendor = name(t)
+	}
+	rows[2].Status = 200
+
+	for i := range rows {
+		insert(t, db, &rows[i])
+	}
+
+	counts, err := db.CountByStatus()
+	if err != nil {
+		t.Fatalf("CountByStatus() error: %v", err)
+	}
+
+	got := make(map[int]int)
+	for _, count := range counts {
+		if count.Vendor == name(t) {
+			got[count.Status] = count.Count
+		}
+	}
+
+	if want := map[int]int{100: 2, 200: 1}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("CountByStatus() of vendor = %v, want %v", got, want)
+	}
+}
+
+func testFetchDatabasesVisibility(t *testing.T, db database.BackendConnection) {
+	user := name(t) + "@example.com"
+	other := "other-" + user
+
+	rows := []data.Row{
+		newRow(t, "own"),
+		newRow(t, "coowned"),
+		newRow(t, "private"),
+		newRow(t, "public"),
+		newRow(t, "team"),
+		newRow(t, "other_team"),
+	}
+	rows[1].Creator, rows[1].CoOwners = other, []string{"someone@example.com", user}
+	rows[2].Creator = other
+	rows[3].Creator, rows[3].Public = other, vis.Public
+	rows[4].Creator, rows[4].Public, rows[4].Team = other, vis.Team, 1000001
+	rows[5].Creator, rows[5].Public, rows[5].Team = other, vis.Team, 1000002
+
+	for i := range rows {
+		insert(t, db, &rows[i])
+	}
+
+	read, err := db.FetchDatabases(data.DatabaseQuery{Agent: rows[0].AgentName, VisibleTo: user, Teams: []int{1000001, 1000003}, Sort: data.SortID})
+	if err != nil {
+		t.Fatalf("FetchDatabases() error: %v", err)
+	}
+
+	want := []data.Row{rows[0], rows[1], rows[3], rows[4]}
+	if len(read) != len(want) {
+		t.Fatalf("FetchDatabases() returned %d entries, want %d: %+v", len(read), len(want), read)
+	}
+
+	for i := range want {
+		if read[i].ID != want[i].ID {
+			t.Errorf("FetchDatabases() entry %d is %q, want %q", i, read[i].DBName, want[i].DBName)
+		}
+	}
+
+	read, _ = db.FetchDatabases(data.DatabaseQuery{Agent: rows[0].AgentName, VisibleTo: user})
+	if len(read) != 3 {
+		t.Errorf("FetchDatabases() without teams returned %d entries, want 3", len(read))
+	}
+}
+
+func testUpdate(t *testing.T, db database.BackendConnection) {
+	row := newRow(t, "update")
+	insert(t, db, &row)
+
+	team := data.Team{Name: name(t)}
+	err := db.InsertTeam(&team)
+	if err != nil {
+		t.Errorf("InsertTeam() error: %v", err)
+		return
+	}
+
+	// Every field changes, the row is identified by its ID
+	updated := data.Row{
+		ID:         row.ID,
+		DBName:     "updatedtestDB",
+		DBUser:     "updatedtestUser",
+		DBPass:     "updatedtestPass",
+		DBSID:      "updatedtestsid",
+		Dumpfile:   "updatedtestloc",
+		CreateDate: time.Now().AddDate(0, 0, -1),
+		ExpiryDate: time.Now().AddDate(0, 0, 60),
+		Creator:    "updatedtest@example.com",
+		AgentName:  row.AgentName + "_updated",
+		DBAddress:  "updatedlocalhost",
+		DBPort:     "updated3306",
+		DBVendor:   "updatedsqlite",
+		Message:    "updated",
+		Status:     200,
+		Public:     vis.Team,
+		Team:       team.ID,
+		Comment:    "Something else I suppose",
+		CoOwners:   []string{"co@example.com"},
+		Tags:       []string{"LPS-12345", "acme"},
+
+		ScriptOutput: "-- reset-admin\nQuery OK, 1 row affected",
+		Liferay:      model.Liferay{SchemaVersion: "9.2.1", BuildNumber: 7413, Companies: 2, VirtualHosts: []string{"localhost", "portal.example.com"}},
+	}
+
+	err = db.Update(&updated)
+	if err != nil {
+		t.Errorf("Update() error: %v", err)
+		return
+	}
+
+	if updated.ID != row.ID {
+		t.Errorf("Update() changed the id from %d to %d", row.ID, updated.ID)
+	}
+
+	read, _ := db.FetchByID(row.ID)
+
+	if err := dbutil.CompareRows(updated, read); err != nil {
+		t.Errorf("Updated and read entries not the same: %v", err)
+	}
+}
+
+func testUpdateMissing(t *testing.T, db database.BackendConnection) {
+	row := newRow(t, "updateMissing")
+
+	err := db.Update(&row)
+	if err != nil {
+		t.Errorf("Update() of new entry error: %v", err)
+		return
+	}
+
+	if row.ID == 0 {
+		t.Errorf("Update() of new entry did not insert it")
+		return
+	}
+
+	read, _ := db.FetchByDBNameAgent(row.DBName, row.AgentName)
+	if read.ID != row.ID {
+		t.Errorf("Update() of new entry inserted id %d, read back %d", row.ID, read.ID)
+	}
+}
+
+func testDelete(t *testing.T, db database.BackendConnection) {
+	row := newRow(t, "delete")
+	insert(t, db, &row)
+
+	err := db.Delete(row)
+	if err != nil {
+		t.Errorf("Delete() error: %v", err)
+		return
+	}
+
+	read, _ := db.FetchByID(row.ID)
+	if read.ID == row.ID {
+		t.Errorf("Row was not deleted, managed to fetch it back")
+	}
+
+	err = db.Delete(row)
+	if err != nil {
+		t.Errorf("Delete() of deleted row error: %v", err)
+	}
+
+	// The name can be reused once the database is dropped
+	again := newRow(t, "delete")
+	insert(t, db, &again)
+}
+
+func testCoOwners(t *testing.T, db database.BackendConnection) {
+	prefix := name(t) + "_"
+
+	row := newRow(t, "coOwned")
+	row.Creator = prefix + "owner@example.com"
+	row.CoOwners = []string{prefix + "co1@example.com", prefix + "co2@example.com"}
+	insert(t, db, &row)
+
+	read, err := db.FetchByID(row.ID)
+	if err != nil {
+		t.Errorf("FetchByID() error: %v", err)
+		return
+	}
+
+	if err := dbutil.CompareRows(read, row); err != nil {
+		t.Errorf("Read and persisted mismatch: %v", err)
+	}
+
+	for _, user := range []string{prefix + "owner@example.com", prefix + "co2@example.com"} {
+		rows, err := db.FetchByCreator(user)
+		if err != nil || len(rows) != 1 || rows[0].ID != row.ID {
+			t.Errorf("FetchByCreator(%q) = %+v, %v, want the co-owned database", user, rows, err)
+		}
+	}
+
+	rows, _ := db.FetchByCreator(prefix + "co@example.com")
+	if len(rows) != 0 {
+		t.Errorf("FetchByCreator() matched a partial email: %+v", rows)
+	}
+
+	row.CoOwners = nil
+	db.Update(&row)
+
+	rows, _ = db.FetchByCreator(prefix + "co1@example.com")
+	if len(rows) != 0 {
+		t.Errorf("FetchByCreator() of removed co-owner = %+v, want none", rows)
+	}
+}
+
+func testPushSubscriptions(t *testing.T, db database.BackendConnection) {
+	subscriber := name(t) + "@example.com"
+	subscription := &model.PushSubscription{
+		Endpoint:       "testEndpoint",
+		ExpirationTime: "testExpirationTime",
+		Keys: webpush.Keys{
+			P256dh: "randomTestKey",
+			Auth:   "randomTestAuth",
+		},
+	}
+
+	insertTests := []struct {
+		name         string
+		subscriber   string
+		subscription *model.PushSubscription
+		wantErr      bool
+	}{
+		{"Success", subscriber, subscription, false},
+		{"Duplicate", subscriber, subscription, true},
+		{"Missing Subscriber", "", subscription, true},
+		{"Missing Endpoint", subscriber, &model.PushSubscription{Keys: subscription.Keys}, true},
+	}
+	for _, tt := range insertTests {
+		if err := db.InsertPushSubscription(tt.subscription, tt.subscriber); (err != nil) != tt.wantErr {
+			t.Errorf("InsertPushSubscription() %s error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	fetchTests := []struct {
+		name       string
+		subscriber string
+		wantCount  int
+		wantErr    bool
+	}{
+		{"Success", subscriber, 1, false},
+		{"No subscription for user", "random@user.com", 0, false},
+		{"No user specified", "", 0, true},
+	}
+	for _, tt := range fetchTests {
+		read, err := db.FetchUserPushSubscriptions(tt.subscriber)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("FetchUserPushSubscriptions() %s error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+
+		if len(read) != tt.wantCount {
+			t.Errorf("FetchUserPushSubscriptions() %s returned %d results, want %d", tt.name, len(read), tt.wantCount)
+			continue
+		}
+
+		if tt.wantCount == 0 {
+			continue
+		}
+
+		s := read[0]
+		if s.Endpoint != subscription.Endpoint || s.Keys.Auth != subscription.Keys.Auth || s.Keys.P256dh != subscription.Keys.P256dh {
+			t.Errorf("FetchUserPushSubscriptions() = %+v, want %+v", s, subscription)
+		}
+	}
+
+	deleteTests := []struct {
+		name       string
+		subscriber string
+		endpoint   string
+		wantErr    bool
+	}{
+		{"No Subscription for user", "random@user.com", subscription.Endpoint, false},
+		{"No User specified", "", subscription.Endpoint, true},
+		{"No Endpoint specified", subscriber, "", true},
+		{"Success", subscriber, subscription.Endpoint, false},
+	}
+	for _, tt := range deleteTests {
+		if err := db.DeletePushSubscription(&model.PushSubscription{Endpoint: tt.endpoint}, tt.subscriber); (err != nil) != tt.wantErr {
+			t.Errorf("DeletePushSubscription() %s error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	read, _ := db.FetchUserPushSubscriptions(subscriber)
+	if len(read) != 0 {
+		t.Errorf("DeletePushSubscription() did not delete the subscription")
+	}
+}
+
+func testWebhooks(t *testing.T, db database.BackendConnection) {
+	owner := name(t) + "@example.com"
+
+	hooks := []data.Webhook{
+		{Owner: owner, URL: "http://example.com/1", Secret: "s3cret", Events: []string{"import.succeeded", "import.failed"}, CreateDate: time.Now()},
+		{Owner: owner, URL: "http://example.com/2", CreateDate: time.Now()},
+		{Owner: "admin@example.com", URL: "http://example.com/3", Global: true, CreateDate: time.Now()},
+	}
+
+	for i := range hooks {
+		err := db.InsertWebhook(&hooks[i])
+		if err != nil {
+			t.Errorf("InsertWebhook() error: %v", err)
+			return
+		}
+	}
+
+	err := db.InsertWebhook(&data.Webhook{Owner: owner})
+	if err == nil {
+		t.Errorf("InsertWebhook() without url should have failed")
+	}
+
+	read, err := db.FetchWebhookByID(hooks[0].ID)
+	if err != nil {
+		t.Errorf("FetchWebhookByID(%d) error: %v", hooks[0].ID, err)
+		return
+	}
+
+	if read.URL != hooks[0].URL || read.Secret != hooks[0].Secret || len(read.Events) != 2 || read.Events[1] != "import.failed" {
+		t.Errorf("FetchWebhookByID(%d) = %+v, want %+v", hooks[0].ID, read, hooks[0])
+	}
+
+	owned, err := db.FetchWebhooksByOwner(owner)
+	if err != nil {
+		t.Errorf("FetchWebhooksByOwner() error: %v", err)
+		return
+	}
+
+	if len(owned) != 2 || owned[0].ID != hooks[0].ID || len(owned[1].Events) != 0 {
+		t.Errorf("FetchWebhooksByOwner() = %+v, expected the first two webhooks", owned)
+	}
+
+	global, err := db.FetchGlobalWebhooks()
+	if err != nil {
+		t.Errorf("FetchGlobalWebhooks() error: %v", err)
+		return
+	}
+
+	var found bool
+	for _, hook := range global {
+		if !hook.Global || hook.ID == hooks[0].ID || hook.ID == hooks[1].ID {
+			t.Errorf("FetchGlobalWebhooks() returned non-global webhook %+v", hook)
+		}
+
+		found = found || hook.ID == hooks[2].ID
+	}
+
+	if !found {
+		t.Errorf("FetchGlobalWebhooks() = %+v, expected the global webhook", global)
+	}
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		err = db.InsertWebhookDelivery(&data.WebhookDelivery{
+			WebhookID:  hooks[0].ID,
+			DeliveryID: "delivery",
+			Event:      "import.succeeded",
+			DatabaseID: 1,
+			Attempt:    attempt,
+			StatusCode: 500,
+			Error:      "server error",
+			Date:       time.Now(),
+		})
+		if err != nil {
+			t.Errorf("InsertWebhookDelivery() error: %v", err)
+			return
+		}
+	}
+
+	deliveries, err := db.FetchWebhookDeliveries(hooks[0].ID, 2)
+	if err != nil {
+		t.Errorf("FetchWebhookDeliveries() error: %v", err)
+		return
+	}
+
+	if len(deliveries) != 2 || deliveries[0].Attempt != 3 || deliveries[0].Success {
+		t.Errorf("FetchWebhookDeliveries() = %+v, expected the last two attempts", deliveries)
+	}
+
+	err = db.DeleteWebhook(hooks[0])
+	if err != nil {
+		t.Errorf("DeleteWebhook() error: %v", err)
+		return
+	}
+
+	read, _ = db.FetchWebhookByID(hooks[0].ID)
+	if read.ID != 0 {
+		t.Errorf("Webhook was not deleted, managed to fetch it back")
+	}
+
+	deliveries, _ = db.FetchWebhookDeliveries(hooks[0].ID, 10)
+	if len(deliveries) != 0 {
+		t.Errorf("Deliveries of deleted webhook were not deleted")
+	}
+}
+
+func testAuditLog(t *testing.T, db database.BackendConnection) {
+	var (
+		start = time.Now().Add(-time.Hour)
+		user  = name(t) + "@example.com"
+		agent = name(t)
+	)
+
+	entries := []data.AuditEntry{
+		{Date: start, User: user, Action: "database.create", DatabaseID: 1, Agent: agent},
+		{Date: start.Add(10 * time.Minute), User: user, Action: "database.extend", DatabaseID: 1, Agent: agent, Details: "1 months"},
+		{Date: start.Add(20 * time.Minute), User: "other@example.com", Action: "database.drop", DatabaseID: 2, Agent: agent},
+		{Date: start.Add(30 * time.Minute), Action: "agent.register", Agent: agent + "-2"},
+	}
+
+	for i := range entries {
+		err := db.InsertAuditEntry(&entries[i])
+		if err != nil {
+			t.Errorf("InsertAuditEntry() error: %v", err)
+			return
+		}
+	}
+
+	err := db.InsertAuditEntry(&data.AuditEntry{User: user, Date: time.Now()})
+	if err == nil {
+		t.Errorf("InsertAuditEntry() without action should have failed")
+	}
+
+	tests := []struct {
+		name    string
+		filter  data.AuditFilter
+		wantIDs []int
+	}{
+		{"user", data.AuditFilter{User: user}, []int{entries[1].ID, entries[0].ID}},
+		{"database", data.AuditFilter{Agent: agent, DatabaseID: 2}, []int{entries[2].ID}},
+		{"agent", data.AuditFilter{Agent: agent + "-2"}, []int{entries[3].ID}},
+		{"timeRange", data.AuditFilter{Agent: agent, From: start.Add(5 * time.Minute), To: start.Add(20 * time.Minute)}, []int{entries[1].ID}},
+		{"limit", data.AuditFilter{Agent: agent, Limit: 1}, []int{entries[2].ID}},
+	}
+	for _, tt := range tests {
+		got, err := db.FetchAuditEntries(tt.filter)
+		if err != nil {
+			t.Errorf("FetchAuditEntries() %s error: %v", tt.name, err)
+			continue
+		}
+
+		if len(got) != len(tt.wantIDs) {
+			t.Errorf("FetchAuditEntries() %s returned %d entries, want %d", tt.name, len(got), len(tt.wantIDs))
+			continue
+		}
+
+		for i, entry := range got {
+			if entry.ID != tt.wantIDs[i] {
+				t.Errorf("FetchAuditEntries() %s entry %d has ID %d, want %d", tt.name, i, entry.ID, tt.wantIDs[i])
+			}
+		}
+	}
+
+	got, _ := db.FetchAuditEntries(data.AuditFilter{User: user, DatabaseID: 1, Limit: 1})
+	if len(got) != 1 || got[0].Details != "1 months" || got[0].Action != "database.extend" {
+		t.Errorf("FetchAuditEntries() = %+v, want %+v", got, entries[1])
+	}
+}
+
+func testUsers(t *testing.T, db database.BackendConnection) {
+	email := name(t) + "@example.com"
+
+	user, err := db.FetchUser("nobody@example.com")
+	if err != nil || user.Email != "" {
+		t.Errorf("FetchUser() of unknown user = %+v, %v, want empty user", user, err)
+	}
+
+	err = db.SaveUser(data.User{Email: email, Role: data.RoleReadOnly})
+	if err != nil {
+		t.Errorf("SaveUser() error: %v", err)
+		return
+	}
+
+	err = db.SaveUser(data.User{Email: email, Role: data.RoleAdmin})
+	if err != nil {
+		t.Errorf("SaveUser() of existing user error: %v", err)
+		return
+	}
+
+	user, err = db.FetchUser(email)
+	if err != nil || user.Role != data.RoleAdmin {
+		t.Errorf("FetchUser() = %+v, %v, want role %q", user, err, data.RoleAdmin)
+	}
+
+	users, err := db.FetchUsers()
+	if err != nil {
+		t.Errorf("FetchUsers() error: %v", err)
+	}
+
+	var count int
+	for _, u := range users {
+		if u.Email == email {
+			count++
+		}
+	}
+
+	if count != 1 {
+		t.Errorf("FetchUsers() returned the user %d times, want once", count)
+	}
+
+	err = db.SaveUser(data.User{Email: email})
+	if err == nil {
+		t.Errorf("SaveUser() without role should have failed")
+	}
+}
+
+func testTeams(t *testing.T, db database.BackendConnection) {
+	prefix := name(t) + "_"
+
+	team := data.Team{Name: name(t), Members: []string{prefix + "a@example.com", prefix + "b@example.com"}}
+
+	err := db.InsertTeam(&team)
+	if err != nil {
+		t.Errorf("InsertTeam() error: %v", err)
+		return
+	}
+
+	err = db.InsertTeam(&data.Team{Name: team.Name})
+	if err == nil {
+		t.Errorf("InsertTeam() with existing name should have failed")
+	}
+
+	err = db.InsertTeam(&data.Team{})
+	if err == nil {
+		t.Errorf("InsertTeam() without name should have failed")
+	}
+
+	err = db.AddTeamMember(team.ID, prefix+"c@example.com")
+	if err != nil {
+		t.Errorf("AddTeamMember() error: %v", err)
+		return
+	}
+
+	err = db.AddTeamMember(team.ID, prefix+"c@example.com")
+	if err != nil {
+		t.Errorf("AddTeamMember() of existing member error: %v", err)
+	}
+
+	err = db.RemoveTeamMember(team.ID, prefix+"a@example.com")
+	if err != nil {
+		t.Errorf("RemoveTeamMember() error: %v", err)
+	}
+
+	read, err := db.FetchTeamByID(team.ID)
+	if err != nil {
+		t.Errorf("FetchTeamByID(%d) error: %v", team.ID, err)
+		return
+	}
+
+	if read.Name != team.Name || len(read.Members) != 2 || read.HasMember(prefix+"a@example.com") || !read.HasMember(prefix+"c@example.com") {
+		t.Errorf("FetchTeamByID(%d) = %+v, want members b and c", team.ID, read)
+	}
+
+	teams, err := db.FetchTeams()
+	if err != nil {
+		t.Errorf("FetchTeams() error: %v", err)
+	}
+
+	var found bool
+	for _, tm := range teams {
+		found = found || (tm.ID == team.ID && len(tm.Members) == 2)
+	}
+
+	if !found {
+		t.Errorf("FetchTeams() = %+v, want it to contain the team with its members", teams)
+	}
+
+	teams, err = db.FetchTeamsByMember(prefix + "b@example.com")
+	if err != nil || len(teams) != 1 || teams[0].ID != team.ID {
+		t.Errorf("FetchTeamsByMember() = %+v, %v, want the team", teams, err)
+	}
+
+	teams, err = db.FetchTeamsByMember(prefix + "a@example.com")
+	if err != nil || len(teams) != 0 {
+		t.Errorf("FetchTeamsByMember() of removed member = %+v, %v, want none", teams, err)
+	}
+
+	row := newRow(t, "sharedWithTeam")
+	row.Public = vis.Team
+	row.Team = team.ID
+	insert(t, db, &row)
+
+	shared, err := db.FetchByTeam(team.ID)
+	if err != nil || len(shared) != 1 || shared[0].ID != row.ID {
+		t.Errorf("FetchByTeam() = %+v, %v, want the shared database", shared, err)
+	}
+
+	err = db.DeleteTeam(team)
+	if err != nil {
+		t.Errorf("DeleteTeam() error: %v", err)
+		return
+	}
+
+	read, _ = db.FetchTeamByID(team.ID)
+	if read.ID != 0 {
+		t.Errorf("FetchTeamByID() after DeleteTeam() = %+v, want no team", read)
+	}
+
+	row, _ = db.FetchByID(row.ID)
+	if row.Public != vis.Private || row.Team != 0 {
+		t.Errorf("database shared with deleted team has visibility %d and team %d, want private", row.Public, row.Team)
+	}
+}
+
+// testConcurrency inserts, updates and reads entries from several
+// goroutines at once, the way the server's handlers do.
+func testConcurrency(t *testing.T, db database.BackendConnection) {
+	const workers = 10
+
+	var wg sync.WaitGroup
+
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			row := newRow(t, fmt.Sprintf("concurrent_%d", i))
+
+			err := db.Insert(&row)
+			if err != nil {
+				errs <- fmt.Errorf("Insert() error: %v", err)
+				return
+			}
+
+			row.Status = 200 + i
+			err = db.Update(&row)
+			if err != nil {
+				errs <- fmt.Errorf("Update() error: %v", err)
+				return
+			}
+
+			read, err := db.FetchByID(row.ID)
+			if err != nil {
+				errs <- fmt.Errorf("FetchByID() error: %v", err)
+				return
+			}
+
+			if err := dbutil.CompareRows(row, read); err != nil {
+				errs <- fmt.Errorf("Updated and read entries not the same: %v", err)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	rows, err := db.FetchByCreator(name(t) + "@example.com")
+	if err != nil || len(rows) != workers {
+		t.Errorf("FetchByCreator() returned %d entries, %v, want %d", len(rows), err, workers)
+	}
+}
+
+func testExportRestore(t *testing.T, db database.BackendConnection) {
+	user := name(t) + "@example.com"
+
+	row := newRow(t, "export")
+	row.CoOwners = []string{"co@example.com"}
+	row.Tags = []string{"LPS-12345"}
+	row.ScriptOutput = "done"
+	row.Liferay = model.Liferay{BuildNumber: 6210, Companies: 1, VirtualHosts: []string{"localhost"}}
+	insert(t, db, &row)
+
+	err := db.InsertPushSubscription(&model.PushSubscription{Endpoint: "exportEndpoint", Keys: webpush.Keys{P256dh: "key", Auth: "auth"}}, user)
+	if err != nil {
+		t.Fatalf("InsertPushSubscription() error: %v", err)
+	}
+
+	hook := data.Webhook{Owner: user, URL: "http://example.com/export", Events: []string{"import.succeeded"}, CreateDate: time.Now()}
+	err = db.InsertWebhook(&hook)
+	if err != nil {
+		t.Fatalf("InsertWebhook() error: %v", err)
+	}
+
+	delivery := data.WebhookDelivery{WebhookID: hook.ID, DeliveryID: "export", Event: "import.succeeded", DatabaseID: row.ID, Attempt: 1, StatusCode: 200, Success: true, Date: time.Now()}
+	err = db.InsertWebhookDelivery(&delivery)
+	if err != nil {
+		t.Fatalf("InsertWebhookDelivery() error: %v", err)
+	}
+
+	err = db.SaveUser(data.User{Email: user, Role: data.RoleAdmin})
+	if err != nil {
+		t.Fatalf("SaveUser() error: %v", err)
+	}
+
+	team := data.Team{Name: name(t), Members: []string{user}}
+	err = db.InsertTeam(&team)
+	if err != nil {
+		t.Fatalf("InsertTeam() error: %v", err)
+	}
+
+	entry := data.AuditEntry{Date: time.Now(), User: user, Action: "database.export", DatabaseID: row.ID}
+	err = db.InsertAuditEntry(&entry)
+	if err != nil {
+		t.Fatalf("InsertAuditEntry() error: %v", err)
+	}
+
+	backup, err := db.Export()
+	if err != nil {
+		t.Fatalf("Export() error: %v", err)
+	}
+
+	if !containsRow(backup.Databases, row.ID) {
+		t.Errorf("Export() is missing database %d", row.ID)
+	}
+
+	after := newRow(t, "export_after")
+	insert(t, db, &after)
+
+	err = db.Restore(backup)
+	if err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+
+	read, err := db.FetchByID(row.ID)
+	if err != nil {
+		t.Fatalf("FetchByID(%d) error: %v", row.ID, err)
+	}
+
+	if err := dbutil.CompareRows(row, read); err != nil {
+		t.Errorf("Restored and original database not the same: %v", err)
+	}
+
+	read, _ = db.FetchByID(after.ID)
+	if read.ID != 0 {
+		t.Errorf("Restore() kept database %d that was not in the backup", after.ID)
+	}
+
+	subscriptions, _ := db.FetchUserPushSubscriptions(user)
+	if len(subscriptions) != 1 || subscriptions[0].Keys.Auth != "auth" {
+		t.Errorf("FetchUserPushSubscriptions() after Restore() = %+v, want the exported one", subscriptions)
+	}
+
+	readHook, _ := db.FetchWebhookByID(hook.ID)
+	if readHook.URL != hook.URL || !readHook.Wants("import.succeeded") || readHook.Wants("import.failed") {
+		t.Errorf("FetchWebhookByID() after Restore() = %+v, want %+v", readHook, hook)
+	}
+
+	deliveries, _ := db.FetchWebhookDeliveries(hook.ID, 10)
+	if len(deliveries) != 1 || deliveries[0].ID != delivery.ID || deliveries[0].DeliveryID != delivery.DeliveryID {
+		t.Errorf("FetchWebhookDeliveries() after Restore() = %+v, want the exported delivery", deliveries)
+	}
+
+	readUser, _ := db.FetchUser(user)
+	if readUser.Role != data.RoleAdmin {
+		t.Errorf("FetchUser() after Restore() = %+v, want role %q", readUser, data.RoleAdmin)
+	}
+
+	readTeam, _ := db.FetchTeamByID(team.ID)
+	if readTeam.Name != team.Name || !readTeam.HasMember(user) {
+		t.Errorf("FetchTeamByID() after Restore() = %+v, want %+v", readTeam, team)
+	}
+
+	entries, _ := db.FetchAuditEntries(data.AuditFilter{User: user})
+	if len(entries) != 1 || entries[0].ID != entry.ID {
+		t.Errorf("FetchAuditEntries() after Restore() = %+v, want the exported entry", entries)
+	}
+
+	// New entries must not reuse the restored IDs.
+	next := newRow(t, "export_next")
+	insert(t, db, &next)
+
+	read, _ = db.FetchByID(row.ID)
+	if read.DBName != row.DBName {
+		t.Errorf("Insert() after Restore() overwrote database %d", row.ID)
+	}
+
+	broken := backup
+	broken.Databases = append([]data.Row{row}, backup.Databases...)
+
+	err = db.Restore(broken)
+	if err == nil {
+		t.Errorf("Restore() with duplicate databases should have failed")
+	}
+
+	read, _ = db.FetchByID(next.ID)
+	if read.ID != next.ID {
+		t.Errorf("Restore() that failed changed the stored databases")
+	}
+}
@@ -3,6 +3,7 @@ package dbutil
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/djavorszky/ddn/server/database/data"
@@ -78,12 +79,41 @@ func CompareRows(first, second data.Row) error {
 		return fmt.Errorf("Public mismatch. First: %q vs Second: %q", first.Public, second.Public)
 	}
 
+	if first.Team != second.Team {
+		return fmt.Errorf("Team mismatch. First: %d vs Second: %d", first.Team, second.Team)
+	}
+
+	if JoinList(first.CoOwners) != JoinList(second.CoOwners) {
+		return fmt.Errorf("CoOwners mismatch. First: %q vs Second: %q", first.CoOwners, second.CoOwners)
+	}
+
+	if JoinList(first.Tags) != JoinList(second.Tags) {
+		return fmt.Errorf("Tags mismatch. First: %q vs Second: %q", first.Tags, second.Tags)
+	}
+
+	if first.ScriptOutput != second.ScriptOutput {
+		return fmt.Errorf("ScriptOutput mismatch. First: %q vs Second: %q", first.ScriptOutput, second.ScriptOutput)
+	}
+
+	if first.Liferay.BuildNumber != second.Liferay.BuildNumber || first.Liferay.SchemaVersion != second.Liferay.SchemaVersion || first.Liferay.Companies != second.Liferay.Companies {
+		return fmt.Errorf("Liferay mismatch. First: %+v vs Second: %+v", first.Liferay, second.Liferay)
+	}
+
+	if JoinList(first.Liferay.VirtualHosts) != JoinList(second.Liferay.VirtualHosts) {
+		return fmt.Errorf("Liferay.VirtualHosts mismatch. First: %q vs Second: %q", first.Liferay.VirtualHosts, second.Liferay.VirtualHosts)
+	}
+
 	return nil
 }
 
 // ReadRow reads an sql.Row into a data.Row
 func ReadRow(result *sql.Row) (data.Row, error) {
-	var row data.Row
+	var (
+		row          data.Row
+		coOwners     string
+		tags         string
+		virtualHosts string
+	)
 
 	err := result.Scan(
 		&row.ID,
@@ -102,17 +132,34 @@ func ReadRow(result *sql.Row) (data.Row, error) {
 		&row.Status,
 		&row.Message,
 		&row.Public,
-		&row.Comment)
+		&row.Comment,
+		&row.Team,
+		&coOwners,
+		&tags,
+		&row.ScriptOutput,
+		&row.Liferay.BuildNumber,
+		&row.Liferay.SchemaVersion,
+		&row.Liferay.Companies,
+		&virtualHosts)
 	if err != nil && err != sql.ErrNoRows {
 		return row, fmt.Errorf("failed reading row: %v", err)
 	}
 
+	row.CoOwners = SplitList(coOwners)
+	row.Tags = SplitList(tags)
+	row.Liferay.VirtualHosts = SplitList(virtualHosts)
+
 	return row, nil
 }
 
 // ReadRows reads an sql.Rows into a data.Row
 func ReadRows(rows *sql.Rows) (data.Row, error) {
-	var row data.Row
+	var (
+		row          data.Row
+		coOwners     string
+		tags         string
+		virtualHosts string
+	)
 
 	err := rows.Scan(
 		&row.ID,
@@ -131,11 +178,23 @@ func ReadRows(rows *sql.Rows) (data.Row, error) {
 		&row.Status,
 		&row.Message,
 		&row.Public,
-		&row.Comment)
+		&row.Comment,
+		&row.Team,
+		&coOwners,
+		&tags,
+		&row.ScriptOutput,
+		&row.Liferay.BuildNumber,
+		&row.Liferay.SchemaVersion,
+		&row.Liferay.Companies,
+		&virtualHosts)
 	if err != nil && err != sql.ErrNoRows {
 		return row, fmt.Errorf("failed reading row: %v", err)
 	}
 
+	row.CoOwners = SplitList(coOwners)
+	row.Tags = SplitList(tags)
+	row.Liferay.VirtualHosts = SplitList(virtualHosts)
+
 	return row, nil
 }
 
@@ -153,3 +212,198 @@ func ReadSubscriptionRows(rows *sql.Rows) (webpush.Subscription, error) {
 
 	return row, nil
 }
+
+// Scanner is implemented by both *sql.Row and *sql.Rows
+type Scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// ReadWebhook reads a row of the webhooks table into a data.Webhook
+func ReadWebhook(row Scanner) (data.Webhook, error) {
+	var (
+		hook   data.Webhook
+		events string
+	)
+
+	err := row.Scan(
+		&hook.ID,
+		&hook.Owner,
+		&hook.URL,
+		&hook.Secret,
+		&events,
+		&hook.Global,
+		&hook.CreateDate)
+	if err != nil && err != sql.ErrNoRows {
+		return hook, fmt.Errorf("failed reading row: %v", err)
+	}
+
+	hook.Events = SplitList(events)
+
+	return hook, nil
+}
+
+// ReadWebhookDelivery reads a row of the webhook_deliveries table into a data.WebhookDelivery
+func ReadWebhookDelivery(row Scanner) (data.WebhookDelivery, error) {
+	var delivery data.WebhookDelivery
+
+	err := row.Scan(
+		&delivery.ID,
+		&delivery.WebhookID,
+		&delivery.DeliveryID,
+		&delivery.Event,
+		&delivery.DatabaseID,
+		&delivery.Attempt,
+		&delivery.StatusCode,
+		&delivery.Success,
+		&delivery.Error,
+		&delivery.Date)
+	if err != nil && err != sql.ErrNoRows {
+		return delivery, fmt.Errorf("failed reading row: %v", err)
+	}
+
+	return delivery, nil
+}
+
+// JoinList returns a list of values, e.g. the events of a webhook, in
+// the form they are persisted. The values can't contain commas.
+func JoinList(values []string) string {
+	return strings.Join(values, ",")
+}
+
+// SplitList is the reverse of JoinList.
+func SplitList(values string) []string {
+	if values == "" {
+		return nil
+	}
+
+	return strings.Split(values, ",")
+}
+
+// ReadAuditEntry reads a row of the audit_log table into a data.AuditEntry
+func ReadAuditEntry(row Scanner) (data.AuditEntry, error) {
+	var entry data.AuditEntry
+
+	err := row.Scan(
+		&entry.ID,
+		&entry.Date,
+		&entry.User,
+		&entry.Action,
+		&entry.DatabaseID,
+		&entry.Agent,
+		&entry.Details)
+	if err != nil && err != sql.ErrNoRows {
+		return entry, fmt.Errorf("failed reading row: %v", err)
+	}
+
+	return entry, nil
+}
+
+// AuditQuery returns the query and its arguments that select the entries
+// of the audit_log table matching filter, newest first.
+func AuditQuery(filter data.AuditFilter) (string, []interface{}) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+
+	if filter.User != "" {
+		conds = append(conds, "`user` = ?")
+		args = append(args, filter.User)
+	}
+
+	if filter.DatabaseID != 0 {
+		conds = append(conds, "`databaseId` = ?")
+		args = append(args, filter.DatabaseID)
+	}
+
+	if filter.Agent != "" {
+		conds = append(conds, "`agent` = ?")
+		args = append(args, filter.Agent)
+	}
+
+	if !filter.From.IsZero() {
+		conds = append(conds, "`date` >= ?")
+		args = append(args, filter.From.UTC())
+	}
+
+	if !filter.To.IsZero() {
+		conds = append(conds, "`date` < ?")
+		args = append(args, filter.To.UTC())
+	}
+
+	query := "SELECT * FROM `audit_log`"
+	if len(conds) != 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	query += " ORDER BY id DESC"
+
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	return query, args
+}
+
+// ReadUser reads a row of the users table into a data.User
+func ReadUser(row Scanner) (data.User, error) {
+	var user data.User
+
+	err := row.Scan(
+		&user.Email,
+		&user.Role)
+	if err != nil && err != sql.ErrNoRows {
+		return user, fmt.Errorf("failed reading row: %v", err)
+	}
+
+	return user, nil
+}
+
+// ReadVersion reads a row of the version table into a data.Version
+func ReadVersion(row Scanner) (data.Version, error) {
+	var version data.Version
+
+	err := row.Scan(
+		&version.ID,
+		&version.Query,
+		&version.Comment,
+		&version.Date)
+	if err != nil && err != sql.ErrNoRows {
+		return version, fmt.Errorf("failed reading row: %v", err)
+	}
+
+	return version, nil
+}
+
+// ReadPushSubscription reads a row of the push_subscriptions table into
+// a data.PushSubscription
+func ReadPushSubscription(row Scanner) (data.PushSubscription, error) {
+	var subscription data.PushSubscription
+
+	err := row.Scan(
+		&subscription.Subscriber,
+		&subscription.Endpoint,
+		&subscription.P256dh,
+		&subscription.Auth)
+	if err != nil && err != sql.ErrNoRows {
+		return subscription, fmt.Errorf("failed reading row: %v", err)
+	}
+
+	return subscription, nil
+}
+
+// ReadTeam reads a row of the teams table into a data.Team, without
+// its members.
+func ReadTeam(row Scanner) (data.Team, error) {
+	var team data.Team
+
+	err := row.Scan(
+		&team.ID,
+		&team.Name)
+	if err != nil && err != sql.ErrNoRows {
+		return team, fmt.Errorf("failed reading row: %v", err)
+	}
+
+	return team, nil
+}
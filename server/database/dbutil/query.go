@@ -0,0 +1,180 @@
+package dbutil
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	vis "github.com/djavorszky/ddn/common/visibility"
+	"github.com/djavorszky/ddn/server/database/data"
+)
+
+// sortColumns maps the fields the databases can be sorted by to the
+// columns of the databases table.
+var sortColumns = map[string]string{
+	data.SortID:      "id",
+	data.SortName:    "dbname",
+	data.SortAgent:   "agentName",
+	data.SortVendor:  "dbvendor",
+	data.SortStatus:  "status",
+	data.SortCreator: "creator",
+	data.SortCreated: "createDate",
+	data.SortExpiry:  "expiryDate",
+}
+
+// OrderBy returns the ORDER BY clause of query. Databases that are equal
+// by the sorted field are ordered newest first.
+func OrderBy(query data.DatabaseQuery) string {
+	field, desc := query.SortField()
+
+	column, ok := sortColumns[field]
+	if !ok {
+		column, desc = "id", true
+	}
+
+	order := " ORDER BY " + column
+	if desc {
+		order += " DESC"
+	}
+
+	if column != "id" {
+		order += ", id DESC"
+	}
+
+	return order
+}
+
+// LikePattern returns a pattern that matches the values containing s,
+// ignoring case, if used with ESCAPE '!' against the lowercase values.
+func LikePattern(s string) string {
+	s = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(strings.ToLower(s))
+
+	return "%" + s + "%"
+}
+
+// DatabaseQuery returns the query and its arguments that select the
+// entries of the databases table matching query. inList is the format of
+// the condition that matches the rows whose comma separated list in the
+// column given to Sprintf contains the value in its only placeholder.
+func DatabaseQuery(query data.DatabaseQuery, inList string) (string, []interface{}) {
+	where, args := databaseWhere(query, inList)
+
+	q := "SELECT * FROM `databases`" + where + OrderBy(query)
+
+	if query.Limit > 0 {
+		q += " LIMIT ? OFFSET ?"
+		args = append(args, query.Limit, query.Offset)
+	}
+
+	return q, args
+}
+
+// DatabaseCountQuery returns the query and its arguments that count the
+// entries of the databases table matching query, ignoring its paging.
+func DatabaseCountQuery(query data.DatabaseQuery, inList string) (string, []interface{}) {
+	where, args := databaseWhere(query, inList)
+
+	return "SELECT COUNT(*) FROM `databases`" + where, args
+}
+
+// StatusCountQuery counts the entries of the databases table by status and
+// vendor.
+const StatusCountQuery = "SELECT status, dbvendor, COUNT(*) FROM `databases` GROUP BY status, dbvendor"
+
+// ReadStatusCounts reads the rows of StatusCountQuery.
+func ReadStatusCounts(rows *sql.Rows) ([]data.StatusCount, error) {
+	defer rows.Close()
+
+	var counts []data.StatusCount
+	for rows.Next() {
+		var (
+			count  data.StatusCount
+			vendor sql.NullString
+		)
+
+		err := rows.Scan(&count.Status, &vendor, &count.Count)
+		if err != nil {
+			return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+		}
+
+		count.Vendor = vendor.String
+		counts = append(counts, count)
+	}
+
+	err := rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+	}
+
+	return counts, nil
+}
+
+func databaseWhere(query data.DatabaseQuery, inList string) (string, []interface{}) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+
+	if query.VisibleTo != "" {
+		visible := []string{"creator = ?", fmt.Sprintf(inList, "coowners"), "visibility = ?"}
+		args = append(args, query.VisibleTo, query.VisibleTo, vis.Public)
+
+		if len(query.Teams) != 0 {
+			visible = append(visible, "(visibility = ? AND team IN (?"+strings.Repeat(", ?", len(query.Teams)-1)+"))")
+			args = append(args, vis.Team)
+
+			for _, team := range query.Teams {
+				args = append(args, team)
+			}
+		}
+
+		conds = append(conds, "("+strings.Join(visible, " OR ")+")")
+	}
+
+	if query.Agent != "" {
+		conds = append(conds, "agentName = ?")
+		args = append(args, query.Agent)
+	}
+
+	if query.Vendor != "" {
+		conds = append(conds, "dbvendor = ?")
+		args = append(args, query.Vendor)
+	}
+
+	if query.Status != 0 {
+		conds = append(conds, "status = ?")
+		args = append(args, query.Status)
+	}
+
+	if query.Creator != "" {
+		conds = append(conds, "creator = ?")
+		args = append(args, query.Creator)
+	}
+
+	if !query.ExpiringBefore.IsZero() {
+		conds = append(conds, "expiryDate < ?")
+		args = append(args, query.ExpiringBefore)
+	}
+
+	if query.Name != "" {
+		conds = append(conds, "LOWER(dbname) LIKE ? ESCAPE '!'")
+		args = append(args, LikePattern(query.Name))
+	}
+
+	if query.Tag != "" {
+		conds = append(conds, fmt.Sprintf(inList, "LOWER(tags)"))
+		args = append(args, strings.ToLower(query.Tag))
+	}
+
+	if query.Search != "" {
+		conds = append(conds, "(LOWER(dbname) LIKE ? ESCAPE '!' OR LOWER(tags) LIKE ? ESCAPE '!' OR LOWER(comment) LIKE ? ESCAPE '!' OR LOWER(liferayVirtualHosts) LIKE ? ESCAPE '!')")
+		pattern := LikePattern(query.Search)
+		args = append(args, pattern, pattern, pattern, pattern)
+	}
+
+	if len(conds) == 0 {
+		return "", args
+	}
+
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
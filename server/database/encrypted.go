@@ -0,0 +1,161 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/djavorszky/ddn/server/database/data"
+	"github.com/djavorszky/ddn/server/database/secret"
+)
+
+// Encrypted is a BackendConnection that encrypts the passwords of the
+// databases before they are stored, and decrypts them when they are read.
+// Everything else, including backups, is passed to the wrapped connection
+// as is, so the passwords in the backups stay encrypted.
+type Encrypted struct {
+	BackendConnection
+
+	Keys *secret.Keyring
+}
+
+// FetchByID returns the entry associated with that ID.
+func (enc Encrypted) FetchByID(ID int) (data.Row, error) {
+	row, err := enc.BackendConnection.FetchByID(ID)
+	if err != nil {
+		return row, err
+	}
+
+	return enc.decrypt(row)
+}
+
+// FetchByDBNameAgent returns the entry for the database with the given
+// name, from the given agent.
+func (enc Encrypted) FetchByDBNameAgent(dbname, agent string) (data.Row, error) {
+	row, err := enc.BackendConnection.FetchByDBNameAgent(dbname, agent)
+	if err != nil {
+		return row, err
+	}
+
+	return enc.decrypt(row)
+}
+
+// FetchByCreator returns the entries created or co-owned by creator.
+func (enc Encrypted) FetchByCreator(creator string) ([]data.Row, error) {
+	return enc.decryptAll(enc.BackendConnection.FetchByCreator(creator))
+}
+
+// FetchPublic returns the public entries.
+func (enc Encrypted) FetchPublic() ([]data.Row, error) {
+	return enc.decryptAll(enc.BackendConnection.FetchPublic())
+}
+
+// FetchAll returns all entries.
+func (enc Encrypted) FetchAll() ([]data.Row, error) {
+	return enc.decryptAll(enc.BackendConnection.FetchAll())
+}
+
+// FetchByTeam returns the databases shared with the team.
+func (enc Encrypted) FetchByTeam(teamID int) ([]data.Row, error) {
+	return enc.decryptAll(enc.BackendConnection.FetchByTeam(teamID))
+}
+
+// FetchDatabases returns the entries matching query.
+func (enc Encrypted) FetchDatabases(query data.DatabaseQuery) ([]data.Row, error) {
+	return enc.decryptAll(enc.BackendConnection.FetchDatabases(query))
+}
+
+// Insert adds an entry with its password encrypted, setting its ID. The
+// password of row is left as it is.
+func (enc Encrypted) Insert(row *data.Row) error {
+	stored, err := enc.encrypt(*row)
+	if err != nil {
+		return err
+	}
+
+	err = enc.BackendConnection.Insert(&stored)
+	row.ID = stored.ID
+
+	return err
+}
+
+// Update updates an entry, encrypting its password. The password of row
+// is left as it is.
+func (enc Encrypted) Update(row *data.Row) error {
+	stored, err := enc.encrypt(*row)
+	if err != nil {
+		return err
+	}
+
+	// Entries that don't exist yet are inserted, getting an ID.
+	err = enc.BackendConnection.Update(&stored)
+	row.ID = stored.ID
+
+	return err
+}
+
+// Migrate encrypts the passwords that are stored in plain text or with
+// an older key using the current key. It returns the number of entries
+// that were updated.
+func (enc Encrypted) Migrate() (int, error) {
+	rows, err := enc.BackendConnection.FetchAll()
+	if err != nil {
+		return 0, fmt.Errorf("fetching databases failed: %v", err)
+	}
+
+	var migrated int
+	for _, row := range rows {
+		if enc.Keys.Current(row.DBPass) {
+			continue
+		}
+
+		row, err = enc.decrypt(row)
+		if err != nil {
+			return migrated, err
+		}
+
+		err = enc.Update(&row)
+		if err != nil {
+			return migrated, fmt.Errorf("updating database %d failed: %v", row.ID, err)
+		}
+
+		migrated++
+	}
+
+	return migrated, nil
+}
+
+func (enc Encrypted) encrypt(row data.Row) (data.Row, error) {
+	var err error
+
+	row.DBPass, err = enc.Keys.Encrypt(row.DBPass)
+	if err != nil {
+		return row, fmt.Errorf("encrypting password of database %d failed: %v", row.ID, err)
+	}
+
+	return row, nil
+}
+
+func (enc Encrypted) decrypt(row data.Row) (data.Row, error) {
+	var err error
+
+	row.DBPass, err = enc.Keys.Decrypt(row.DBPass)
+	if err != nil {
+		return row, fmt.Errorf("decrypting password of database %d failed: %v", row.ID, err)
+	}
+
+	return row, nil
+}
+
+func (enc Encrypted) decryptAll(rows []data.Row, err error) ([]data.Row, error) {
+	if err != nil {
+		return rows, err
+	}
+
+	for i := range rows {
+		rows[i], err = enc.decrypt(rows[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,105 @@
+package database_test
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/djavorszky/ddn/server/database"
+	"github.com/djavorszky/ddn/server/database/data"
+	"github.com/djavorszky/ddn/server/database/dbtest"
+	"github.com/djavorszky/ddn/server/database/memory"
+	"github.com/djavorszky/ddn/server/database/secret"
+)
+
+var (
+	oldKey = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	newKey = base64.StdEncoding.EncodeToString([]byte("fedcba9876543210fedcba9876543210"))
+)
+
+func newEncrypted(t *testing.T, keys ...string) (database.Encrypted, *memory.DB) {
+	ring, err := secret.NewKeyring(keys...)
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+
+	mem := &memory.DB{}
+	mem.ConnectAndPrepare()
+
+	return database.Encrypted{BackendConnection: mem, Keys: ring}, mem
+}
+
+func TestEncrypted_Conformance(t *testing.T) {
+	enc, _ := newEncrypted(t, oldKey)
+
+	dbtest.Run(t, func(t *testing.T) database.BackendConnection {
+		return enc
+	})
+}
+
+func TestEncrypted_Stored(t *testing.T) {
+	enc, mem := newEncrypted(t, oldKey)
+
+	row := data.Row{DBName: "encrypted", DBPass: "s3cret", AgentName: "agent"}
+
+	err := enc.Insert(&row)
+	if err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+
+	if row.DBPass != "s3cret" {
+		t.Errorf("Insert() changed the password of the row to %q", row.DBPass)
+	}
+
+	stored, _ := mem.FetchByID(row.ID)
+	if !secret.IsEncrypted(stored.DBPass) {
+		t.Errorf("stored password = %q, want it encrypted", stored.DBPass)
+	}
+
+	read, _ := enc.FetchByID(row.ID)
+	if read.DBPass != "s3cret" {
+		t.Errorf("FetchByID() password = %q, want %q", read.DBPass, "s3cret")
+	}
+
+	all, _ := enc.FetchAll()
+	if len(all) != 1 || all[0].DBPass != "s3cret" {
+		t.Errorf("FetchAll() = %+v, want the decrypted password", all)
+	}
+}
+
+func TestEncrypted_Migrate(t *testing.T) {
+	old, mem := newEncrypted(t, oldKey)
+
+	plain := data.Row{DBName: "plain", DBPass: "plain", AgentName: "agent"}
+	mem.Insert(&plain)
+
+	encrypted := data.Row{DBName: "old", DBPass: "old", AgentName: "agent"}
+	old.Insert(&encrypted)
+
+	ring, _ := secret.NewKeyring(newKey, oldKey)
+	rotated := database.Encrypted{BackendConnection: mem, Keys: ring}
+
+	migrated, err := rotated.Migrate()
+	if err != nil || migrated != 2 {
+		t.Errorf("Migrate() = %d, %v, want 2 databases migrated", migrated, err)
+	}
+
+	migrated, err = rotated.Migrate()
+	if err != nil || migrated != 0 {
+		t.Errorf("Migrate() again = %d, %v, want nothing to migrate", migrated, err)
+	}
+
+	fresh, _ := secret.NewKeyring(newKey)
+	current := database.Encrypted{BackendConnection: mem, Keys: fresh}
+
+	for _, row := range []data.Row{plain, encrypted} {
+		stored, _ := mem.FetchByID(row.ID)
+		if !fresh.Current(stored.DBPass) {
+			t.Errorf("stored password of %q = %q, want it encrypted with the new key", row.DBName, stored.DBPass)
+		}
+
+		read, err := current.FetchByID(row.ID)
+		if err != nil || read.DBPass != row.DBPass {
+			t.Errorf("FetchByID() of %q = %q, %v, want %q", row.DBName, read.DBPass, err, row.DBPass)
+		}
+	}
+}
@@ -19,6 +19,10 @@ type BackendConnection interface {
 	FetchByCreator(creator string) ([]data.Row, error)
 	FetchPublic() ([]data.Row, error)
 	FetchAll() ([]data.Row, error)
+	FetchByTeam(teamID int) ([]data.Row, error)
+	FetchDatabases(query data.DatabaseQuery) ([]data.Row, error)
+	CountDatabases(query data.DatabaseQuery) (int, error)
+	CountByStatus() ([]data.StatusCount, error)
 
 	Insert(row *data.Row) error
 	Update(row *data.Row) error
@@ -27,4 +31,31 @@ type BackendConnection interface {
 	InsertPushSubscription(row *model.PushSubscription, subscriber string) error
 	DeletePushSubscription(row *model.PushSubscription, subscriber string) error
 	FetchUserPushSubscriptions(subscriber string) ([]webpush.Subscription, error)
+
+	FetchWebhookByID(ID int) (data.Webhook, error)
+	FetchWebhooksByOwner(owner string) ([]data.Webhook, error)
+	FetchGlobalWebhooks() ([]data.Webhook, error)
+	InsertWebhook(hook *data.Webhook) error
+	DeleteWebhook(hook data.Webhook) error
+
+	InsertWebhookDelivery(delivery *data.WebhookDelivery) error
+	FetchWebhookDeliveries(webhookID, limit int) ([]data.WebhookDelivery, error)
+
+	InsertAuditEntry(entry *data.AuditEntry) error
+	FetchAuditEntries(filter data.AuditFilter) ([]data.AuditEntry, error)
+
+	FetchUser(email string) (data.User, error)
+	FetchUsers() ([]data.User, error)
+	SaveUser(user data.User) error
+
+	FetchTeamByID(ID int) (data.Team, error)
+	FetchTeams() ([]data.Team, error)
+	FetchTeamsByMember(email string) ([]data.Team, error)
+	InsertTeam(team *data.Team) error
+	DeleteTeam(team data.Team) error
+	AddTeamMember(teamID int, email string) error
+	RemoveTeamMember(teamID int, email string) error
+
+	Export() (data.Backup, error)
+	Restore(backup data.Backup) error
 }
@@ -0,0 +1,872 @@
+// Package memory implements a BackendConnection that keeps everything in
+// memory. Nothing survives a restart, so it is meant for tests.
+package memory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/djavorszky/ddn/common/model"
+	vis "github.com/djavorszky/ddn/common/visibility"
+	"github.com/djavorszky/ddn/server/database/data"
+	"github.com/djavorszky/sutils"
+	webpush "github.com/sherclockholmes/webpush-go"
+)
+
+// DB implements the BackendConnection
+type DB struct {
+	mu sync.RWMutex
+
+	rows          map[int]data.Row
+	subscriptions map[string][]webpush.Subscription
+	webhooks      map[int]data.Webhook
+	deliveries    []data.WebhookDelivery
+	audit         []data.AuditEntry
+	users         map[string]data.User
+	teams         map[int]data.Team
+
+	lastID int
+}
+
+// ConnectAndPrepare initializes the storage. Calling it again drops
+// everything that has been stored.
+func (mem *DB) ConnectAndPrepare() error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	mem.rows = make(map[int]data.Row)
+	mem.subscriptions = make(map[string][]webpush.Subscription)
+	mem.webhooks = make(map[int]data.Webhook)
+	mem.deliveries = nil
+	mem.audit = nil
+	mem.users = make(map[string]data.User)
+	mem.teams = make(map[int]data.Team)
+
+	return nil
+}
+
+// Close does nothing, the stored data is kept until ConnectAndPrepare
+// is called again.
+func (mem *DB) Close() error {
+	return nil
+}
+
+// nextID returns a new ID. IDs are unique across all tables, which is
+// enough as nobody relies on them being consecutive.
+func (mem *DB) nextID() int {
+	mem.lastID++
+
+	return mem.lastID
+}
+
+// FetchByID returns the entry associated with that ID. If it does not
+// exist, the returned entry's ID is 0.
+func (mem *DB) FetchByID(ID int) (data.Row, error) {
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+
+	return copyRow(mem.rows[ID]), nil
+}
+
+// FetchByDBNameAgent returns the entry for the database with the given name, from the given agent.
+// If it does not exist, the returned entry's ID is 0.
+func (mem *DB) FetchByDBNameAgent(dbname, agent string) (data.Row, error) {
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+
+	for _, row := range mem.rows {
+		if row.DBName == dbname && row.AgentName == agent {
+			return copyRow(row), nil
+		}
+	}
+
+	return data.Row{}, nil
+}
+
+// FetchByCreator returns private entries that were created or are
+// co-owned by the specified user
+func (mem *DB) FetchByCreator(creator string) ([]data.Row, error) {
+	return mem.fetchRows(func(row data.Row) bool {
+		return row.Public == vis.Private && row.IsOwner(creator)
+	}), nil
+}
+
+// FetchPublic returns all entries that have "Public" set to true
+func (mem *DB) FetchPublic() ([]data.Row, error) {
+	return mem.fetchRows(func(row data.Row) bool {
+		return row.Public == vis.Public
+	}), nil
+}
+
+// FetchAll returns all entries.
+func (mem *DB) FetchAll() ([]data.Row, error) {
+	return mem.fetchRows(func(row data.Row) bool {
+		return true
+	}), nil
+}
+
+// FetchByTeam returns the databases shared with the team.
+func (mem *DB) FetchByTeam(teamID int) ([]data.Row, error) {
+	return mem.fetchRows(func(row data.Row) bool {
+		return row.Public == vis.Team && row.Team == teamID
+	}), nil
+}
+
+// FetchDatabases returns the entries matching query.
+func (mem *DB) FetchDatabases(query data.DatabaseQuery) ([]data.Row, error) {
+	entries := mem.fetchRows(func(row data.Row) bool {
+		return matches(row, query)
+	})
+
+	field, desc := query.SortField()
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if desc {
+			a, b = b, a
+		}
+
+		switch field {
+		case data.SortName:
+			return a.DBName < b.DBName
+		case data.SortAgent:
+			return a.AgentName < b.AgentName
+		case data.SortVendor:
+			return a.DBVendor < b.DBVendor
+		case data.SortStatus:
+			return a.Status < b.Status
+		case data.SortCreator:
+			return a.Creator < b.Creator
+		case data.SortCreated:
+			return a.CreateDate.Before(b.CreateDate)
+		case data.SortExpiry:
+			return a.ExpiryDate.Before(b.ExpiryDate)
+		}
+
+		return a.ID < b.ID
+	})
+
+	if query.Limit > 0 {
+		if query.Offset >= len(entries) {
+			return nil, nil
+		}
+
+		entries = entries[query.Offset:]
+		if len(entries) > query.Limit {
+			entries = entries[:query.Limit]
+		}
+	}
+
+	return entries, nil
+}
+
+// CountDatabases returns the number of entries matching query, ignoring
+// its paging.
+func (mem *DB) CountDatabases(query data.DatabaseQuery) (int, error) {
+	entries := mem.fetchRows(func(row data.Row) bool {
+		return matches(row, query)
+	})
+
+	return len(entries), nil
+}
+
+// CountByStatus returns the number of entries by status and vendor.
+func (mem *DB) CountByStatus() ([]data.StatusCount, error) {
+	type key struct {
+		status int
+		vendor string
+	}
+
+	mem.mu.RLock()
+	counts := make(map[key]int)
+	for _, row := range mem.rows {
+		counts[key{row.Status, row.DBVendor}]++
+	}
+	mem.mu.RUnlock()
+
+	var result []data.StatusCount
+	for k, count := range counts {
+		result = append(result, data.StatusCount{Status: k.status, Vendor: k.vendor, Count: count})
+	}
+
+	return result, nil
+}
+
+// matches returns true if the row is selected by query.
+func matches(row data.Row, query data.DatabaseQuery) bool {
+	if query.VisibleTo != "" && !row.IsOwner(query.VisibleTo) && row.Public != vis.Public {
+		shared := false
+		for _, team := range query.Teams {
+			shared = shared || (row.Public == vis.Team && row.Team == team)
+		}
+
+		if !shared {
+			return false
+		}
+	}
+
+	switch {
+	case query.Agent != "" && row.AgentName != query.Agent,
+		query.Vendor != "" && row.DBVendor != query.Vendor,
+		query.Status != 0 && row.Status != query.Status,
+		query.Creator != "" && row.Creator != query.Creator,
+		!query.ExpiringBefore.IsZero() && !row.ExpiryDate.Before(query.ExpiringBefore),
+		query.Name != "" && !containsFold(row.DBName, query.Name),
+		query.Tag != "" && !row.HasTag(query.Tag),
+		query.Search != "" && !containsFold(row.DBName, query.Search) && !containsFold(strings.Join(row.Tags, ","), query.Search) && !containsFold(row.Comment, query.Search) && !containsFold(strings.Join(row.Liferay.VirtualHosts, ","), query.Search):
+		return false
+	}
+
+	return true
+}
+
+// containsFold returns true if s contains substr, ignoring case.
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// fetchRows returns the entries matching the filter, newest first.
+func (mem *DB) fetchRows(filter func(data.Row) bool) []data.Row {
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+
+	var entries []data.Row
+	for _, row := range mem.rows {
+		if filter(row) {
+			entries = append(entries, copyRow(row))
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID > entries[j].ID
+	})
+
+	return entries
+}
+
+// Insert adds an entry to the database, setting its ID
+func (mem *DB) Insert(entry *data.Row) error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	return mem.insert(entry)
+}
+
+func (mem *DB) insert(entry *data.Row) error {
+	if mem.exists(*entry) {
+		return fmt.Errorf("insert failed: database %q already exists on agent %q", entry.DBName, entry.AgentName)
+	}
+
+	entry.ID = mem.nextID()
+	mem.rows[entry.ID] = copyRow(*entry)
+
+	return nil
+}
+
+// Update updates an already existing entry, or inserts it if it doesn't
+// exist yet
+func (mem *DB) Update(entry *data.Row) error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	if _, ok := mem.rows[entry.ID]; !ok {
+		return mem.insert(entry)
+	}
+
+	if mem.exists(*entry) {
+		return fmt.Errorf("failed update: database %q already exists on agent %q", entry.DBName, entry.AgentName)
+	}
+
+	mem.rows[entry.ID] = copyRow(*entry)
+
+	return nil
+}
+
+// exists returns true if there is another entry with the same name on
+// the same agent.
+func (mem *DB) exists(entry data.Row) bool {
+	for _, row := range mem.rows {
+		if row.ID != entry.ID && row.DBName == entry.DBName && row.AgentName == entry.AgentName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Delete removes the entry from the database
+func (mem *DB) Delete(entry data.Row) error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	delete(mem.rows, entry.ID)
+
+	return nil
+}
+
+// InsertPushSubscription adds a push subscription of the subscriber
+func (mem *DB) InsertPushSubscription(subscription *model.PushSubscription, subscriber string) error {
+	if !sutils.Present(subscriber) {
+		return fmt.Errorf("missing subscriber")
+	}
+
+	if !sutils.Present(subscription.Endpoint) {
+		return fmt.Errorf("missing endpoint")
+	}
+
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	for _, s := range mem.subscriptions[subscriber] {
+		if s.Endpoint == subscription.Endpoint {
+			return fmt.Errorf("saving push subscription to the database failed: endpoint already subscribed")
+		}
+	}
+
+	mem.subscriptions[subscriber] = append(mem.subscriptions[subscriber], webpush.Subscription{
+		Endpoint: subscription.Endpoint,
+		Keys:     subscription.Keys,
+	})
+
+	return nil
+}
+
+// DeletePushSubscription deletes a push subscription of the subscriber
+func (mem *DB) DeletePushSubscription(subscription *model.PushSubscription, subscriber string) error {
+	if !sutils.Present(subscriber) {
+		return fmt.Errorf("missing subscriber")
+	}
+
+	if !sutils.Present(subscription.Endpoint) {
+		return fmt.Errorf("missing endpoint")
+	}
+
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	var kept []webpush.Subscription
+	for _, s := range mem.subscriptions[subscriber] {
+		if s.Endpoint != subscription.Endpoint {
+			kept = append(kept, s)
+		}
+	}
+
+	mem.subscriptions[subscriber] = kept
+
+	return nil
+}
+
+// FetchUserPushSubscriptions fetches the subscriptions for the specified user
+func (mem *DB) FetchUserPushSubscriptions(subscriber string) ([]webpush.Subscription, error) {
+	if !sutils.Present(subscriber) {
+		return nil, fmt.Errorf("missing subscriber")
+	}
+
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+
+	return append([]webpush.Subscription(nil), mem.subscriptions[subscriber]...), nil
+}
+
+// FetchWebhookByID returns the webhook with the given ID. If it
+// does not exist, the returned webhook's ID is 0.
+func (mem *DB) FetchWebhookByID(ID int) (data.Webhook, error) {
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+
+	return copyWebhook(mem.webhooks[ID]), nil
+}
+
+// FetchWebhooksByOwner returns the webhooks registered by owner.
+func (mem *DB) FetchWebhooksByOwner(owner string) ([]data.Webhook, error) {
+	return mem.fetchWebhooks(func(hook data.Webhook) bool {
+		return hook.Owner == owner
+	}), nil
+}
+
+// FetchGlobalWebhooks returns the webhooks that are notified about
+// the events of all databases.
+func (mem *DB) FetchGlobalWebhooks() ([]data.Webhook, error) {
+	return mem.fetchWebhooks(func(hook data.Webhook) bool {
+		return hook.Global
+	}), nil
+}
+
+func (mem *DB) fetchWebhooks(filter func(data.Webhook) bool) []data.Webhook {
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+
+	var hooks []data.Webhook
+	for _, hook := range mem.webhooks {
+		if filter(hook) {
+			hooks = append(hooks, copyWebhook(hook))
+		}
+	}
+
+	sort.Slice(hooks, func(i, j int) bool {
+		return hooks[i].ID < hooks[j].ID
+	})
+
+	return hooks
+}
+
+// InsertWebhook adds a webhook to the database, setting its ID
+func (mem *DB) InsertWebhook(hook *data.Webhook) error {
+	if !sutils.Present(hook.Owner, hook.URL) {
+		return fmt.Errorf("missing owner or url")
+	}
+
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	hook.ID = mem.nextID()
+	mem.webhooks[hook.ID] = copyWebhook(*hook)
+
+	return nil
+}
+
+// DeleteWebhook removes the webhook along with its deliveries
+func (mem *DB) DeleteWebhook(hook data.Webhook) error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	var kept []data.WebhookDelivery
+	for _, delivery := range mem.deliveries {
+		if delivery.WebhookID != hook.ID {
+			kept = append(kept, delivery)
+		}
+	}
+
+	mem.deliveries = kept
+	delete(mem.webhooks, hook.ID)
+
+	return nil
+}
+
+// InsertWebhookDelivery logs a delivery attempt, setting its ID
+func (mem *DB) InsertWebhookDelivery(delivery *data.WebhookDelivery) error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	delivery.ID = mem.nextID()
+	mem.deliveries = append(mem.deliveries, *delivery)
+
+	return nil
+}
+
+// FetchWebhookDeliveries returns the latest limit delivery attempts of
+// the webhook, newest first.
+func (mem *DB) FetchWebhookDeliveries(webhookID, limit int) ([]data.WebhookDelivery, error) {
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+
+	var deliveries []data.WebhookDelivery
+	for i := len(mem.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if mem.deliveries[i].WebhookID == webhookID {
+			deliveries = append(deliveries, mem.deliveries[i])
+		}
+	}
+
+	return deliveries, nil
+}
+
+// InsertAuditEntry adds an entry to the audit log, setting its ID
+func (mem *DB) InsertAuditEntry(entry *data.AuditEntry) error {
+	if !sutils.Present(entry.Action) {
+		return fmt.Errorf("missing action")
+	}
+
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	entry.ID = mem.nextID()
+
+	stored := *entry
+	stored.Date = stored.Date.UTC()
+	mem.audit = append(mem.audit, stored)
+
+	return nil
+}
+
+// FetchAuditEntries returns the entries of the audit log that match
+// filter, newest first.
+func (mem *DB) FetchAuditEntries(filter data.AuditFilter) ([]data.AuditEntry, error) {
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+
+	var entries []data.AuditEntry
+	for i := len(mem.audit) - 1; i >= 0; i-- {
+		if filter.Limit > 0 && len(entries) == filter.Limit {
+			break
+		}
+
+		entry := mem.audit[i]
+
+		switch {
+		case filter.User != "" && entry.User != filter.User,
+			filter.DatabaseID != 0 && entry.DatabaseID != filter.DatabaseID,
+			filter.Agent != "" && entry.Agent != filter.Agent,
+			!filter.From.IsZero() && entry.Date.Before(filter.From),
+			!filter.To.IsZero() && !entry.Date.Before(filter.To):
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// FetchUser returns the user with the given email. If it has not been
+// stored, the returned user's Email is empty.
+func (mem *DB) FetchUser(email string) (data.User, error) {
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+
+	return mem.users[email], nil
+}
+
+// FetchUsers returns all stored users.
+func (mem *DB) FetchUsers() ([]data.User, error) {
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+
+	var users []data.User
+	for _, user := range mem.users {
+		users = append(users, user)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Email < users[j].Email
+	})
+
+	return users, nil
+}
+
+// SaveUser stores the user, replacing its role if it already exists.
+func (mem *DB) SaveUser(user data.User) error {
+	if !sutils.Present(user.Email, user.Role) {
+		return fmt.Errorf("missing email or role")
+	}
+
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	mem.users[user.Email] = user
+
+	return nil
+}
+
+// FetchTeamByID returns the team with the given ID along with its members.
+// If it does not exist, the returned team's ID is 0.
+func (mem *DB) FetchTeamByID(ID int) (data.Team, error) {
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+
+	return copyTeam(mem.teams[ID]), nil
+}
+
+// FetchTeams returns all teams along with their members.
+func (mem *DB) FetchTeams() ([]data.Team, error) {
+	return mem.fetchTeams(func(team data.Team) bool {
+		return true
+	}), nil
+}
+
+// FetchTeamsByMember returns the teams the user is a member of.
+func (mem *DB) FetchTeamsByMember(email string) ([]data.Team, error) {
+	return mem.fetchTeams(func(team data.Team) bool {
+		return team.HasMember(email)
+	}), nil
+}
+
+func (mem *DB) fetchTeams(filter func(data.Team) bool) []data.Team {
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+
+	var teams []data.Team
+	for _, team := range mem.teams {
+		if filter(team) {
+			teams = append(teams, copyTeam(team))
+		}
+	}
+
+	sort.Slice(teams, func(i, j int) bool {
+		return teams[i].Name < teams[j].Name
+	})
+
+	return teams
+}
+
+// InsertTeam adds a team to the database along with its members,
+// setting its ID
+func (mem *DB) InsertTeam(team *data.Team) error {
+	if !sutils.Present(team.Name) {
+		return fmt.Errorf("missing name")
+	}
+
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	for _, t := range mem.teams {
+		if t.Name == team.Name {
+			return fmt.Errorf("insert failed: team %q already exists", team.Name)
+		}
+	}
+
+	team.ID = mem.nextID()
+
+	stored := data.Team{ID: team.ID, Name: team.Name}
+	for _, member := range team.Members {
+		stored = addMember(stored, member)
+	}
+
+	mem.teams[team.ID] = stored
+
+	return nil
+}
+
+// DeleteTeam removes the team and its members. The databases that were
+// shared with the team become private.
+func (mem *DB) DeleteTeam(team data.Team) error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	for id, row := range mem.rows {
+		if row.Team == team.ID {
+			row.Public = vis.Private
+			row.Team = 0
+			mem.rows[id] = row
+		}
+	}
+
+	delete(mem.teams, team.ID)
+
+	return nil
+}
+
+// AddTeamMember adds the user to the team. Adding an existing member
+// is not an error.
+func (mem *DB) AddTeamMember(teamID int, email string) error {
+	if !sutils.Present(email) {
+		return fmt.Errorf("missing email")
+	}
+
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	team, ok := mem.teams[teamID]
+	if !ok {
+		return fmt.Errorf("insert failed: team %d does not exist", teamID)
+	}
+
+	mem.teams[teamID] = addMember(team, email)
+
+	return nil
+}
+
+// RemoveTeamMember removes the user from the team.
+func (mem *DB) RemoveTeamMember(teamID int, email string) error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	team, ok := mem.teams[teamID]
+	if !ok {
+		return nil
+	}
+
+	var members []string
+	for _, member := range team.Members {
+		if member != email {
+			members = append(members, member)
+		}
+	}
+
+	team.Members = members
+	mem.teams[teamID] = team
+
+	return nil
+}
+
+// Export returns everything that is stored. There is no version table,
+// so the backup has no versions.
+func (mem *DB) Export() (data.Backup, error) {
+	var backup data.Backup
+
+	backup.Databases, _ = mem.FetchAll()
+
+	mem.mu.RLock()
+	for subscriber, subscriptions := range mem.subscriptions {
+		for _, s := range subscriptions {
+			backup.PushSubscriptions = append(backup.PushSubscriptions, data.PushSubscription{
+				Subscriber: subscriber,
+				Endpoint:   s.Endpoint,
+				P256dh:     s.Keys.P256dh,
+				Auth:       s.Keys.Auth,
+			})
+		}
+	}
+	mem.mu.RUnlock()
+
+	sort.Slice(backup.PushSubscriptions, func(i, j int) bool {
+		a, b := backup.PushSubscriptions[i], backup.PushSubscriptions[j]
+		if a.Subscriber != b.Subscriber {
+			return a.Subscriber < b.Subscriber
+		}
+
+		return a.Endpoint < b.Endpoint
+	})
+
+	backup.Webhooks = mem.fetchWebhooks(func(hook data.Webhook) bool {
+		return true
+	})
+
+	mem.mu.RLock()
+	backup.WebhookDeliveries = append([]data.WebhookDelivery(nil), mem.deliveries...)
+	mem.mu.RUnlock()
+
+	backup.Users, _ = mem.FetchUsers()
+	backup.Teams, _ = mem.FetchTeams()
+	backup.AuditLog, _ = mem.FetchAuditEntries(data.AuditFilter{})
+
+	return backup, nil
+}
+
+// Restore replaces everything that is stored with the contents of the
+// backup, keeping the IDs.
+func (mem *DB) Restore(backup data.Backup) error {
+	rows := make(map[int]data.Row)
+	for _, row := range backup.Databases {
+		if _, ok := rows[row.ID]; ok {
+			return fmt.Errorf("restoring database %d failed: duplicate id", row.ID)
+		}
+
+		rows[row.ID] = copyRow(row)
+	}
+
+	subscriptions := make(map[string][]webpush.Subscription)
+	for _, s := range backup.PushSubscriptions {
+		subscriptions[s.Subscriber] = append(subscriptions[s.Subscriber], webpush.Subscription{
+			Endpoint: s.Endpoint,
+			Keys:     webpush.Keys{P256dh: s.P256dh, Auth: s.Auth},
+		})
+	}
+
+	webhooks := make(map[int]data.Webhook)
+	for _, hook := range backup.Webhooks {
+		webhooks[hook.ID] = copyWebhook(hook)
+	}
+
+	deliveries := make([]data.WebhookDelivery, 0, len(backup.WebhookDeliveries))
+	for _, delivery := range backup.WebhookDeliveries {
+		delivery.Date = delivery.Date.UTC()
+		deliveries = append(deliveries, delivery)
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].ID < deliveries[j].ID
+	})
+
+	users := make(map[string]data.User)
+	for _, user := range backup.Users {
+		users[user.Email] = user
+	}
+
+	teams := make(map[int]data.Team)
+	for _, team := range backup.Teams {
+		stored := data.Team{ID: team.ID, Name: team.Name}
+		for _, member := range team.Members {
+			stored = addMember(stored, member)
+		}
+
+		teams[team.ID] = stored
+	}
+
+	audit := make([]data.AuditEntry, 0, len(backup.AuditLog))
+	for _, entry := range backup.AuditLog {
+		entry.Date = entry.Date.UTC()
+		audit = append(audit, entry)
+	}
+
+	sort.Slice(audit, func(i, j int) bool {
+		return audit[i].ID < audit[j].ID
+	})
+
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	mem.rows = rows
+	mem.subscriptions = subscriptions
+	mem.webhooks = webhooks
+	mem.deliveries = deliveries
+	mem.audit = audit
+	mem.users = users
+	mem.teams = teams
+
+	for id := range rows {
+		mem.keepID(id)
+	}
+
+	for id := range webhooks {
+		mem.keepID(id)
+	}
+
+	for _, delivery := range deliveries {
+		mem.keepID(delivery.ID)
+	}
+
+	for id := range teams {
+		mem.keepID(id)
+	}
+
+	for _, entry := range audit {
+		mem.keepID(entry.ID)
+	}
+
+	return nil
+}
+
+// keepID makes sure nextID won't hand out an ID that is already in use.
+func (mem *DB) keepID(ID int) {
+	if ID > mem.lastID {
+		mem.lastID = ID
+	}
+}
+
+// addMember returns the team with email among its members, keeping them
+// sorted like the SQL backends do.
+func addMember(team data.Team, email string) data.Team {
+	if team.HasMember(email) {
+		return team
+	}
+
+	team.Members = append(append([]string(nil), team.Members...), email)
+	sort.Strings(team.Members)
+
+	return team
+}
+
+// The copy functions make sure callers can't modify the stored values
+// through the slices they get back.
+
+func copyRow(row data.Row) data.Row {
+	row.CoOwners = append([]string(nil), row.CoOwners...)
+	row.Tags = append([]string(nil), row.Tags...)
+	row.Liferay.VirtualHosts = append([]string(nil), row.Liferay.VirtualHosts...)
+
+	return row
+}
+
+func copyWebhook(hook data.Webhook) data.Webhook {
+	hook.Events = append([]string(nil), hook.Events...)
+
+	return hook
+}
+
+func copyTeam(team data.Team) data.Team {
+	team.Members = append([]string(nil), team.Members...)
+
+	return team
+}
@@ -0,0 +1,21 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/djavorszky/ddn/server/database"
+	"github.com/djavorszky/ddn/server/database/dbtest"
+)
+
+func TestConformance(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) database.BackendConnection {
+		mem := &DB{}
+
+		err := mem.ConnectAndPrepare()
+		if err != nil {
+			t.Fatalf("ConnectAndPrepare() error: %v", err)
+		}
+
+		return mem
+	})
+}
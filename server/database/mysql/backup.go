@@ -0,0 +1,270 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/djavorszky/ddn/server/database/data"
+	"github.com/djavorszky/ddn/server/database/dbutil"
+)
+
+// Export returns everything that is stored, along with the version table.
+func (mys *DB) Export() (data.Backup, error) {
+	var (
+		backup data.Backup
+		err    error
+	)
+
+	if err = mys.alive(); err != nil {
+		return backup, fmt.Errorf("database down: %s", err.Error())
+	}
+
+	backup.Versions, err = mys.fetchVersions()
+	if err != nil {
+		return backup, fmt.Errorf("fetching versions failed: %v", err)
+	}
+
+	backup.Databases, err = mys.FetchAll()
+	if err != nil {
+		return backup, fmt.Errorf("fetching databases failed: %v", err)
+	}
+
+	backup.PushSubscriptions, err = mys.fetchPushSubscriptions()
+	if err != nil {
+		return backup, fmt.Errorf("fetching push subscriptions failed: %v", err)
+	}
+
+	backup.Webhooks, err = mys.fetchWebhooks("SELECT * FROM `webhooks` ORDER BY id")
+	if err != nil {
+		return backup, fmt.Errorf("fetching webhooks failed: %v", err)
+	}
+
+	backup.WebhookDeliveries, err = mys.fetchWebhookDeliveries()
+	if err != nil {
+		return backup, fmt.Errorf("fetching webhook deliveries failed: %v", err)
+	}
+
+	backup.Users, err = mys.FetchUsers()
+	if err != nil {
+		return backup, fmt.Errorf("fetching users failed: %v", err)
+	}
+
+	backup.Teams, err = mys.FetchTeams()
+	if err != nil {
+		return backup, fmt.Errorf("fetching teams failed: %v", err)
+	}
+
+	backup.AuditLog, err = mys.FetchAuditEntries(data.AuditFilter{})
+	if err != nil {
+		return backup, fmt.Errorf("fetching audit log failed: %v", err)
+	}
+
+	return backup, nil
+}
+
+func (mys *DB) fetchVersions() ([]data.Version, error) {
+	rows, err := mys.conn.Query("SELECT queryId, query, comment, date FROM version ORDER BY queryId")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't execute query: %s", err.Error())
+	}
+	defer rows.Close()
+
+	var versions []data.Version
+	for rows.Next() {
+		version, err := dbutil.ReadVersion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+		}
+
+		versions = append(versions, version)
+	}
+
+	return versions, rows.Err()
+}
+
+func (mys *DB) fetchPushSubscriptions() ([]data.PushSubscription, error) {
+	rows, err := mys.conn.Query("SELECT subscriber, endpoint, p256dh_key, auth_key FROM `push_subscriptions` ORDER BY subscriber, endpoint")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't execute query: %s", err.Error())
+	}
+	defer rows.Close()
+
+	var subscriptions []data.PushSubscription
+	for rows.Next() {
+		subscription, err := dbutil.ReadPushSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+		}
+
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	return subscriptions, rows.Err()
+}
+
+func (mys *DB) fetchWebhookDeliveries() ([]data.WebhookDelivery, error) {
+	rows, err := mys.conn.Query("SELECT * FROM `webhook_deliveries` ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't execute query: %s", err.Error())
+	}
+	defer rows.Close()
+
+	var deliveries []data.WebhookDelivery
+	for rows.Next() {
+		delivery, err := dbutil.ReadWebhookDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// Restore replaces everything that is stored with the contents of the
+// backup, keeping the IDs. The version table is left alone, as it
+// belongs to this backend. Either everything is restored, or nothing.
+func (mys *DB) Restore(backup data.Backup) error {
+	if err := mys.alive(); err != nil {
+		return fmt.Errorf("database down: %s", err.Error())
+	}
+
+	tx, err := mys.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("starting transaction failed: %v", err)
+	}
+
+	err = restore(tx, backup)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("committing transaction failed: %v", err)
+	}
+
+	return nil
+}
+
+func restore(tx *sql.Tx, backup data.Backup) error {
+	for _, table := range []string{"team_members", "teams", "users", "audit_log", "webhook_deliveries", "webhooks", "push_subscriptions", "databases"} {
+		_, err := tx.Exec("DELETE FROM `" + table + "`")
+		if err != nil {
+			return fmt.Errorf("emptying %s failed: %v", table, err)
+		}
+	}
+
+	for _, row := range backup.Databases {
+		_, err := tx.Exec("INSERT INTO `databases` (`id`, `dbname`, `dbuser`, `dbpass`, `dbsid`, `dumpfile`, `createDate`, `expiryDate`, `creator`, `agentName`, `dbAddress`, `dbPort`, `dbvendor`, `status`, `message`, `visibility`, `comment`, `team`, `coowners`, `tags`, `scriptOutput`, `liferayBuild`, `liferaySchema`, `liferayCompanies`, `liferayVirtualHosts`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			row.ID,
+			row.DBName,
+			row.DBUser,
+			row.DBPass,
+			row.DBSID,
+			row.Dumpfile,
+			row.CreateDate,
+			row.ExpiryDate,
+			row.Creator,
+			row.AgentName,
+			row.DBAddress,
+			row.DBPort,
+			row.DBVendor,
+			row.Status,
+			row.Message,
+			row.Public,
+			row.Comment,
+			row.Team,
+			dbutil.JoinList(row.CoOwners),
+			dbutil.JoinList(row.Tags),
+			row.ScriptOutput,
+			row.Liferay.BuildNumber,
+			row.Liferay.SchemaVersion,
+			row.Liferay.Companies,
+			dbutil.JoinList(row.Liferay.VirtualHosts),
+		)
+		if err != nil {
+			return fmt.Errorf("restoring database %d failed: %v", row.ID, err)
+		}
+	}
+
+	for _, sub := range backup.PushSubscriptions {
+		_, err := tx.Exec("INSERT INTO `push_subscriptions` (`subscriber`, `endpoint`, `p256dh_key`, `auth_key`) VALUES (?, ?, ?, ?)", sub.Subscriber, sub.Endpoint, sub.P256dh, sub.Auth)
+		if err != nil {
+			return fmt.Errorf("restoring push subscription of %s failed: %v", sub.Subscriber, err)
+		}
+	}
+
+	for _, hook := range backup.Webhooks {
+		_, err := tx.Exec("INSERT INTO `webhooks` (`id`, `owner`, `url`, `secret`, `events`, `global`, `createDate`) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			hook.ID,
+			hook.Owner,
+			hook.URL,
+			hook.Secret,
+			dbutil.JoinList(hook.Events),
+			hook.Global,
+			hook.CreateDate,
+		)
+		if err != nil {
+			return fmt.Errorf("restoring webhook %d failed: %v", hook.ID, err)
+		}
+	}
+
+	for _, delivery := range backup.WebhookDeliveries {
+		_, err := tx.Exec("INSERT INTO `webhook_deliveries` (`id`, `webhookId`, `deliveryId`, `event`, `databaseId`, `attempt`, `statusCode`, `success`, `error`, `date`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			delivery.ID,
+			delivery.WebhookID,
+			delivery.DeliveryID,
+			delivery.Event,
+			delivery.DatabaseID,
+			delivery.Attempt,
+			delivery.StatusCode,
+			delivery.Success,
+			delivery.Error,
+			delivery.Date,
+		)
+		if err != nil {
+			return fmt.Errorf("restoring webhook delivery %d failed: %v", delivery.ID, err)
+		}
+	}
+
+	for _, user := range backup.Users {
+		_, err := tx.Exec("INSERT INTO `users` (`email`, `role`) VALUES (?, ?)", user.Email, user.Role)
+		if err != nil {
+			return fmt.Errorf("restoring user %s failed: %v", user.Email, err)
+		}
+	}
+
+	for _, team := range backup.Teams {
+		_, err := tx.Exec("INSERT INTO `teams` (`id`, `name`) VALUES (?, ?)", team.ID, team.Name)
+		if err != nil {
+			return fmt.Errorf("restoring team %d failed: %v", team.ID, err)
+		}
+
+		for _, member := range team.Members {
+			_, err = tx.Exec("INSERT INTO `team_members` (`teamId`, `email`) VALUES (?, ?)", team.ID, member)
+			if err != nil {
+				return fmt.Errorf("restoring member %s of team %d failed: %v", member, team.ID, err)
+			}
+		}
+	}
+
+	for _, entry := range backup.AuditLog {
+		_, err := tx.Exec("INSERT INTO `audit_log` (`id`, `date`, `user`, `action`, `databaseId`, `agent`, `details`) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			entry.ID,
+			entry.Date.UTC(),
+			entry.User,
+			entry.Action,
+			entry.DatabaseID,
+			entry.Agent,
+			entry.Details,
+		)
+		if err != nil {
+			return fmt.Errorf("restoring audit entry %d failed: %v", entry.ID, err)
+		}
+	}
+
+	return nil
+}
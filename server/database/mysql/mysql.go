@@ -89,8 +89,8 @@ func (mys *DB) FetchByDBNameAgent(dbname, agent string) (data.Row, error) {
 	return res, nil
 }
 
-// FetchByCreator returns public entries that were created by the
-// specified user, an empty list if it's not the user does
+// FetchByCreator returns private entries that were created or are
+// co-owned by the specified user, an empty list if it's not the user does
 // not have any entries, or an error if something went
 // wrong
 func (mys *DB) FetchByCreator(creator string) ([]data.Row, error) {
@@ -100,7 +100,7 @@ func (mys *DB) FetchByCreator(creator string) ([]data.Row, error) {
 
 	var entries []data.Row
 
-	rows, err := mys.conn.Query("SELECT * FROM `databases` WHERE creator = ? AND visibility = 0 ORDER BY id DESC", creator)
+	rows, err := mys.conn.Query("SELECT * FROM `databases` WHERE (creator = ? OR FIND_IN_SET(?, coowners) > 0) AND visibility = 0 ORDER BY id DESC", creator, creator)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't execute query: %s", err.Error())
 	}
@@ -213,7 +213,7 @@ func (mys *DB) Insert(entry *data.Row) error {
 		return fmt.Errorf("database down: %s", err.Error())
 	}
 
-	query := "INSERT INTO `databases` (`dbname`, `dbuser`, `dbpass`, `dbsid`, `dumpfile`, `createDate`, `expiryDate`, `creator`, `agentName`, `dbAddress`, `dbPort`, `dbvendor`, `status`, `message`, `visibility`, `comment`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	query := "INSERT INTO `databases` (`dbname`, `dbuser`, `dbpass`, `dbsid`, `dumpfile`, `createDate`, `expiryDate`, `creator`, `agentName`, `dbAddress`, `dbPort`, `dbvendor`, `status`, `message`, `visibility`, `comment`, `team`, `coowners`, `tags`, `scriptOutput`, `liferayBuild`, `liferaySchema`, `liferayCompanies`, `liferayVirtualHosts`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
 
 	res, err := mys.conn.Exec(query,
 		entry.DBName,
@@ -232,6 +232,14 @@ func (mys *DB) Insert(entry *data.Row) error {
 		entry.Message,
 		entry.Public,
 		entry.Comment,
+		entry.Team,
+		dbutil.JoinList(entry.CoOwners),
+		dbutil.JoinList(entry.Tags),
+		entry.ScriptOutput,
+		entry.Liferay.BuildNumber,
+		entry.Liferay.SchemaVersion,
+		entry.Liferay.Companies,
+		dbutil.JoinList(entry.Liferay.VirtualHosts),
 	)
 	if err != nil {
 		return fmt.Errorf("insert failed: %v", err)
@@ -293,7 +301,7 @@ func (mys *DB) Update(entry *data.Row) error {
 		return mys.Insert(entry)
 	}
 
-	query := "UPDATE `databases` SET `dbname`= ?, `dbuser`= ?, `dbpass`= ?, `dbsid`= ?, `dumpfile`= ?, `createDate`= ?, `expiryDate`= ?, `creator`= ?, `agentName`= ?, `dbAddress`= ?, `dbPort`= ?, `dbvendor`= ?, `status`= ?, `message`= ?, `visibility`= ?, `comment` = ? WHERE id = ?"
+	query := "UPDATE `databases` SET `dbname`= ?, `dbuser`= ?, `dbpass`= ?, `dbsid`= ?, `dumpfile`= ?, `createDate`= ?, `expiryDate`= ?, `creator`= ?, `agentName`= ?, `dbAddress`= ?, `dbPort`= ?, `dbvendor`= ?, `status`= ?, `message`= ?, `visibility`= ?, `comment` = ?, `team` = ?, `coowners` = ?, `tags` = ?, `scriptOutput` = ?, `liferayBuild` = ?, `liferaySchema` = ?, `liferayCompanies` = ?, `liferayVirtualHosts` = ? WHERE id = ?"
 
 	_, err = mys.conn.Exec(query,
 		entry.DBName,
@@ -312,6 +320,14 @@ func (mys *DB) Update(entry *data.Row) error {
 		entry.Message,
 		entry.Public,
 		entry.Comment,
+		entry.Team,
+		dbutil.JoinList(entry.CoOwners),
+		dbutil.JoinList(entry.Tags),
+		entry.ScriptOutput,
+		entry.Liferay.BuildNumber,
+		entry.Liferay.SchemaVersion,
+		entry.Liferay.Companies,
+		dbutil.JoinList(entry.Liferay.VirtualHosts),
 		entry.ID)
 	if err != nil {
 		return fmt.Errorf("failed update: %v", err)
@@ -416,6 +432,78 @@ var queries = []dbUpdate{
 		Query:   "CREATE UNIQUE INDEX `agent_db_idx` ON `databases` (`dbname`, `agentName`);",
 		Comment: "Create unique index on columns (dbname, agentName) for table databases",
 	},
+	{
+		Query:   "CREATE TABLE IF NOT EXISTS `webhooks` (`id` INT NOT NULL AUTO_INCREMENT, `owner` VARCHAR(255) NOT NULL, `url` TEXT NOT NULL, `secret` VARCHAR(255) NOT NULL DEFAULT '', `events` VARCHAR(1024) NOT NULL DEFAULT '', `global` TINYINT(1) NOT NULL DEFAULT 0, `createDate` DATETIME NULL, PRIMARY KEY (`id`));",
+		Comment: "Create the webhooks table",
+	},
+	{
+		Query:   "CREATE TABLE IF NOT EXISTS `webhook_deliveries` (`id` INT NOT NULL AUTO_INCREMENT, `webhookId` INT NOT NULL, `deliveryId` VARCHAR(64) NOT NULL, `event` VARCHAR(64) NOT NULL, `databaseId` INT NOT NULL, `attempt` INT NOT NULL, `statusCode` INT NOT NULL, `success` TINYINT(1) NOT NULL, `error` TEXT NOT NULL, `date` DATETIME NULL, PRIMARY KEY (`id`));",
+		Comment: "Create the webhook_deliveries table",
+	},
+	{
+		Query:   "CREATE INDEX `webhook_deliveries_idx` ON `webhook_deliveries` (`webhookId`);",
+		Comment: "Create index on column webhookId for table webhook_deliveries",
+	},
+	{
+		Query:   "CREATE TABLE IF NOT EXISTS `audit_log` (`id` INT NOT NULL AUTO_INCREMENT, `date` DATETIME(6) NOT NULL, `user` VARCHAR(255) NOT NULL, `action` VARCHAR(64) NOT NULL, `databaseId` INT NOT NULL DEFAULT 0, `agent` VARCHAR(255) NOT NULL DEFAULT '', `details` TEXT NOT NULL, PRIMARY KEY (`id`));",
+		Comment: "Create the audit_log table",
+	},
+	{
+		Query:   "CREATE INDEX `audit_log_date_idx` ON `audit_log` (`date`);",
+		Comment: "Create index on column date for table audit_log",
+	},
+	{
+		Query:   "ALTER TABLE `databases` ADD COLUMN `team` INT NOT NULL DEFAULT 0;",
+		Comment: "Add 'team' column",
+	},
+	{
+		Query:   "CREATE TABLE IF NOT EXISTS `users` (`email` VARCHAR(255) NOT NULL, `role` VARCHAR(32) NOT NULL, PRIMARY KEY (`email`));",
+		Comment: "Create the users table",
+	},
+	{
+		Query:   "CREATE TABLE IF NOT EXISTS `teams` (`id` INT NOT NULL AUTO_INCREMENT, `name` VARCHAR(255) NOT NULL, PRIMARY KEY (`id`), UNIQUE KEY `team_name_idx` (`name`));",
+		Comment: "Create the teams table",
+	},
+	{
+		Query:   "CREATE TABLE IF NOT EXISTS `team_members` (`teamId` INT NOT NULL, `email` VARCHAR(255) NOT NULL, PRIMARY KEY (`teamId`, `email`));",
+		Comment: "Create the team_members table",
+	},
+	{
+		Query:   "ALTER TABLE `databases` ADD COLUMN `coowners` VARCHAR(2048) NOT NULL DEFAULT '';",
+		Comment: "Add 'coowners' column",
+	},
+	{
+		Query:   "ALTER TABLE `databases` ADD COLUMN `tags` VARCHAR(2048) NOT NULL DEFAULT '';",
+		Comment: "Add 'tags' column",
+	},
+	{
+		Query:   "ALTER TABLE `databases` ADD COLUMN `scriptOutput` LONGTEXT;",
+		Comment: "Add 'scriptOutput' column",
+	},
+	{
+		Query:   "UPDATE `databases` SET `scriptOutput` = '' WHERE `scriptOutput` IS NULL;",
+		Comment: "Update 'scriptOutput' columns to empty where null",
+	},
+	{
+		Query:   "ALTER TABLE `databases` ADD COLUMN `liferayBuild` INT NOT NULL DEFAULT 0;",
+		Comment: "Add 'liferayBuild' column",
+	},
+	{
+		Query:   "ALTER TABLE `databases` ADD COLUMN `liferaySchema` VARCHAR(32) NOT NULL DEFAULT '';",
+		Comment: "Add 'liferaySchema' column",
+	},
+	{
+		Query:   "ALTER TABLE `databases` ADD COLUMN `liferayCompanies` INT NOT NULL DEFAULT 0;",
+		Comment: "Add 'liferayCompanies' column",
+	},
+	{
+		Query:   "ALTER TABLE `databases` ADD COLUMN `liferayVirtualHosts` VARCHAR(2048) NOT NULL DEFAULT '';",
+		Comment: "Add 'liferayVirtualHosts' column",
+	},
+	{
+		Query:   "ALTER TABLE `databases` MODIFY `dbpass` TEXT NULL;",
+		Comment: "Change 'dbpass' to TEXT, to fit the encrypted passwords",
+	},
 }
 
 func (mys *DB) connect(datasource string) error {
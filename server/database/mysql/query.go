@@ -0,0 +1,77 @@
+package mysql
+
+import (
+	"fmt"
+
+	"github.com/djavorszky/ddn/server/database/data"
+	"github.com/djavorszky/ddn/server/database/dbutil"
+)
+
+// inListCond matches the rows whose comma separated list in the column
+// given to Sprintf contains the value in its placeholder.
+const inListCond = "FIND_IN_SET(?, %s) > 0"
+
+// FetchDatabases returns the entries matching query.
+func (mys *DB) FetchDatabases(query data.DatabaseQuery) ([]data.Row, error) {
+	if err := mys.alive(); err != nil {
+		return nil, fmt.Errorf("database down: %s", err.Error())
+	}
+
+	q, args := dbutil.DatabaseQuery(query, inListCond)
+
+	rows, err := mys.conn.Query(q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't execute query: %s", err.Error())
+	}
+	defer rows.Close()
+
+	var entries []data.Row
+	for rows.Next() {
+		row, err := dbutil.ReadRows(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+		}
+
+		entries = append(entries, row)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+	}
+
+	return entries, nil
+}
+
+// CountDatabases returns the number of entries matching query, ignoring
+// its paging.
+func (mys *DB) CountDatabases(query data.DatabaseQuery) (int, error) {
+	if err := mys.alive(); err != nil {
+		return 0, fmt.Errorf("database down: %s", err.Error())
+	}
+
+	q, args := dbutil.DatabaseCountQuery(query, inListCond)
+
+	var count int
+
+	err := mys.conn.QueryRow(q, args...).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't execute query: %s", err.Error())
+	}
+
+	return count, nil
+}
+
+// CountByStatus returns the number of entries by status and vendor.
+func (mys *DB) CountByStatus() ([]data.StatusCount, error) {
+	if err := mys.alive(); err != nil {
+		return nil, fmt.Errorf("database down: %s", err.Error())
+	}
+
+	rows, err := mys.conn.Query(dbutil.StatusCountQuery)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't execute query: %s", err.Error())
+	}
+
+	return dbutil.ReadStatusCounts(rows)
+}
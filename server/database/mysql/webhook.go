@@ -0,0 +1,175 @@
+package mysql
+
+import (
+	"fmt"
+
+	"github.com/djavorszky/ddn/server/database/data"
+	"github.com/djavorszky/ddn/server/database/dbutil"
+	"github.com/djavorszky/sutils"
+)
+
+// FetchWebhookByID returns the webhook with the given ID. If it
+// does not exist, the returned webhook's ID is 0.
+func (mys *DB) FetchWebhookByID(ID int) (data.Webhook, error) {
+	if err := mys.alive(); err != nil {
+		return data.Webhook{}, fmt.Errorf("database down: %s", err.Error())
+	}
+
+	row := mys.conn.QueryRow("SELECT * FROM `webhooks` WHERE id = ?", ID)
+	hook, err := dbutil.ReadWebhook(row)
+	if err != nil {
+		return data.Webhook{}, fmt.Errorf("failed reading result: %v", err)
+	}
+
+	return hook, nil
+}
+
+// FetchWebhooksByOwner returns the webhooks registered by owner.
+func (mys *DB) FetchWebhooksByOwner(owner string) ([]data.Webhook, error) {
+	return mys.fetchWebhooks("SELECT * FROM `webhooks` WHERE owner = ? ORDER BY id", owner)
+}
+
+// FetchGlobalWebhooks returns the webhooks that are notified about
+// the events of all databases.
+func (mys *DB) FetchGlobalWebhooks() ([]data.Webhook, error) {
+	return mys.fetchWebhooks("SELECT * FROM `webhooks` WHERE global = 1 ORDER BY id")
+}
+
+func (mys *DB) fetchWebhooks(query string, args ...interface{}) ([]data.Webhook, error) {
+	if err := mys.alive(); err != nil {
+		return nil, fmt.Errorf("database down: %s", err.Error())
+	}
+
+	rows, err := mys.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't execute query: %s", err.Error())
+	}
+	defer rows.Close()
+
+	var hooks []data.Webhook
+	for rows.Next() {
+		hook, err := dbutil.ReadWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+		}
+
+		hooks = append(hooks, hook)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+	}
+
+	return hooks, nil
+}
+
+// InsertWebhook adds a webhook to the database, setting its ID
+func (mys *DB) InsertWebhook(hook *data.Webhook) error {
+	if err := mys.alive(); err != nil {
+		return fmt.Errorf("database down: %s", err.Error())
+	}
+
+	if !sutils.Present(hook.Owner, hook.URL) {
+		return fmt.Errorf("missing owner or url")
+	}
+
+	res, err := mys.conn.Exec("INSERT INTO `webhooks` (`owner`, `url`, `secret`, `events`, `global`, `createDate`) VALUES (?, ?, ?, ?, ?, ?)",
+		hook.Owner,
+		hook.URL,
+		hook.Secret,
+		dbutil.JoinList(hook.Events),
+		hook.Global,
+		hook.CreateDate,
+	)
+	if err != nil {
+		return fmt.Errorf("insert failed: %v", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed getting new ID: %v", err)
+	}
+
+	hook.ID = int(id)
+
+	return nil
+}
+
+// DeleteWebhook removes the webhook along with its deliveries
+func (mys *DB) DeleteWebhook(hook data.Webhook) error {
+	if err := mys.alive(); err != nil {
+		return fmt.Errorf("database down: %s", err.Error())
+	}
+
+	_, err := mys.conn.Exec("DELETE FROM `webhook_deliveries` WHERE webhookId = ?", hook.ID)
+	if err != nil {
+		return fmt.Errorf("deleting deliveries failed: %v", err)
+	}
+
+	_, err = mys.conn.Exec("DELETE FROM `webhooks` WHERE id = ?", hook.ID)
+
+	return err
+}
+
+// InsertWebhookDelivery logs a delivery attempt, setting its ID
+func (mys *DB) InsertWebhookDelivery(delivery *data.WebhookDelivery) error {
+	if err := mys.alive(); err != nil {
+		return fmt.Errorf("database down: %s", err.Error())
+	}
+
+	res, err := mys.conn.Exec("INSERT INTO `webhook_deliveries` (`webhookId`, `deliveryId`, `event`, `databaseId`, `attempt`, `statusCode`, `success`, `error`, `date`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		delivery.WebhookID,
+		delivery.DeliveryID,
+		delivery.Event,
+		delivery.DatabaseID,
+		delivery.Attempt,
+		delivery.StatusCode,
+		delivery.Success,
+		delivery.Error,
+		delivery.Date,
+	)
+	if err != nil {
+		return fmt.Errorf("insert failed: %v", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed getting new ID: %v", err)
+	}
+
+	delivery.ID = int(id)
+
+	return nil
+}
+
+// FetchWebhookDeliveries returns the latest limit delivery attempts of
+// the webhook, newest first.
+func (mys *DB) FetchWebhookDeliveries(webhookID, limit int) ([]data.WebhookDelivery, error) {
+	if err := mys.alive(); err != nil {
+		return nil, fmt.Errorf("database down: %s", err.Error())
+	}
+
+	rows, err := mys.conn.Query("SELECT * FROM `webhook_deliveries` WHERE webhookId = ? ORDER BY id DESC LIMIT ?", webhookID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't execute query: %s", err.Error())
+	}
+	defer rows.Close()
+
+	var deliveries []data.WebhookDelivery
+	for rows.Next() {
+		delivery, err := dbutil.ReadWebhookDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+	}
+
+	return deliveries, nil
+}
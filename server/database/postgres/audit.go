@@ -0,0 +1,115 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/djavorszky/ddn/server/database/data"
+	"github.com/djavorszky/ddn/server/database/dbutil"
+	"github.com/djavorszky/sutils"
+)
+
+// InsertAuditEntry adds an entry to the audit log, setting its ID
+func (pg *DB) InsertAuditEntry(entry *data.AuditEntry) error {
+	if err := pg.alive(); err != nil {
+		return fmt.Errorf("database down: %s", err.Error())
+	}
+
+	if !sutils.Present(entry.Action) {
+		return fmt.Errorf("missing action")
+	}
+
+	err := pg.conn.QueryRow(`INSERT INTO audit_log (date, "user", action, databaseId, agent, details) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		entry.Date.UTC(),
+		entry.User,
+		entry.Action,
+		entry.DatabaseID,
+		entry.Agent,
+		entry.Details,
+	).Scan(&entry.ID)
+	if err != nil {
+		return fmt.Errorf("insert failed: %v", err)
+	}
+
+	return nil
+}
+
+// FetchAuditEntries returns the entries of the audit log that match
+// filter, newest first.
+func (pg *DB) FetchAuditEntries(filter data.AuditFilter) ([]data.AuditEntry, error) {
+	if err := pg.alive(); err != nil {
+		return nil, fmt.Errorf("database down: %s", err.Error())
+	}
+
+	query, args := auditQuery(filter)
+
+	rows, err := pg.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't execute query: %s", err.Error())
+	}
+	defer rows.Close()
+
+	var entries []data.AuditEntry
+	for rows.Next() {
+		entry, err := dbutil.ReadAuditEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+		}
+
+		entries = append(entries, entry)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+	}
+
+	return entries, nil
+}
+
+// auditQuery is dbutil.AuditQuery with postgres' placeholders and quoting.
+func auditQuery(filter data.AuditFilter) (string, []interface{}) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+
+	cond := func(format string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(format, len(args)))
+	}
+
+	if filter.User != "" {
+		cond(`"user" = $%d`, filter.User)
+	}
+
+	if filter.DatabaseID != 0 {
+		cond("databaseId = $%d", filter.DatabaseID)
+	}
+
+	if filter.Agent != "" {
+		cond("agent = $%d", filter.Agent)
+	}
+
+	if !filter.From.IsZero() {
+		cond("date >= $%d", filter.From.UTC())
+	}
+
+	if !filter.To.IsZero() {
+		cond("date < $%d", filter.To.UTC())
+	}
+
+	query := "SELECT * FROM audit_log"
+	if len(conds) != 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	query += " ORDER BY id DESC"
+
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	return query, args
+}
@@ -0,0 +1,279 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/djavorszky/ddn/server/database/data"
+	"github.com/djavorszky/ddn/server/database/dbutil"
+)
+
+// Export returns everything that is stored, along with the version table.
+func (pg *DB) Export() (data.Backup, error) {
+	var (
+		backup data.Backup
+		err    error
+	)
+
+	if err = pg.alive(); err != nil {
+		return backup, fmt.Errorf("database down: %s", err.Error())
+	}
+
+	backup.Versions, err = pg.fetchVersions()
+	if err != nil {
+		return backup, fmt.Errorf("fetching versions failed: %v", err)
+	}
+
+	backup.Databases, err = pg.FetchAll()
+	if err != nil {
+		return backup, fmt.Errorf("fetching databases failed: %v", err)
+	}
+
+	backup.PushSubscriptions, err = pg.fetchPushSubscriptions()
+	if err != nil {
+		return backup, fmt.Errorf("fetching push subscriptions failed: %v", err)
+	}
+
+	backup.Webhooks, err = pg.fetchWebhooks("SELECT * FROM webhooks ORDER BY id")
+	if err != nil {
+		return backup, fmt.Errorf("fetching webhooks failed: %v", err)
+	}
+
+	backup.WebhookDeliveries, err = pg.fetchWebhookDeliveries()
+	if err != nil {
+		return backup, fmt.Errorf("fetching webhook deliveries failed: %v", err)
+	}
+
+	backup.Users, err = pg.FetchUsers()
+	if err != nil {
+		return backup, fmt.Errorf("fetching users failed: %v", err)
+	}
+
+	backup.Teams, err = pg.FetchTeams()
+	if err != nil {
+		return backup, fmt.Errorf("fetching teams failed: %v", err)
+	}
+
+	backup.AuditLog, err = pg.FetchAuditEntries(data.AuditFilter{})
+	if err != nil {
+		return backup, fmt.Errorf("fetching audit log failed: %v", err)
+	}
+
+	return backup, nil
+}
+
+func (pg *DB) fetchVersions() ([]data.Version, error) {
+	rows, err := pg.conn.Query("SELECT queryId, query, comment, date FROM version ORDER BY queryId")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't execute query: %s", err.Error())
+	}
+	defer rows.Close()
+
+	var versions []data.Version
+	for rows.Next() {
+		version, err := dbutil.ReadVersion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+		}
+
+		versions = append(versions, version)
+	}
+
+	return versions, rows.Err()
+}
+
+func (pg *DB) fetchPushSubscriptions() ([]data.PushSubscription, error) {
+	rows, err := pg.conn.Query("SELECT subscriber, endpoint, p256dh_key, auth_key FROM push_subscriptions ORDER BY subscriber, endpoint")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't execute query: %s", err.Error())
+	}
+	defer rows.Close()
+
+	var subscriptions []data.PushSubscription
+	for rows.Next() {
+		subscription, err := dbutil.ReadPushSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+		}
+
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	return subscriptions, rows.Err()
+}
+
+func (pg *DB) fetchWebhookDeliveries() ([]data.WebhookDelivery, error) {
+	rows, err := pg.conn.Query("SELECT * FROM webhook_deliveries ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't execute query: %s", err.Error())
+	}
+	defer rows.Close()
+
+	var deliveries []data.WebhookDelivery
+	for rows.Next() {
+		delivery, err := dbutil.ReadWebhookDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// Restore replaces everything that is stored with the contents of the
+// backup, keeping the IDs. The version table is left alone, as it
+// belongs to this backend. Either everything is restored, or nothing.
+func (pg *DB) Restore(backup data.Backup) error {
+	if err := pg.alive(); err != nil {
+		return fmt.Errorf("database down: %s", err.Error())
+	}
+
+	tx, err := pg.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("starting transaction failed: %v", err)
+	}
+
+	err = restore(tx, backup)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("committing transaction failed: %v", err)
+	}
+
+	return nil
+}
+
+func restore(tx *sql.Tx, backup data.Backup) error {
+	for _, table := range []string{"team_members", "teams", "users", "audit_log", "webhook_deliveries", "webhooks", "push_subscriptions", "databases"} {
+		_, err := tx.Exec("DELETE FROM " + table)
+		if err != nil {
+			return fmt.Errorf("emptying %s failed: %v", table, err)
+		}
+	}
+
+	for _, row := range backup.Databases {
+		_, err := tx.Exec("INSERT INTO databases (id, dbname, dbuser, dbpass, dbsid, dumpfile, createDate, expiryDate, creator, agentName, dbAddress, dbPort, dbvendor, status, message, visibility, comment, team, coowners, tags, scriptOutput, liferayBuild, liferaySchema, liferayCompanies, liferayVirtualHosts) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25)",
+			row.ID,
+			row.DBName,
+			row.DBUser,
+			row.DBPass,
+			row.DBSID,
+			row.Dumpfile,
+			row.CreateDate,
+			row.ExpiryDate,
+			row.Creator,
+			row.AgentName,
+			row.DBAddress,
+			row.DBPort,
+			row.DBVendor,
+			row.Status,
+			row.Message,
+			row.Public,
+			row.Comment,
+			row.Team,
+			dbutil.JoinList(row.CoOwners),
+			dbutil.JoinList(row.Tags),
+			row.ScriptOutput,
+			row.Liferay.BuildNumber,
+			row.Liferay.SchemaVersion,
+			row.Liferay.Companies,
+			dbutil.JoinList(row.Liferay.VirtualHosts),
+		)
+		if err != nil {
+			return fmt.Errorf("restoring database %d failed: %v", row.ID, err)
+		}
+	}
+
+	for _, sub := range backup.PushSubscriptions {
+		_, err := tx.Exec("INSERT INTO push_subscriptions (subscriber, endpoint, p256dh_key, auth_key) VALUES ($1, $2, $3, $4)", sub.Subscriber, sub.Endpoint, sub.P256dh, sub.Auth)
+		if err != nil {
+			return fmt.Errorf("restoring push subscription of %s failed: %v", sub.Subscriber, err)
+		}
+	}
+
+	for _, hook := range backup.Webhooks {
+		_, err := tx.Exec("INSERT INTO webhooks (id, owner, url, secret, events, global, createDate) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+			hook.ID,
+			hook.Owner,
+			hook.URL,
+			hook.Secret,
+			dbutil.JoinList(hook.Events),
+			hook.Global,
+			hook.CreateDate,
+		)
+		if err != nil {
+			return fmt.Errorf("restoring webhook %d failed: %v", hook.ID, err)
+		}
+	}
+
+	for _, delivery := range backup.WebhookDeliveries {
+		_, err := tx.Exec(`INSERT INTO webhook_deliveries (id, webhookId, deliveryId, event, databaseId, attempt, statusCode, success, error, date) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+			delivery.ID,
+			delivery.WebhookID,
+			delivery.DeliveryID,
+			delivery.Event,
+			delivery.DatabaseID,
+			delivery.Attempt,
+			delivery.StatusCode,
+			delivery.Success,
+			delivery.Error,
+			delivery.Date,
+		)
+		if err != nil {
+			return fmt.Errorf("restoring webhook delivery %d failed: %v", delivery.ID, err)
+		}
+	}
+
+	for _, user := range backup.Users {
+		_, err := tx.Exec("INSERT INTO users (email, role) VALUES ($1, $2)", user.Email, user.Role)
+		if err != nil {
+			return fmt.Errorf("restoring user %s failed: %v", user.Email, err)
+		}
+	}
+
+	for _, team := range backup.Teams {
+		_, err := tx.Exec("INSERT INTO teams (id, name) VALUES ($1, $2)", team.ID, team.Name)
+		if err != nil {
+			return fmt.Errorf("restoring team %d failed: %v", team.ID, err)
+		}
+
+		for _, member := range team.Members {
+			_, err = tx.Exec("INSERT INTO team_members (teamId, email) VALUES ($1, $2)", team.ID, member)
+			if err != nil {
+				return fmt.Errorf("restoring member %s of team %d failed: %v", member, team.ID, err)
+			}
+		}
+	}
+
+	for _, entry := range backup.AuditLog {
+		_, err := tx.Exec(`INSERT INTO audit_log (id, date, "user", action, databaseId, agent, details) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			entry.ID,
+			entry.Date.UTC(),
+			entry.User,
+			entry.Action,
+			entry.DatabaseID,
+			entry.Agent,
+			entry.Details,
+		)
+		if err != nil {
+			return fmt.Errorf("restoring audit entry %d failed: %v", entry.ID, err)
+		}
+	}
+
+	// The IDs were set explicitly, so the sequences have to be moved
+	// past them for the next inserts.
+	for _, table := range []string{"databases", "webhooks", "webhook_deliveries", "teams", "audit_log"} {
+		_, err := tx.Exec(fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM %[1]s", table))
+		if err != nil {
+			return fmt.Errorf("resetting the id sequence of %s failed: %v", table, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,522 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/djavorszky/ddn/common/logger"
+	"github.com/djavorszky/ddn/common/model"
+	"github.com/djavorszky/ddn/server/database/data"
+	"github.com/djavorszky/ddn/server/database/dbutil"
+	"github.com/djavorszky/sutils"
+	webpush "github.com/sherclockholmes/webpush-go"
+
+	// Db
+	_ "github.com/lib/pq"
+)
+
+// maintenanceDB is the database that always exists and is connected to
+// when the server's database has to be created.
+const maintenanceDB = "postgres"
+
+// DB implements the BackendConnection
+type DB struct {
+	Address, Port, User, Pass, Database string
+	conn                                *sql.DB
+}
+
+// ConnectAndPrepare establishes a database connection and initializes the tables, if needed
+func (pg *DB) ConnectAndPrepare() error {
+	err := pg.connect(pg.datasource(maintenanceDB))
+	if err != nil {
+		return fmt.Errorf("couldn't connect to the database: %s", err.Error())
+	}
+
+	var count int
+
+	err = pg.conn.QueryRow("SELECT count(*) FROM pg_database WHERE datname = $1", pg.Database).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("checking if the database exists failed: %s", sutils.TrimNL(err.Error()))
+	}
+
+	if count == 0 {
+		_, err = pg.conn.Exec(fmt.Sprintf("CREATE DATABASE %q ENCODING 'UTF8';", pg.Database))
+		if err != nil {
+			return fmt.Errorf("executing create database query failed: %s", sutils.TrimNL(err.Error()))
+		}
+	}
+
+	pg.Close()
+
+	err = pg.connect(pg.datasource(pg.Database))
+	if err != nil {
+		return fmt.Errorf("couldn't connect to the database: %s", err.Error())
+	}
+
+	err = pg.initTables()
+	if err != nil {
+		return fmt.Errorf("initializing tables failed: %s", err.Error())
+	}
+
+	return nil
+}
+
+// Close closes the database connection
+func (pg *DB) Close() error {
+	return pg.conn.Close()
+}
+
+// FetchByID returns the entry associated with that ID, or
+// an error if it does not exist
+func (pg *DB) FetchByID(ID int) (data.Row, error) {
+	if err := pg.alive(); err != nil {
+		return data.Row{}, fmt.Errorf("database down: %s", err.Error())
+	}
+
+	row := pg.conn.QueryRow("SELECT * FROM databases WHERE id = $1", ID)
+	res, err := dbutil.ReadRow(row)
+	if err != nil {
+		return data.Row{}, fmt.Errorf("failed reading result: %v", err)
+	}
+
+	return res, nil
+}
+
+// FetchByDBNameAgent returns the entry for the database with the given name, from the given agent,
+// or an error if it does not exist
+func (pg *DB) FetchByDBNameAgent(dbname, agent string) (data.Row, error) {
+	if err := pg.alive(); err != nil {
+		return data.Row{}, fmt.Errorf("database down: %s", err.Error())
+	}
+
+	row := pg.conn.QueryRow("SELECT * FROM databases WHERE dbname = $1 AND agentName = $2", dbname, agent)
+	res, err := dbutil.ReadRow(row)
+	if err != nil {
+		return data.Row{}, fmt.Errorf("failed reading result: %v", err)
+	}
+
+	return res, nil
+}
+
+// FetchByCreator returns private entries that were created or are
+// co-owned by the specified user, an empty list if it's not the user does
+// not have any entries, or an error if something went
+// wrong
+func (pg *DB) FetchByCreator(creator string) ([]data.Row, error) {
+	if err := pg.alive(); err != nil {
+		return nil, fmt.Errorf("database down: %s", err.Error())
+	}
+
+	var entries []data.Row
+
+	rows, err := pg.conn.Query("SELECT * FROM databases WHERE (creator = $1 OR $2 = ANY(string_to_array(coowners, ','))) AND visibility = 0 ORDER BY id DESC", creator, creator)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't execute query: %s", err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row, err := dbutil.ReadRows(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+		}
+
+		entries = append(entries, row)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+	}
+
+	return entries, nil
+}
+
+// FetchPublic returns all entries that have "Public" set to true
+func (pg *DB) FetchPublic() ([]data.Row, error) {
+	return pg.fetchRows("SELECT * FROM databases WHERE visibility = 1 ORDER BY id DESC")
+}
+
+// FetchAll returns all entries.
+func (pg *DB) FetchAll() ([]data.Row, error) {
+	return pg.fetchRows("SELECT * FROM databases ORDER BY id DESC")
+}
+
+func (pg *DB) fetchRows(query string, args ...interface{}) ([]data.Row, error) {
+	if err := pg.alive(); err != nil {
+		return nil, fmt.Errorf("database down: %s", err.Error())
+	}
+
+	var entries []data.Row
+
+	rows, err := pg.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed running query: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row, err := dbutil.ReadRows(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+		}
+
+		entries = append(entries, row)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+	}
+
+	return entries, nil
+}
+
+// FetchUserPushSubscriptions fetches the subscriptions for the specified user
+func (pg *DB) FetchUserPushSubscriptions(subscriber string) ([]webpush.Subscription, error) {
+	if err := pg.alive(); err != nil {
+		return nil, fmt.Errorf("database down: %s", err.Error())
+	}
+
+	if !sutils.Present(subscriber) {
+		return nil, fmt.Errorf("missing subscriber")
+	}
+
+	var entries []webpush.Subscription
+
+	rows, err := pg.conn.Query("SELECT endpoint, p256dh_key, auth_key FROM push_subscriptions WHERE subscriber = $1", subscriber)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't execute query: %s", err.Error())
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		row, err := dbutil.ReadSubscriptionRows(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+		}
+
+		entries = append(entries, row)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+	}
+
+	return entries, nil
+}
+
+// Insert adds an entry to the database, returning its ID
+func (pg *DB) Insert(entry *data.Row) error {
+	if err := pg.alive(); err != nil {
+		return fmt.Errorf("database down: %s", err.Error())
+	}
+
+	query := "INSERT INTO databases (dbname, dbuser, dbpass, dbsid, dumpfile, createDate, expiryDate, creator, agentName, dbAddress, dbPort, dbvendor, status, message, visibility, comment, team, coowners, tags, scriptOutput, liferayBuild, liferaySchema, liferayCompanies, liferayVirtualHosts) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24) RETURNING id"
+
+	err := pg.conn.QueryRow(query,
+		entry.DBName,
+		entry.DBUser,
+		entry.DBPass,
+		entry.DBSID,
+		entry.Dumpfile,
+		entry.CreateDate,
+		entry.ExpiryDate,
+		entry.Creator,
+		entry.AgentName,
+		entry.DBAddress,
+		entry.DBPort,
+		entry.DBVendor,
+		entry.Status,
+		entry.Message,
+		entry.Public,
+		entry.Comment,
+		entry.Team,
+		dbutil.JoinList(entry.CoOwners),
+		dbutil.JoinList(entry.Tags),
+		entry.ScriptOutput,
+		entry.Liferay.BuildNumber,
+		entry.Liferay.SchemaVersion,
+		entry.Liferay.Companies,
+		dbutil.JoinList(entry.Liferay.VirtualHosts),
+	).Scan(&entry.ID)
+	if err != nil {
+		return fmt.Errorf("insert failed: %v", err)
+	}
+
+	return nil
+}
+
+// InsertPushSubscription adds a record to the push_subscriptions table
+func (pg *DB) InsertPushSubscription(subscription *model.PushSubscription, subscriber string) error {
+	if err := pg.alive(); err != nil {
+		return fmt.Errorf("database down: %s", err.Error())
+	}
+
+	if !sutils.Present(subscriber) {
+		return fmt.Errorf("missing subscriber")
+	}
+
+	if !sutils.Present(subscription.Endpoint) {
+		return fmt.Errorf("missing endpoint")
+	}
+
+	query := "INSERT INTO push_subscriptions (subscriber, endpoint, p256dh_key, auth_key) VALUES ($1, $2, $3, $4)"
+
+	_, err := pg.conn.Exec(query,
+		subscriber,
+		subscription.Endpoint,
+		subscription.Keys.P256dh,
+		subscription.Keys.Auth,
+	)
+	if err != nil {
+		return fmt.Errorf("saving push subscription to the database failed: %v", err)
+	}
+
+	return nil
+}
+
+// Update updates an already existing entry
+func (pg *DB) Update(entry *data.Row) error {
+	if err := pg.alive(); err != nil {
+		return fmt.Errorf("database down: %s", err.Error())
+	}
+
+	var count int
+
+	err := pg.conn.QueryRow("SELECT count(*) FROM databases WHERE id = $1", entry.ID).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed existence check: %v", err)
+	}
+
+	if count == 0 {
+		return pg.Insert(entry)
+	}
+
+	query := "UPDATE databases SET dbname = $1, dbuser = $2, dbpass = $3, dbsid = $4, dumpfile = $5, createDate = $6, expiryDate = $7, creator = $8, agentName = $9, dbAddress = $10, dbPort = $11, dbvendor = $12, status = $13, message = $14, visibility = $15, comment = $16, team = $17, coowners = $18, tags = $19, scriptOutput = $20, liferayBuild = $21, liferaySchema = $22, liferayCompanies = $23, liferayVirtualHosts = $24 WHERE id = $25"
+
+	_, err = pg.conn.Exec(query,
+		entry.DBName,
+		entry.DBUser,
+		entry.DBPass,
+		entry.DBSID,
+		entry.Dumpfile,
+		entry.CreateDate,
+		entry.ExpiryDate,
+		entry.Creator,
+		entry.AgentName,
+		entry.DBAddress,
+		entry.DBPort,
+		entry.DBVendor,
+		entry.Status,
+		entry.Message,
+		entry.Public,
+		entry.Comment,
+		entry.Team,
+		dbutil.JoinList(entry.CoOwners),
+		dbutil.JoinList(entry.Tags),
+		entry.ScriptOutput,
+		entry.Liferay.BuildNumber,
+		entry.Liferay.SchemaVersion,
+		entry.Liferay.Companies,
+		dbutil.JoinList(entry.Liferay.VirtualHosts),
+		entry.ID)
+	if err != nil {
+		return fmt.Errorf("failed update: %v", err)
+	}
+
+	return nil
+}
+
+// Delete removes the entry from the database
+func (pg *DB) Delete(entry data.Row) error {
+	if err := pg.alive(); err != nil {
+		return fmt.Errorf("database down: %s", err.Error())
+	}
+
+	_, err := pg.conn.Exec("DELETE FROM databases WHERE id = $1", entry.ID)
+
+	return err
+}
+
+// Alive checks whether the connection is alive. Returns error if not.
+func (pg *DB) alive() error {
+	defer func() {
+		if p := recover(); p != nil {
+			logger.Error("Panic Attack! Database seems to be down.")
+		}
+	}()
+
+	_, err := pg.conn.Exec("SELECT * FROM databases WHERE 1 = 0")
+	if err != nil {
+		return fmt.Errorf("executing stayalive query failed: %s", sutils.TrimNL(err.Error()))
+	}
+
+	return nil
+}
+
+// DeletePushSubscription deletes a record from the push_subscriptions table
+func (pg *DB) DeletePushSubscription(subscription *model.PushSubscription, subscriber string) error {
+	if err := pg.alive(); err != nil {
+		return fmt.Errorf("database down: %s", err.Error())
+	}
+
+	if !sutils.Present(subscriber) {
+		return fmt.Errorf("missing subscriber")
+	}
+
+	if !sutils.Present(subscription.Endpoint) {
+		return fmt.Errorf("missing endpoint")
+	}
+
+	_, err := pg.conn.Exec("DELETE FROM push_subscriptions WHERE subscriber = $1 AND endpoint = $2", subscriber, subscription.Endpoint)
+
+	return err
+}
+
+type dbUpdate struct {
+	Query   string
+	Comment string
+}
+
+// queries starts from the schema the other backends had arrived at when
+// postgres support was added. Append new updates to the end.
+var queries = []dbUpdate{
+	{
+		Query:   "CREATE TABLE version (queryId SERIAL PRIMARY KEY, query TEXT NULL, comment TEXT NULL, date TIMESTAMPTZ NULL);",
+		Comment: "Create the version table",
+	},
+	{
+		Query:   "CREATE TABLE IF NOT EXISTS databases (id SERIAL PRIMARY KEY, dbname VARCHAR(255) NULL, dbuser VARCHAR(255) NULL, dbpass VARCHAR(255) NULL, dbsid VARCHAR(45) NULL, dumpfile TEXT NULL, createDate TIMESTAMPTZ NULL, expiryDate TIMESTAMPTZ NULL, creator VARCHAR(255) NULL, agentName VARCHAR(255) NULL, dbAddress VARCHAR(255) NULL, dbPort VARCHAR(45) NULL, dbvendor VARCHAR(255) NULL, status INT, message TEXT NOT NULL DEFAULT '', visibility INT NOT NULL DEFAULT 0, comment TEXT NOT NULL DEFAULT '', team INT NOT NULL DEFAULT 0, coowners VARCHAR(2048) NOT NULL DEFAULT '');",
+		Comment: "Create the databases table",
+	},
+	{
+		Query:   "CREATE UNIQUE INDEX agent_db_idx ON databases (dbname, agentName);",
+		Comment: "Create unique index on columns (dbname, agentName) for table databases",
+	},
+	{
+		Query:   "CREATE TABLE IF NOT EXISTS push_subscriptions (subscriber VARCHAR(255) NOT NULL, endpoint VARCHAR(255) NOT NULL, p256dh_key VARCHAR(255) NOT NULL, auth_key VARCHAR(255) NOT NULL);",
+		Comment: "Create the push_subscriptions table",
+	},
+	{
+		Query:   "CREATE UNIQUE INDEX push_subscription ON push_subscriptions (subscriber, endpoint);",
+		Comment: "Create unique index on columns (subscriber,endpoint) for table push_subscriptions",
+	},
+	{
+		Query:   "CREATE TABLE IF NOT EXISTS webhooks (id SERIAL PRIMARY KEY, owner VARCHAR(255) NOT NULL, url TEXT NOT NULL, secret VARCHAR(255) NOT NULL DEFAULT '', events VARCHAR(1024) NOT NULL DEFAULT '', global BOOLEAN NOT NULL DEFAULT FALSE, createDate TIMESTAMPTZ NULL);",
+		Comment: "Create the webhooks table",
+	},
+	{
+		Query:   "CREATE TABLE IF NOT EXISTS webhook_deliveries (id SERIAL PRIMARY KEY, webhookId INT NOT NULL, deliveryId VARCHAR(64) NOT NULL, event VARCHAR(64) NOT NULL, databaseId INT NOT NULL, attempt INT NOT NULL, statusCode INT NOT NULL, success BOOLEAN NOT NULL, error TEXT NOT NULL, date TIMESTAMPTZ NULL);",
+		Comment: "Create the webhook_deliveries table",
+	},
+	{
+		Query:   "CREATE INDEX webhook_deliveries_idx ON webhook_deliveries (webhookId);",
+		Comment: "Create index on column webhookId for table webhook_deliveries",
+	},
+	{
+		Query:   `CREATE TABLE IF NOT EXISTS audit_log (id SERIAL PRIMARY KEY, date TIMESTAMPTZ NOT NULL, "user" VARCHAR(255) NOT NULL, action VARCHAR(64) NOT NULL, databaseId INT NOT NULL DEFAULT 0, agent VARCHAR(255) NOT NULL DEFAULT '', details TEXT NOT NULL);`,
+		Comment: "Create the audit_log table",
+	},
+	{
+		Query:   "CREATE INDEX audit_log_date_idx ON audit_log (date);",
+		Comment: "Create index on column date for table audit_log",
+	},
+	{
+		Query:   "CREATE TABLE IF NOT EXISTS users (email VARCHAR(255) NOT NULL PRIMARY KEY, role VARCHAR(32) NOT NULL);",
+		Comment: "Create the users table",
+	},
+	{
+		Query:   "CREATE TABLE IF NOT EXISTS teams (id SERIAL PRIMARY KEY, name VARCHAR(255) NOT NULL UNIQUE);",
+		Comment: "Create the teams table",
+	},
+	{
+		Query:   "CREATE TABLE IF NOT EXISTS team_members (teamId INT NOT NULL, email VARCHAR(255) NOT NULL, PRIMARY KEY (teamId, email));",
+		Comment: "Create the team_members table",
+	},
+	{
+		Query:   "ALTER TABLE databases ADD COLUMN tags VARCHAR(2048) NOT NULL DEFAULT '';",
+		Comment: "Add 'tags' column",
+	},
+	{
+		Query:   "ALTER TABLE databases ADD COLUMN scriptOutput TEXT NOT NULL DEFAULT '';",
+		Comment: "Add 'scriptOutput' column",
+	},
+	{
+		Query:   "ALTER TABLE databases ADD COLUMN liferayBuild INT NOT NULL DEFAULT 0;",
+		Comment: "Add 'liferayBuild' column",
+	},
+	{
+		Query:   "ALTER TABLE databases ADD COLUMN liferaySchema VARCHAR(32) NOT NULL DEFAULT '';",
+		Comment: "Add 'liferaySchema' column",
+	},
+	{
+		Query:   "ALTER TABLE databases ADD COLUMN liferayCompanies INT NOT NULL DEFAULT 0;",
+		Comment: "Add 'liferayCompanies' column",
+	},
+	{
+		Query:   "ALTER TABLE databases ADD COLUMN liferayVirtualHosts VARCHAR(2048) NOT NULL DEFAULT '';",
+		Comment: "Add 'liferayVirtualHosts' column",
+	},
+	{
+		Query:   "ALTER TABLE databases ALTER COLUMN dbpass TYPE TEXT;",
+		Comment: "Change 'dbpass' to TEXT, to fit the encrypted passwords",
+	},
+}
+
+// datasource returns the connection string for the given database on
+// the configured server.
+func (pg *DB) datasource(database string) string {
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(pg.User, pg.Pass),
+		Host:     pg.Address + ":" + pg.Port,
+		Path:     database,
+		RawQuery: "sslmode=disable",
+	}
+
+	return u.String()
+}
+
+func (pg *DB) connect(datasource string) error {
+	db, err := sql.Open("postgres", datasource)
+	if err != nil {
+		return fmt.Errorf("creating connection pool failed: %s", err.Error())
+	}
+
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("database ping failed: %s", sutils.TrimNL(err.Error()))
+	}
+	pg.conn = db
+
+	return nil
+}
+
+func (pg *DB) initTables() error {
+	var (
+		err      error
+		startLoc int
+	)
+
+	pg.conn.QueryRow("SELECT count(*) FROM version").Scan(&startLoc)
+
+	for _, q := range queries[startLoc:] {
+		logger.Info("Updating database %q", q.Comment)
+		_, err = pg.conn.Exec(q.Query)
+		if err != nil {
+			return fmt.Errorf("executing query %q (%q) failed: %s", q.Comment, q.Query, sutils.TrimNL(err.Error()))
+		}
+
+		_, err = pg.conn.Exec("INSERT INTO version (query, comment, date) VALUES ($1, $2, $3)", q.Query, q.Comment, time.Now())
+		if err != nil {
+			return fmt.Errorf("updating version table with query %q (%q) failed: %s", q.Comment, q.Query, sutils.TrimNL(err.Error()))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,249 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/djavorszky/ddn/server/database"
+	"github.com/djavorszky/ddn/server/database/data"
+	"github.com/djavorszky/ddn/server/database/dbtest"
+	"github.com/djavorszky/ddn/server/database/dbutil"
+	"github.com/djavorszky/sutils"
+
+	_ "github.com/lib/pq"
+)
+
+const (
+	testAddr = "127.0.0.1"
+	testPort = "5432"
+	testUser = "postgres"
+	testPass = ""
+	testName = "unit_test"
+)
+
+var (
+	testConn *sql.DB
+
+	pg DB
+
+	gmt, _ = time.LoadLocation("GMT")
+
+	testEntry = data.Row{
+		ID:         1,
+		DBName:     "testDB",
+		DBUser:     "testUser",
+		DBPass:     "testPass",
+		DBSID:      "testsid",
+		Dumpfile:   "testloc",
+		CreateDate: time.Now().In(gmt),
+		ExpiryDate: time.Now().In(gmt).AddDate(0, 0, 30),
+		Creator:    "test@gmail.com",
+		AgentName:  "postgresql-96",
+		DBAddress:  "localhost",
+		DBPort:     "5432",
+		DBVendor:   "postgres",
+		Comment:    "This is just a comment somewhere",
+		Message:    "",
+		Status:     100,
+	}
+)
+
+func TestMain(m *testing.M) {
+	// For these tests to run, a local database should be present
+	// which has a user named 'postgres' with no password authentication
+
+	err := setup()
+	if err != nil {
+		fmt.Printf("Failed setup: %s", err.Error())
+		os.Exit(-1)
+	}
+
+	res := m.Run()
+
+	err = teardown()
+	if err != nil {
+		fmt.Printf("Failed teardown: %s", err.Error())
+		os.Exit(-1)
+	}
+
+	os.Exit(res)
+}
+
+// Connect to a local database
+func setup() error {
+	var err error
+
+	pg = DB{Address: testAddr, Port: testPort, User: testUser, Pass: testPass, Database: testName}
+
+	err = testConnDS(pg.datasource(maintenanceDB))
+	if err != nil {
+		return fmt.Errorf("failed to setup test connection: %v", err)
+	}
+
+	_, err = testConn.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS %s;", testName))
+	if err != nil {
+		return fmt.Errorf("failed dropping leftover database: %s", sutils.TrimNL(err.Error()))
+	}
+
+	_, err = testConn.Exec(fmt.Sprintf("CREATE DATABASE %s ENCODING 'UTF8';", testName))
+	if err != nil {
+		return fmt.Errorf("failed creating database: %s", sutils.TrimNL(err.Error()))
+	}
+
+	testConn.Close()
+
+	err = testConnDS(pg.datasource(testName))
+	if err != nil {
+		return fmt.Errorf("failed connecting to created database")
+	}
+
+	err = pg.connect(pg.datasource(testName))
+	if err != nil {
+		return fmt.Errorf("failed initializing main connection")
+	}
+
+	return nil
+}
+
+// DROP EVERYTHING!!4one
+func teardown() error {
+	var err error
+
+	// Postgres can't drop the database that is connected to.
+	testConn.Close()
+	pg.Close()
+
+	err = testConnDS(pg.datasource(maintenanceDB))
+	if err != nil {
+		return fmt.Errorf("failed connecting to maintenance database: %v", err)
+	}
+	defer testConn.Close()
+
+	_, err = testConn.Exec(fmt.Sprintf("DROP DATABASE %s;", testName))
+	if err != nil {
+		return fmt.Errorf("failed dropping database: %s", sutils.TrimNL(err.Error()))
+	}
+
+	return nil
+}
+
+func testConnDS(datasource string) error {
+	var err error
+
+	testConn, err = sql.Open("postgres", datasource)
+	if err != nil {
+		return fmt.Errorf("creating connection pool failed: %s", err.Error())
+	}
+
+	err = testConn.Ping()
+	if err != nil {
+		testConn.Close()
+		return fmt.Errorf("database ping failed: %s", sutils.TrimNL(err.Error()))
+	}
+
+	return nil
+}
+
+func TestInitTables(t *testing.T) {
+	var err error
+
+	_, err = testConn.Exec("SELECT 1 FROM version LIMIT 1;")
+	if err == nil {
+		t.Errorf("Version table already exists before test even ran.")
+	}
+
+	_, err = testConn.Exec("SELECT 1 FROM databases LIMIT 1;")
+	if err == nil {
+		t.Errorf("Databases table already exists before test even ran.")
+	}
+
+	err = pg.initTables()
+	if err != nil {
+		t.Errorf("Failed initializing tables: %s", err.Error())
+	}
+
+	_, err = testConn.Exec("SELECT 1 FROM version LIMIT 1;")
+	if err != nil {
+		t.Errorf("Version table has not been created.")
+	}
+
+	_, err = testConn.Exec("SELECT 1 FROM databases LIMIT 1;")
+	if err != nil {
+		t.Errorf("Databases table has not been created.")
+	}
+
+	type versiontest struct {
+		queryID int
+		query   string
+		comment string
+		date    time.Time
+	}
+
+	rows, _ := testConn.Query("SELECT * FROM version")
+
+	for rows.Next() {
+		var row versiontest
+
+		rows.Scan(&row.queryID, &row.query, &row.comment, &row.date)
+
+		dbu := queries[row.queryID-1]
+
+		if row.query != dbu.Query {
+			t.Errorf("Saved query not what was expected")
+		}
+
+		if row.comment != dbu.Comment {
+			t.Errorf("Saved comment not what was expected")
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		t.Errorf("error reading result from query: %s", err.Error())
+	}
+}
+
+func TestReadRow(t *testing.T) {
+	testEntry.DBName = "readRow"
+	err := pg.Insert(&testEntry)
+	if err != nil {
+		t.Errorf("Failed adding a entry: %s", err.Error())
+	}
+
+	rows, err := testConn.Query("SELECT * FROM databases WHERE id = $1", testEntry.ID)
+	if err != nil {
+		t.Errorf("Failed querying for entries: %s", err.Error())
+	}
+
+	for rows.Next() {
+		row, err := dbutil.ReadRows(rows)
+		if err != nil {
+			t.Errorf("Failed reading row from rows: %s", err.Error())
+		}
+
+		if err = dbutil.CompareRows(testEntry, row); err != nil {
+			t.Errorf("Persisted and read DBEntry not the same: %s", err.Error())
+		}
+	}
+
+	// cleanup
+	_, err = testConn.Exec("DELETE FROM databases WHERE id = $1", testEntry.ID)
+	if err != nil {
+		t.Errorf("Could not delete created entry")
+	}
+
+	testEntry.ID++
+}
+
+func TestConformance(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) database.BackendConnection {
+		err := pg.initTables()
+		if err != nil {
+			t.Fatalf("initTables() error: %v", err)
+		}
+
+		return &pg
+	})
+}
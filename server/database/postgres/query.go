@@ -0,0 +1,130 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+
+	vis "github.com/djavorszky/ddn/common/visibility"
+	"github.com/djavorszky/ddn/server/database/data"
+	"github.com/djavorszky/ddn/server/database/dbutil"
+)
+
+// FetchDatabases returns the entries matching query.
+func (pg *DB) FetchDatabases(query data.DatabaseQuery) ([]data.Row, error) {
+	q, args := databaseWhere(query)
+
+	q = "SELECT * FROM databases" + q + dbutil.OrderBy(query)
+
+	if query.Limit > 0 {
+		args = append(args, query.Limit, query.Offset)
+		q += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	}
+
+	return pg.fetchRows(q, args...)
+}
+
+// CountDatabases returns the number of entries matching query, ignoring
+// its paging.
+func (pg *DB) CountDatabases(query data.DatabaseQuery) (int, error) {
+	if err := pg.alive(); err != nil {
+		return 0, fmt.Errorf("database down: %s", err.Error())
+	}
+
+	q, args := databaseWhere(query)
+
+	var count int
+
+	err := pg.conn.QueryRow("SELECT COUNT(*) FROM databases"+q, args...).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't execute query: %s", err.Error())
+	}
+
+	return count, nil
+}
+
+// CountByStatus returns the number of entries by status and vendor.
+func (pg *DB) CountByStatus() ([]data.StatusCount, error) {
+	if err := pg.alive(); err != nil {
+		return nil, fmt.Errorf("database down: %s", err.Error())
+	}
+
+	rows, err := pg.conn.Query("SELECT status, dbvendor, COUNT(*) FROM databases GROUP BY status, dbvendor")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't execute query: %s", err.Error())
+	}
+
+	return dbutil.ReadStatusCounts(rows)
+}
+
+// databaseWhere is the WHERE clause of dbutil.DatabaseQuery with postgres'
+// placeholders.
+func databaseWhere(query data.DatabaseQuery) (string, []interface{}) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if query.VisibleTo != "" {
+		user := arg(query.VisibleTo)
+		visible := []string{
+			"creator = " + user,
+			user + " = ANY(string_to_array(coowners, ','))",
+			"visibility = " + arg(vis.Public),
+		}
+
+		if len(query.Teams) != 0 {
+			var teams []string
+			for _, team := range query.Teams {
+				teams = append(teams, arg(team))
+			}
+
+			visible = append(visible, "(visibility = "+arg(vis.Team)+" AND team IN ("+strings.Join(teams, ", ")+"))")
+		}
+
+		conds = append(conds, "("+strings.Join(visible, " OR ")+")")
+	}
+
+	if query.Agent != "" {
+		conds = append(conds, "agentName = "+arg(query.Agent))
+	}
+
+	if query.Vendor != "" {
+		conds = append(conds, "dbvendor = "+arg(query.Vendor))
+	}
+
+	if query.Status != 0 {
+		conds = append(conds, "status = "+arg(query.Status))
+	}
+
+	if query.Creator != "" {
+		conds = append(conds, "creator = "+arg(query.Creator))
+	}
+
+	if !query.ExpiringBefore.IsZero() {
+		conds = append(conds, "expiryDate < "+arg(query.ExpiringBefore))
+	}
+
+	if query.Name != "" {
+		conds = append(conds, "LOWER(dbname) LIKE "+arg(dbutil.LikePattern(query.Name))+" ESCAPE '!'")
+	}
+
+	if query.Tag != "" {
+		conds = append(conds, arg(strings.ToLower(query.Tag))+" = ANY(string_to_array(LOWER(tags), ','))")
+	}
+
+	if query.Search != "" {
+		pattern := arg(dbutil.LikePattern(query.Search))
+		conds = append(conds, "(LOWER(dbname) LIKE "+pattern+" ESCAPE '!' OR LOWER(tags) LIKE "+pattern+" ESCAPE '!' OR LOWER(comment) LIKE "+pattern+" ESCAPE '!' OR LOWER(liferayVirtualHosts) LIKE "+pattern+" ESCAPE '!')")
+	}
+
+	if len(conds) == 0 {
+		return "", args
+	}
+
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
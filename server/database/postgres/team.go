@@ -0,0 +1,257 @@
+package postgres
+
+import (
+	"fmt"
+
+	vis "github.com/djavorszky/ddn/common/visibility"
+	"github.com/djavorszky/ddn/server/database/data"
+	"github.com/djavorszky/ddn/server/database/dbutil"
+	"github.com/djavorszky/sutils"
+)
+
+// FetchByTeam returns the databases shared with the team.
+func (pg *DB) FetchByTeam(teamID int) ([]data.Row, error) {
+	if err := pg.alive(); err != nil {
+		return nil, fmt.Errorf("database down: %s", err.Error())
+	}
+
+	rows, err := pg.conn.Query("SELECT * FROM databases WHERE visibility = $1 AND team = $2 ORDER BY id DESC", vis.Team, teamID)
+	if err != nil {
+		return nil, fmt.Errorf("failed running query: %v", err)
+	}
+	defer rows.Close()
+
+	var entries []data.Row
+	for rows.Next() {
+		row, err := dbutil.ReadRows(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+		}
+
+		entries = append(entries, row)
+	}
+
+	return entries, nil
+}
+
+// FetchUser returns the user with the given email. If it has not been
+// stored, the returned user's Email is empty.
+func (pg *DB) FetchUser(email string) (data.User, error) {
+	if err := pg.alive(); err != nil {
+		return data.User{}, fmt.Errorf("database down: %s", err.Error())
+	}
+
+	row := pg.conn.QueryRow("SELECT * FROM users WHERE email = $1", email)
+	user, err := dbutil.ReadUser(row)
+	if err != nil {
+		return data.User{}, fmt.Errorf("failed reading result: %v", err)
+	}
+
+	return user, nil
+}
+
+// FetchUsers returns all stored users.
+func (pg *DB) FetchUsers() ([]data.User, error) {
+	if err := pg.alive(); err != nil {
+		return nil, fmt.Errorf("database down: %s", err.Error())
+	}
+
+	rows, err := pg.conn.Query("SELECT * FROM users ORDER BY email")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't execute query: %s", err.Error())
+	}
+	defer rows.Close()
+
+	var users []data.User
+	for rows.Next() {
+		user, err := dbutil.ReadUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+		}
+
+		users = append(users, user)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+	}
+
+	return users, nil
+}
+
+// SaveUser stores the user, replacing its role if it already exists.
+func (pg *DB) SaveUser(user data.User) error {
+	if err := pg.alive(); err != nil {
+		return fmt.Errorf("database down: %s", err.Error())
+	}
+
+	if !sutils.Present(user.Email, user.Role) {
+		return fmt.Errorf("missing email or role")
+	}
+
+	_, err := pg.conn.Exec("INSERT INTO users (email, role) VALUES ($1, $2) ON CONFLICT (email) DO UPDATE SET role = EXCLUDED.role", user.Email, user.Role)
+	if err != nil {
+		return fmt.Errorf("save failed: %v", err)
+	}
+
+	return nil
+}
+
+// FetchTeamByID returns the team with the given ID along with its members.
+// If it does not exist, the returned team's ID is 0.
+func (pg *DB) FetchTeamByID(ID int) (data.Team, error) {
+	teams, err := pg.fetchTeams("SELECT * FROM teams WHERE id = $1", ID)
+	if err != nil || len(teams) == 0 {
+		return data.Team{}, err
+	}
+
+	return teams[0], nil
+}
+
+// FetchTeams returns all teams along with their members.
+func (pg *DB) FetchTeams() ([]data.Team, error) {
+	return pg.fetchTeams("SELECT * FROM teams ORDER BY name")
+}
+
+// FetchTeamsByMember returns the teams the user is a member of.
+func (pg *DB) FetchTeamsByMember(email string) ([]data.Team, error) {
+	return pg.fetchTeams("SELECT t.* FROM teams t JOIN team_members m ON m.teamId = t.id WHERE m.email = $1 ORDER BY t.name", email)
+}
+
+func (pg *DB) fetchTeams(query string, args ...interface{}) ([]data.Team, error) {
+	if err := pg.alive(); err != nil {
+		return nil, fmt.Errorf("database down: %s", err.Error())
+	}
+
+	rows, err := pg.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't execute query: %s", err.Error())
+	}
+
+	var teams []data.Team
+	for rows.Next() {
+		team, err := dbutil.ReadTeam(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+		}
+
+		teams = append(teams, team)
+	}
+	rows.Close()
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+	}
+
+	for i := range teams {
+		teams[i].Members, err = pg.fetchTeamMembers(teams[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return teams, nil
+}
+
+func (pg *DB) fetchTeamMembers(teamID int) ([]string, error) {
+	rows, err := pg.conn.Query("SELECT email FROM team_members WHERE teamId = $1 ORDER BY email", teamID)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't execute query: %s", err.Error())
+	}
+	defer rows.Close()
+
+	var members []string
+	for rows.Next() {
+		var email string
+
+		err = rows.Scan(&email)
+		if err != nil {
+			return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+		}
+
+		members = append(members, email)
+	}
+
+	return members, rows.Err()
+}
+
+// InsertTeam adds a team to the database along with its members,
+// setting its ID
+func (pg *DB) InsertTeam(team *data.Team) error {
+	if err := pg.alive(); err != nil {
+		return fmt.Errorf("database down: %s", err.Error())
+	}
+
+	if !sutils.Present(team.Name) {
+		return fmt.Errorf("missing name")
+	}
+
+	err := pg.conn.QueryRow("INSERT INTO teams (name) VALUES ($1) RETURNING id", team.Name).Scan(&team.ID)
+	if err != nil {
+		return fmt.Errorf("insert failed: %v", err)
+	}
+
+	for _, member := range team.Members {
+		err = pg.AddTeamMember(team.ID, member)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteTeam removes the team and its members. The databases that were
+// shared with the team become private.
+func (pg *DB) DeleteTeam(team data.Team) error {
+	if err := pg.alive(); err != nil {
+		return fmt.Errorf("database down: %s", err.Error())
+	}
+
+	_, err := pg.conn.Exec("UPDATE databases SET visibility = $1, team = 0 WHERE team = $2", vis.Private, team.ID)
+	if err != nil {
+		return fmt.Errorf("unsharing databases failed: %v", err)
+	}
+
+	_, err = pg.conn.Exec("DELETE FROM team_members WHERE teamId = $1", team.ID)
+	if err != nil {
+		return fmt.Errorf("deleting members failed: %v", err)
+	}
+
+	_, err = pg.conn.Exec("DELETE FROM teams WHERE id = $1", team.ID)
+
+	return err
+}
+
+// AddTeamMember adds the user to the team. Adding an existing member
+// is not an error.
+func (pg *DB) AddTeamMember(teamID int, email string) error {
+	if err := pg.alive(); err != nil {
+		return fmt.Errorf("database down: %s", err.Error())
+	}
+
+	if !sutils.Present(email) {
+		return fmt.Errorf("missing email")
+	}
+
+	_, err := pg.conn.Exec("INSERT INTO team_members (teamId, email) VALUES ($1, $2) ON CONFLICT DO NOTHING", teamID, email)
+	if err != nil {
+		return fmt.Errorf("insert failed: %v", err)
+	}
+
+	return nil
+}
+
+// RemoveTeamMember removes the user from the team.
+func (pg *DB) RemoveTeamMember(teamID int, email string) error {
+	if err := pg.alive(); err != nil {
+		return fmt.Errorf("database down: %s", err.Error())
+	}
+
+	_, err := pg.conn.Exec("DELETE FROM team_members WHERE teamId = $1 AND email = $2", teamID, email)
+
+	return err
+}
@@ -0,0 +1,161 @@
+package postgres
+
+import (
+	"fmt"
+
+	"github.com/djavorszky/ddn/server/database/data"
+	"github.com/djavorszky/ddn/server/database/dbutil"
+	"github.com/djavorszky/sutils"
+)
+
+// FetchWebhookByID returns the webhook with the given ID. If it
+// does not exist, the returned webhook's ID is 0.
+func (pg *DB) FetchWebhookByID(ID int) (data.Webhook, error) {
+	if err := pg.alive(); err != nil {
+		return data.Webhook{}, fmt.Errorf("database down: %s", err.Error())
+	}
+
+	row := pg.conn.QueryRow("SELECT * FROM webhooks WHERE id = $1", ID)
+	hook, err := dbutil.ReadWebhook(row)
+	if err != nil {
+		return data.Webhook{}, fmt.Errorf("failed reading result: %v", err)
+	}
+
+	return hook, nil
+}
+
+// FetchWebhooksByOwner returns the webhooks registered by owner.
+func (pg *DB) FetchWebhooksByOwner(owner string) ([]data.Webhook, error) {
+	return pg.fetchWebhooks("SELECT * FROM webhooks WHERE owner = $1 ORDER BY id", owner)
+}
+
+// FetchGlobalWebhooks returns the webhooks that are notified about
+// the events of all databases.
+func (pg *DB) FetchGlobalWebhooks() ([]data.Webhook, error) {
+	return pg.fetchWebhooks("SELECT * FROM webhooks WHERE global = TRUE ORDER BY id")
+}
+
+func (pg *DB) fetchWebhooks(query string, args ...interface{}) ([]data.Webhook, error) {
+	if err := pg.alive(); err != nil {
+		return nil, fmt.Errorf("database down: %s", err.Error())
+	}
+
+	rows, err := pg.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't execute query: %s", err.Error())
+	}
+	defer rows.Close()
+
+	var hooks []data.Webhook
+	for rows.Next() {
+		hook, err := dbutil.ReadWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+		}
+
+		hooks = append(hooks, hook)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+	}
+
+	return hooks, nil
+}
+
+// InsertWebhook adds a webhook to the database, setting its ID
+func (pg *DB) InsertWebhook(hook *data.Webhook) error {
+	if err := pg.alive(); err != nil {
+		return fmt.Errorf("database down: %s", err.Error())
+	}
+
+	if !sutils.Present(hook.Owner, hook.URL) {
+		return fmt.Errorf("missing owner or url")
+	}
+
+	err := pg.conn.QueryRow("INSERT INTO webhooks (owner, url, secret, events, global, createDate) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
+		hook.Owner,
+		hook.URL,
+		hook.Secret,
+		dbutil.JoinList(hook.Events),
+		hook.Global,
+		hook.CreateDate,
+	).Scan(&hook.ID)
+	if err != nil {
+		return fmt.Errorf("insert failed: %v", err)
+	}
+
+	return nil
+}
+
+// DeleteWebhook removes the webhook along with its deliveries
+func (pg *DB) DeleteWebhook(hook data.Webhook) error {
+	if err := pg.alive(); err != nil {
+		return fmt.Errorf("database down: %s", err.Error())
+	}
+
+	_, err := pg.conn.Exec("DELETE FROM webhook_deliveries WHERE webhookId = $1", hook.ID)
+	if err != nil {
+		return fmt.Errorf("deleting deliveries failed: %v", err)
+	}
+
+	_, err = pg.conn.Exec("DELETE FROM webhooks WHERE id = $1", hook.ID)
+
+	return err
+}
+
+// InsertWebhookDelivery logs a delivery attempt, setting its ID
+func (pg *DB) InsertWebhookDelivery(delivery *data.WebhookDelivery) error {
+	if err := pg.alive(); err != nil {
+		return fmt.Errorf("database down: %s", err.Error())
+	}
+
+	err := pg.conn.QueryRow("INSERT INTO webhook_deliveries (webhookId, deliveryId, event, databaseId, attempt, statusCode, success, error, date) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id",
+		delivery.WebhookID,
+		delivery.DeliveryID,
+		delivery.Event,
+		delivery.DatabaseID,
+		delivery.Attempt,
+		delivery.StatusCode,
+		delivery.Success,
+		delivery.Error,
+		delivery.Date,
+	).Scan(&delivery.ID)
+	if err != nil {
+		return fmt.Errorf("insert failed: %v", err)
+	}
+
+	return nil
+}
+
+// FetchWebhookDeliveries returns the latest limit delivery attempts of
+// the webhook, newest first.
+func (pg *DB) FetchWebhookDeliveries(webhookID, limit int) ([]data.WebhookDelivery, error) {
+	if err := pg.alive(); err != nil {
+		return nil, fmt.Errorf("database down: %s", err.Error())
+	}
+
+	rows, err := pg.conn.Query("SELECT * FROM webhook_deliveries WHERE webhookId = $1 ORDER BY id DESC LIMIT $2", webhookID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't execute query: %s", err.Error())
+	}
+	defer rows.Close()
+
+	var deliveries []data.WebhookDelivery
+	for rows.Next() {
+		delivery, err := dbutil.ReadWebhookDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+	}
+
+	return deliveries, nil
+}
@@ -0,0 +1,140 @@
+// Package secret encrypts values, such as the passwords of the databases,
+// before they are stored.
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// prefix marks the encrypted values. Values without it are plain text,
+// stored before encryption was enabled.
+const prefix = "enc:"
+
+// keySize is the size of the keys in bytes, so AES-256 is used.
+const keySize = 32
+
+// Keyring encrypts values with its first key, and decrypts them with
+// whichever key they were encrypted with. Keys can be rotated by adding
+// a new key at the front and removing the old one once every value has
+// been encrypted again.
+type Keyring struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// NewKeyring returns a keyring of the base64 encoded 32 byte keys. The
+// first key is used to encrypt, all of them to decrypt.
+func NewKeyring(keys ...string) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys")
+	}
+
+	ring := &Keyring{keys: make(map[string]cipher.AEAD)}
+
+	for i, key := range keys {
+		raw, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %d is not base64 encoded: %v", i+1, err)
+		}
+
+		if len(raw) != keySize {
+			return nil, fmt.Errorf("key %d is %d bytes long instead of %d", i+1, len(raw), keySize)
+		}
+
+		block, err := aes.NewCipher(raw)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %v", i+1, err)
+		}
+
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %v", i+1, err)
+		}
+
+		id := keyID(raw)
+		if i == 0 {
+			ring.current = id
+		}
+
+		ring.keys[id] = gcm
+	}
+
+	return ring, nil
+}
+
+// keyID identifies the key in the encrypted values, without giving it away.
+func keyID(key []byte) string {
+	sum := sha256.Sum256(key)
+
+	return hex.EncodeToString(sum[:4])
+}
+
+// Encrypt returns value encrypted with the first key of the keyring,
+// in the form of "enc:<key id>:<base64 encoded nonce and ciphertext>".
+// Empty values are left empty.
+func (ring *Keyring) Encrypt(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	gcm := ring.keys[ring.current]
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err := io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return "", fmt.Errorf("generating nonce failed: %v", err)
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(value), nil)
+
+	return prefix + ring.current + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt returns the value that was encrypted by Encrypt. Values that
+// are not encrypted are returned as they are.
+func (ring *Keyring) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(value, prefix), ":", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+
+	gcm, ok := ring.keys[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("encrypted with unknown key %s", parts[0])
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("decryption with key %s failed: %v", parts[0], err)
+	}
+
+	return string(plain), nil
+}
+
+// Current returns true if value is empty or encrypted with the first key
+// of the keyring, so it does not need to be encrypted again.
+func (ring *Keyring) Current(value string) bool {
+	return value == "" || strings.HasPrefix(value, prefix+ring.current+":")
+}
+
+// IsEncrypted returns true if value was returned by Encrypt.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
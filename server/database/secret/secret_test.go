@@ -0,0 +1,102 @@
+package secret
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+var (
+	oldKey = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	newKey = base64.StdEncoding.EncodeToString([]byte("fedcba9876543210fedcba9876543210"))
+)
+
+func TestNewKeyring(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    []string
+		wantErr bool
+	}{
+		{"One key", []string{oldKey}, false},
+		{"Two keys", []string{newKey, oldKey}, false},
+		{"No keys", nil, true},
+		{"Not base64", []string{"not base64!"}, true},
+		{"Too short", []string{base64.StdEncoding.EncodeToString([]byte("short"))}, true},
+	}
+	for _, tt := range tests {
+		_, err := NewKeyring(tt.keys...)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewKeyring() %s error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestKeyring_EncryptDecrypt(t *testing.T) {
+	ring, err := NewKeyring(oldKey)
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+
+	encrypted, err := ring.Encrypt("s3cret")
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+
+	if !IsEncrypted(encrypted) || strings.Contains(encrypted, "s3cret") {
+		t.Errorf("Encrypt() = %q, want it encrypted", encrypted)
+	}
+
+	again, _ := ring.Encrypt("s3cret")
+	if again == encrypted {
+		t.Errorf("Encrypt() of the same value returned the same result twice")
+	}
+
+	decrypted, err := ring.Decrypt(encrypted)
+	if err != nil || decrypted != "s3cret" {
+		t.Errorf("Decrypt() = %q, %v, want %q", decrypted, err, "s3cret")
+	}
+
+	plain, err := ring.Decrypt("plain")
+	if err != nil || plain != "plain" {
+		t.Errorf("Decrypt() of plain text = %q, %v, want it unchanged", plain, err)
+	}
+
+	empty, _ := ring.Encrypt("")
+	if empty != "" {
+		t.Errorf("Encrypt() of empty value = %q, want it empty", empty)
+	}
+
+	tampered := encrypted[:len(encrypted)-4] + "AAAA"
+	if _, err = ring.Decrypt(tampered); err == nil {
+		t.Errorf("Decrypt() of tampered value should have failed")
+	}
+}
+
+func TestKeyring_Rotation(t *testing.T) {
+	old, _ := NewKeyring(oldKey)
+	rotated, _ := NewKeyring(newKey, oldKey)
+	fresh, _ := NewKeyring(newKey)
+
+	encrypted, _ := old.Encrypt("s3cret")
+
+	if !old.Current(encrypted) {
+		t.Errorf("Current() of value encrypted with the first key = false")
+	}
+
+	if rotated.Current(encrypted) {
+		t.Errorf("Current() of value encrypted with an older key = true")
+	}
+
+	if rotated.Current("plain") {
+		t.Errorf("Current() of plain text = true")
+	}
+
+	decrypted, err := rotated.Decrypt(encrypted)
+	if err != nil || decrypted != "s3cret" {
+		t.Errorf("Decrypt() with older key = %q, %v, want %q", decrypted, err, "s3cret")
+	}
+
+	if _, err = fresh.Decrypt(encrypted); err == nil {
+		t.Errorf("Decrypt() without the key should have failed")
+	}
+}
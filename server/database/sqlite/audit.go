@@ -0,0 +1,74 @@
+package sqlite
+
+import (
+	"fmt"
+
+	"github.com/djavorszky/ddn/server/database/data"
+	"github.com/djavorszky/ddn/server/database/dbutil"
+	"github.com/djavorszky/sutils"
+)
+
+// InsertAuditEntry adds an entry to the audit log, setting its ID
+func (lite *DB) InsertAuditEntry(entry *data.AuditEntry) error {
+	if err := lite.alive(); err != nil {
+		return fmt.Errorf("database down: %s", err.Error())
+	}
+
+	if !sutils.Present(entry.Action) {
+		return fmt.Errorf("missing action")
+	}
+
+	res, err := lite.conn.Exec("INSERT INTO `audit_log` (`date`, `user`, `action`, `databaseId`, `agent`, `details`) VALUES (?, ?, ?, ?, ?, ?)",
+		entry.Date.UTC(),
+		entry.User,
+		entry.Action,
+		entry.DatabaseID,
+		entry.Agent,
+		entry.Details,
+	)
+	if err != nil {
+		return fmt.Errorf("insert failed: %v", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed getting new ID: %v", err)
+	}
+
+	entry.ID = int(id)
+
+	return nil
+}
+
+// FetchAuditEntries returns the entries of the audit log that match
+// filter, newest first.
+func (lite *DB) FetchAuditEntries(filter data.AuditFilter) ([]data.AuditEntry, error) {
+	if err := lite.alive(); err != nil {
+		return nil, fmt.Errorf("database down: %s", err.Error())
+	}
+
+	query, args := dbutil.AuditQuery(filter)
+
+	rows, err := lite.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't execute query: %s", err.Error())
+	}
+	defer rows.Close()
+
+	var entries []data.AuditEntry
+	for rows.Next() {
+		entry, err := dbutil.ReadAuditEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+		}
+
+		entries = append(entries, entry)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+	}
+
+	return entries, nil
+}
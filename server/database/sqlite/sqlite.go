@@ -81,8 +81,8 @@ func (lite *DB) FetchByDBNameAgent(dbname, agent string) (data.Row, error) {
 	return res, nil
 }
 
-// FetchByCreator returns private entries that were created by the
-// specified user, an empty list if it's not the user does
+// FetchByCreator returns private entries that were created or are
+// co-owned by the specified user, an empty list if it's not the user does
 // not have any entries, or an error if something went
 // wrong
 func (lite *DB) FetchByCreator(creator string) ([]data.Row, error) {
@@ -92,7 +92,7 @@ func (lite *DB) FetchByCreator(creator string) ([]data.Row, error) {
 
 	var entries []data.Row
 
-	rows, err := lite.conn.Query("SELECT * FROM databases WHERE creator = ? AND visibility = 0 ORDER BY id DESC", creator)
+	rows, err := lite.conn.Query("SELECT * FROM databases WHERE (creator = ? OR instr(',' || coowners || ',', ',' || ? || ',') > 0) AND visibility = 0 ORDER BY id DESC", creator, creator)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't execute query: %s", err.Error())
 	}
@@ -205,7 +205,7 @@ func (lite *DB) Insert(row *data.Row) error {
 		return fmt.Errorf("database down: %s", err.Error())
 	}
 
-	query := "INSERT INTO `databases` (`dbname`, `dbuser`, `dbpass`, `dbsid`, `dumpfile`, `createDate`, `expiryDate`, `creator`, `agentName`, `dbAddress`, `dbPort`, `dbvendor`, `status`, `message`, `visibility`, `comment`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	query := "INSERT INTO `databases` (`dbname`, `dbuser`, `dbpass`, `dbsid`, `dumpfile`, `createDate`, `expiryDate`, `creator`, `agentName`, `dbAddress`, `dbPort`, `dbvendor`, `status`, `message`, `visibility`, `comment`, `team`, `coowners`, `tags`, `scriptOutput`, `liferayBuild`, `liferaySchema`, `liferayCompanies`, `liferayVirtualHosts`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
 
 	res, err := lite.conn.Exec(query,
 		row.DBName,
@@ -224,6 +224,14 @@ func (lite *DB) Insert(row *data.Row) error {
 		row.Message,
 		row.Public,
 		row.Comment,
+		row.Team,
+		dbutil.JoinList(row.CoOwners),
+		dbutil.JoinList(row.Tags),
+		row.ScriptOutput,
+		row.Liferay.BuildNumber,
+		row.Liferay.SchemaVersion,
+		row.Liferay.Companies,
+		dbutil.JoinList(row.Liferay.VirtualHosts),
 	)
 	if err != nil {
 		return fmt.Errorf("insert failed: %v", err)
@@ -285,7 +293,7 @@ func (lite *DB) Update(entry *data.Row) error {
 		return lite.Insert(entry)
 	}
 
-	query := "UPDATE `databases` SET `dbname`= ?, `dbuser`= ?, `dbpass`= ?, `dbsid`= ?, `dumpfile`= ?, `createDate`= ?, `expiryDate`= ?, `creator`= ?, `agentName`= ?, `dbAddress`= ?, `dbPort`= ?, `dbvendor`= ?, `status`= ?, `message`= ?, `visibility`= ?, `comment` = ? WHERE id = ?"
+	query := "UPDATE `databases` SET `dbname`= ?, `dbuser`= ?, `dbpass`= ?, `dbsid`= ?, `dumpfile`= ?, `createDate`= ?, `expiryDate`= ?, `creator`= ?, `agentName`= ?, `dbAddress`= ?, `dbPort`= ?, `dbvendor`= ?, `status`= ?, `message`= ?, `visibility`= ?, `comment` = ?, `team` = ?, `coowners` = ?, `tags` = ?, `scriptOutput` = ?, `liferayBuild` = ?, `liferaySchema` = ?, `liferayCompanies` = ?, `liferayVirtualHosts` = ? WHERE id = ?"
 
 	_, err = lite.conn.Exec(query,
 		entry.DBName,
@@ -304,6 +312,14 @@ func (lite *DB) Update(entry *data.Row) error {
 		entry.Message,
 		entry.Public,
 		entry.Comment,
+		entry.Team,
+		dbutil.JoinList(entry.CoOwners),
+		dbutil.JoinList(entry.Tags),
+		entry.ScriptOutput,
+		entry.Liferay.BuildNumber,
+		entry.Liferay.SchemaVersion,
+		entry.Liferay.Companies,
+		dbutil.JoinList(entry.Liferay.VirtualHosts),
 		entry.ID,
 	)
 	if err != nil {
@@ -397,6 +413,90 @@ var queries = []dbUpdate{
 		Query:   "CREATE UNIQUE INDEX IF NOT EXISTS `agent_db_idx` ON `databases` (`dbname`, `agentName`);",
 		Comment: "Create unique index on columns (dbname, agentName) for table databases",
 	},
+	{
+		Query:   "CREATE TABLE `webhooks` (`id` INTEGER PRIMARY KEY AUTOINCREMENT, `owner` VARCHAR(255) NOT NULL, `url` TEXT NOT NULL, `secret` VARCHAR(255) NOT NULL DEFAULT '', `events` TEXT NOT NULL DEFAULT '', `global` INTEGER NOT NULL DEFAULT 0, `createDate` DATETIME NULL);",
+		Comment: "Create the webhooks table",
+	},
+	{
+		Query:   "CREATE TABLE `webhook_deliveries` (`id` INTEGER PRIMARY KEY AUTOINCREMENT, `webhookId` INTEGER NOT NULL, `deliveryId` VARCHAR(64) NOT NULL, `event` VARCHAR(64) NOT NULL, `databaseId` INTEGER NOT NULL, `attempt` INTEGER NOT NULL, `statusCode` INTEGER NOT NULL, `success` INTEGER NOT NULL, `error` TEXT NOT NULL, `date` DATETIME NULL);",
+		Comment: "Create the webhook_deliveries table",
+	},
+	{
+		Query:   "CREATE INDEX IF NOT EXISTS `webhook_deliveries_idx` ON `webhook_deliveries` (`webhookId`);",
+		Comment: "Create index on column webhookId for table webhook_deliveries",
+	},
+	{
+		Query:   "CREATE TABLE `audit_log` (`id` INTEGER PRIMARY KEY AUTOINCREMENT, `date` DATETIME NOT NULL, `user` VARCHAR(255) NOT NULL, `action` VARCHAR(64) NOT NULL, `databaseId` INTEGER NOT NULL DEFAULT 0, `agent` VARCHAR(255) NOT NULL DEFAULT '', `details` TEXT NOT NULL DEFAULT '');",
+		Comment: "Create the audit_log table",
+	},
+	{
+		Query:   "CREATE INDEX IF NOT EXISTS `audit_log_date_idx` ON `audit_log` (`date`);",
+		Comment: "Create index on column date for table audit_log",
+	},
+	{
+		Query:   "ALTER TABLE `databases` ADD COLUMN `team` INTEGER NOT NULL DEFAULT 0;",
+		Comment: "Add 'team' column",
+	},
+	{
+		Query:   "CREATE TABLE `users` (`email` VARCHAR(255) PRIMARY KEY, `role` VARCHAR(32) NOT NULL);",
+		Comment: "Create the users table",
+	},
+	{
+		Query:   "CREATE TABLE `teams` (`id` INTEGER PRIMARY KEY AUTOINCREMENT, `name` VARCHAR(255) NOT NULL UNIQUE);",
+		Comment: "Create the teams table",
+	},
+	{
+		Query:   "CREATE TABLE `team_members` (`teamId` INTEGER NOT NULL, `email` VARCHAR(255) NOT NULL, PRIMARY KEY (`teamId`, `email`));",
+		Comment: "Create the team_members table",
+	},
+	{
+		Query:   "ALTER TABLE `databases` ADD COLUMN `coowners` TEXT NOT NULL DEFAULT '';",
+		Comment: "Add 'coowners' column",
+	},
+	{
+		Query:   "ALTER TABLE `databases` ADD COLUMN `tags` TEXT NOT NULL DEFAULT '';",
+		Comment: "Add 'tags' column",
+	},
+	{
+		Query:   "ALTER TABLE `databases` ADD COLUMN `scriptOutput` TEXT NOT NULL DEFAULT '';",
+		Comment: "Add 'scriptOutput' column",
+	},
+	{
+		Query:   "ALTER TABLE `databases` ADD COLUMN `liferayBuild` INTEGER NOT NULL DEFAULT 0;",
+		Comment: "Add 'liferayBuild' column",
+	},
+	{
+		Query:   "ALTER TABLE `databases` ADD COLUMN `liferaySchema` TEXT NOT NULL DEFAULT '';",
+		Comment: "Add 'liferaySchema' column",
+	},
+	{
+		Query:   "ALTER TABLE `databases` ADD COLUMN `liferayCompanies` INTEGER NOT NULL DEFAULT 0;",
+		Comment: "Add 'liferayCompanies' column",
+	},
+	{
+		Query:   "ALTER TABLE `databases` ADD COLUMN `liferayVirtualHosts` TEXT NOT NULL DEFAULT '';",
+		Comment: "Add 'liferayVirtualHosts' column",
+	},
+	{
+		Query:   "ALTER TABLE databases RENAME TO databases_tmp",
+		Comment: "Change 'dbpass' to TEXT: Create temp table",
+	},
+	{
+		Query:   "CREATE TABLE databases (id INTEGER PRIMARY KEY AUTOINCREMENT, dbname VARCHAR(255) NULL, dbuser VARCHAR(255) NULL, dbpass TEXT NULL, dbsid VARCHAR(45) NULL, dumpfile TEXT NULL, createDate DATETIME NULL, expiryDate DATETIME NULL, creator VARCHAR(255) NULL, agentName VARCHAR(255) NULL, dbAddress VARCHAR(255) NULL, dbPort VARCHAR(45) NULL, dbvendor VARCHAR(255) NULL, status INTEGER, message TEXT, visibility INTEGER DEFAULT 0, comment TEXT, team INTEGER NOT NULL DEFAULT 0, coowners TEXT NOT NULL DEFAULT '', tags TEXT NOT NULL DEFAULT '', scriptOutput TEXT NOT NULL DEFAULT '', liferayBuild INTEGER NOT NULL DEFAULT 0, liferaySchema TEXT NOT NULL DEFAULT '', liferayCompanies INTEGER NOT NULL DEFAULT 0, liferayVirtualHosts TEXT NOT NULL DEFAULT '');",
+		Comment: "Change 'dbpass' to TEXT: Create updated table",
+	},
+	{
+		Query:   "INSERT INTO databases SELECT id, dbname, dbuser, dbpass, dbsid, dumpfile, createDate, expiryDate, creator, agentName, dbAddress, dbPort, dbvendor, status, message, visibility, comment, team, coowners, tags, scriptOutput, liferayBuild, liferaySchema, liferayCompanies, liferayVirtualHosts FROM databases_tmp;",
+		Comment: "Change 'dbpass' to TEXT: Insert data to updated table",
+	},
+	{
+		Query:   "DROP TABLE databases_tmp;",
+		Comment: "Change 'dbpass' to TEXT: Drop temp table",
+	},
+	{
+		Query:   "CREATE UNIQUE INDEX IF NOT EXISTS `agent_db_idx` ON `databases` (`dbname`, `agentName`);",
+		Comment: "Change 'dbpass' to TEXT: Recreate index on columns dbname, agentName",
+	},
 }
 
 func (lite *DB) initTables() error {
@@ -0,0 +1,264 @@
+package sqlite
+
+import (
+	"fmt"
+
+	vis "github.com/djavorszky/ddn/common/visibility"
+	"github.com/djavorszky/ddn/server/database/data"
+	"github.com/djavorszky/ddn/server/database/dbutil"
+	"github.com/djavorszky/sutils"
+)
+
+// FetchByTeam returns the databases shared with the team.
+func (lite *DB) FetchByTeam(teamID int) ([]data.Row, error) {
+	if err := lite.alive(); err != nil {
+		return nil, fmt.Errorf("database down: %s", err.Error())
+	}
+
+	rows, err := lite.conn.Query("SELECT * FROM `databases` WHERE visibility = ? AND team = ? ORDER BY id DESC", vis.Team, teamID)
+	if err != nil {
+		return nil, fmt.Errorf("failed running query: %v", err)
+	}
+	defer rows.Close()
+
+	var entries []data.Row
+	for rows.Next() {
+		row, err := dbutil.ReadRows(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+		}
+
+		entries = append(entries, row)
+	}
+
+	return entries, nil
+}
+
+// FetchUser returns the user with the given email. If it has not been
+// stored, the returned user's Email is empty.
+func (lite *DB) FetchUser(email string) (data.User, error) {
+	if err := lite.alive(); err != nil {
+		return data.User{}, fmt.Errorf("database down: %s", err.Error())
+	}
+
+	row := lite.conn.QueryRow("SELECT * FROM `users` WHERE email = ?", email)
+	user, err := dbutil.ReadUser(row)
+	if err != nil {
+		return data.User{}, fmt.Errorf("failed reading result: %v", err)
+	}
+
+	return user, nil
+}
+
+// FetchUsers returns all stored users.
+func (lite *DB) FetchUsers() ([]data.User, error) {
+	if err := lite.alive(); err != nil {
+		return nil, fmt.Errorf("database down: %s", err.Error())
+	}
+
+	rows, err := lite.conn.Query("SELECT * FROM `users` ORDER BY email")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't execute query: %s", err.Error())
+	}
+	defer rows.Close()
+
+	var users []data.User
+	for rows.Next() {
+		user, err := dbutil.ReadUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+		}
+
+		users = append(users, user)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+	}
+
+	return users, nil
+}
+
+// SaveUser stores the user, replacing its role if it already exists.
+func (lite *DB) SaveUser(user data.User) error {
+	if err := lite.alive(); err != nil {
+		return fmt.Errorf("database down: %s", err.Error())
+	}
+
+	if !sutils.Present(user.Email, user.Role) {
+		return fmt.Errorf("missing email or role")
+	}
+
+	_, err := lite.conn.Exec("INSERT OR REPLACE INTO `users` (`email`, `role`) VALUES (?, ?)", user.Email, user.Role)
+	if err != nil {
+		return fmt.Errorf("save failed: %v", err)
+	}
+
+	return nil
+}
+
+// FetchTeamByID returns the team with the given ID along with its members.
+// If it does not exist, the returned team's ID is 0.
+func (lite *DB) FetchTeamByID(ID int) (data.Team, error) {
+	teams, err := lite.fetchTeams("SELECT * FROM `teams` WHERE id = ?", ID)
+	if err != nil || len(teams) == 0 {
+		return data.Team{}, err
+	}
+
+	return teams[0], nil
+}
+
+// FetchTeams returns all teams along with their members.
+func (lite *DB) FetchTeams() ([]data.Team, error) {
+	return lite.fetchTeams("SELECT * FROM `teams` ORDER BY name")
+}
+
+// FetchTeamsByMember returns the teams the user is a member of.
+func (lite *DB) FetchTeamsByMember(email string) ([]data.Team, error) {
+	return lite.fetchTeams("SELECT t.* FROM `teams` t JOIN `team_members` m ON m.teamId = t.id WHERE m.email = ? ORDER BY t.name", email)
+}
+
+func (lite *DB) fetchTeams(query string, args ...interface{}) ([]data.Team, error) {
+	if err := lite.alive(); err != nil {
+		return nil, fmt.Errorf("database down: %s", err.Error())
+	}
+
+	rows, err := lite.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't execute query: %s", err.Error())
+	}
+
+	var teams []data.Team
+	for rows.Next() {
+		team, err := dbutil.ReadTeam(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+		}
+
+		teams = append(teams, team)
+	}
+	rows.Close()
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+	}
+
+	for i := range teams {
+		teams[i].Members, err = lite.fetchTeamMembers(teams[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return teams, nil
+}
+
+func (lite *DB) fetchTeamMembers(teamID int) ([]string, error) {
+	rows, err := lite.conn.Query("SELECT email FROM `team_members` WHERE teamId = ? ORDER BY email", teamID)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't execute query: %s", err.Error())
+	}
+	defer rows.Close()
+
+	var members []string
+	for rows.Next() {
+		var email string
+
+		err = rows.Scan(&email)
+		if err != nil {
+			return nil, fmt.Errorf("error reading result from query: %s", err.Error())
+		}
+
+		members = append(members, email)
+	}
+
+	return members, rows.Err()
+}
+
+// InsertTeam adds a team to the database along with its members,
+// setting its ID
+func (lite *DB) InsertTeam(team *data.Team) error {
+	if err := lite.alive(); err != nil {
+		return fmt.Errorf("database down: %s", err.Error())
+	}
+
+	if !sutils.Present(team.Name) {
+		return fmt.Errorf("missing name")
+	}
+
+	res, err := lite.conn.Exec("INSERT INTO `teams` (`name`) VALUES (?)", team.Name)
+	if err != nil {
+		return fmt.Errorf("insert failed: %v", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed getting new ID: %v", err)
+	}
+
+	team.ID = int(id)
+
+	for _, member := range team.Members {
+		err = lite.AddTeamMember(team.ID, member)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteTeam removes the team and its members. The databases that were
+// shared with the team become private.
+func (lite *DB) DeleteTeam(team data.Team) error {
+	if err := lite.alive(); err != nil {
+		return fmt.Errorf("database down: %s", err.Error())
+	}
+
+	_, err := lite.conn.Exec("UPDATE `databases` SET visibility = ?, team = 0 WHERE team = ?", vis.Private, team.ID)
+	if err != nil {
+		return fmt.Errorf("unsharing databases failed: %v", err)
+	}
+
+	_, err = lite.conn.Exec("DELETE FROM `team_members` WHERE teamId = ?", team.ID)
+	if err != nil {
+		return fmt.Errorf("deleting members failed: %v", err)
+	}
+
+	_, err = lite.conn.Exec("DELETE FROM `teams` WHERE id = ?", team.ID)
+
+	return err
+}
+
+// AddTeamMember adds the user to the team. Adding an existing member
+// is not an error.
+func (lite *DB) AddTeamMember(teamID int, email string) error {
+	if err := lite.alive(); err != nil {
+		return fmt.Errorf("database down: %s", err.Error())
+	}
+
+	if !sutils.Present(email) {
+		return fmt.Errorf("missing email")
+	}
+
+	_, err := lite.conn.Exec("INSERT OR IGNORE INTO `team_members` (`teamId`, `email`) VALUES (?, ?)", teamID, email)
+	if err != nil {
+		return fmt.Errorf("insert failed: %v", err)
+	}
+
+	return nil
+}
+
+// RemoveTeamMember removes the user from the team.
+func (lite *DB) RemoveTeamMember(teamID int, email string) error {
+	if err := lite.alive(); err != nil {
+		return fmt.Errorf("database down: %s", err.Error())
+	}
+
+	_, err := lite.conn.Exec("DELETE FROM `team_members` WHERE teamId = ? AND email = ?", teamID, email)
+
+	return err
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/djavorszky/ddn/common/errs"
+	"github.com/djavorszky/ddn/common/inet"
+	"github.com/djavorszky/ddn/common/logger"
+	"github.com/djavorszky/ddn/server/database/data"
+	"github.com/djavorszky/ddn/server/hub"
+)
+
+// keepAliveInterval is how often a comment is sent on idle event streams
+// so that proxies don't close the connection.
+const keepAliveInterval = 30 * time.Second
+
+var events hub.Hub
+
+// publishEvent sends the event to the subscribers of the event stream.
+func publishEvent(typ string, dbe data.Row) {
+	dbe.DBPass = ""
+
+	events.Publish(typ, dbe)
+}
+
+// apiEvents streams the changes of the databases the user has access to as
+// Server-Sent Events. The stream can be limited to some databases with the
+// "id" query parameter, e.g. ?id=1,2. Clients reconnecting with the
+// Last-Event-ID header receive the events they missed.
+//
+// Besides the Authorization header, the user cookie is accepted as well,
+// as browsers can't set headers on an EventSource.
+func apiEvents(w http.ResponseWriter, r *http.Request) {
+	user, err := getAPIUser(r)
+	if err != nil {
+		if c, cerr := r.Cookie("user"); cerr == nil {
+			user = c.Value
+		}
+	}
+
+	if user == "" {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	ids := make(map[int]bool)
+	for _, param := range r.URL.Query()["id"] {
+		for _, s := range strings.Split(param, ",") {
+			id, err := strconv.Atoi(s)
+			if err != nil {
+				inet.SendFailure(w, http.StatusBadRequest, errs.InvalidURL, s)
+				return
+			}
+
+			ids[id] = true
+		}
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+
+	lastID, _ := strconv.ParseInt(lastEventID, 10, 64)
+
+	sub, missed := events.Subscribe(lastID, func(e hub.Event) bool {
+		if len(ids) != 0 && !ids[e.Database.ID] {
+			return false
+		}
+
+		return hasAccess(e.Database, user)
+	})
+	defer events.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: 5000\n\n")
+
+	for _, e := range missed {
+		if err := writeEvent(w, e); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				// Dropped for being too slow, the client will reconnect.
+				return
+			}
+
+			if err := writeEvent(w, e); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprintf(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, e hub.Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		logger.Error("failed encoding event %d: %v", e.ID, err)
+		return nil
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, b)
+
+	return err
+}
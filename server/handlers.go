@@ -2,9 +2,14 @@ package main
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -15,12 +20,15 @@ import (
 	"github.com/djavorszky/ddn/common/inet"
 	"github.com/djavorszky/ddn/common/logger"
 	"github.com/djavorszky/ddn/common/model"
+	"github.com/djavorszky/ddn/common/srv"
 	"github.com/djavorszky/ddn/common/status"
+	"github.com/djavorszky/ddn/common/storage"
 	vis "github.com/djavorszky/ddn/common/visibility"
 	"github.com/djavorszky/ddn/server/database/data"
+	"github.com/djavorszky/ddn/server/hub"
 	"github.com/djavorszky/ddn/server/mail"
 	"github.com/djavorszky/ddn/server/registry"
-	"github.com/djavorszky/liferay"
+	"github.com/djavorszky/ddn/server/webhook"
 	"github.com/djavorszky/notif"
 	"github.com/djavorszky/sutils"
 	"github.com/gorilla/mux"
@@ -79,21 +87,38 @@ func prepImportAction(w http.ResponseWriter, r *http.Request) {
 		public   = r.PostFormValue("public")
 	)
 
-	dbID, err := doPrepImport(getUser(r), agent, dumpfile, dbname, dbuser, dbpass, public)
+	user := getUser(r)
+	if !canWrite(user) {
+		session.AddFlash("Failed preparing import: You are not allowed to import databases.", "fail")
+		return
+	}
+
+	tags, comment, err := formNotes(r)
+	if err != nil {
+		session.AddFlash(fmt.Sprintf("Failed preparing import: %v", err), "fail")
+		return
+	}
+
+	dbID, err := doPrepImport(user, agent, dumpfile, dbname, dbuser, dbpass, public, tags, comment)
 	if err != nil {
 		session.AddFlash(fmt.Sprintf("Failed preparing import: %v", err), "fail")
 		return
 	}
 
-	go doImport(int(dbID), dumpfile)
+	audit(user, auditImport, data.Row{ID: dbID, AgentName: agent}, dumpfile)
+
+	requestID := srv.RequestID(r)
+	background(func() { doImport(int(dbID), dumpfile, requestID) })
 
 	session.AddFlash("Started the import process...", "msg")
 }
 
-func doImport(dbID int, dumpfile string) {
+func doImport(dbID int, dumpfile, requestID string) {
+	log := logger.With(logger.Fields{"request_id": requestID, "database_id": dbID})
+
 	dbe, err := db.FetchByID(dbID)
 	if err != nil {
-		logger.Error("Failed getting entry by ID: %v", err)
+		log.Error("Failed getting entry by ID: %v", err)
 		dbe.Status = status.ImportFailed
 		dbe.Message = "Server error: " + err.Error()
 		dbe.ExpiryDate = time.Now().AddDate(0, 0, 2)
@@ -103,21 +128,31 @@ func doImport(dbID int, dumpfile string) {
 		return
 	}
 
-	dbe.Status = status.CopyInProgress
-	db.Update(&dbe)
-
-	url, err := copyFile(dumpfile)
-	if err != nil {
-		logger.Error("file copy: %v", err)
-		dbe.Status = status.ImportFailed
-		dbe.Message = "Server error: " + err.Error()
-		dbe.ExpiryDate = time.Now().AddDate(0, 0, 2)
+	defer func() {
+		if dbe.IsErr() {
+			removeStaged(dbe.ID)
+			fireEvent(webhook.ImportFailed, dbe)
+		}
+	}()
 
+	url, sum := dumpfile, ""
+	if !storage.Supported(dumpfile) {
+		dbe.Status = status.CopyInProgress
 		db.Update(&dbe)
-		return
+
+		url, sum, err = copyFile(dbe.ID, dumpfile)
+		if err != nil {
+			log.Error("file copy: %v", err)
+			dbe.Status = status.ImportFailed
+			dbe.Message = "Server error: " + err.Error()
+			dbe.ExpiryDate = time.Now().AddDate(0, 0, 2)
+
+			db.Update(&dbe)
+			return
+		}
 	}
 
-	dbe.Dumpfile = url
+	dbe.Dumpfile = dumpfile
 	db.Update(&dbe)
 
 	conn, ok := registry.Get(dbe.AgentName)
@@ -129,26 +164,37 @@ func doImport(dbID int, dumpfile string) {
 		db.Update(&dbe)
 		return
 	}
+	conn = conn.WithRequestID(requestID)
 
-	_, err = conn.ImportDatabase(int(dbID), dbe.DBName, dbe.DBUser, dbe.DBPass, url)
+	_, err = conn.ImportDatabase(model.DBRequest{
+		ID:           dbID,
+		DatabaseName: dbe.DBName,
+		Username:     dbe.DBUser,
+		Password:     dbe.DBPass,
+		DumpLocation: url,
+		SHA256:       sum,
+	})
 	if err != nil {
 		dbe.Status = status.ImportFailed
 		dbe.Message = "Server error: " + err.Error()
 		dbe.ExpiryDate = time.Now().AddDate(0, 0, 2)
 
 		db.Update(&dbe)
-		os.Remove(fmt.Sprintf("%s/web/dumps/%s", workdir, dumpfile))
 		return
 	}
 
 }
 
-func doPrepImport(creator, agent, dumpfile, dbname, dbuser, dbpass, public string) (int, error) {
+func doPrepImport(creator, agent, dumpfile, dbname, dbuser, dbpass, public string, tags []string, comment string) (int, error) {
 	conn, ok := registry.Get(agent)
 	if !ok {
 		return 0, fmt.Errorf("agent went offline")
 	}
 
+	if conn.Draining {
+		return 0, fmt.Errorf("agent %s is draining", agent)
+	}
+
 	ensureValues(&dbname, &dbuser, &dbpass, conn.DBVendor)
 
 	entry := data.Row{
@@ -164,6 +210,8 @@ func doPrepImport(creator, agent, dumpfile, dbname, dbuser, dbpass, public strin
 		DBPort:     conn.DBPort,
 		DBVendor:   conn.DBVendor,
 		Status:     status.Started,
+		Tags:       tags,
+		Comment:    comment,
 	}
 
 	if public == "on" {
@@ -178,32 +226,39 @@ func doPrepImport(creator, agent, dumpfile, dbname, dbuser, dbpass, public strin
 	return entry.ID, nil
 }
 
-func copyFile(dump string) (string, error) {
-	filename := filepath.Base(dump)
-
+// copyFile stages the dump from the mounted folder to be served to the
+// agent importing it into the database, and returns its url and SHA-256
+// checksum.
+func copyFile(id int, dump string) (string, string, error) {
 	src, err := os.OpenFile(filepath.Join(config.MountLoc, dump), os.O_RDONLY, 0644)
 	if err != nil {
-		return "", fmt.Errorf("failed opening source file: %v", err)
+		return "", "", fmt.Errorf("failed opening source file: %v", err)
 
 	}
 	defer src.Close()
 
-	dst, err := os.OpenFile(fmt.Sprintf("%s/web/dumps/%s", workdir, filename), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	return stageDump(id, filepath.Base(dump), src)
+}
+
+// stageDump saves the dump read from src to be served to the agent importing
+// it into the database, and returns its url and SHA-256 checksum.
+func stageDump(id int, filename string, src io.Reader) (string, string, error) {
+	dst, err := stageFile(id, filename)
 	if err != nil {
-		return "", fmt.Errorf("failed creating file: %v", err)
+		return "", "", fmt.Errorf("failed creating file: %v", err)
 
 	}
 	defer dst.Close()
 
-	_, err = io.Copy(dst, src)
+	h := sha256.New()
+
+	_, err = io.Copy(io.MultiWriter(dst, h), src)
 	if err != nil {
-		return "", fmt.Errorf("failed copying file: %v", err)
+		return "", "", fmt.Errorf("failed copying file: %v", err)
 
 	}
 
-	url := fmt.Sprintf("http://%s:%s/dumps/%s", config.ServerHost, config.ServerPort, filename)
-
-	return url, nil
+	return stagedURL(id, filename), hex.EncodeToString(h.Sum(nil)), nil
 }
 
 func importAction(w http.ResponseWriter, r *http.Request) {
@@ -226,47 +281,50 @@ func importAction(w http.ResponseWriter, r *http.Request) {
 	}
 	defer session.Save(r, w)
 
-	var filename string
-	for _, uploadFile := range r.MultipartForm.File {
-		filename = uploadFile[0].Filename
+	if !canWrite(getUser(r)) {
+		session.AddFlash("Failed importing database: You are not allowed to import databases.", "fail")
+		return
+	}
 
-		dst, err := os.OpenFile(fmt.Sprintf("%s/web/dumps/%s", workdir, filename), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
-		if err != nil {
-			logger.Error("Failed creating file: %v", err)
-			return
-		}
-		defer dst.Close()
+	tags, comment, err := formNotes(r)
+	if err != nil {
+		session.AddFlash(fmt.Sprintf("Failed importing database: %v", err), "fail")
+		return
+	}
 
-		upf, err := uploadFile[0].Open()
-		if err != nil {
-			logger.Error("Failed opening uploaded file: %v", err)
-			return
-		}
+	var file *multipart.FileHeader
+	for _, uploadFile := range r.MultipartForm.File {
+		file = uploadFile[0]
+	}
 
-		_, err = io.Copy(dst, upf)
+	defer func() {
+		err := r.MultipartForm.RemoveAll()
 		if err != nil {
-			logger.Error("Failed saving file: %v", err)
-
-			os.Remove(fmt.Sprintf("%s/web/dumps/%s", workdir, filename))
-			return
+			logger.Error("Could not removeall multipartform: %v", err)
 		}
-	}
+	}()
 
-	err = r.MultipartForm.RemoveAll()
-	if err != nil {
-		logger.Error("Could not removeall multipartform: %v", err)
+	if file == nil {
+		session.AddFlash("Failed importing database: no dump was uploaded.", "fail")
+		return
 	}
 
+	filename := uploadFilename(file.Filename)
+
 	conn, ok := registry.Get(agent)
 	if !ok {
 		session.AddFlash(fmt.Sprintf("Failed importing database, agent %s went offline", agent), "fail")
-		os.Remove(fmt.Sprintf("%s/web/dumps/%s", workdir, filename))
+		return
+	}
+	conn = conn.WithRequestID(srv.RequestID(r))
+
+	if conn.Draining {
+		session.AddFlash(fmt.Sprintf("Failed importing database, agent %s is draining", agent), "fail")
 		return
 	}
 
 	ensureValues(&dbname, &dbuser, &dbpass, conn.DBVendor)
 
-	url := fmt.Sprintf("http://%s:%s/dumps/%s", config.ServerHost, config.ServerPort, filename)
 	entry := data.Row{
 		DBName:     dbname,
 		DBUser:     dbuser,
@@ -276,11 +334,13 @@ func importAction(w http.ResponseWriter, r *http.Request) {
 		ExpiryDate: time.Now().AddDate(0, 1, 0),
 		AgentName:  agent,
 		Creator:    getUser(r),
-		Dumpfile:   url,
+		Dumpfile:   filename,
 		DBAddress:  conn.DBAddr,
 		DBPort:     conn.DBPort,
 		DBVendor:   conn.DBVendor,
 		Status:     status.Started,
+		Tags:       tags,
+		Comment:    comment,
 	}
 
 	if public == "on" {
@@ -291,19 +351,47 @@ func importAction(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		logger.Error("persist: %v", err)
 		session.AddFlash(fmt.Sprintf("failed persisting database locally: %v", err), "fail")
-		os.Remove(fmt.Sprintf("%s/web/dumps/%s", workdir, filename))
 		return
 	}
 
-	resp, err := conn.ImportDatabase(entry.ID, dbname, dbuser, dbpass, url)
+	upf, err := file.Open()
+	if err != nil {
+		logger.Error("Failed opening uploaded file: %v", err)
+		session.AddFlash(fmt.Sprintf("Failed opening uploaded file: %v", err), "fail")
+
+		db.Delete(entry)
+		return
+	}
+	defer upf.Close()
+
+	url, sum, err := stageDump(entry.ID, filename, upf)
+	if err != nil {
+		logger.Error("Failed saving file: %v", err)
+		session.AddFlash(fmt.Sprintf("Failed saving uploaded file: %v", err), "fail")
+
+		db.Delete(entry)
+		removeStaged(entry.ID)
+		return
+	}
+
+	resp, err := conn.ImportDatabase(model.DBRequest{
+		ID:           entry.ID,
+		DatabaseName: dbname,
+		Username:     dbuser,
+		Password:     dbpass,
+		DumpLocation: url,
+		SHA256:       sum,
+	})
 	if err != nil {
 		session.AddFlash(err.Error(), "fail")
 
 		db.Delete(entry)
-		os.Remove(fmt.Sprintf("%s/web/dumps/%s", workdir, filename))
+		removeStaged(entry.ID)
 		return
 	}
 
+	audit(entry.Creator, auditImport, entry, filename)
+
 	session.AddFlash(resp, "msg")
 }
 
@@ -326,11 +414,28 @@ func createAction(w http.ResponseWriter, r *http.Request) {
 	}
 	defer session.Save(r, w)
 
+	if !canWrite(getUser(r)) {
+		session.AddFlash("Failed creating database: You are not allowed to create databases.", "fail")
+		return
+	}
+
+	tags, comment, err := formNotes(r)
+	if err != nil {
+		session.AddFlash(fmt.Sprintf("Failed creating database: %v", err), "fail")
+		return
+	}
+
 	conn, ok := registry.Get(agent)
 	if !ok {
 		session.AddFlash(fmt.Sprintf("Failed creating database, agent %s went offline", agent), "fail")
 		return
 	}
+	conn = conn.WithRequestID(srv.RequestID(r))
+
+	if conn.Draining {
+		session.AddFlash(fmt.Sprintf("Failed creating database, agent %s is draining", agent), "fail")
+		return
+	}
 
 	ensureValues(&dbname, &dbuser, &dbpass, conn.DBVendor)
 
@@ -347,6 +452,8 @@ func createAction(w http.ResponseWriter, r *http.Request) {
 		DBPort:     conn.DBPort,
 		DBVendor:   conn.DBVendor,
 		Status:     status.Success,
+		Tags:       tags,
+		Comment:    comment,
 	}
 
 	if public == "on" {
@@ -368,6 +475,9 @@ func createAction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	fireEvent(webhook.DatabaseCreated, entry)
+	audit(entry.Creator, auditCreate, entry, "")
+
 	session.Values["id"] = entry.ID
 	session.AddFlash(resp, "success")
 }
@@ -394,21 +504,34 @@ func register(w http.ResponseWriter, r *http.Request) {
 		Version:    req.Version,
 		Address:    req.Addr,
 		AgentPort:  req.Port,
+		Token:      newAgentToken(),
 		Up:         true,
+		Draining:   req.Draining,
 	}
 
 	registry.Store(ddnc)
 
 	logger.Info("Registered: %v", req.AgentName)
 
+	auditAgent(auditSystem, auditRegister, ddnc.ShortName, fmt.Sprintf("%s (version %s) at %s:%s", ddnc.Identifier, ddnc.Version, ddnc.Address, ddnc.AgentPort))
+
 	conAddr := fmt.Sprintf("%s:%s", ddnc.Address, ddnc.AgentPort)
 
-	resp, _ := inet.JSONify(model.RegisterResponse{ID: ddnc.ID, Address: conAddr})
+	resp, _ := inet.JSONify(model.RegisterResponse{ID: ddnc.ID, Address: conAddr, Token: ddnc.Token})
 
 	inet.WriteHeader(w, http.StatusOK)
 	w.Write(resp)
 }
 
+// newAgentToken returns the token an agent proves with that it's the one that
+// registered under its name.
+func newAgentToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
 func unregister(w http.ResponseWriter, r *http.Request) {
 	var agent model.Agent
 
@@ -421,6 +544,48 @@ func unregister(w http.ResponseWriter, r *http.Request) {
 	registry.Remove(agent.ShortName)
 
 	logger.Info("Unregistered: %s", agent.Identifier)
+
+	auditAgent(auditSystem, auditUnregister, agent.ShortName, agent.Identifier)
+}
+
+// drain marks an agent as draining, so that it's not given new databases
+// while it's waiting for its imports to finish before shutting down.
+func drain(w http.ResponseWriter, r *http.Request) {
+	var req model.Agent
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		logger.Error("json decode: %v", err)
+
+		inet.SendResponse(w, http.StatusBadRequest, inet.ErrorJSONResponse(err))
+		return
+	}
+
+	agent, ok := registry.Get(req.ShortName)
+	if !ok {
+		inet.SendResponse(w, http.StatusNotFound, inet.Message{Status: status.NotFound, Message: fmt.Sprintf("agent %q is not registered", req.ShortName)})
+		return
+	}
+
+	if !validAgentToken(agent, req.Token) {
+		inet.SendResponse(w, http.StatusForbidden, inet.Message{Status: status.ClientError, Message: "invalid agent token"})
+		return
+	}
+
+	agent.Draining = true
+	registry.Store(agent)
+
+	logger.Info("Draining: %s", agent.Identifier)
+
+	auditAgent(auditSystem, auditDrain, agent.ShortName, agent.Identifier)
+
+	inet.SendResponse(w, http.StatusOK, inet.Message{Status: status.Success, Message: "Marked as draining"})
+}
+
+// validAgentToken returns true if token is the one the agent got when it
+// registered.
+func validAgentToken(agent model.Agent, token string) bool {
+	return agent.Token != "" && subtle.ConstantTimeCompare([]byte(agent.Token), []byte(token)) == 1
 }
 
 func heartbeat(w http.ResponseWriter, r *http.Request) {
@@ -493,6 +658,11 @@ func extend(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !canModify(dbe, getUser(r)) {
+		http.Error(w, "You can only extend databases you have access to.", http.StatusForbidden)
+		return
+	}
+
 	dbe.ExpiryDate = time.Now().AddDate(0, 0, 30)
 	dbe.Status = status.Success
 
@@ -502,6 +672,8 @@ func extend(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	audit(getUser(r), auditExtend, dbe, "until "+dbe.ExpiryDate.Format("2006-01-02"))
+
 	session, err := store.Get(r, "user-session")
 	if err != nil {
 		http.Error(w, "Failed getting session: "+err.Error(), http.StatusInternalServerError)
@@ -543,9 +715,9 @@ func drop(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if dbe.Creator != user {
+	if !canModify(dbe, user) {
 		logger.Error("User %q tried to drop database of user %q.", user, dbe.Creator)
-		session.AddFlash("Failed dropping database: You can only drop databases you created.", "fail")
+		session.AddFlash("Failed dropping database: You can only drop databases you created or that are shared with your team.", "fail")
 		return
 	}
 
@@ -555,12 +727,15 @@ func drop(w http.ResponseWriter, r *http.Request) {
 		session.AddFlash("Unable to drop database: Agent is down.", "fail")
 		return
 	}
+	conn = conn.WithRequestID(srv.RequestID(r))
 
 	dbe.Status = status.DropInProgress
 
 	db.Update(&dbe)
 
-	go dropAsync(conn, ID, dbe.DBName, dbe.DBUser)
+	audit(user, auditDrop, dbe, dbe.DBName)
+
+	background(func() { dropAsync(conn, ID, dbe.DBName, dbe.DBUser) })
 
 	session.AddFlash("Started to drop the database.", "msg")
 }
@@ -584,6 +759,8 @@ func dropAsync(agent model.Agent, ID int, dbname, dbuser string) {
 	}
 
 	db.Delete(dbe)
+
+	fireEvent(webhook.DatabaseDropped, dbe)
 }
 
 func portalext(w http.ResponseWriter, r *http.Request) {
@@ -617,7 +794,7 @@ func portalext(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if dbe.Public == vis.Private && dbe.Creator != user {
+	if !hasAccess(dbe, user) {
 		logger.Error("User %q tried to get portalext of db created by %q.", user, dbe.Creator)
 		session.AddFlash("Failed fetching portal-ext: You can only fetch the portal-ext of public databases or ones that you created.", "fail")
 		return
@@ -658,9 +835,9 @@ func recreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if dbe.Creator != user {
+	if !canModify(dbe, user) {
 		logger.Error("User %q tried to get recreate the database created by %q.", user, dbe.Creator)
-		session.AddFlash("Failed recreating databasee: You can only recreate database you created.", "fail")
+		session.AddFlash("Failed recreating database: You can only recreate databases you created or that are shared with your team.", "fail")
 		return
 	}
 
@@ -670,8 +847,16 @@ func recreate(w http.ResponseWriter, r *http.Request) {
 		session.AddFlash("Unable to recreate database: Agent is down.", "fail")
 		return
 	}
+	conn = conn.WithRequestID(srv.RequestID(r))
 
-	go recreateAsync(conn, dbe)
+	if conn.Draining {
+		session.AddFlash("Unable to recreate database: Agent is draining.", "fail")
+		return
+	}
+
+	audit(user, auditRecreate, dbe, dbe.DBName)
+
+	background(func() { recreateAsync(conn, dbe) })
 
 	session.AddFlash("Started to recreate", "msg")
 }
@@ -709,32 +894,56 @@ func recreateAsync(conn model.Agent, dbe data.Row) {
 
 // upd8 updates the status of the databases.
 func upd8(w http.ResponseWriter, r *http.Request) {
+	log := srv.Log(r)
+
 	var msg notif.Msg
 
 	err := json.NewDecoder(r.Body).Decode(&msg)
 	if err != nil {
-		logger.Error("json decode: %v", err)
+		log.Error("json decode: %v", err)
 
 		inet.SendResponse(w, http.StatusBadRequest, inet.ErrorJSONResponse(err))
 		return
 	}
 
+	log = log.With(logger.Fields{"database_id": msg.ID})
+
 	dbe, err := db.FetchByID(msg.ID)
 	if err != nil {
-		logger.Error("FetchById: %v", err)
+		log.Error("FetchById: %v", err)
 		return
 	}
 
+	importing := dbe.InProgress()
+
+	// The update that ends the post-import scripts carries their output,
+	// whose last line is the error if one of them failed.
+	message := msg.Message
+	if dbe.Status == status.RunningScripts {
+		dbe.ScriptOutput = msg.Message
+		message = msg.Message[strings.LastIndex(msg.Message, "\n")+1:]
+	}
+
 	dbe.Status = msg.StatusID
 
+	if importing && dbe.Status == status.Success {
+		dbe.Liferay = inspectLiferay(dbe, srv.RequestID(r))
+	}
+
 	db.Update(&dbe)
 
-	// Delete the dumpfile once import is started or if an error has occurred.
-	if dbe.Status == status.ImportInProgress || dbe.IsErr() {
-		loc := strings.LastIndex(dbe.Dumpfile, "/")
+	if importing && !dbe.InProgress() {
+		observeImport(dbe)
+	}
+
+	// Delete the staged dump once the agent has downloaded it, or the import
+	// finished or failed.
+	if dbe.Status == status.ImportInProgress || !dbe.InProgress() {
+		removeStaged(dbe.ID)
+	}
 
-		file := fmt.Sprintf("%s/web/dumps/%s", workdir, dbe.Dumpfile[loc+1:])
-		os.Remove(file)
+	if dbe.Status == status.ImportInProgress {
+		fireEvent(webhook.ImportStarted, dbe)
 	}
 
 	if dbe.IsErr() {
@@ -744,78 +953,57 @@ func upd8(w http.ResponseWriter, r *http.Request) {
 <p>%q</p>
 
 <p>We're sorry for the inconvenience caused.</p>
-<p>Visit <a href="http://cloud-db.liferay.int">Cloud DB</a>.</p>`, dbe.DBVendor, dbe.DBName, msg.Message))
+<p>Visit <a href="http://cloud-db.liferay.int">Cloud DB</a>.</p>`, dbe.DBVendor, dbe.DBName, message))
 
 		err = sendUserNotifications(dbe.Creator, fmt.Sprintf("Importing %s failed!", dbe.DBName))
 		if err != nil {
-			logger.Error("failed notifying user: %v", err)
+			log.Error("failed notifying user: %v", err)
 		}
 
 		// Update dbentry as well
-		dbe.Message = msg.Message
+		dbe.Message = message
 		dbe.ExpiryDate = time.Now().AddDate(0, 0, 2)
 
 		err = db.Update(&dbe)
 		if err != nil {
-			logger.Error("Update: %v", err)
+			log.Error("Update: %v", err)
 		}
+
+		fireEvent(webhook.ImportFailed, dbe)
 	}
 
-	if dbe.Status == status.Success {
-		var (
-			jdbc62x liferay.JDBC
-			jdbcDXP liferay.JDBC
-		)
-
-		switch dbe.DBVendor {
-		case "mysql":
-			jdbc62x = liferay.MysqlJDBC(dbe.DBAddress, dbe.DBPort, dbe.DBName, dbe.DBUser, dbe.DBPass)
-			jdbcDXP = liferay.MysqlJDBCDXP(dbe.DBAddress, dbe.DBPort, dbe.DBName, dbe.DBUser, dbe.DBPass)
-		case "mariadb":
-			jdbc62x = liferay.MariaDBJDBC(dbe.DBAddress, dbe.DBPort, dbe.DBName, dbe.DBUser, dbe.DBPass)
-			jdbcDXP = jdbc62x
-		case "postgres":
-			jdbc62x = liferay.PostgreJDBC(dbe.DBAddress, dbe.DBPort, dbe.DBName, dbe.DBUser, dbe.DBPass)
-			jdbcDXP = jdbc62x
-		case "oracle":
-			jdbc62x = liferay.OracleJDBC(dbe.DBAddress, dbe.DBPort, dbe.DBSID, dbe.DBUser, dbe.DBPass)
-			jdbcDXP = jdbc62x
-		case "mssql":
-			jdbc62x = liferay.MSSQLJDBC(dbe.DBAddress, dbe.DBPort, dbe.DBName, dbe.DBUser, dbe.DBPass)
-			jdbcDXP = jdbc62x
-		}
+	publishEvent(hub.StatusChanged, dbe)
 
+	if dbe.Status == status.Success {
 		mail.Send(dbe.Creator, fmt.Sprintf("[Cloud DB] Importing %q succeeded", dbe.DBName), fmt.Sprintf(`<h3>Import database successful</h3>
 		
 <p>The %s import that you started completed successfully.</p>
-<p>Below you can find the portal-exts, should you need them:</p>
-
-<h2><= 6.2 EE properties</h2>
-<pre>
-%s
-%s
-%s
-%s
-</pre>
-
-<h2>DXP properties</h2>
-<pre>
-%s
-%s
-%s
 %s
-</pre>
-
 <p>Visit <a href="http://cloud-db.liferay.int">Cloud DB</a> for more awesomeness.</p>
-<p>Cheers</p>`, dbe.DBVendor, jdbc62x.Driver, jdbc62x.URL, jdbc62x.User, jdbc62x.Password, jdbcDXP.Driver, jdbcDXP.URL, jdbcDXP.User, jdbcDXP.Password))
+<p>Cheers</p>`, dbe.DBVendor, portalExtMail(dbe)))
 
 		err = sendUserNotifications(dbe.Creator, fmt.Sprintf("Finished importing %s", dbe.DBName))
 		if err != nil {
-			logger.Error("failed notifying user: %v", err)
+			log.Error("failed notifying user: %v", err)
 		}
+
+		fireEvent(webhook.ImportSucceeded, dbe)
 	}
 }
 
+// formNotes returns the comma separated tags and the comment of the
+// database in the submitted form.
+func formNotes(r *http.Request) ([]string, string, error) {
+	comment := r.PostFormValue("comment")
+
+	tags, errr := checkNotes(strings.Split(r.PostFormValue("tags"), ","), comment)
+	if errr.httpStatus != 0 {
+		return nil, "", fmt.Errorf("%s", strings.Join(errr.errors, ": "))
+	}
+
+	return tags, comment, nil
+}
+
 func ensureValues(dbname, dbuser, dbpass *string, vendor string) {
 	if vendor == "mssql" {
 		*dbuser = "clouddb"
@@ -837,7 +1025,10 @@ func ensureValues(dbname, dbuser, dbpass *string, vendor string) {
 }
 
 func getUser(r *http.Request) string {
-	usr, _ := r.Cookie("user")
+	usr, err := r.Cookie("user")
+	if err != nil {
+		return ""
+	}
 
 	return usr.Value
 }
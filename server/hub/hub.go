@@ -0,0 +1,184 @@
+// Package hub is an in-process publish/subscribe hub for the status changes
+// of databases. It keeps the latest events in memory so that subscribers
+// that reconnect can catch up on the ones they missed.
+package hub
+
+import (
+	"sync"
+	"time"
+
+	"github.com/djavorszky/ddn/server/database/data"
+)
+
+// StatusChanged is the type of the events published when a database's
+// status is updated.
+const StatusChanged = "status.changed"
+
+const (
+	// DefaultBufferSize is the number of events kept for replaying if
+	// BufferSize is not set.
+	DefaultBufferSize = 1000
+
+	// subscriberBuffer is the number of events a subscriber can lag
+	// behind before it is dropped.
+	subscriberBuffer = 64
+)
+
+// Event is a change of a database. StatusLabel and Progress are derived
+// from the database's status, so clients don't have to.
+type Event struct {
+	ID          int64     `json:"id"`
+	Type        string    `json:"type"`
+	Time        time.Time `json:"time"`
+	Database    data.Row  `json:"database"`
+	StatusLabel string    `json:"statusLabel"`
+	Progress    int       `json:"progress"`
+}
+
+// Hub distributes events to its subscribers. The zero value is ready to use.
+type Hub struct {
+	// BufferSize is the number of latest events kept for replaying.
+	BufferSize int
+
+	// pubMu keeps the events in order while they are filtered and sent. The
+	// filters may be slow, e.g. query the database, so they don't run under
+	// mu, which would block subscribing and unsubscribing.
+	pubMu sync.Mutex
+
+	mu     sync.Mutex
+	lastID int64
+	buffer []Event
+	subs   map[*Subscription]bool
+}
+
+// Subscription receives the events that pass its filter on C. C is closed
+// if the subscriber is too slow to keep up, or when it unsubscribes.
+type Subscription struct {
+	C <-chan Event
+
+	c      chan Event
+	filter func(Event) bool
+}
+
+// Publish sends an event of type typ about row to all subscribers and
+// returns it.
+func (h *Hub) Publish(typ string, row data.Row) Event {
+	h.pubMu.Lock()
+	defer h.pubMu.Unlock()
+
+	h.mu.Lock()
+
+	h.lastID++
+	e := Event{
+		ID:          h.lastID,
+		Type:        typ,
+		Time:        time.Now(),
+		Database:    row,
+		StatusLabel: row.StatusLabel(),
+		Progress:    row.Progress(),
+	}
+
+	size := h.BufferSize
+	if size == 0 {
+		size = DefaultBufferSize
+	}
+
+	h.buffer = append(h.buffer, e)
+	if len(h.buffer) > size {
+		h.buffer = h.buffer[len(h.buffer)-size:]
+	}
+
+	subs := make([]*Subscription, 0, len(h.subs))
+	for s := range h.subs {
+		subs = append(subs, s)
+	}
+
+	h.mu.Unlock()
+
+	var recipients []*Subscription
+	for _, s := range subs {
+		if s.filter != nil && !s.filter(e) {
+			continue
+		}
+
+		recipients = append(recipients, s)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, s := range recipients {
+		// It may have unsubscribed while the filters ran.
+		if !h.subs[s] {
+			continue
+		}
+
+		select {
+		case s.c <- e:
+		default:
+			// Too slow, it can reconnect and catch up via the buffer.
+			delete(h.subs, s)
+			close(s.c)
+		}
+	}
+
+	return e
+}
+
+// Subscribe registers a new subscriber that receives the events for which
+// filter returns true, or all of them if filter is nil. It also returns the
+// buffered events with an ID larger than lastID that pass the filter, so
+// reconnecting subscribers don't miss anything. Use 0 as lastID to skip
+// the replay.
+//
+// If lastID is larger than the ID of the latest event, e.g. because the
+// server has been restarted since, all buffered events are returned.
+func (h *Hub) Subscribe(lastID int64, filter func(Event) bool) (*Subscription, []Event) {
+	h.mu.Lock()
+
+	c := make(chan Event, subscriberBuffer)
+	s := &Subscription{C: c, c: c, filter: filter}
+
+	if h.subs == nil {
+		h.subs = make(map[*Subscription]bool)
+	}
+	h.subs[s] = true
+
+	if lastID == 0 {
+		h.mu.Unlock()
+		return s, nil
+	}
+
+	if lastID > h.lastID {
+		lastID = 0
+	}
+
+	buffer := make([]Event, len(h.buffer))
+	copy(buffer, h.buffer)
+
+	h.mu.Unlock()
+
+	var missed []Event
+	for _, e := range buffer {
+		if e.ID <= lastID || (filter != nil && !filter(e)) {
+			continue
+		}
+
+		missed = append(missed, e)
+	}
+
+	return s, missed
+}
+
+// Unsubscribe removes the subscriber and closes its channel.
+func (h *Hub) Unsubscribe(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.subs[s] {
+		return
+	}
+
+	delete(h.subs, s)
+	close(s.c)
+}
@@ -0,0 +1,132 @@
+package hub
+
+import (
+	"testing"
+
+	"github.com/djavorszky/ddn/server/database/data"
+)
+
+func TestHub_Publish(t *testing.T) {
+	var h Hub
+
+	all, _ := h.Subscribe(0, nil)
+	odd, _ := h.Subscribe(0, func(e Event) bool { return e.Database.ID%2 == 1 })
+
+	for id := 1; id <= 4; id++ {
+		h.Publish(StatusChanged, data.Row{ID: id})
+	}
+
+	if got := len(all.C); got != 4 {
+		t.Errorf("unfiltered subscriber received %d events, want 4", got)
+	}
+
+	if got := len(odd.C); got != 2 {
+		t.Errorf("filtered subscriber received %d events, want 2", got)
+	}
+
+	if e := <-odd.C; e.Database.ID != 1 || e.ID != 1 {
+		t.Errorf("first filtered event = %+v, want database 1 with id 1", e)
+	}
+
+	h.Unsubscribe(all)
+	h.Unsubscribe(all)
+
+	if _, ok := <-drain(all.C); ok {
+		t.Errorf("channel of unsubscribed subscriber is not closed")
+	}
+}
+
+func TestHub_Subscribe(t *testing.T) {
+	h := Hub{BufferSize: 3}
+
+	for id := 1; id <= 5; id++ {
+		h.Publish(StatusChanged, data.Row{ID: id})
+	}
+
+	tests := []struct {
+		name    string
+		lastID  int64
+		filter  func(Event) bool
+		wantIDs []int64
+	}{
+		{"noReplay", 0, nil, nil},
+		{"missedOne", 4, nil, []int64{5}},
+		{"missedMoreThanBuffer", 1, nil, []int64{3, 4, 5}},
+		{"filtered", 2, func(e Event) bool { return e.Database.ID != 4 }, []int64{3, 5}},
+		{"serverRestarted", 100, nil, []int64{3, 4, 5}},
+		{"upToDate", 5, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, missed := h.Subscribe(tt.lastID, tt.filter)
+			defer h.Unsubscribe(s)
+
+			if len(missed) != len(tt.wantIDs) {
+				t.Errorf("Subscribe() replayed %d events, want %d", len(missed), len(tt.wantIDs))
+				return
+			}
+
+			for i, e := range missed {
+				if e.ID != tt.wantIDs[i] {
+					t.Errorf("Subscribe() replayed event %d, want %d", e.ID, tt.wantIDs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestHub_slowSubscriber(t *testing.T) {
+	var h Hub
+
+	slow, _ := h.Subscribe(0, nil)
+
+	for id := 0; id <= subscriberBuffer; id++ {
+		h.Publish(StatusChanged, data.Row{ID: id})
+	}
+
+	if _, ok := <-drain(slow.C); ok {
+		t.Errorf("slow subscriber was not dropped")
+	}
+}
+
+func TestHub_slowFilter(t *testing.T) {
+	var h Hub
+
+	filtering := make(chan struct{})
+	release := make(chan struct{})
+
+	slow, _ := h.Subscribe(0, func(e Event) bool {
+		close(filtering)
+		<-release
+		return true
+	})
+
+	published := make(chan Event)
+	go func() { published <- h.Publish(StatusChanged, data.Row{ID: 1}) }()
+
+	<-filtering
+
+	// Subscribing and unsubscribing don't wait for the filters to finish.
+	other, missed := h.Subscribe(100, nil)
+	if len(missed) != 1 {
+		t.Errorf("Subscribe() while filtering replayed %d events, want 1", len(missed))
+	}
+	h.Unsubscribe(other)
+
+	close(release)
+	<-published
+
+	if e := <-slow.C; e.Database.ID != 1 {
+		t.Errorf("slowly filtered subscriber received %+v, want database 1", e)
+	}
+}
+
+// drain reads all buffered events of c, and returns c so its
+// closed state can be checked.
+func drain(c <-chan Event) <-chan Event {
+	for len(c) > 0 {
+		<-c
+	}
+
+	return c
+}
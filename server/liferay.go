@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/djavorszky/ddn/common/logger"
+	"github.com/djavorszky/ddn/common/model"
+	"github.com/djavorszky/ddn/server/database/data"
+	"github.com/djavorszky/ddn/server/registry"
+	"github.com/djavorszky/liferay"
+)
+
+// portalExt returns the JDBC properties of the portal-ext for the database,
+// either the ones of DXP or the ones of 6.2 and earlier.
+func portalExt(entry data.Row, dxp bool) liferay.JDBC {
+	switch entry.DBVendor {
+	case "mysql":
+		if dxp {
+			return liferay.MysqlJDBCDXP(entry.DBAddress, entry.DBPort, entry.DBName, entry.DBUser, entry.DBPass)
+		}
+
+		return liferay.MysqlJDBC(entry.DBAddress, entry.DBPort, entry.DBName, entry.DBUser, entry.DBPass)
+	case "mariadb":
+		return liferay.MariaDBJDBC(entry.DBAddress, entry.DBPort, entry.DBName, entry.DBUser, entry.DBPass)
+	case "postgres":
+		return liferay.PostgreJDBC(entry.DBAddress, entry.DBPort, entry.DBName, entry.DBUser, entry.DBPass)
+	case "oracle":
+		return liferay.OracleJDBC(entry.DBAddress, entry.DBPort, entry.DBSID, entry.DBUser, entry.DBPass)
+	case "mssql":
+		return liferay.MSSQLJDBC(entry.DBAddress, entry.DBPort, entry.DBName, entry.DBUser, entry.DBPass)
+	}
+
+	return liferay.JDBC{}
+}
+
+// inspectLiferay asks the agent of the freshly imported database which
+// Liferay portal it belongs to. The inspection is best effort: if it fails,
+// the database is treated as if it wasn't a Liferay one.
+func inspectLiferay(dbe data.Row, requestID string) model.Liferay {
+	agent, ok := registry.Get(dbe.AgentName)
+	if !ok {
+		logger.Warn("Inspecting database %d failed: agent %q went offline", dbe.ID, dbe.AgentName)
+
+		return model.Liferay{}
+	}
+
+	lr, err := agent.WithRequestID(requestID).InspectDatabase(dbe.ID, dbe.DBName, dbe.DBUser, dbe.DBPass)
+	if err != nil {
+		logger.Warn("Inspecting database %d failed: %v", dbe.ID, err)
+
+		return model.Liferay{}
+	}
+
+	return lr
+}
+
+// portalExtMail returns the portal-ext part of the mail sent when the import
+// succeeded. If the portal of the database is known, only its properties are
+// listed.
+func portalExtMail(dbe data.Row) string {
+	block := func(title string, jdbc liferay.JDBC) string {
+		return fmt.Sprintf(`
+<h2>%s</h2>
+<pre>
+%s
+%s
+%s
+%s
+</pre>
+`, title, jdbc.Driver, jdbc.URL, jdbc.User, jdbc.Password)
+	}
+
+	if !dbe.Liferay.Known() {
+		return "<p>Below you can find the portal-exts, should you need them:</p>\n" +
+			block("<= 6.2 EE properties", portalExt(dbe, false)) +
+			block("DXP properties", portalExt(dbe, true))
+	}
+
+	title := "<= 6.2 EE properties"
+	if dbe.Liferay.DXP() {
+		title = "DXP properties"
+	}
+
+	return fmt.Sprintf("<p>It's a Liferay %s database (build %d). Below you can find its portal-ext, should you need it:</p>\n",
+		dbe.Liferay.Version(), dbe.Liferay.BuildNumber) +
+		block(title, portalExt(dbe, dbe.Liferay.DXP()))
+}
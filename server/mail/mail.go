@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/djavorszky/sutils"
+	"github.com/prometheus/client_golang/prometheus"
 	gomail "gopkg.in/gomail.v2"
 )
 
@@ -13,6 +14,13 @@ var (
 	dialer      gomail.Dialer
 )
 
+// Failures counts the emails that couldn't be sent. It is up to the caller
+// to register it.
+var Failures = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "ddn_server_email_failures_total",
+	Help: "Number of emails that couldn't be sent.",
+})
+
 // InitNoAuth iinitializes the email sending feature without any
 // user authentication
 func InitNoAuth(host string, port int, from string) error {
@@ -75,6 +83,7 @@ func Send(to, subj, body string) error {
 	m.SetBody("text/html", body)
 
 	if err := dialer.DialAndSend(m); err != nil {
+		Failures.Inc()
 		return fmt.Errorf("failed to send email: %s", err.Error())
 	}
 
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -16,7 +18,10 @@ import (
 	"github.com/djavorszky/ddn/common/logger"
 	"github.com/djavorszky/ddn/server/brwsr"
 	"github.com/djavorszky/ddn/server/database"
+	"github.com/djavorszky/ddn/server/database/data"
 	"github.com/djavorszky/ddn/server/database/mysql"
+	"github.com/djavorszky/ddn/server/database/postgres"
+	"github.com/djavorszky/ddn/server/database/secret"
 	"github.com/djavorszky/ddn/server/database/sqlite"
 	"github.com/djavorszky/ddn/server/mail"
 	"github.com/djavorszky/sutils"
@@ -44,37 +49,46 @@ func main() {
 		}
 	}()
 
-	c := make(chan os.Signal, 2)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGKILL)
-	go func() {
-		<-c
-		// Received kill
-		logger.Fatal("Received signal to terminate.")
-	}()
-
 	var err error
 	filename := flag.String("p", "server.conf", "Specify the configuration file's name")
 	logname := flag.String("l", "std", "Specify the log's filename. By default, logs to the terminal.")
+	logFormat := flag.String("log-format", "text", "Specify the format of the log: text or json.")
+	logMaxSize := flag.Int64("log-max-size", 100, "Rotate the log file once it's bigger than this many megabytes. 0 disables it.")
+	logDaily := flag.Bool("log-daily", true, "Rotate the log file every day.")
+	logBackups := flag.Int("log-backups", 10, "Keep this many rotated log files. 0 keeps all of them.")
+	logCompress := flag.Bool("log-compress", true, "Compress the rotated log files with gzip.")
+	backupFile := flag.String("backup", "", "Write a backup of the metadata to the given file and exit.")
+	restoreFile := flag.String("restore", "", "Replace the metadata with the backup in the given file and exit.")
 
 	flag.Parse()
 
-	if *logname != "std" {
-		if _, err = os.Stat(*logname); err == nil {
-			rotated := fmt.Sprintf("%s.%d", *logname, time.Now().Unix())
-
-			logger.Debug("Rotated logfile to %s", rotated)
+	switch *logFormat {
+	case "text":
+	case "json":
+		logger.Structured = true
+	default:
+		logger.Fatal("unknown log format %q, expected text or json", *logFormat)
+	}
 
-			os.Rename(*logname, rotated)
+	if *logname != "std" {
+		logOut := &logger.File{
+			Name:       *logname,
+			MaxSize:    *logMaxSize * 1024 * 1024,
+			Daily:      *logDaily,
+			MaxBackups: *logBackups,
+			Compress:   *logCompress,
 		}
 
-		logOut, err := os.OpenFile(*logname, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+		err = logOut.Open()
 		if err != nil {
 			fmt.Printf("error opening file %s, will continue logging to stderr: %s", *logname, err.Error())
-			logOut = os.Stderr
-		}
-		defer logOut.Close()
+		} else {
+			defer logOut.Close()
+
+			log.SetOutput(logOut)
 
-		log.SetOutput(logOut)
+			go logOut.ReopenOn(syscall.SIGHUP)
+		}
 	}
 
 	loadProperties(*filename)
@@ -85,6 +99,8 @@ func main() {
 
 	config.Print()
 
+	brwsr.Remote(config.Credentials)
+
 	if config.MountLoc != "" {
 		err = brwsr.Mount(config.MountLoc)
 		if err != nil {
@@ -105,6 +121,14 @@ func main() {
 			Pass:     config.DBPass,
 			Database: config.DBName,
 		}
+	case "postgres":
+		db = &postgres.DB{
+			Address:  config.DBAddress,
+			Port:     config.DBPort,
+			User:     config.DBUser,
+			Pass:     config.DBPass,
+			Database: config.DBName,
+		}
 	case "sqlite":
 		db = &sqlite.DB{DBLocation: config.DBAddress}
 	default:
@@ -119,6 +143,53 @@ func main() {
 
 	logger.Info("Database connection established")
 
+	if len(config.EncryptionKeys) != 0 {
+		keys, err := secret.NewKeyring(config.EncryptionKeys...)
+		if err != nil {
+			logger.Fatal("Invalid encryption keys: %v", err)
+		}
+
+		enc := database.Encrypted{BackendConnection: db, Keys: keys}
+
+		migrated, err := enc.Migrate()
+		if err != nil {
+			logger.Fatal("Failed encrypting passwords: %v", err)
+		}
+
+		if migrated != 0 {
+			logger.Info("Encrypted the passwords of %d databases with the current key", migrated)
+		}
+
+		db = enc
+	}
+
+	if *backupFile != "" {
+		err = writeBackup(*backupFile)
+		if err != nil {
+			logger.Fatal("Backup failed: %v", err)
+		}
+
+		logger.Info("Backup written to %s", *backupFile)
+		return
+	}
+
+	if *restoreFile != "" {
+		backup, err := readBackup(*restoreFile)
+		if err != nil {
+			logger.Fatal("Restore failed: %v", err)
+		}
+
+		err = restoreBackup(backup)
+		if err != nil {
+			logger.Fatal("Restore failed: %v", err)
+		}
+
+		writeAudit(data.AuditEntry{User: auditSystem, Action: auditRestore, Details: *restoreFile})
+
+		logger.Info("Restored %d databases from %s", len(backup.Databases), *restoreFile)
+		return
+	}
+
 	if config.SMTPAddr != "" {
 		if config.SMTPUser != "" {
 			err = mail.Init(config.SMTPAddr, config.SMTPPort, config.SMTPUser, config.SMTPPass, config.EmailSender)
@@ -142,22 +213,98 @@ func main() {
 		}
 	}
 
+	webhooks.Retries = config.WebhookRetries
+
+	recoverStuck()
+
 	// Start maintenance goroutine
 	go maintain()
 
 	// Start agent checker goroutine
 	go checkAgents()
 
+	if config.BackupDir != "" {
+		if config.BackupInterval <= 0 {
+			config.BackupInterval = defaultBackupInterval
+		}
+
+		go backupPeriodically()
+	}
+
+	if config.UploadMaxSize <= 0 {
+		config.UploadMaxSize = defaultUploadMaxSize
+	}
+
+	if config.UploadExpiry <= 0 {
+		config.UploadExpiry = defaultUploadExpiry
+	}
+
+	if config.UploadMaxPending <= 0 {
+		config.UploadMaxPending = defaultUploadMaxPending
+	}
+
+	if config.DumpURLExpiry <= 0 {
+		config.DumpURLExpiry = defaultDumpURLExpiry
+	}
+
+	if config.DumpSigningKey != "" {
+		signingKey = []byte(config.DumpSigningKey)
+	}
+
+	// Start goroutine removing the abandoned uploads
+	go expireUploadsPeriodically()
+
+	if config.ShutdownTimeout <= 0 {
+		config.ShutdownTimeout = defaultShutdownTimeout
+	}
+
+	// Cancelling the base context on shutdown ends the event streams, which
+	// would keep the server running otherwise.
+	base, cancel := context.WithCancel(context.Background())
+
+	server := &http.Server{
+		Addr:        fmt.Sprintf(":%s", config.ServerPort),
+		Handler:     Router(),
+		BaseContext: func(net.Listener) context.Context { return base },
+	}
+	server.RegisterOnShutdown(cancel)
+
+	stopped := make(chan struct{})
+
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+
+		go func() {
+			<-c
+			logger.Fatal("Received another signal, stopping without waiting.")
+		}()
+
+		logger.Info("Received signal to terminate, shutting down.")
+
+		shutdown(server, time.Duration(config.ShutdownTimeout)*time.Second)
+		close(stopped)
+	}()
+
 	logger.Info("Starting to listen on port %s", config.ServerPort)
 
-	port := fmt.Sprintf(":%s", config.ServerPort)
-	logger.Error("%v", http.ListenAndServe(port, Router()))
+	err = server.ListenAndServe()
+	if err != http.ErrServerClosed {
+		logger.Error("%v", err)
 
-	if len(config.AdminEmail) != 0 {
-		for _, addr := range config.AdminEmail {
-			mail.Send(addr, "[Cloud DB] Server went down", fmt.Sprintf(`<p>Cloud DB down for some reason.</p>`))
+		if len(config.AdminEmail) != 0 {
+			for _, addr := range config.AdminEmail {
+				mail.Send(addr, "[Cloud DB] Server went down", fmt.Sprintf(`<p>Cloud DB down for some reason.</p>`))
+			}
 		}
+
+		return
 	}
+
+	<-stopped
+
+	logger.Info("Server stopped.")
 }
 
 func loadProperties(filename string) {
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/djavorszky/ddn/common/logger"
+	"github.com/djavorszky/ddn/server/database/data"
+	"github.com/djavorszky/ddn/server/mail"
+	"github.com/djavorszky/ddn/server/registry"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	importDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ddn_server_import_duration_seconds",
+		Help:    "Time from accepting an import until the agent reported it finished, by vendor and result.",
+		Buckets: prometheus.ExponentialBuckets(10, 2, 12),
+	}, []string{"vendor", "result"})
+
+	pushFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ddn_server_push_failures_total",
+		Help: "Number of push notifications that couldn't be sent.",
+	})
+
+	agentsDesc = prometheus.NewDesc("ddn_server_agents",
+		"Number of registered agents by state.", []string{"state"}, nil)
+
+	databasesDesc = prometheus.NewDesc("ddn_server_databases",
+		"Number of databases by status code and vendor.", []string{"status", "vendor"}, nil)
+)
+
+func init() {
+	prometheus.MustRegister(importDuration, pushFailures, mail.Failures, serverCollector{})
+}
+
+// observeImport records the duration of the import that just finished.
+func observeImport(dbe data.Row) {
+	result := "success"
+	if dbe.IsErr() {
+		result = "failed"
+	}
+
+	importDuration.WithLabelValues(dbe.DBVendor, result).Observe(time.Since(dbe.CreateDate).Seconds())
+}
+
+// serverCollector reports the state of the agents and the databases at
+// the time of the scrape.
+type serverCollector struct{}
+
+func (serverCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- agentsDesc
+	ch <- databasesDesc
+}
+
+func (serverCollector) Collect(ch chan<- prometheus.Metric) {
+	var up, down, draining int
+	for _, agent := range registry.List() {
+		switch {
+		case !agent.Up:
+			down++
+		case agent.Draining:
+			draining++
+		default:
+			up++
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(agentsDesc, prometheus.GaugeValue, float64(up), "up")
+	ch <- prometheus.MustNewConstMetric(agentsDesc, prometheus.GaugeValue, float64(down), "down")
+	ch <- prometheus.MustNewConstMetric(agentsDesc, prometheus.GaugeValue, float64(draining), "draining")
+
+	counts, err := db.CountByStatus()
+	if err != nil {
+		logger.Error("Counting dbs for metrics failed: %v", err)
+
+		ch <- prometheus.NewInvalidMetric(databasesDesc, err)
+		return
+	}
+
+	for _, count := range counts {
+		ch <- prometheus.MustNewConstMetric(databasesDesc, prometheus.GaugeValue, float64(count.Count), strconv.Itoa(count.Status), count.Vendor)
+	}
+}
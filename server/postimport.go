@@ -0,0 +1,115 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/djavorszky/ddn/common/errs"
+	"github.com/djavorszky/ddn/common/inet"
+	"github.com/djavorszky/ddn/common/logger"
+	"github.com/djavorszky/ddn/common/model"
+)
+
+// Post-import script sets are folders in config.PostImportDir holding a
+// script for each vendor they support, e.g. reset-admin/mysql.sql and
+// reset-admin/postgres.sql. MariaDB agents run mysql.sql, unless the set
+// has a mariadb.sql as well.
+
+var scriptSetPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+var scriptVendors = []string{"mysql", "mariadb", "postgres", "oracle", "mssql"}
+
+// getScripts reads the scripts of the named sets for the vendor, in order.
+func getScripts(names []string, vendor string) ([]model.Script, errResult) {
+	scripts := make([]model.Script, 0, len(names))
+
+	for _, name := range names {
+		sql, err := readScript(name, strings.ToLower(vendor))
+		if os.IsNotExist(err) {
+			return nil, errResult{
+				httpStatus: http.StatusBadRequest,
+				errors:     []string{errs.ScriptSetNotFound, name},
+			}
+		}
+
+		if err != nil {
+			logger.Error("Reading post-import script %q failed: %v", name, err)
+
+			return nil, errResult{
+				httpStatus: http.StatusInternalServerError,
+				errors:     []string{errs.FileIOFailed, err.Error()},
+			}
+		}
+
+		scripts = append(scripts, model.Script{Name: name, SQL: sql})
+	}
+
+	return scripts, errResult{}
+}
+
+func readScript(name, vendor string) (string, error) {
+	if config.PostImportDir == "" || !scriptSetPattern.MatchString(name) {
+		return "", os.ErrNotExist
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(config.PostImportDir, name, vendor+".sql"))
+	if os.IsNotExist(err) && vendor == "mariadb" {
+		return readScript(name, "mysql")
+	}
+
+	return string(b), err
+}
+
+// listScriptSets returns the post-import script sets along with the vendors
+// they have scripts for.
+func listScriptSets() ([]model.ScriptSet, error) {
+	sets := []model.ScriptSet{}
+	if config.PostImportDir == "" {
+		return sets, nil
+	}
+
+	dirs, err := ioutil.ReadDir(config.PostImportDir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dir := range dirs {
+		if !dir.IsDir() || !scriptSetPattern.MatchString(dir.Name()) {
+			continue
+		}
+
+		set := model.ScriptSet{Name: dir.Name(), Vendors: []string{}}
+		for _, vendor := range scriptVendors {
+			if _, err := readScript(dir.Name(), vendor); err == nil {
+				set.Vendors = append(set.Vendors, vendor)
+			}
+		}
+
+		sets = append(sets, set)
+	}
+
+	return sets, nil
+}
+
+// getAPIScriptSets lists the post-import script sets imports can run.
+func getAPIScriptSets(w http.ResponseWriter, r *http.Request) {
+	_, err := getAPIUser(r)
+	if err != nil {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	sets, err := listScriptSets()
+	if err != nil {
+		inet.SendFailure(w, http.StatusInternalServerError, errs.FailedListingDirectory, err.Error())
+
+		logger.Error("Listing post-import scripts failed: %v", err)
+		return
+	}
+
+	inet.SendSuccess(w, http.StatusOK, sets)
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/djavorszky/ddn/common/status"
 	"github.com/djavorszky/ddn/server/mail"
 	"github.com/djavorszky/ddn/server/registry"
+	"github.com/djavorszky/ddn/server/webhook"
 )
 
 // maintain runs each day and checks the databases about when they will expire.
@@ -42,6 +43,9 @@ func maintain() {
 				agent.DropDatabase(registry.ID(), dbe.DBName, dbe.DBUser)
 				db.Delete(dbe)
 
+				fireEvent(webhook.DatabaseDropped, dbe)
+				audit(auditSystem, auditDrop, dbe, "expired")
+
 				mail.Send(dbe.Creator, fmt.Sprintf("[Cloud DB] Database %q dropped", dbe.DBName), fmt.Sprintf(`
 <h3>Database dropped</h3>
 				
@@ -69,6 +73,8 @@ func maintain() {
 <p>If you'd like to extend it, please visit <a href="http://cloud-db.liferay.int">Cloud DB</a>.</p>
 <p>Cheers</p>`, dbe.DBName))
 
+				fireEvent(webhook.DatabaseExpiring, dbe)
+
 				continue
 			}
 
@@ -94,6 +100,8 @@ func maintain() {
 				if err != nil {
 					logger.Error("failed notifying user: %v", err)
 				}
+
+				fireEvent(webhook.DatabaseExpiring, dbe)
 			}
 		}
 	}
@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 
+	"github.com/djavorszky/ddn/common/logger"
+	"github.com/djavorszky/ddn/server/mail"
 	webpush "github.com/sherclockholmes/webpush-go"
 )
 
@@ -22,9 +24,26 @@ func sendUserNotifications(subscriber string, message string) error {
 		})
 
 		if err != nil {
+			pushFailures.Inc()
 			return fmt.Errorf("push failed to user %v at endpoint %v", subscriber, subscription.Endpoint)
 		}
 	}
 
 	return nil
 }
+
+// notifyUsers sends an email and a push notification about the same
+// thing to each of the users.
+func notifyUsers(title, message string, users ...string) {
+	for _, user := range users {
+		mail.Send(user, "[Cloud DB] "+title, fmt.Sprintf(`<h3>%s</h3>
+
+<p>%s</p>
+<p>Visit <a href="http://cloud-db.liferay.int">Cloud DB</a>.</p>`, title, message))
+
+		err := sendUserNotifications(user, message)
+		if err != nil {
+			logger.Error("failed notifying user: %v", err)
+		}
+	}
+}
@@ -25,8 +25,8 @@ func Router() *mux.Router {
 			Handler(handler)
 	}
 
-	// Add static serving of files in dumps directory.
-	dumps := http.StripPrefix("/dumps/", http.FileServer(http.Dir(fmt.Sprintf("%s/web/dumps/", workdir))))
+	// Add serving of the staged dumps to the agents, with signed urls only.
+	dumps := http.StripPrefix("/dumps/", serveDumps(fmt.Sprintf("%s/web/dumps/", workdir)))
 	router.PathPrefix("/dumps/").Handler(dumps)
 
 	// Add static serving of images / css / js from res directory.
@@ -1,6 +1,10 @@
 package main
 
-import "net/http"
+import (
+	"net/http"
+
+	"github.com/djavorszky/ddn/common/srv"
+)
 
 type route struct {
 	Name        string
@@ -25,6 +29,12 @@ var routes = Routes{
 		"/unregister",
 		unregister,
 	},
+	route{
+		"drain",
+		http.MethodPost,
+		"/drain",
+		drain,
+	},
 	route{
 		"heartbeat",
 		http.MethodGet,
@@ -227,6 +237,12 @@ var routes = Routes{
 		"/api/agents/{agent:[a-zA-Z0-9-_]+}",
 		getAPIAgentByName,
 	},
+	route{
+		"api/agents/$agent-name/drain",
+		http.MethodPost,
+		"/api/agents/{agent:[a-zA-Z0-9-_]+}/drain",
+		drainAPIAgent,
+	},
 	route{
 		"api/databases",
 		http.MethodGet,
@@ -287,6 +303,48 @@ var routes = Routes{
 		"/api/databases/{id:[0-9]+}/visibility/{visibility:public|private}",
 		apiSetVisibility,
 	},
+	route{
+		"api/databases/visibility/team",
+		http.MethodPut,
+		"/api/databases/{id:[0-9]+}/visibility/{visibility:team}/{team:[0-9]+}",
+		apiSetVisibility,
+	},
+	route{
+		"api/databases/id/owner/email",
+		http.MethodPut,
+		"/api/databases/{id:[0-9]+}/owner/{email:[a-zA-Z0-9-_.@+]+}",
+		transferAPIDatabase,
+	},
+	route{
+		"api/databases/id/coowners/email",
+		http.MethodPut,
+		"/api/databases/{id:[0-9]+}/coowners/{email:[a-zA-Z0-9-_.@+]+}",
+		addAPICoOwner,
+	},
+	route{
+		"api/databases/id/coowners/email",
+		http.MethodDelete,
+		"/api/databases/{id:[0-9]+}/coowners/{email:[a-zA-Z0-9-_.@+]+}",
+		removeAPICoOwner,
+	},
+	route{
+		"api/databases/id/tags/tag",
+		http.MethodPut,
+		"/api/databases/{id:[0-9]+}/tags/{tag:[a-zA-Z0-9_.:-]+}",
+		addAPITag,
+	},
+	route{
+		"api/databases/id/tags/tag",
+		http.MethodDelete,
+		"/api/databases/{id:[0-9]+}/tags/{tag:[a-zA-Z0-9_.:-]+}",
+		removeAPITag,
+	},
+	route{
+		"api/databases/id/comment",
+		http.MethodPut,
+		"/api/databases/{id:[0-9]+}/comment",
+		apiSetComment,
+	},
 	route{
 		"api/databases/expiry",
 		http.MethodPut,
@@ -311,4 +369,142 @@ var routes = Routes{
 		"/api/loglevel/{level:[a-zA-Z]+}",
 		apiSetLogLevel,
 	},
+	route{
+		"api/webhooks",
+		http.MethodGet,
+		"/api/webhooks",
+		getAPIWebhooks,
+	},
+	route{
+		"api/webhooks",
+		http.MethodPost,
+		"/api/webhooks",
+		createAPIWebhook,
+	},
+	route{
+		"api/webhooks/id",
+		http.MethodGet,
+		"/api/webhooks/{id:[0-9]+}",
+		getAPIWebhookByID,
+	},
+	route{
+		"api/webhooks/id",
+		http.MethodDelete,
+		"/api/webhooks/{id:[0-9]+}",
+		deleteAPIWebhook,
+	},
+	route{
+		"api/webhooks/id/deliveries",
+		http.MethodGet,
+		"/api/webhooks/{id:[0-9]+}/deliveries",
+		getAPIWebhookDeliveries,
+	},
+	route{
+		"api/uploads",
+		http.MethodPost,
+		"/api/uploads",
+		createAPIUpload,
+	},
+	route{
+		"api/uploads/id",
+		http.MethodGet,
+		"/api/uploads/{id:[0-9a-f]+}",
+		getAPIUpload,
+	},
+	route{
+		"api/uploads/id",
+		http.MethodPatch,
+		"/api/uploads/{id:[0-9a-f]+}",
+		patchAPIUpload,
+	},
+	route{
+		"api/uploads/id",
+		http.MethodDelete,
+		"/api/uploads/{id:[0-9a-f]+}",
+		deleteAPIUpload,
+	},
+	route{
+		"api/anonymization-rules",
+		http.MethodGet,
+		"/api/anonymization-rules",
+		getAPIRuleSets,
+	},
+	route{
+		"api/post-import-scripts",
+		http.MethodGet,
+		"/api/post-import-scripts",
+		getAPIScriptSets,
+	},
+	route{
+		"api/events",
+		http.MethodGet,
+		"/api/events",
+		apiEvents,
+	},
+	route{
+		"api/admin/audit",
+		http.MethodGet,
+		"/api/admin/audit",
+		getAPIAuditLog,
+	},
+	route{
+		"api/admin/users",
+		http.MethodGet,
+		"/api/admin/users",
+		getAPIUsers,
+	},
+	route{
+		"api/admin/users/email/role",
+		http.MethodPut,
+		"/api/admin/users/{email:[a-zA-Z0-9-_.@+]+}/role/{role:[a-z-]+}",
+		setAPIUserRole,
+	},
+	route{
+		"api/admin/backup",
+		http.MethodGet,
+		"/api/admin/backup",
+		getAPIBackup,
+	},
+	route{
+		"api/admin/restore",
+		http.MethodPost,
+		"/api/admin/restore",
+		restoreAPIBackup,
+	},
+	route{
+		"api/teams",
+		http.MethodGet,
+		"/api/teams",
+		getAPITeams,
+	},
+	route{
+		"api/teams",
+		http.MethodPost,
+		"/api/teams",
+		createAPITeam,
+	},
+	route{
+		"api/teams/id",
+		http.MethodDelete,
+		"/api/teams/{id:[0-9]+}",
+		deleteAPITeam,
+	},
+	route{
+		"api/teams/id/members/email",
+		http.MethodPut,
+		"/api/teams/{id:[0-9]+}/members/{email:[a-zA-Z0-9-_.@+]+}",
+		addAPITeamMember,
+	},
+	route{
+		"api/teams/id/members/email",
+		http.MethodDelete,
+		"/api/teams/{id:[0-9]+}/members/{email:[a-zA-Z0-9-_.@+]+}",
+		removeAPITeamMember,
+	},
+	route{
+		"metrics",
+		http.MethodGet,
+		"/metrics",
+		srv.Metrics,
+	},
 }
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/djavorszky/ddn/common/logger"
+	"github.com/djavorszky/ddn/common/status"
+	"github.com/djavorszky/ddn/server/webhook"
+)
+
+// defaultShutdownTimeout is used if the shutdown-timeout is not set, in
+// seconds.
+const defaultShutdownTimeout = 120
+
+// inflight tracks the operations started by background, e.g. the imports,
+// so that the server can wait for them before stopping.
+var inflight struct {
+	sync.Mutex
+	running  int
+	stopping bool
+
+	// idle is closed once the running operations finished during shutdown.
+	idle chan struct{}
+}
+
+// background runs f in a new goroutine, which the server waits for when
+// shutting down. Operations started after the shutdown began are not
+// waited for.
+func background(f func()) {
+	inflight.Lock()
+	track := !inflight.stopping
+	if track {
+		inflight.running++
+	}
+	inflight.Unlock()
+
+	go func() {
+		if track {
+			defer func() {
+				inflight.Lock()
+				defer inflight.Unlock()
+
+				inflight.running--
+				if inflight.running == 0 && inflight.idle != nil {
+					close(inflight.idle)
+					inflight.idle = nil
+				}
+			}()
+		}
+
+		f()
+	}()
+}
+
+// shutdown stops the server from accepting new requests, then waits for
+// the running requests and the background operations to finish, for
+// timeout at most.
+func shutdown(server *http.Server, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := server.Shutdown(ctx)
+	if err != nil {
+		logger.Warn("Requests still running after %s: %v", timeout, err)
+	}
+
+	inflight.Lock()
+	inflight.stopping = true
+	running := inflight.running
+	if running == 0 {
+		inflight.Unlock()
+		return
+	}
+
+	inflight.idle = make(chan struct{})
+	idle := inflight.idle
+	inflight.Unlock()
+
+	logger.Info("Waiting for %d operations to finish.", running)
+
+	select {
+	case <-idle:
+		logger.Info("Operations finished.")
+	case <-ctx.Done():
+		inflight.Lock()
+		running = inflight.running
+		inflight.Unlock()
+
+		logger.Warn("%d operations still running after %s, they are marked failed on the next start.", running, timeout)
+	}
+}
+
+// recoverStuck marks the databases failed whose operation was running on
+// the server when it stopped, as nothing is going to finish them. The ones
+// that are being imported by the agents are left alone, as the agents keep
+// updating them.
+func recoverStuck() {
+	rows, err := db.FetchAll()
+	if err != nil {
+		logger.Error("Failed listing databases: %v", err)
+		return
+	}
+
+	for _, dbe := range rows {
+		switch dbe.Status {
+		case status.Started, status.CopyInProgress, status.Accepted:
+			dbe.Status = status.ImportFailed
+			dbe.Message = "Server error: the server stopped before the import was handed over to the agent."
+			dbe.ExpiryDate = time.Now().AddDate(0, 0, 2)
+		case status.DropInProgress:
+			dbe.Status = status.DropDatabaseFailed
+			dbe.Message = "Server error: the server stopped while dropping the database, please drop it again."
+		default:
+			continue
+		}
+
+		err = db.Update(&dbe)
+		if err != nil {
+			logger.Error("Failed updating stuck database %d: %v", dbe.ID, err)
+			continue
+		}
+
+		logger.Warn("Database %q (%d) was stuck, marked it as %q", dbe.DBName, dbe.ID, dbe.StatusLabel())
+
+		if dbe.Status == status.ImportFailed {
+			removeStaged(dbe.ID)
+			fireEvent(webhook.ImportFailed, dbe)
+		}
+	}
+}
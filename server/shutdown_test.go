@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/djavorszky/ddn/common/status"
+	"github.com/djavorszky/ddn/server/database/data"
+)
+
+func TestShutdownWaitsForOperations(t *testing.T) {
+	defer resetInflight()
+
+	release := make(chan struct{})
+	finished := make(chan struct{})
+
+	background(func() {
+		<-release
+		close(finished)
+	})
+
+	stopped := make(chan struct{})
+	go func() {
+		shutdown(&http.Server{}, time.Minute)
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		t.Fatalf("shutdown() returned while an operation was running")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("shutdown() didn't return after the operation finished")
+	}
+
+	select {
+	case <-finished:
+	default:
+		t.Errorf("shutdown() returned before the operation finished")
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	defer resetInflight()
+
+	release := make(chan struct{})
+	finished := make(chan struct{})
+
+	background(func() {
+		<-release
+		close(finished)
+	})
+
+	start := time.Now()
+	shutdown(&http.Server{}, 50*time.Millisecond)
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("shutdown() took %s, want it to give up after the timeout", elapsed)
+	}
+
+	close(release)
+	<-finished
+}
+
+func TestRecoverStuck(t *testing.T) {
+	tests := []struct {
+		status int
+		want   int
+	}{
+		{status.Started, status.ImportFailed},
+		{status.CopyInProgress, status.ImportFailed},
+		{status.Accepted, status.ImportFailed},
+		{status.DropInProgress, status.DropDatabaseFailed},
+		{status.ImportInProgress, status.ImportInProgress},
+		{status.Success, status.Success},
+	}
+
+	var rows []data.Row
+	for i, test := range tests {
+		row := data.Row{
+			DBName:     "stuck_" + string(rune('a'+i)),
+			DBUser:     "stuck",
+			DBPass:     "stuck",
+			AgentName:  testAgent,
+			Creator:    testUser,
+			CreateDate: time.Now(),
+			ExpiryDate: time.Now().AddDate(0, 1, 0),
+			Status:     test.status,
+		}
+
+		if err := db.Insert(&row); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+		defer db.Delete(row)
+
+		rows = append(rows, row)
+	}
+
+	recoverStuck()
+
+	for i, test := range tests {
+		got, err := db.FetchByID(rows[i].ID)
+		if err != nil {
+			t.Fatalf("FetchByID() error = %v", err)
+		}
+
+		if got.Status != test.want {
+			t.Errorf("status %d recovered to %d, want %d", test.status, got.Status, test.want)
+		}
+
+		if got.IsErr() && got.Message == "" {
+			t.Errorf("status %d recovered without a message", test.status)
+		}
+	}
+}
+
+func resetInflight() {
+	inflight.Lock()
+	inflight.stopping = false
+	inflight.idle = nil
+	inflight.Unlock()
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Dumps copied from the mounted folder or uploaded to the server are staged
+// in web/dumps/<database id>/ until the agent downloads them. They are only
+// served with urls signed with signingKey, which expire after
+// config.DumpURLExpiry hours.
+
+// defaultDumpURLExpiry is the number of hours the urls of the staged dumps
+// are valid for, if dump-url-expiry is not set.
+const defaultDumpURLExpiry = 24
+
+// signingKey is used to sign the urls of the staged dumps. It's random
+// unless dump-signing-key is set, so that the urls outlive restarts.
+var signingKey = newSigningKey()
+
+func newSigningKey() []byte {
+	key := make([]byte, 32)
+	rand.Read(key)
+
+	return key
+}
+
+// stageDir returns the folder the dump of the database is staged in.
+func stageDir(id int) string {
+	return filepath.Join(workdir, "web", "dumps", strconv.Itoa(id))
+}
+
+// stageFile creates the file to stage the dump called filename in for the
+// database.
+func stageFile(id int, filename string) (*os.File, error) {
+	err := os.MkdirAll(stageDir(id), os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.OpenFile(filepath.Join(stageDir(id), filename), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+}
+
+// removeStaged removes the dump staged for the database, if any.
+func removeStaged(id int) {
+	os.RemoveAll(stageDir(id))
+}
+
+// stagedURL returns the signed url the agent can download the dump staged
+// for the database from.
+func stagedURL(id int, filename string) string {
+	path := fmt.Sprintf("%d/%s", id, filename)
+	expires := time.Now().Add(time.Duration(config.DumpURLExpiry) * time.Hour).Unix()
+
+	return fmt.Sprintf("http://%s:%s/dumps/%s?expires=%d&signature=%s",
+		config.ServerHost, config.ServerPort, (&url.URL{Path: path}).EscapedPath(), expires, signDump(path, expires))
+}
+
+func signDump(path string, expires int64) string {
+	mac := hmac.New(sha256.New, signingKey)
+	fmt.Fprintf(mac, "%s\n%d", path, expires)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// serveDumps serves the staged dumps from dir if the url was signed by
+// stagedURL and has not expired yet. The path of the request has to be
+// relative to dir.
+func serveDumps(dir string) http.Handler {
+	files := http.FileServer(http.Dir(dir))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+		if err != nil || time.Now().Unix() > expires {
+			http.Error(w, "The link has expired.", http.StatusForbidden)
+			return
+		}
+
+		if !hmac.Equal([]byte(query.Get("signature")), []byte(signDump(r.URL.Path, expires))) {
+			http.Error(w, "The link is invalid.", http.StatusForbidden)
+			return
+		}
+
+		files.ServeHTTP(w, r)
+	})
+}
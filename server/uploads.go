@@ -0,0 +1,533 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/djavorszky/ddn/common/errs"
+	"github.com/djavorszky/ddn/common/inet"
+	"github.com/djavorszky/ddn/common/logger"
+	"github.com/djavorszky/ddn/common/model"
+	"github.com/djavorszky/ddn/common/srv"
+	"github.com/gorilla/mux"
+)
+
+// UploadOffsetHeader holds the offset a chunk of an upload starts at in
+// requests, and the number of bytes received so far in responses.
+const UploadOffsetHeader = "Upload-Offset"
+
+const (
+	// defaultUploadMaxSize is the largest upload accepted in megabytes,
+	// if upload-max-size is not set.
+	defaultUploadMaxSize = 10240
+
+	// defaultUploadExpiry is the number of hours after which the abandoned
+	// uploads are removed, if upload-expiry is not set.
+	defaultUploadExpiry = 24
+
+	// defaultUploadMaxPending is the number of uploads a user can have that
+	// are not imported yet, if upload-max-pending is not set.
+	defaultUploadMaxPending = 5
+)
+
+// uploadFilePattern matches the names of the files of the uploads in
+// web/dumps, which start with the id of the upload.
+var uploadFilePattern = regexp.MustCompile(`^[0-9a-f]{32}_`)
+
+// upload is an upload in progress or waiting to be imported. Its fields
+// are guarded by the lock of uploads.
+type upload struct {
+	model.Upload
+
+	// name is the name of the uploaded file, without the id.
+	name     string
+	creator  string
+	expected string
+	updated  time.Time
+
+	// busy is set while a chunk is being written.
+	busy bool
+	hash hash.Hash
+}
+
+var uploads = struct {
+	sync.Mutex
+	m map[string]*upload
+}{m: make(map[string]*upload)}
+
+func (u *upload) file() string {
+	return filepath.Join(workdir, "web", "dumps", u.Filename)
+}
+
+// getUpload returns the upload of user with the given id.
+func getUpload(id, user string) (*upload, bool) {
+	uploads.Lock()
+	defer uploads.Unlock()
+
+	u, ok := uploads.m[id]
+	if !ok || u.creator != user {
+		return nil, false
+	}
+
+	return u, true
+}
+
+// claimUpload removes the completed upload of user from the registry, so
+// that it can be imported. It can be put back with releaseUpload if the
+// import could not be started.
+func claimUpload(id, user string) (*upload, errResult) {
+	uploads.Lock()
+	defer uploads.Unlock()
+
+	u, ok := uploads.m[id]
+	if !ok || u.creator != user {
+		return nil, errResult{
+			httpStatus: http.StatusNotFound,
+			errors:     []string{errs.UploadNotFound, id},
+		}
+	}
+
+	if u.busy || u.SHA256 == "" {
+		return nil, errResult{
+			httpStatus: http.StatusConflict,
+			errors:     []string{errs.UploadIncomplete, id},
+		}
+	}
+
+	delete(uploads.m, id)
+
+	return u, errResult{}
+}
+
+// reserveUpload adds the new upload to the registry, unless its creator
+// already has config.UploadMaxPending uploads that are not imported yet.
+func reserveUpload(u *upload) bool {
+	uploads.Lock()
+	defer uploads.Unlock()
+
+	pending := 0
+	for _, other := range uploads.m {
+		if other.creator == u.creator {
+			pending++
+		}
+	}
+
+	if pending >= config.UploadMaxPending {
+		return false
+	}
+
+	uploads.m[u.ID] = u
+
+	return true
+}
+
+func releaseUpload(u *upload) {
+	uploads.Lock()
+	defer uploads.Unlock()
+
+	u.updated = time.Now()
+	uploads.m[u.ID] = u
+}
+
+// stageUpload moves the file of the claimed upload to be served to the agent
+// importing it into the database, and returns its url.
+func stageUpload(u *upload, id int) (string, error) {
+	err := os.MkdirAll(stageDir(id), os.ModePerm)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.Rename(u.file(), filepath.Join(stageDir(id), u.name))
+	if err != nil {
+		return "", err
+	}
+
+	return stagedURL(id, u.name), nil
+}
+
+func removeUpload(u *upload) {
+	uploads.Lock()
+	delete(uploads.m, u.ID)
+	uploads.Unlock()
+
+	os.Remove(u.file())
+}
+
+// expireUploads removes the uploads that were not written to or imported
+// for config.UploadExpiry hours, along with the files in web/dumps left
+// behind by uploads that are no longer known, e.g. because the server was
+// restarted.
+func expireUploads() {
+	expiry := time.Duration(config.UploadExpiry) * time.Hour
+	known := make(map[string]bool)
+
+	uploads.Lock()
+	for id, u := range uploads.m {
+		if !u.busy && time.Since(u.updated) > expiry {
+			delete(uploads.m, id)
+			os.Remove(u.file())
+
+			logger.Info("Removed abandoned upload %s of %s", id, u.creator)
+			continue
+		}
+
+		known[u.Filename] = true
+	}
+	uploads.Unlock()
+
+	files, err := ioutil.ReadDir(filepath.Join(workdir, "web", "dumps"))
+	if err != nil {
+		logger.Error("Failed listing uploaded files: %v", err)
+		return
+	}
+
+	for _, fi := range files {
+		if !uploadFilePattern.MatchString(fi.Name()) || known[fi.Name()] || time.Since(fi.ModTime()) <= expiry {
+			continue
+		}
+
+		err = os.Remove(filepath.Join(workdir, "web", "dumps", fi.Name()))
+		if err != nil {
+			logger.Error("Failed removing uploaded file %s: %v", fi.Name(), err)
+			continue
+		}
+
+		logger.Info("Removed leftover uploaded file %s", fi.Name())
+	}
+}
+
+// expireUploadsPeriodically removes the abandoned uploads every hour.
+func expireUploadsPeriodically() {
+	ticker := time.NewTicker(time.Hour)
+
+	for {
+		expireUploads()
+
+		<-ticker.C
+	}
+}
+
+// uploadFilename strips the folders and the characters that are not safe in
+// urls from the name of the uploaded file.
+func uploadFilename(name string) string {
+	name = path.Base(strings.Replace(name, "\\", "/", -1))
+
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+
+		return '_'
+	}, name)
+}
+
+func newUploadID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+func createAPIUpload(w http.ResponseWriter, r *http.Request) {
+	user, err := getAPIUser(r)
+	if err != nil || !canWrite(user) {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	var req model.Upload
+
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		inet.SendFailure(w, http.StatusBadRequest, errs.JSONDecodeFailed, err.Error())
+		return
+	}
+
+	filename := uploadFilename(req.Filename)
+	if filename == "" || filename == "." || filename == "_" {
+		inet.SendFailure(w, http.StatusBadRequest, errs.MissingParameters, "filename")
+		return
+	}
+
+	if req.Size <= 0 {
+		inet.SendFailure(w, http.StatusBadRequest, errs.MissingParameters, "size")
+		return
+	}
+
+	maxSize := int64(config.UploadMaxSize) * 1024 * 1024
+	if req.Size > maxSize {
+		inet.SendFailure(w, http.StatusRequestEntityTooLarge, errs.UploadTooLarge, strconv.FormatInt(maxSize, 10))
+		return
+	}
+
+	if req.SHA256 != "" && !sha256Pattern.MatchString(req.SHA256) {
+		inet.SendFailure(w, http.StatusBadRequest, errs.InvalidChecksum, req.SHA256)
+		return
+	}
+
+	id := newUploadID()
+	u := &upload{
+		Upload: model.Upload{
+			ID:       id,
+			Filename: id + "_" + filename,
+			Size:     req.Size,
+		},
+		name:     filename,
+		creator:  user,
+		expected: strings.ToLower(req.SHA256),
+		updated:  time.Now(),
+		hash:     sha256.New(),
+	}
+
+	// The upload is reserved busy, so that no chunk is written to it before
+	// its file is created.
+	u.busy = true
+	if !reserveUpload(u) {
+		inet.SendFailure(w, http.StatusTooManyRequests, errs.TooManyUploads, strconv.Itoa(config.UploadMaxPending))
+		return
+	}
+
+	f, err := os.OpenFile(u.file(), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		uploads.Lock()
+		delete(uploads.m, id)
+		uploads.Unlock()
+
+		inet.SendFailure(w, http.StatusInternalServerError, errs.FileIOFailed, err.Error())
+
+		srv.Log(r).Error("failed creating upload file: %v", err)
+		return
+	}
+	f.Close()
+
+	uploads.Lock()
+	u.busy = false
+	uploads.Unlock()
+
+	srv.Log(r).Info("%s started uploading %s (%d bytes) as %s", user, filename, req.Size, id)
+
+	inet.SendSuccess(w, http.StatusCreated, u.Upload)
+}
+
+func getAPIUpload(w http.ResponseWriter, r *http.Request) {
+	user, err := getAPIUser(r)
+	if err != nil {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	u, ok := getUpload(id, user)
+	if !ok {
+		inet.SendFailure(w, http.StatusNotFound, errs.UploadNotFound, id)
+		return
+	}
+
+	uploads.Lock()
+	res := u.Upload
+	uploads.Unlock()
+
+	w.Header().Set(UploadOffsetHeader, strconv.FormatInt(res.Offset, 10))
+	inet.SendSuccess(w, http.StatusOK, res)
+}
+
+// patchAPIUpload appends the body of the request to the upload. The
+// Upload-Offset header of the request has to match the number of bytes
+// received so far, which is returned by getAPIUpload if a chunk failed.
+func patchAPIUpload(w http.ResponseWriter, r *http.Request) {
+	user, err := getAPIUser(r)
+	if err != nil {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	u, ok := getUpload(id, user)
+	if !ok {
+		inet.SendFailure(w, http.StatusNotFound, errs.UploadNotFound, id)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get(UploadOffsetHeader), 10, 64)
+	if err != nil {
+		inet.SendFailure(w, http.StatusBadRequest, errs.MissingParameters, UploadOffsetHeader)
+		return
+	}
+
+	uploads.Lock()
+	if u.busy || offset != u.Offset {
+		current := u.Offset
+		uploads.Unlock()
+
+		w.Header().Set(UploadOffsetHeader, strconv.FormatInt(current, 10))
+		inet.SendFailure(w, http.StatusConflict, errs.UploadOffsetMismatch, strconv.FormatInt(current, 10))
+		return
+	}
+	remaining := u.Size - u.Offset
+	u.busy = true
+	uploads.Unlock()
+
+	defer func() {
+		uploads.Lock()
+		u.busy = false
+		u.updated = time.Now()
+		uploads.Unlock()
+	}()
+
+	if r.ContentLength > remaining {
+		inet.SendFailure(w, http.StatusRequestEntityTooLarge, errs.UploadTooLarge, strconv.FormatInt(remaining, 10))
+		return
+	}
+
+	f, err := os.OpenFile(u.file(), os.O_WRONLY, 0644)
+	if err != nil {
+		inet.SendFailure(w, http.StatusInternalServerError, errs.FileIOFailed, err.Error())
+
+		srv.Log(r).Error("failed opening upload file: %v", err)
+		return
+	}
+	defer f.Close()
+
+	_, err = f.Seek(offset, io.SeekStart)
+	if err != nil {
+		inet.SendFailure(w, http.StatusInternalServerError, errs.FileIOFailed, err.Error())
+
+		srv.Log(r).Error("failed seeking in upload file: %v", err)
+		return
+	}
+
+	// The hash is saved so that a chunk that turns out to be too long can be
+	// taken back.
+	uploads.Lock()
+	state, err := u.hash.(encoding.BinaryMarshaler).MarshalBinary()
+	uploads.Unlock()
+	if err != nil {
+		inet.SendFailure(w, http.StatusInternalServerError, errs.FileIOFailed, err.Error())
+
+		srv.Log(r).Error("failed saving the checksum of upload %s: %v", id, err)
+		return
+	}
+
+	// Bodies without a Content-Length could still be longer than the upload,
+	// which is only noticed by reading past its end.
+	written, err := io.Copy(chunkWriter{f, u}, io.LimitReader(r.Body, remaining+1))
+	if err != nil {
+		inet.SendFailure(w, http.StatusInternalServerError, errs.FileIOFailed, err.Error())
+
+		srv.Log(r).Warn("failed receiving chunk of upload %s: %v", id, err)
+		return
+	}
+
+	if written > remaining {
+		err = rollbackChunk(f, u, offset, state)
+		if err != nil {
+			srv.Log(r).Error("failed taking back the chunk of upload %s: %v", id, err)
+		}
+
+		w.Header().Set(UploadOffsetHeader, strconv.FormatInt(offset, 10))
+		inet.SendFailure(w, http.StatusRequestEntityTooLarge, errs.UploadTooLarge, strconv.FormatInt(remaining, 10))
+		return
+	}
+
+	uploads.Lock()
+	res := u.Upload
+	uploads.Unlock()
+
+	w.Header().Set(UploadOffsetHeader, strconv.FormatInt(res.Offset, 10))
+
+	if res.Offset == res.Size {
+		uploads.Lock()
+		u.SHA256 = hex.EncodeToString(u.hash.Sum(nil))
+		res = u.Upload
+		uploads.Unlock()
+
+		if u.expected != "" && u.expected != res.SHA256 {
+			removeUpload(u)
+
+			inet.SendFailure(w, http.StatusBadRequest, errs.InvalidChecksum, res.SHA256)
+			return
+		}
+
+		srv.Log(r).Info("%s finished uploading %s", user, id)
+	}
+
+	inet.SendSuccess(w, http.StatusOK, res)
+}
+
+func deleteAPIUpload(w http.ResponseWriter, r *http.Request) {
+	user, err := getAPIUser(r)
+	if err != nil {
+		inet.SendFailure(w, http.StatusForbidden, errs.AccessDenied)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	u, ok := getUpload(id, user)
+	if !ok {
+		inet.SendFailure(w, http.StatusNotFound, errs.UploadNotFound, id)
+		return
+	}
+
+	removeUpload(u)
+
+	inet.SendSuccess(w, http.StatusOK, "Delete successful")
+}
+
+// rollbackChunk takes back the chunk written to the upload from offset on,
+// restoring its checksum to state.
+func rollbackChunk(f *os.File, u *upload, offset int64, state []byte) error {
+	uploads.Lock()
+	defer uploads.Unlock()
+
+	u.Offset = offset
+
+	err := u.hash.(encoding.BinaryUnmarshaler).UnmarshalBinary(state)
+	if err != nil {
+		return fmt.Errorf("failed restoring checksum: %v", err)
+	}
+
+	return f.Truncate(offset)
+}
+
+// chunkWriter writes to the file of the upload and advances its offset and
+// checksum by what was written, so that they stay right even if the client
+// goes away in the middle of a chunk.
+type chunkWriter struct {
+	f *os.File
+	u *upload
+}
+
+func (c chunkWriter) Write(p []byte) (int, error) {
+	n, err := c.f.Write(p)
+
+	uploads.Lock()
+	c.u.hash.Write(p[:n])
+	c.u.Offset += int64(n)
+	uploads.Unlock()
+
+	if err != nil {
+		return n, fmt.Errorf("failed writing upload file: %v", err)
+	}
+
+	return n, nil
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/djavorszky/ddn/common/logger"
 	"github.com/djavorszky/ddn/common/model"
+	"github.com/djavorszky/ddn/common/storage"
 	"github.com/djavorszky/ddn/server/brwsr"
 	"github.com/djavorszky/ddn/server/database/data"
 	"github.com/djavorszky/ddn/server/registry"
@@ -34,6 +35,7 @@ type Page struct {
 	HasPublicDBs           bool
 	Ext62                  liferay.JDBC
 	ExtDXP                 liferay.JDBC
+	Liferay                model.Liferay
 	FileList               brwsr.FileList
 	HasMountedFolder       bool
 	WebPushEnabled         bool
@@ -103,23 +105,9 @@ func loadPage(w http.ResponseWriter, r *http.Request, pages ...string) {
 				logger.Error("database query: %v", err)
 				session.AddFlash("Failed querying database", "fail")
 			} else {
-				switch entry.DBVendor {
-				case "mysql":
-					page.Ext62 = liferay.MysqlJDBC(entry.DBAddress, entry.DBPort, entry.DBName, entry.DBUser, entry.DBPass)
-					page.ExtDXP = liferay.MysqlJDBCDXP(entry.DBAddress, entry.DBPort, entry.DBName, entry.DBUser, entry.DBPass)
-				case "mariadb":
-					page.Ext62 = liferay.MariaDBJDBC(entry.DBAddress, entry.DBPort, entry.DBName, entry.DBUser, entry.DBPass)
-					page.ExtDXP = page.Ext62
-				case "postgres":
-					page.Ext62 = liferay.PostgreJDBC(entry.DBAddress, entry.DBPort, entry.DBName, entry.DBUser, entry.DBPass)
-					page.ExtDXP = page.Ext62
-				case "oracle":
-					page.Ext62 = liferay.OracleJDBC(entry.DBAddress, entry.DBPort, entry.DBSID, entry.DBUser, entry.DBPass)
-					page.ExtDXP = page.Ext62
-				case "mssql":
-					page.Ext62 = liferay.MSSQLJDBC(entry.DBAddress, entry.DBPort, entry.DBName, entry.DBUser, entry.DBPass)
-					page.ExtDXP = page.Ext62
-				}
+				page.Ext62 = portalExt(entry, false)
+				page.ExtDXP = portalExt(entry, true)
+				page.Liferay = entry.Liferay
 			}
 		}
 	} else if flashes := session.Flashes("fail"); len(flashes) > 0 {
@@ -144,15 +132,21 @@ func loadPage(w http.ResponseWriter, r *http.Request, pages ...string) {
 	*/
 	session.Save(r, w)
 
-	if pages[0] == "browse" && page.HasMountedFolder {
+	if pages[0] == "browse" {
 		loc := mux.Vars(r)["loc"]
-
-		files, err := brwsr.List(loc)
-		if err != nil {
-			session.AddFlash("Failed listing folder", "fail")
+		if remote := r.URL.Query().Get("loc"); storage.Supported(remote) {
+			loc = remote
 		}
 
-		page.FileList = files
+		if page.HasMountedFolder || storage.Supported(loc) {
+			files, err := brwsr.List(loc)
+			if err != nil {
+				logger.Error("failed listing folder: %v", err)
+				session.AddFlash("Failed listing folder", "fail")
+			}
+
+			page.FileList = files
+		}
 	}
 
 	if pages[0] == "srvimport" {
@@ -179,6 +173,13 @@ func loadPage(w http.ResponseWriter, r *http.Request, pages ...string) {
 			logger.Error("couldn't list databases: %v", err)
 		}
 
+		teamDBs, err := fetchTeamDatabases(page.User)
+		if err != nil {
+			logger.Error("couldn't list team databases: %v", err)
+		}
+
+		publicDBs = append(publicDBs, teamDBs...)
+
 		if len(publicDBs) != 0 {
 			page.PublicDatabases = publicDBs
 			page.HasPublicDBs = true
@@ -0,0 +1,42 @@
+// Keeps the list of databases up to date by listening on the event stream
+// of the server. Progress of running imports is updated in place, anything
+// else reloads the page.
+$(document).ready(function() {
+    if (!window.EventSource || $("#databases").length == 0) {
+        return
+    }
+
+    var reloadTimer
+
+    function reload() {
+        clearTimeout(reloadTimer)
+        reloadTimer = setTimeout(function() {
+            location.reload()
+        }, 1000)
+    }
+
+    var source = new EventSource("/api/events")
+
+    source.addEventListener("status.changed", function(e) {
+        var event = JSON.parse(e.data)
+        var row = $('tr[data-id="' + event.database.id + '"]')
+
+        if (row.length == 0) {
+            return
+        }
+
+        var bar = row.find(".progress-bar")
+
+        if (bar.length == 0 || event.database.status > 99) {
+            reload()
+            return
+        }
+
+        row.find("td.status").text(event.statusLabel)
+        bar.attr("aria-valuenow", event.progress).css("width", event.progress + "%")
+    })
+
+    $.each(["database.created", "database.dropped"], function(i, type) {
+        source.addEventListener(type, reload)
+    })
+})
@@ -0,0 +1,190 @@
+// Package webhook delivers signed notifications about the lifecycle
+// of databases to user-registered URLs.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/djavorszky/ddn/server/database/data"
+)
+
+// Events that webhooks can subscribe to.
+const (
+	DatabaseCreated  = "database.created"
+	ImportStarted    = "import.started"
+	ImportSucceeded  = "import.succeeded"
+	ImportFailed     = "import.failed"
+	DatabaseExpiring = "database.expiring"
+	DatabaseDropped  = "database.dropped"
+)
+
+// Events lists all events that can be subscribed to.
+var Events = []string{DatabaseCreated, ImportStarted, ImportSucceeded, ImportFailed, DatabaseExpiring, DatabaseDropped}
+
+// Headers sent along with every delivery.
+const (
+	EventHeader     = "X-DDN-Event"
+	DeliveryHeader  = "X-DDN-Delivery"
+	SignatureHeader = "X-DDN-Signature"
+)
+
+// Defaults used when the corresponding Sender field is not set.
+const (
+	DefaultTimeout = 10 * time.Second
+	DefaultBackoff = 10 * time.Second
+)
+
+// ValidEvent returns true if event is one of Events.
+func ValidEvent(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Payload is the JSON body of a delivery.
+type Payload struct {
+	Event     string    `json:"event"`
+	Timestamp time.Time `json:"timestamp"`
+	Database  data.Row  `json:"database"`
+}
+
+// NewPayload returns the payload of event about row. The password
+// of the database is left out, it can be fetched via the API.
+func NewPayload(event string, row data.Row) Payload {
+	row.DBPass = ""
+
+	return Payload{Event: event, Timestamp: time.Now(), Database: row}
+}
+
+// Sign returns the value of the signature header for body signed with secret,
+// which is the hex encoded HMAC-SHA256 of the body, prefixed with "sha256=".
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sender delivers payloads to webhooks. The zero value uses DefaultTimeout
+// and DefaultBackoff, and doesn't retry failed deliveries.
+type Sender struct {
+	// Client is used to send the requests. If nil, a client with
+	// DefaultTimeout is used.
+	Client *http.Client
+
+	// Retries is the number of times a failed delivery is retried.
+	Retries int
+
+	// Backoff is the time to wait before the first retry. It is doubled
+	// after every further attempt. Defaults to DefaultBackoff.
+	Backoff time.Duration
+
+	// Log, if not nil, is called after every attempt.
+	Log func(data.WebhookDelivery)
+}
+
+// Send delivers the payload to the webhook, retrying with an exponential
+// backoff until it succeeds or runs out of retries. A delivery succeeds if
+// the webhook responds with a 2xx status code. Send blocks until the
+// delivery is finished, so it should usually be called in a goroutine.
+func (s Sender) Send(hook data.Webhook, p Payload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("encoding payload failed: %v", err)
+	}
+
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: DefaultTimeout}
+	}
+
+	backoff := s.Backoff
+	if backoff == 0 {
+		backoff = DefaultBackoff
+	}
+
+	delivery := data.WebhookDelivery{
+		WebhookID:  hook.ID,
+		DeliveryID: randomHex(16),
+		Event:      p.Event,
+		DatabaseID: p.Database.ID,
+	}
+
+	for attempt := 1; ; attempt++ {
+		delivery.Attempt = attempt
+		delivery.Date = time.Now()
+		delivery.StatusCode, err = post(client, hook, delivery.DeliveryID, p.Event, body)
+		delivery.Success = err == nil
+
+		delivery.Error = ""
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+
+		if s.Log != nil {
+			s.Log(delivery)
+		}
+
+		if err == nil || attempt > s.Retries {
+			return err
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func post(client *http.Client, hook data.Webhook, deliveryID, event string, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("creating request failed: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(DeliveryHeader, deliveryID)
+	if hook.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(hook.Secret, body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Drain the body so the connection can be reused.
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// NewSecret returns a random secret that can be used to sign the payloads.
+func NewSecret() string {
+	return randomHex(32)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
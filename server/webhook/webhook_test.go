@@ -0,0 +1,98 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/djavorszky/ddn/server/database/data"
+)
+
+func TestSign(t *testing.T) {
+	// echo -n '{"event":"import.succeeded"}' | openssl dgst -sha256 -hmac secret
+	want := "sha256=a45f9cb0ae2b39c39fd323e31a8fa3c14b1aad26d34f7d98fb3f53fc56f9df7e"
+
+	if got := Sign("secret", []byte(`{"event":"import.succeeded"}`)); got != want {
+		t.Errorf("Sign() = %v, want %v", got, want)
+	}
+}
+
+func TestSender_Send(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int
+		retries      int
+		wantErr      bool
+		wantAttempts int
+	}{
+		{"firstTry", 0, 3, false, 1},
+		{"afterRetries", 2, 3, false, 3},
+		{"outOfRetries", 5, 2, true, 3},
+		{"noRetries", 1, 0, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+
+				body, _ := ioutil.ReadAll(r.Body)
+				if r.Header.Get(SignatureHeader) != Sign("secret", body) {
+					t.Errorf("signature mismatch: %q", r.Header.Get(SignatureHeader))
+				}
+
+				if r.Header.Get(EventHeader) != ImportSucceeded {
+					t.Errorf("event header = %q, want %q", r.Header.Get(EventHeader), ImportSucceeded)
+				}
+
+				var p Payload
+				if err := json.Unmarshal(body, &p); err != nil || p.Database.ID != 42 || p.Database.DBPass != "" {
+					t.Errorf("unexpected payload: %s", body)
+				}
+
+				if calls <= tt.failures {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+			}))
+			defer ts.Close()
+
+			var (
+				mu       sync.Mutex
+				attempts []data.WebhookDelivery
+			)
+
+			s := Sender{
+				Retries: tt.retries,
+				Backoff: time.Millisecond,
+				Log: func(d data.WebhookDelivery) {
+					mu.Lock()
+					attempts = append(attempts, d)
+					mu.Unlock()
+				},
+			}
+
+			hook := data.Webhook{ID: 1, URL: ts.URL, Secret: "secret"}
+
+			err := s.Send(hook, NewPayload(ImportSucceeded, data.Row{ID: 42, DBPass: "password"}))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if len(attempts) != tt.wantAttempts {
+				t.Errorf("Send() made %d attempts, want %d", len(attempts), tt.wantAttempts)
+				return
+			}
+
+			last := attempts[len(attempts)-1]
+			if last.Success == tt.wantErr || last.Attempt != tt.wantAttempts || last.DeliveryID != attempts[0].DeliveryID {
+				t.Errorf("unexpected last attempt: %+v", last)
+			}
+		})
+	}
+}
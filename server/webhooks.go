@@ -0,0 +1,56 @@
+package main
+
+import (
+	"github.com/djavorszky/ddn/common/logger"
+	"github.com/djavorszky/ddn/server/database/data"
+	"github.com/djavorszky/ddn/server/webhook"
+)
+
+// deliveryLogLimit is the maximum number of delivery attempts returned
+// by the API for a single webhook.
+const deliveryLogLimit = 100
+
+var webhooks = webhook.Sender{Log: logDelivery}
+
+// fireEvent notifies the webhooks of the creator of the database, as well as
+// the global ones, about the event, and publishes it on the event stream.
+// The deliveries happen in the background.
+func fireEvent(event string, dbe data.Row) {
+	publishEvent(event, dbe)
+
+	go func() {
+		owned, err := db.FetchWebhooksByOwner(dbe.Creator)
+		if err != nil {
+			logger.Error("failed fetching webhooks of %q: %v", dbe.Creator, err)
+		}
+
+		global, err := db.FetchGlobalWebhooks()
+		if err != nil {
+			logger.Error("failed fetching global webhooks: %v", err)
+		}
+
+		payload := webhook.NewPayload(event, dbe)
+		sent := make(map[int]bool)
+
+		for _, hook := range append(owned, global...) {
+			if sent[hook.ID] || !hook.Wants(event) {
+				continue
+			}
+			sent[hook.ID] = true
+
+			go func(hook data.Webhook) {
+				err := webhooks.Send(hook, payload)
+				if err != nil {
+					logger.Warn("delivering %q of database %d to webhook %d failed: %v", event, dbe.ID, hook.ID, err)
+				}
+			}(hook)
+		}
+	}()
+}
+
+func logDelivery(delivery data.WebhookDelivery) {
+	err := db.InsertWebhookDelivery(&delivery)
+	if err != nil {
+		logger.Error("failed logging webhook delivery: %v", err)
+	}
+}